@@ -18,9 +18,78 @@
 #include "bpf/bpf_tracing.h"
 
 #define PRINT_SKB_STR_SIZE    2048
+#define MAX_CAPTURE_LEN       2048
+/* The linear data and the page fragments are copied into a buffer of twice
+ * this size, which has to fit in a per-CPU map value (32KB at most). */
+#define MAX_FULL_CAPTURE_LEN  16000
+#define MAX_CAPTURE_FRAGS     8
+#define X86_PAGE_SHIFT        12
+
+#define EVENT_TYPE_ENTRY      0
+#define EVENT_TYPE_RETURN     1
+#define EVENT_TYPE_XDP        2
+#define EVENT_TYPE_TC         3
+#define EVENT_TYPE_TRACEPOINT 4
 
 #define ETH_P_IP              0x800
 #define ETH_P_IPV6            0x86dd
+#define VLAN_VID_MASK         0x0fff
+#define ETH_ALEN              6
+#define TASK_COMM_LEN         16
+#define IFNAMSIZ              16
+#define IPPROTO_ICMPV6        58
+#define IPPROTO_HOPOPTS       0
+#define IPPROTO_ROUTING       43
+#define IPPROTO_FRAGMENT      44
+#define IPPROTO_DSTOPTS       60
+#define IP6_OFFSET            0xfff8
+#define IPV6_MAX_EXTHDRS      8
+
+/* Bits of the extension headers in tuple.ipv6_exthdrs */
+#define IPV6_EXTHDR_HOPOPTS   (1 << 0)
+#define IPV6_EXTHDR_ROUTING   (1 << 1)
+#define IPV6_EXTHDR_FRAGMENT  (1 << 2)
+#define IPV6_EXTHDR_DSTOPTS   (1 << 3)
+
+#define ETH_P_TEB             0x6558
+#define ETH_P_8021Q           0x8100
+#define ETH_P_8021AD          0x88a8
+#define ETH_P_MPLS_UC         0x8847
+#define ETH_P_MPLS_MC         0x8848
+#define MPLS_LS_LABEL_SHIFT   12
+#define MPLS_LS_S_MASK        0x100
+#define MAX_MPLS_LABELS       4
+#define ETH_HLEN              14
+#define VXLAN_PORT            4789
+#define GENEVE_PORT           6081
+#define GRE_CSUM              0x8000
+#define GRE_KEY               0x2000
+#define GRE_SEQ               0x1000
+#define GRE_VERSION           0x0007
+
+/* Encapsulations of tunnel_info.type */
+#define TUNNEL_VXLAN          1
+#define TUNNEL_GENEVE         2
+#define TUNNEL_GRE            3
+#define TUNNEL_NVGRE          4
+
+#define CHECKSUM_PARTIAL      3
+#define NFCT_INFOMASK         7
+#define CT_NONE               0xff
+#define SKB_DST_PTRMASK       ~1UL
+#define AF_INET               2
+#define AF_INET6              10
+
+#define FILTER_ICMP           (1 << 0)
+#define FILTER_ICMPV6         (1 << 1)
+
+#if __BYTE_ORDER__ == __ORDER_LITTLE_ENDIAN__
+#define bpf_ntohs(x)          __builtin_bswap16(x)
+#define bpf_ntohl(x)          __builtin_bswap32(x)
+#else
+#define bpf_ntohs(x)          (x)
+#define bpf_ntohl(x)          (x)
+#endif
 
 union addr {
 	u32 v4addr;
@@ -37,7 +106,36 @@ struct skb_meta {
 	u32 len;
 	u32 mtu;
 	u16 protocol;
-	u16 pad;
+	u8 vlan_present;
+	u8 pad;
+	u16 vlan_tci;
+	/* Length of the paged data, the skb is linear if 0 */
+	u32 data_len;
+	u8 nr_frags;
+	/* CHECKSUM_NONE, UNNECESSARY, COMPLETE or PARTIAL. The offsets are
+	 * only meaningful for CHECKSUM_PARTIAL. */
+	u8 ip_summed;
+	u16 csum_start;
+	u16 csum_offset;
+	u32 hash;
+	/* The rx queue + 1 on receive, the tx queue on transmit */
+	u16 queue_mapping;
+	u32 priority;
+	/* Minor of the class selected by a tc classifier, from the qdisc
+	 * control block, only valid while the skb is in a qdisc */
+	u16 tc_classid;
+	/* 4 or 6 if the network header is IPv4 or IPv6, 0 otherwise */
+	u8 ip_version;
+	/* The IPv4 TOS or IPv6 traffic class, i.e. DSCP << 2 | ECN */
+	u8 tos;
+	/* The IPv4 TTL or IPv6 hop limit */
+	u8 ttl;
+	/* The top label stack entries of MPLS packets, in network byte order */
+	u8 mpls_labels;
+	u32 mpls_lse[MAX_MPLS_LABELS];
+	/* Read along with the ifindex, as the device may be gone or in another
+	 * netns by the time the event is printed */
+	char ifname[IFNAMSIZ];
 } __attribute__((packed));
 
 struct tuple {
@@ -47,7 +145,111 @@ struct tuple {
 	u16 dport;
 	u16 l3_proto;
 	u8 l4_proto;
-	u8 pad;
+	u8 tcp_flags;
+	/* Or the verification tag for SCTP, the sequence number for ESP and
+	 * AH, or the rest of the header for ICMP, e.g. the identifier and the
+	 * sequence number of the echo messages */
+	u32 seq;
+	u32 ack_seq;
+	u8 icmp_type;
+	u8 icmp_code;
+	/* IPV6_EXTHDR_* bits of the extension headers before the L4 header */
+	u8 ipv6_exthdrs;
+	/* The security parameter index of ESP and AH */
+	u32 spi;
+	/* The identification of the IPv4 header */
+	u16 ip_id;
+} __attribute__((packed));
+
+struct l2_hdr {
+	u8 dest[ETH_ALEN];
+	u8 source[ETH_ALEN];
+	u16 proto;
+} __attribute__((packed));
+
+/* The socket of the skb, if any. The cookie is 0 until one is requested,
+ * e.g. by ss. */
+struct sock_info {
+	u64 addr;
+	u64 cookie;
+	u16 protocol;
+	u8 state;
+	/* Owner of the socket, (u32) -1 if unknown. The gid is the one of the
+	 * process which opened the socket file. */
+	u32 uid;
+	u32 gid;
+} __attribute__((packed));
+
+/* The conntrack entry of the skb. ctinfo is an enum ip_conntrack_info, or
+ * CT_NONE if the skb has no entry (yet). */
+struct ct_info {
+	u8 ctinfo;
+	u16 zone;
+	u32 mark;
+} __attribute__((packed));
+
+#define NF_NAME_LEN           32
+
+#define NF_KIND_HOOK_SLOW     1
+#define NF_KIND_XT_TABLE      2
+#define NF_KIND_NFT_CHAIN     3
+
+/* Set by the --output-netfilter programs, kind is 0 otherwise. The verdict
+ * is the return value of the traced function. */
+struct nf_info {
+	u8 kind;
+	u8 pf;
+	u8 hook;
+	s32 verdict;
+	char table[NF_NAME_LEN];
+	char chain[NF_NAME_LEN];
+} __attribute__((packed));
+
+#define BPF_OBJ_NAME_LEN      16
+
+/* The XDP program run on the packet, with --filter-trace-xdp */
+struct xdp_info {
+	u32 prog_id;
+	char prog_name[BPF_OBJ_NAME_LEN];
+	u32 rx_queue;
+	/* The XDP action returned by the program */
+	u32 verdict;
+} __attribute__((packed));
+
+/* The tc BPF program run on the skb, with --filter-trace-tc */
+struct tc_info {
+	u32 prog_id;
+	char prog_name[BPF_OBJ_NAME_LEN];
+	u8 ingress;
+	/* The TC_ACT_* verdict of the filter */
+	s32 verdict;
+} __attribute__((packed));
+
+/* The tunnel of an encapsulated packet and its inner headers, with
+ * --output-tuple */
+struct tunnel_info {
+	/* TUNNEL_*, 0 if the packet is not encapsulated */
+	u8 type;
+	/* The VNI of VXLAN and Geneve, the key of GRE, or the VSID and flow id
+	 * of NVGRE */
+	u32 key;
+	struct tuple inner;
+} __attribute__((packed));
+
+/* The route of the skb with --output-route, or the nexthop selected by
+ * fib_table_lookup(). ifindex is 0 if there is none. */
+struct pwru_route {
+	/* Of the output device */
+	u32 netns;
+	u32 ifindex;
+	char ifname[IFNAMSIZ];
+	/* ETH_P_IP or ETH_P_IPV6 as tuple.l3_proto, 0 without a gateway */
+	u16 gw_proto;
+	union addr gw;
+	/* RTN_*, 0 if unknown */
+	u8 type;
+	/* 0 if unknown */
+	u32 table;
 } __attribute__((packed));
 
 u64 print_skb_id = 0;
@@ -63,27 +265,120 @@ struct event_t {
 	struct tuple tuple;
 	s64 print_stack_id;
 	u32 cpu_id;
+	/* The argument following the skb, e.g. the drop reason of
+	 * kfree_skb_reason(), or the return value for EVENT_TYPE_RETURN */
+	u64 param_next;
+	/* Time spent in the function for EVENT_TYPE_RETURN */
+	u64 duration;
+	struct l2_hdr eth;
+	struct sock_info sk;
+	struct ct_info ct;
+	struct nf_info nf;
+	/* The skb this one was cloned or copied from, with --track-clones */
+	u64 parent_addr;
+	struct xdp_info xdp;
+	struct tc_info tc;
+	struct tunnel_info tunnel;
+	struct pwru_route route;
 } __attribute__((packed));
 
 struct {
 	__uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
 } events SEC(".maps");
 
+/* The size is set from userspace */
+struct {
+	__uint(type, BPF_MAP_TYPE_RINGBUF);
+	__uint(max_entries, 1 << 12);
+} events_rb SEC(".maps");
+
+/*
+ * Set from userspace if the kernel supports ring buffers (>= 5.8). As it is
+ * a constant, the verifier removes the unused path and older kernels don't
+ * reject the bpf_ringbuf_output() call.
+ */
+volatile const bool use_ringbuf = false;
+
+/*
+ * Events dropped as the ring buffer was full. The perf buffer reports its
+ * lost samples by itself.
+ */
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, u64);
+} lost_events SEC(".maps");
+
+/* Inclusive, in host byte order. The filter is disabled if max is 0. */
+struct port_range {
+	u16 min;
+	u16 max;
+} __attribute__((packed));
+
 struct config {
 	u32 netns;
 	u32 mark;
 	u8 ipv6;
-	union addr saddr;
-	union addr daddr;
+	/* The prefixes are in the filter_saddr/daddr maps */
+	u8 filter_saddr;
+	u8 filter_daddr;
 	u8 l4_proto;
-	u16 sport;
-	u16 dport;
-	u16 port;
+	struct port_range sport;
+	struct port_range dport;
+	struct port_range port;
 	u8 output_timestamp;
 	u8 output_meta;
 	u8 output_tuple;
 	u8 output_skb;
 	u8 output_stack;
+	u16 capture_len;
+	u8 output_retval;
+	u8 output_latency;
+	u64 latency_threshold;
+	/* The VLAN ID may be 0, of the priority-tagged frames */
+	u8 filter_vlan;
+	u16 vlan_id;
+	u8 output_eth;
+	u8 filter_pcap;
+	u32 ifindex;
+	u32 mark_mask;
+	u32 pid;
+	char comm[TASK_COMM_LEN];
+	u8 filter_cgroup;
+	/* FILTER_ICMP and/or FILTER_ICMPV6 */
+	u8 filter_icmp;
+	u8 icmp_type;
+	u8 icmp6_type;
+	/* Match if (flags & tcp_flags_mask) == tcp_flags */
+	u8 tcp_flags;
+	u8 tcp_flags_mask;
+	u8 filter_tunnel_inner;
+	u32 sample_rate;
+	/* Capture the paged data too, into full_capture_buf */
+	u8 capture_full;
+	/* Addresses of the page_offset_base and vmemmap_base variables to
+	 * compute the address of the fragment pages, 0 if unknown */
+	u64 page_offset_base;
+	u64 vmemmap_base;
+	u8 output_sock;
+	u8 output_conntrack;
+	u8 track_clones;
+	/* Bounds of skb->len, 0 if unset */
+	u32 len_min;
+	u32 len_max;
+	u8 filter_dscp;
+	u8 dscp;
+	/* SPI of the ESP and AH packets, 0 if unset as it is reserved */
+	u32 spi;
+	/* A label of the MPLS label stack */
+	u8 filter_mpls;
+	u32 mpls_label;
+	u8 output_route;
+	/* Count the durations in latency_hists */
+	u8 latency_hist;
+	/* Count the events in aggregates instead of reporting them */
+	u8 aggregate;
 	u8 pad;
 } __attribute__((packed));
 
@@ -102,6 +397,178 @@ struct {
 	__type(value, struct config);
 } cfg_map SEC(".maps");
 
+struct packet_capture {
+	struct event_t event;
+	u32 pkt_len;
+	u32 cap_len;
+	u8 data[MAX_CAPTURE_LEN];
+} __attribute__((packed));
+
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, struct packet_capture);
+} capture_buf SEC(".maps");
+
+struct packet_full_capture {
+	struct event_t event;
+	u32 pkt_len;
+	u32 cap_len;
+	u8 data[2 * MAX_FULL_CAPTURE_LEN];
+} __attribute__((packed));
+
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, struct packet_full_capture);
+} full_capture_buf SEC(".maps");
+
+/* skb_frag_t is a struct skb_frag of a netmem_ref since 6.8, a bio_vec before */
+struct skb_frag___netmem {
+	unsigned long netmem;
+	unsigned int len;
+	unsigned int offset;
+} __attribute__((preserve_access_index));
+
+/*
+ * To report the return value of a function, the entry kprobe pushes the
+ * skb into a per-task stack, which is popped by the kretprobe. The stack is
+ * pushed to even if the skb was filtered out (with skb == 0) to keep the
+ * entries and returns balanced.
+ */
+#define MAX_RET_DEPTH 16
+
+struct ret_entry {
+	u64 skb;
+	u64 addr;
+	u64 ts;
+};
+
+struct ret_stack {
+	u32 depth;
+	u32 pad;
+	struct ret_entry entries[MAX_RET_DEPTH];
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 8192);
+	__type(key, u64);
+	__type(value, struct ret_stack);
+} ret_stacks SEC(".maps");
+
+/*
+ * The skbs cloned or copied from another one, by address, with
+ * --track-clones. The entries are removed when the skbs are freed, as the
+ * addresses are reused.
+ */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 65536);
+	__type(key, u64);
+	__type(value, u64);
+} skb_parents SEC(".maps");
+
+/* The skb being cloned by the task, until the clone is returned */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 8192);
+	__type(key, u64);
+	__type(value, u64);
+} clone_origins SEC(".maps");
+
+/*
+ * The log2 histograms of the durations of the traced functions, with
+ * --latency-histogram: the number of calls per function address and slot.
+ * Slot 0 counts the durations of 0ns, and slot n those in [2^(n-1), 2^n).
+ */
+struct latency_hist_key {
+	u64 addr;
+	u32 slot;
+	u32 pad;
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_HASH);
+	__uint(max_entries, 1 << 16);
+	__type(key, struct latency_hist_key);
+	__type(value, u64);
+} latency_hists SEC(".maps");
+
+/*
+ * The number of events per function and flow, or netns for the packets
+ * without a tuple, with --aggregate. The counters are per CPU, so that the
+ * hot paths don't contend on them.
+ */
+struct aggregate_key {
+	u64 addr;
+	union addr saddr;
+	union addr daddr;
+	u16 sport;
+	u16 dport;
+	u16 l3_proto;
+	u8 l4_proto;
+	u8 type;
+	u32 netns;
+	u32 pad;
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_HASH);
+	__uint(max_entries, 1 << 16);
+	__type(key, struct aggregate_key);
+	__type(value, u64);
+} aggregates SEC(".maps");
+
+/*
+ * The prefixes of --filter-src-ip and --filter-dst-ip. IPv4 addresses are
+ * stored in the first 4 bytes of the address.
+ */
+struct lpm_key {
+	u32 prefixlen;
+	union addr addr;
+} __attribute__((packed));
+
+struct {
+	__uint(type, BPF_MAP_TYPE_LPM_TRIE);
+	__uint(max_entries, 1);
+	__uint(map_flags, BPF_F_NO_PREALLOC);
+	__type(key, struct lpm_key);
+	__type(value, u8);
+} saddr_lpm SEC(".maps");
+
+struct {
+	__uint(type, BPF_MAP_TYPE_LPM_TRIE);
+	__uint(max_entries, 1);
+	__uint(map_flags, BPF_F_NO_PREALLOC);
+	__type(key, struct lpm_key);
+	__type(value, u8);
+} daddr_lpm SEC(".maps");
+
+/* The cgroup of --filter-cgroup, at index 0 */
+struct {
+	__uint(type, BPF_MAP_TYPE_CGROUP_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, u32);
+} cgroup_map SEC(".maps");
+
+/* Linear data copied for the filter expression, from the network header */
+#define PCAP_FILTER_LEN 256
+
+struct filter_buf {
+	u8 data[PCAP_FILTER_LEN];
+};
+
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, struct filter_buf);
+} filter_buf_map SEC(".maps");
+
 #ifdef OUTPUT_SKB
 struct {
 	__uint(type, BPF_MAP_TYPE_ARRAY);
@@ -127,115 +594,461 @@ get_netns(struct sk_buff *skb) {
 	return netns;
 }
 
+static __always_inline bool
+vlan_present(struct sk_buff *skb) {
+	if (bpf_core_field_exists(skb->vlan_present)) {
+		return BPF_CORE_READ_BITFIELD_PROBED(skb, vlan_present);
+	}
+	/* Since 6.2 the tag is present when any of vlan_proto/vlan_tci is set */
+	return BPF_CORE_READ(skb, vlan_proto) || BPF_CORE_READ(skb, vlan_tci);
+}
+
+static __always_inline bool
+filter_len(u32 len, struct config *cfg) {
+	return (!cfg->len_min || len >= cfg->len_min) && (!cfg->len_max || len <= cfg->len_max);
+}
+
+static __always_inline bool
+is_mpls(u16 proto) {
+	return proto == ETH_P_MPLS_UC || proto == ETH_P_MPLS_MC;
+}
+
+/*
+ * Read the label stack entries of the MPLS header at mpls_hdr into lse, until
+ * the bottom of the stack or MAX_MPLS_LABELS, and return their number.
+ */
+static __always_inline u8
+get_mpls_labels(void *mpls_hdr, u32 *lse) {
+	u8 n = 0;
+
+	bpf_probe_read_kernel(lse, sizeof(u32) * MAX_MPLS_LABELS, mpls_hdr);
+#pragma unroll
+	for (int i = 0; i < MAX_MPLS_LABELS; i++) {
+		n++;
+		if (bpf_ntohl(lse[i]) & MPLS_LS_S_MASK) {
+			break;
+		}
+	}
+	return n;
+}
+
+static __always_inline bool
+filter_mpls(void *mpls_hdr, u16 proto, struct config *cfg) {
+	u32 lse[MAX_MPLS_LABELS];
+
+	if (!is_mpls(proto)) {
+		return false;
+	}
+
+	u8 n = get_mpls_labels(mpls_hdr, lse);
+#pragma unroll
+	for (int i = 0; i < MAX_MPLS_LABELS; i++) {
+		if (i < n && bpf_ntohl(lse[i]) >> MPLS_LS_LABEL_SHIFT == cfg->mpls_label) {
+			return true;
+		}
+	}
+	return false;
+}
+
 static __always_inline bool
 filter_meta(struct sk_buff *skb, struct config *cfg) {
 	if (cfg->netns && get_netns(skb) != cfg->netns) {
 			return false;
 	}
-	if (cfg->mark && BPF_CORE_READ(skb, mark) != cfg->mark) {
+	if (cfg->mark_mask && (BPF_CORE_READ(skb, mark) & cfg->mark_mask) != cfg->mark) {
+		return false;
+	}
+	if (cfg->ifindex && BPF_CORE_READ(skb, dev, ifindex) != cfg->ifindex) {
+		return false;
+	}
+	if (cfg->filter_vlan && (!vlan_present(skb) ||
+				 (BPF_CORE_READ(skb, vlan_tci) & VLAN_VID_MASK) != cfg->vlan_id)) {
+		return false;
+	}
+	if (!filter_len(BPF_CORE_READ(skb, len), cfg)) {
+		return false;
+	}
+	if (cfg->filter_mpls &&
+	    !filter_mpls(BPF_CORE_READ(skb, head) + BPF_CORE_READ(skb, network_header),
+			 bpf_ntohs(BPF_CORE_READ(skb, protocol)), cfg)) {
 		return false;
 	}
 	return true;
 }
 
 static __always_inline bool
-addr_empty(union addr addr) {
-	return addr.v6addr.d1 == 0 && addr.v6addr.d2 == 0;
+addr_in_prefix(void *lpm, union addr *addr, u32 prefixlen) {
+	struct lpm_key key = {
+		.prefixlen = prefixlen,
+		.addr = *addr,
+	};
+	return bpf_map_lookup_elem(lpm, &key) != NULL;
 }
 
 static __always_inline bool
-v6addr_equal(union addr addr, u8 bytes[16]) {
-	u64 *u64p = (u64 *) bytes;
-	return addr.v6addr.d1 == *u64p && addr.v6addr.d2 == *(u64p + 1);
+port_in_range(u16 port, struct port_range *range) {
+	return port >= range->min && port <= range->max;
 }
 
 static __always_inline bool
 config_tuple_empty(struct config *cfg) {
-	if (!addr_empty(cfg->saddr) || !addr_empty(cfg->daddr)) {
+	if (cfg->filter_saddr || cfg->filter_daddr) {
 		return false;
 	}
-	if (cfg->l4_proto || cfg->sport || cfg->dport || cfg->port) {
+	if (cfg->l4_proto || cfg->sport.max || cfg->dport.max || cfg->port.max) {
+		return false;
+	}
+	if (cfg->filter_icmp || cfg->tcp_flags_mask || cfg->filter_dscp || cfg->spi) {
 		return false;
 	}
 	return true;
 }
 
 /*
- * Filter by packet tuple, return true when the tuple is empty, return false
- * if one of the other fields does not match.
+ * Move l3_off and l4_off to the inner headers if the packet is encapsulated
+ * in VXLAN, Geneve, GRE or NVGRE, and return the TUNNEL_* encapsulation and
+ * its key, or 0. The inner headers are expected to be in the linear data, and
+ * VLAN tags of inner Ethernet frames are not supported.
+ */
+static __always_inline u8
+tunnel_inner_offsets(void *skb_head, u16 *l3_off, u16 *l4_off, u32 *key) {
+	u8 ip_vsn_ihl, l4_proto, type;
+	u16 proto, off;
+	__be16 dport;
+	__be32 hdr_key = 0;
+
+	bpf_probe_read_kernel(&ip_vsn_ihl, sizeof(ip_vsn_ihl), skb_head + *l3_off);
+	if (ip_vsn_ihl >> 4 == 4) {
+		bpf_probe_read_kernel(&l4_proto, sizeof(l4_proto),
+				      skb_head + *l3_off + offsetof(struct iphdr, protocol));
+	} else if (ip_vsn_ihl >> 4 == 6) {
+		bpf_probe_read_kernel(&l4_proto, sizeof(l4_proto),
+				      skb_head + *l3_off + offsetof(struct ipv6hdr, nexthdr));
+	} else {
+		return 0;
+	}
+
+	off = *l4_off;
+	if (l4_proto == IPPROTO_UDP) {
+		bpf_probe_read_kernel(&dport, sizeof(dport),
+				      skb_head + off + offsetof(struct udphdr, dest));
+		off += sizeof(struct udphdr);
+		if (bpf_ntohs(dport) == VXLAN_PORT) {
+			/* The VNI is in the upper 24 bits of the second word */
+			bpf_probe_read_kernel(&hdr_key, sizeof(hdr_key), skb_head + off + 4);
+			*key = bpf_ntohl(hdr_key) >> 8;
+			type = TUNNEL_VXLAN;
+			off += 8;
+			proto = ETH_P_TEB;
+		} else if (bpf_ntohs(dport) == GENEVE_PORT) {
+			u8 opt_len;
+
+			bpf_probe_read_kernel(&opt_len, sizeof(opt_len), skb_head + off);
+			bpf_probe_read_kernel(&proto, sizeof(proto), skb_head + off + 2);
+			bpf_probe_read_kernel(&hdr_key, sizeof(hdr_key), skb_head + off + 4);
+			*key = bpf_ntohl(hdr_key) >> 8;
+			type = TUNNEL_GENEVE;
+			proto = bpf_ntohs(proto);
+			off += 8 + (opt_len & 0x3f) * 4;
+		} else {
+			return 0;
+		}
+	} else if (l4_proto == IPPROTO_GRE) {
+		u16 flags;
+
+		bpf_probe_read_kernel(&flags, sizeof(flags), skb_head + off);
+		bpf_probe_read_kernel(&proto, sizeof(proto), skb_head + off + 2);
+		flags = bpf_ntohs(flags);
+		proto = bpf_ntohs(proto);
+		/* Only the version 0, i.e. not the enhanced GRE of PPTP */
+		if (flags & GRE_VERSION) {
+			return 0;
+		}
+		off += 4;
+		if (flags & GRE_CSUM) {
+			off += 4;
+		}
+		if (flags & GRE_KEY) {
+			bpf_probe_read_kernel(&hdr_key, sizeof(hdr_key), skb_head + off);
+			*key = bpf_ntohl(hdr_key);
+			off += 4;
+		}
+		if (flags & GRE_SEQ) {
+			off += 4;
+		}
+		/* NVGRE (RFC 7637) is transparent Ethernet bridging over GRE,
+		 * with the VSID and flow id in the key */
+		type = (proto == ETH_P_TEB && (flags & GRE_KEY)) ? TUNNEL_NVGRE : TUNNEL_GRE;
+	} else {
+		return 0;
+	}
+
+	if (proto == ETH_P_TEB) {
+		bpf_probe_read_kernel(&proto, sizeof(proto),
+				      skb_head + off + offsetof(struct ethhdr, h_proto));
+		proto = bpf_ntohs(proto);
+		off += ETH_HLEN;
+	}
+
+	if (proto == ETH_P_IP) {
+		bpf_probe_read_kernel(&ip_vsn_ihl, sizeof(ip_vsn_ihl), skb_head + off);
+		*l3_off = off;
+		*l4_off = off + (ip_vsn_ihl & 0xf) * 4;
+	} else if (proto == ETH_P_IPV6) {
+		*l3_off = off;
+		*l4_off = off + sizeof(struct ipv6hdr);
+	} else {
+		return 0;
+	}
+	return type;
+}
+
+/*
+ * Walk the extension headers of the IPv6 packet whose fixed header is at
+ * l3_off from head. Set nexthdr to the L4 protocol, l4_off to the L4 header
+ * if there were extension headers, and exthdrs to their IPV6_EXTHDR_* bits.
+ * Return false if there is no L4 header, i.e. for the non-first fragments
+ * and when there are more than IPV6_MAX_EXTHDRS extension headers.
  */
 static __always_inline bool
-filter_l3_and_l4(struct sk_buff *skb, struct config *cfg) {
-	if (config_tuple_empty(cfg)) {
-		return true;
+ipv6_skip_exthdrs(void *head, u16 l3_off, u8 *nexthdr, u16 *l4_off, u8 *exthdrs) {
+	u16 off = l3_off + sizeof(struct ipv6hdr);
+	u8 hdr[2];
+
+	bpf_probe_read_kernel(nexthdr, sizeof(*nexthdr),
+			      head + l3_off + offsetof(struct ipv6hdr, nexthdr));
+
+#pragma unroll
+	for (int i = 0; i < IPV6_MAX_EXTHDRS; i++) {
+		if (*nexthdr == IPPROTO_HOPOPTS) {
+			*exthdrs |= IPV6_EXTHDR_HOPOPTS;
+		} else if (*nexthdr == IPPROTO_ROUTING) {
+			*exthdrs |= IPV6_EXTHDR_ROUTING;
+		} else if (*nexthdr == IPPROTO_FRAGMENT) {
+			*exthdrs |= IPV6_EXTHDR_FRAGMENT;
+		} else if (*nexthdr == IPPROTO_DSTOPTS) {
+			*exthdrs |= IPV6_EXTHDR_DSTOPTS;
+		} else {
+			if (*exthdrs) {
+				*l4_off = off;
+			}
+			return true;
+		}
+
+		/* All of them start with the next header, then the length in
+		 * units of 8 bytes, not including the first 8 bytes, except the
+		 * fragment header which is always 8 bytes long */
+		bpf_probe_read_kernel(hdr, sizeof(hdr), head + off);
+		if (*nexthdr == IPPROTO_FRAGMENT) {
+			__be16 frag_off;
+
+			bpf_probe_read_kernel(&frag_off, sizeof(frag_off), head + off + 2);
+			*nexthdr = hdr[0];
+			if (bpf_ntohs(frag_off) & IP6_OFFSET) {
+				return false;
+			}
+			off += 8;
+		} else {
+			*nexthdr = hdr[0];
+			off += (hdr[1] + 1) * 8;
+		}
 	}
+	return false;
+}
 
-	void *skb_head = BPF_CORE_READ(skb, head);
-	u16 l3_off = BPF_CORE_READ(skb, network_header);
-	u16 l4_off = BPF_CORE_READ(skb, transport_header);
+/*
+ * Read the SPI and the sequence number of the ESP or AH header at l4_hdr,
+ * return false if l4_proto is neither.
+ */
+static __always_inline bool
+get_ipsec_hdr(void *l4_hdr, u8 l4_proto, u32 *spi, u32 *seq) {
+	u32 hdr[2];
+
+	if (l4_proto == IPPROTO_ESP) {
+		bpf_probe_read_kernel(hdr, sizeof(hdr), l4_hdr);
+	} else if (l4_proto == IPPROTO_AH) {
+		bpf_probe_read_kernel(hdr, sizeof(hdr),
+				      l4_hdr + offsetof(struct ip_auth_hdr, spi));
+	} else {
+		return false;
+	}
+	*spi = hdr[0];
+	*seq = hdr[1];
+	return true;
+}
+
+/*
+ * Return the IP version of the network header, and its TOS or traffic class
+ * and TTL or hop limit
+ */
+static __always_inline u8
+get_ip_hdr(void *l3_hdr, u8 *tos, u8 *ttl) {
+	struct iphdr *ip4 = (struct iphdr *) l3_hdr;
+	u8 ip_vsn = BPF_CORE_READ_BITFIELD_PROBED(ip4, version);
+
+	if (ip_vsn == 4) {
+		*tos = BPF_CORE_READ(ip4, tos);
+		*ttl = BPF_CORE_READ(ip4, ttl);
+	} else if (ip_vsn == 6) {
+		/* The traffic class is in the 4 bits after the version and in
+		 * the upper 4 bits of the next byte */
+		u8 hdr[2];
+		bpf_probe_read_kernel(hdr, sizeof(hdr), l3_hdr);
+		*tos = (hdr[0] << 4) | (hdr[1] >> 4);
+		*ttl = BPF_CORE_READ((struct ipv6hdr *) l3_hdr, hop_limit);
+	} else {
+		return 0;
+	}
+	return ip_vsn;
+}
+
+/*
+ * Filter by the tuple of the packet whose L3 and L4 headers are at l3_off and
+ * l4_off from head, return false if one of the fields does not match.
+ */
+static __always_inline bool
+filter_headers(void *head, u16 l3_off, u16 l4_off, struct config *cfg) {
+	if (cfg->filter_tunnel_inner) {
+		u32 key;
+		tunnel_inner_offsets(head, &l3_off, &l4_off, &key);
+	}
 
-	struct iphdr *l3_hdr = (struct iphdr *) (skb_head + l3_off);
+	struct iphdr *l3_hdr = (struct iphdr *) (head + l3_off);
 	u8 ip_vsn = BPF_CORE_READ_BITFIELD_PROBED(l3_hdr, version);
 
 	u16 l4_proto;
+	bool has_l4 = true;
+	union addr saddr = {}, daddr = {};
 
 	if (cfg->ipv6 == 0 && ip_vsn == 4) {
 		struct iphdr *ip4 = (struct iphdr *) l3_hdr;
 
-		if (!addr_empty(cfg->saddr) && BPF_CORE_READ(ip4, saddr) != cfg->saddr.v4addr) {
+		BPF_CORE_READ_INTO(&saddr.v4addr, ip4, saddr);
+		BPF_CORE_READ_INTO(&daddr.v4addr, ip4, daddr);
+
+		if (cfg->filter_saddr && !addr_in_prefix(&saddr_lpm, &saddr, 32)) {
 			return false;
 		}
 
-		if (!addr_empty(cfg->daddr) && BPF_CORE_READ(ip4, daddr) != cfg->daddr.v4addr) {
+		if (cfg->filter_daddr && !addr_in_prefix(&daddr_lpm, &daddr, 32)) {
 			return false;
 		}
 
 		l4_proto = BPF_CORE_READ(ip4, protocol);
-	} else if (cfg->ipv6 == 1 && ip_vsn == 6) {
+	} else if (ip_vsn == 6 && (cfg->ipv6 == 1 || !(cfg->filter_saddr || cfg->filter_daddr))) {
+		/* Without address filters, e.g. --filter-proto icmp6 */
 		struct ipv6hdr *ip6 = (struct ipv6hdr *) l3_hdr;
 
-		if (!addr_empty(cfg->saddr) && !v6addr_equal(cfg->saddr, BPF_CORE_READ(ip6, saddr.in6_u.u6_addr8))) {
+		BPF_CORE_READ_INTO(&saddr, ip6, saddr);
+		BPF_CORE_READ_INTO(&daddr, ip6, daddr);
+
+		if (cfg->filter_saddr && !addr_in_prefix(&saddr_lpm, &saddr, 128)) {
 			return false;
 		}
 
-		if (!addr_empty(cfg->daddr) && !v6addr_equal(cfg->daddr, BPF_CORE_READ(ip6, daddr.in6_u.u6_addr8))) {
+		if (cfg->filter_daddr && !addr_in_prefix(&daddr_lpm, &daddr, 128)) {
 			return false;
 		}
 
-		l4_proto = BPF_CORE_READ(ip6, nexthdr); // TODO: ipv6 l4 protocol
+		u8 nexthdr, exthdrs = 0;
+		has_l4 = ipv6_skip_exthdrs(head, l3_off, &nexthdr, &l4_off, &exthdrs);
+		l4_proto = nexthdr;
 	} else {
 		// currently ignore network layer protocols other than ipv4/ipv6
 		return false;
 	}
 
+	/* The ports, ICMP type, TCP flags and SPI filters need the L4 header */
+	if (!has_l4 && (cfg->filter_icmp || cfg->tcp_flags_mask || cfg->spi ||
+			cfg->dport.max || cfg->sport.max || cfg->port.max)) {
+		return false;
+	}
+
+	if (cfg->spi) {
+		u32 spi, seq;
+
+		if (!get_ipsec_hdr(head + l4_off, l4_proto, &spi, &seq) ||
+		    bpf_ntohl(spi) != cfg->spi) {
+			return false;
+		}
+	}
+
 	if (cfg->l4_proto && l4_proto != cfg->l4_proto) {
 		return false;
 	}
 
-	if (cfg->dport || cfg->sport || cfg->port) {
+	if (cfg->filter_dscp) {
+		u8 tos = 0, ttl;
+		get_ip_hdr(l3_hdr, &tos, &ttl);
+		if ((tos >> 2) != cfg->dscp) {
+			return false;
+		}
+	}
+
+	if (cfg->filter_icmp) {
+		u8 type, want;
+
+		if (l4_proto == IPPROTO_ICMP && (cfg->filter_icmp & FILTER_ICMP)) {
+			want = cfg->icmp_type;
+		} else if (l4_proto == IPPROTO_ICMPV6 && (cfg->filter_icmp & FILTER_ICMPV6)) {
+			want = cfg->icmp6_type;
+		} else {
+			return false;
+		}
+
+		/* The type is the first byte of both the ICMP and ICMPv6 headers */
+		bpf_probe_read_kernel(&type, sizeof(type), head + l4_off);
+		if (type != want) {
+			return false;
+		}
+	}
+
+	if (cfg->tcp_flags_mask) {
+		u8 flags;
+
+		if (l4_proto != IPPROTO_TCP) {
+			return false;
+		}
+
+		/* The flags are bitfields, so read the whole byte after doff */
+		bpf_probe_read_kernel(&flags, sizeof(flags), head + l4_off + 13);
+		if ((flags & cfg->tcp_flags_mask) != cfg->tcp_flags) {
+			return false;
+		}
+	}
+
+	if (cfg->dport.max || cfg->sport.max || cfg->port.max) {
 		u16 sport, dport;
 
 		if (l4_proto == IPPROTO_TCP) {
-			struct tcphdr *tcp = (struct tcphdr *) (skb_head + l4_off);
+			struct tcphdr *tcp = (struct tcphdr *) (head + l4_off);
 			sport = BPF_CORE_READ(tcp, source);
 			dport = BPF_CORE_READ(tcp, dest);
 		} else if (l4_proto == IPPROTO_UDP) {
-			struct udphdr *udp = (struct udphdr *) (skb_head + l4_off);
+			struct udphdr *udp = (struct udphdr *) (head + l4_off);
 			sport = BPF_CORE_READ(udp, source);
 			dport = BPF_CORE_READ(udp, dest);
+		} else if (l4_proto == IPPROTO_SCTP) {
+			struct sctphdr *sctp = (struct sctphdr *) (head + l4_off);
+			sport = BPF_CORE_READ(sctp, source);
+			dport = BPF_CORE_READ(sctp, dest);
 		} else {
 			return false;
 		}
 
-		if (cfg->sport && sport != cfg->sport) {
+		sport = bpf_ntohs(sport);
+		dport = bpf_ntohs(dport);
+
+		if (cfg->sport.max && !port_in_range(sport, &cfg->sport)) {
 			return false;
 		}
 
-		if (cfg->dport && dport != cfg->dport) {
+		if (cfg->dport.max && !port_in_range(dport, &cfg->dport)) {
 			return false;
 		}
 
-		if (cfg->port && (dport != cfg->port && sport != cfg->port)) {
+		if (cfg->port.max && !port_in_range(dport, &cfg->port) &&
+		    !port_in_range(sport, &cfg->port)) {
 			return false;
 		}
 	}
@@ -244,29 +1057,160 @@ filter_l3_and_l4(struct sk_buff *skb, struct config *cfg) {
 	return true;
 }
 
+/*
+ * Filter by packet tuple, return true when the tuple is empty, return false
+ * if one of the other fields does not match.
+ */
 static __always_inline bool
-filter(struct sk_buff *skb, struct config *cfg) {
-	return filter_meta(skb, cfg) && filter_l3_and_l4(skb, cfg);
-}
-
-static __always_inline void
-set_meta(struct sk_buff *skb, struct skb_meta *meta) {
-	meta->netns = get_netns(skb);
-	meta->mark = BPF_CORE_READ(skb, mark);
-	meta->len = BPF_CORE_READ(skb, len);
-	meta->protocol = BPF_CORE_READ(skb, protocol);
-	meta->ifindex = BPF_CORE_READ(skb, dev, ifindex);
-	meta->mtu = BPF_CORE_READ(skb, dev, mtu);
-}
+filter_l3_and_l4(struct sk_buff *skb, struct config *cfg) {
+	if (config_tuple_empty(cfg)) {
+		return true;
+	}
 
-static __always_inline void
-set_tuple(struct sk_buff *skb, struct tuple *tpl) {
 	void *skb_head = BPF_CORE_READ(skb, head);
 	u16 l3_off = BPF_CORE_READ(skb, network_header);
 	u16 l4_off = BPF_CORE_READ(skb, transport_header);
 
-	struct iphdr *l3_hdr = (struct iphdr *) (skb_head + l3_off);
-	u8 ip_vsn = BPF_CORE_READ_BITFIELD_PROBED(l3_hdr, version);
+	return filter_headers(skb_head, l3_off, l4_off, cfg);
+}
+
+/*
+ * The body of this function is replaced in userspace with the filter
+ * expression compiled from the pcap-filter syntax. The stub only has to
+ * survive the compiler, which is why it uses all of its arguments.
+ */
+static __noinline bool
+filter_pcap_ebpf_l3(void *data, u32 cap_len, u32 pkt_len) {
+	return data != 0 && cap_len <= pkt_len;
+}
+
+/* Run the filter expression on the len bytes of the packet starting at l3 */
+static __always_inline bool
+filter_pcap_data(void *l3, u32 len, u32 pkt_len) {
+	u32 index = 0;
+	struct filter_buf *buf = bpf_map_lookup_elem(&filter_buf_map, &index);
+	if (!buf) {
+		return false;
+	}
+
+	if (len > PCAP_FILTER_LEN) {
+		len = PCAP_FILTER_LEN;
+	}
+	if (bpf_probe_read_kernel(buf->data, len, l3) < 0) {
+		return false;
+	}
+
+	return filter_pcap_ebpf_l3(buf->data, len, pkt_len);
+}
+
+static __always_inline bool
+filter_pcap(struct sk_buff *skb) {
+	void *skb_head = BPF_CORE_READ(skb, head);
+	u16 l3_off = BPF_CORE_READ(skb, network_header);
+	u32 tail = BPF_CORE_READ(skb, tail);
+
+	u32 len = tail > l3_off ? tail - l3_off : 0;
+	return filter_pcap_data(skb_head + l3_off, len, BPF_CORE_READ(skb, len));
+}
+
+static __always_inline bool
+filter_task(struct config *cfg) {
+	if (cfg->pid && (bpf_get_current_pid_tgid() >> 32) != cfg->pid) {
+		return false;
+	}
+
+	if (cfg->comm[0]) {
+		char comm[TASK_COMM_LEN];
+		bpf_get_current_comm(comm, sizeof(comm));
+#pragma unroll
+		for (int i = 0; i < TASK_COMM_LEN; i++) {
+			if (comm[i] != cfg->comm[i]) {
+				return false;
+			}
+			if (!comm[i]) {
+				break;
+			}
+		}
+	}
+
+	/* The current task is in the cgroup or in one of its descendants */
+	if (cfg->filter_cgroup && bpf_current_task_under_cgroup(&cgroup_map, 0) != 1) {
+		return false;
+	}
+
+	return true;
+}
+
+/*
+ * Keep 1 in sample_rate skbs. The decision is made on a hash of the skb
+ * address, so that the sampled skbs are traced through all the functions.
+ */
+static __always_inline bool
+filter_sample(struct sk_buff *skb, struct config *cfg) {
+	if (cfg->sample_rate <= 1) {
+		return true;
+	}
+
+	/* Knuth's multiplicative hash, skbs are at least 64-byte aligned */
+	u32 hash = (u32) ((u64) skb >> 6) * 2654435761U;
+	return hash % cfg->sample_rate == 0;
+}
+
+static __always_inline bool
+filter(struct sk_buff *skb, struct config *cfg) {
+	return filter_sample(skb, cfg) && filter_task(cfg) && filter_meta(skb, cfg) &&
+	       filter_l3_and_l4(skb, cfg) &&
+	       (!cfg->filter_pcap || filter_pcap(skb));
+}
+
+static __always_inline void
+set_meta(struct sk_buff *skb, struct skb_meta *meta) {
+	meta->netns = get_netns(skb);
+	meta->mark = BPF_CORE_READ(skb, mark);
+	meta->len = BPF_CORE_READ(skb, len);
+	meta->protocol = BPF_CORE_READ(skb, protocol);
+	struct net_device *dev = BPF_CORE_READ(skb, dev);
+	meta->ifindex = BPF_CORE_READ(dev, ifindex);
+	meta->mtu = BPF_CORE_READ(dev, mtu);
+	if (dev) {
+		BPF_CORE_READ_STR_INTO(&meta->ifname, dev, name);
+	}
+	meta->vlan_present = vlan_present(skb);
+	if (meta->vlan_present) {
+		meta->vlan_tci = BPF_CORE_READ(skb, vlan_tci);
+	}
+
+	meta->data_len = BPF_CORE_READ(skb, data_len);
+	struct skb_shared_info *shinfo = BPF_CORE_READ(skb, head) + BPF_CORE_READ(skb, end);
+	meta->nr_frags = BPF_CORE_READ(shinfo, nr_frags);
+
+	meta->ip_summed = BPF_CORE_READ_BITFIELD_PROBED(skb, ip_summed);
+	if (meta->ip_summed == CHECKSUM_PARTIAL) {
+		meta->csum_start = BPF_CORE_READ(skb, csum_start);
+		meta->csum_offset = BPF_CORE_READ(skb, csum_offset);
+	}
+
+	meta->hash = BPF_CORE_READ(skb, hash);
+	meta->queue_mapping = BPF_CORE_READ(skb, queue_mapping);
+
+	meta->priority = BPF_CORE_READ(skb, priority);
+	struct qdisc_skb_cb *qcb = (struct qdisc_skb_cb *) skb->cb;
+	meta->tc_classid = BPF_CORE_READ(qcb, tc_classid);
+
+	void *l3_hdr = BPF_CORE_READ(skb, head) + BPF_CORE_READ(skb, network_header);
+	meta->ip_version = get_ip_hdr(l3_hdr, &meta->tos, &meta->ttl);
+	if (is_mpls(bpf_ntohs(meta->protocol))) {
+		u32 lse[MAX_MPLS_LABELS];
+
+		meta->mpls_labels = get_mpls_labels(l3_hdr, lse);
+		__builtin_memcpy(meta->mpls_lse, lse, sizeof(lse));
+	}
+}
+
+static __always_inline void
+set_tuple_headers(void *head, u16 l3_off, u16 l4_off, struct tuple *tpl) {
+	struct iphdr *l3_hdr = (struct iphdr *) (head + l3_off);
+	u8 ip_vsn = BPF_CORE_READ_BITFIELD_PROBED(l3_hdr, version);
 
 	if (ip_vsn == 4) {
 		struct iphdr *ip4 = (struct iphdr *) l3_hdr;
@@ -274,22 +1218,187 @@ set_tuple(struct sk_buff *skb, struct tuple *tpl) {
 		BPF_CORE_READ_INTO(&tpl->daddr, ip4, daddr);
 		tpl->l4_proto = BPF_CORE_READ(ip4, protocol);
 		tpl->l3_proto = ETH_P_IP;
+		tpl->ip_id = BPF_CORE_READ(ip4, id);
 	} else if (ip_vsn == 6) {
 		struct ipv6hdr *ip6 = (struct ipv6hdr *) l3_hdr;
 		BPF_CORE_READ_INTO(&tpl->saddr, ip6, saddr);
 		BPF_CORE_READ_INTO(&tpl->daddr, ip6, daddr);
-		tpl->l4_proto = BPF_CORE_READ(ip6, nexthdr); // TODO: ipv6 l4 protocol
 		tpl->l3_proto = ETH_P_IPV6;
+		if (!ipv6_skip_exthdrs(head, l3_off, &tpl->l4_proto, &l4_off,
+				       &tpl->ipv6_exthdrs)) {
+			return;
+		}
 	}
 
 	if (tpl->l4_proto == IPPROTO_TCP) {
-		struct tcphdr *tcp = (struct tcphdr *) (skb_head + l4_off);
+		struct tcphdr *tcp = (struct tcphdr *) (head + l4_off);
 		tpl->sport= BPF_CORE_READ(tcp, source);
 		tpl->dport= BPF_CORE_READ(tcp, dest);
+		/* The flags are bitfields, so read the whole byte after doff */
+		bpf_probe_read_kernel(&tpl->tcp_flags, sizeof(tpl->tcp_flags),
+				      (void *) tcp + 13);
+		tpl->seq = BPF_CORE_READ(tcp, seq);
+		tpl->ack_seq = BPF_CORE_READ(tcp, ack_seq);
 	} else if (tpl->l4_proto == IPPROTO_UDP) {
-		struct udphdr *udp = (struct udphdr *) (skb_head + l4_off);
+		struct udphdr *udp = (struct udphdr *) (head + l4_off);
 		tpl->sport= BPF_CORE_READ(udp, source);
 		tpl->dport= BPF_CORE_READ(udp, dest);
+	} else if (tpl->l4_proto == IPPROTO_SCTP) {
+		struct sctphdr *sctp = (struct sctphdr *) (head + l4_off);
+		tpl->sport = BPF_CORE_READ(sctp, source);
+		tpl->dport = BPF_CORE_READ(sctp, dest);
+		tpl->seq = BPF_CORE_READ(sctp, vtag);
+	} else if (tpl->l4_proto == IPPROTO_ICMP || tpl->l4_proto == IPPROTO_ICMPV6) {
+		/* Both headers start with the type and the code, and the rest
+		 * of the header after the checksum */
+		bpf_probe_read_kernel(&tpl->icmp_type, 2, head + l4_off);
+		bpf_probe_read_kernel(&tpl->seq, sizeof(tpl->seq), head + l4_off + 4);
+	} else {
+		u32 spi, seq;
+
+		if (get_ipsec_hdr(head + l4_off, tpl->l4_proto, &spi, &seq)) {
+			tpl->spi = spi;
+			tpl->seq = seq;
+		}
+	}
+}
+
+static __always_inline void
+set_tunnel_headers(void *head, u16 l3_off, u16 l4_off, struct tunnel_info *tun) {
+	tun->type = tunnel_inner_offsets(head, &l3_off, &l4_off, &tun->key);
+	if (tun->type) {
+		set_tuple_headers(head, l3_off, l4_off, &tun->inner);
+	}
+}
+
+static __always_inline void
+set_tuple(struct sk_buff *skb, struct tuple *tpl, struct tunnel_info *tun) {
+	void *skb_head = BPF_CORE_READ(skb, head);
+	u16 l3_off = BPF_CORE_READ(skb, network_header);
+	u16 l4_off = BPF_CORE_READ(skb, transport_header);
+
+	set_tuple_headers(skb_head, l3_off, l4_off, tpl);
+	set_tunnel_headers(skb_head, l3_off, l4_off, tun);
+}
+
+static __always_inline void
+set_eth(struct sk_buff *skb, struct l2_hdr *eth) {
+	u16 mac_off = BPF_CORE_READ(skb, mac_header);
+
+	/* skb_mac_header_was_set() */
+	if (mac_off == (u16) ~0U) {
+		return;
+	}
+
+	void *skb_head = BPF_CORE_READ(skb, head);
+	bpf_probe_read_kernel(eth, sizeof(*eth), skb_head + mac_off);
+}
+
+static __always_inline void
+set_sk_info(struct sock *sk, struct sock_info *info) {
+	info->addr = (u64) sk;
+	info->cookie = BPF_CORE_READ(sk, __sk_common.skc_cookie.counter);
+	info->state = BPF_CORE_READ(sk, __sk_common.skc_state);
+	/* Only the struct sock_common is there for the request and timewait
+	 * sockets, which are TCP ones */
+	info->uid = (u32) -1;
+	info->gid = (u32) -1;
+	if (info->state == TCP_TIME_WAIT || info->state == TCP_NEW_SYN_RECV) {
+		info->protocol = IPPROTO_TCP;
+		return;
+	}
+
+	info->protocol = BPF_CORE_READ_BITFIELD_PROBED(sk, sk_protocol);
+	info->uid = BPF_CORE_READ(sk, sk_uid.val);
+	const struct cred *cred = BPF_CORE_READ(sk, sk_socket, file, f_cred);
+	if (cred) {
+		info->gid = BPF_CORE_READ(cred, fsgid.val);
+	}
+}
+
+static __always_inline void
+set_sock(struct sk_buff *skb, struct sock_info *info) {
+	struct sock *sk = BPF_CORE_READ(skb, sk);
+	if (!sk) {
+		return;
+	}
+
+	set_sk_info(sk, info);
+}
+
+static __always_inline void
+set_conntrack(struct sk_buff *skb, struct ct_info *ct) {
+	unsigned long nfct = BPF_CORE_READ(skb, _nfct);
+	if (!nfct) {
+		ct->ctinfo = CT_NONE;
+		return;
+	}
+
+	ct->ctinfo = nfct & NFCT_INFOMASK;
+	if (ct->ctinfo == IP_CT_UNTRACKED) {
+		return;
+	}
+
+	struct nf_conn *conn = (void *) (nfct & ~NFCT_INFOMASK);
+	/* CONFIG_NF_CONNTRACK_ZONES and CONFIG_NF_CONNTRACK_MARK */
+	if (bpf_core_field_exists(conn->zone)) {
+		ct->zone = BPF_CORE_READ(conn, zone.id);
+	}
+	if (bpf_core_field_exists(conn->mark)) {
+		ct->mark = BPF_CORE_READ(conn, mark);
+	}
+}
+
+/*
+ * The gateway of the IPv4 routes is only known since 5.2, when they got IPv6
+ * gateways. The IPv4 routes do not keep their table.
+ */
+static __always_inline void
+set_route(struct sk_buff *skb, struct pwru_route *route) {
+	unsigned long refdst = BPF_CORE_READ(skb, _skb_refdst);
+	struct dst_entry *dst = (void *) (refdst & SKB_DST_PTRMASK);
+	if (!dst) {
+		return;
+	}
+
+	struct net_device *dev = BPF_CORE_READ(dst, dev);
+	if (!dev) {
+		return;
+	}
+	route->netns = BPF_CORE_READ(dev, nd_net.net, ns.inum);
+	route->ifindex = BPF_CORE_READ(dev, ifindex);
+	BPF_CORE_READ_STR_INTO(&route->ifname, dev, name);
+
+	u16 family = BPF_CORE_READ(dst, ops, family);
+	if (family == AF_INET) {
+		struct rtable *rt = (void *) dst;
+		route->type = BPF_CORE_READ(rt, rt_type);
+		if (!bpf_core_field_exists(rt->rt_gw_family)) {
+			return;
+		}
+		u8 gw_family = BPF_CORE_READ(rt, rt_gw_family);
+		if (gw_family == AF_INET) {
+			route->gw_proto = ETH_P_IP;
+			route->gw.v4addr = BPF_CORE_READ(rt, rt_gw4);
+		} else if (gw_family == AF_INET6) {
+			union addr gw = {};
+			BPF_CORE_READ_INTO(&gw, rt, rt_gw6);
+			route->gw_proto = ETH_P_IPV6;
+			route->gw = gw;
+		}
+	} else if (family == AF_INET6) {
+		struct rt6_info *rt = (void *) dst;
+		union addr gw = {};
+		BPF_CORE_READ_INTO(&gw, rt, rt6i_gateway);
+		if (gw.v6addr.d1 || gw.v6addr.d2) {
+			route->gw_proto = ETH_P_IPV6;
+			route->gw = gw;
+		}
+		struct fib6_info *from = BPF_CORE_READ(rt, from);
+		if (from) {
+			route->type = BPF_CORE_READ(from, fib6_type);
+			route->table = BPF_CORE_READ(from, fib6_table, tb6_id);
+		}
 	}
 }
 
@@ -324,7 +1433,31 @@ set_output(struct pt_regs *ctx, struct sk_buff *skb, struct event_t *event, stru
 	}
 
 	if (cfg->output_tuple) {
-		set_tuple(skb, &event->tuple);
+		set_tuple(skb, &event->tuple, &event->tunnel);
+	}
+
+	if (cfg->output_eth) {
+		set_eth(skb, &event->eth);
+	}
+
+	if (cfg->output_sock) {
+		set_sock(skb, &event->sk);
+	}
+
+	if (cfg->output_conntrack) {
+		set_conntrack(skb, &event->ct);
+	}
+
+	if (cfg->output_route) {
+		set_route(skb, &event->route);
+	}
+
+	if (cfg->track_clones) {
+		u64 skb_addr = (u64) skb;
+		u64 *parent = bpf_map_lookup_elem(&skb_parents, &skb_addr);
+		if (parent) {
+			event->parent_addr = *parent;
+		}
 	}
 
 	if (cfg->output_skb) {
@@ -336,15 +1469,306 @@ set_output(struct pt_regs *ctx, struct sk_buff *skb, struct event_t *event, stru
 	}
 }
 
+/*
+ * Emit the event followed by the linear packet data starting at the network
+ * header, truncated to cfg->capture_len bytes.
+ */
+static __always_inline void
+output_event(void *ctx, void *data, u64 size) {
+	if (use_ringbuf) {
+		if (bpf_ringbuf_output(&events_rb, data, size, 0) < 0) {
+			u32 index = 0;
+			u64 *lost = bpf_map_lookup_elem(&lost_events, &index);
+			if (lost) {
+				(*lost)++;
+			}
+		}
+	} else {
+		bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, data, size);
+	}
+}
+
+static __always_inline void
+output_capture(struct pt_regs *ctx, struct sk_buff *skb, struct event_t *event, struct config *cfg) {
+	u32 index = 0;
+	struct packet_capture *buf = bpf_map_lookup_elem(&capture_buf, &index);
+	if (!buf) {
+		return;
+	}
+
+	void *skb_head = BPF_CORE_READ(skb, head);
+	void *skb_data = BPF_CORE_READ(skb, data);
+	u16 l3_off = BPF_CORE_READ(skb, network_header);
+	u32 tail = BPF_CORE_READ(skb, tail);
+	u32 len = 0;
+
+	__builtin_memcpy(&buf->event, event, sizeof(*event));
+	buf->pkt_len = 0;
+
+	if (l3_off != (u16) ~0U && tail > l3_off) {
+		buf->pkt_len = BPF_CORE_READ(skb, len) + (skb_data - skb_head) - l3_off;
+		len = tail - l3_off;
+		if (len > cfg->capture_len) {
+			len = cfg->capture_len;
+		}
+		/* capture_len is always below MAX_CAPTURE_LEN, the mask only
+		 * bounds len for the verifier */
+		len &= MAX_CAPTURE_LEN - 1;
+		if (bpf_probe_read_kernel(buf->data, len, skb_head + l3_off) < 0) {
+			len = 0;
+		}
+	}
+	buf->cap_len = len;
+
+	output_event(ctx, buf, offsetof(struct packet_capture, data) + len);
+}
+
+/*
+ * Return the address of the data of the fragment in the direct mapping of
+ * the physical memory, i.e. page_address(). Only the x86_64 layout is
+ * known, for which userspace passes the addresses of the variables set at
+ * boot.
+ */
+static __always_inline void *
+frag_address(skb_frag_t *frag, struct config *cfg, u32 *len) {
+	struct page *page;
+	u32 offset;
+
+	if (bpf_core_type_exists(struct skb_frag___netmem)) {
+		struct skb_frag___netmem *f = (void *) frag;
+		/* The low bit tags the net_iov (devmem) fragments, not backed by
+		 * pages */
+		unsigned long netmem = BPF_CORE_READ(f, netmem);
+		if (netmem & 1) {
+			return NULL;
+		}
+		page = (void *) netmem;
+		*len = BPF_CORE_READ(f, len);
+		offset = BPF_CORE_READ(f, offset);
+	} else {
+		page = BPF_CORE_READ(frag, bv_page);
+		*len = BPF_CORE_READ(frag, bv_len);
+		offset = BPF_CORE_READ(frag, bv_offset);
+	}
+
+	u64 page_offset_base, vmemmap_base;
+	if (!cfg->page_offset_base || !cfg->vmemmap_base ||
+	    bpf_probe_read_kernel(&page_offset_base, sizeof(u64), (void *) cfg->page_offset_base) < 0 ||
+	    bpf_probe_read_kernel(&vmemmap_base, sizeof(u64), (void *) cfg->vmemmap_base) < 0) {
+		return NULL;
+	}
+	u64 pfn = ((u64) page - vmemmap_base) / bpf_core_type_size(struct page);
+	return (void *) (page_offset_base + (pfn << X86_PAGE_SHIFT) + offset);
+}
+
+/*
+ * Same as output_capture(), followed by the data of the first
+ * MAX_CAPTURE_FRAGS page fragments, up to MAX_FULL_CAPTURE_LEN bytes. The
+ * frag_list of GRO packets is not followed.
+ */
+static __always_inline void
+output_full_capture(struct pt_regs *ctx, struct sk_buff *skb, struct event_t *event, struct config *cfg) {
+	u32 index = 0;
+	struct packet_full_capture *buf = bpf_map_lookup_elem(&full_capture_buf, &index);
+	if (!buf) {
+		return;
+	}
+
+	void *skb_head = BPF_CORE_READ(skb, head);
+	void *skb_data = BPF_CORE_READ(skb, data);
+	u16 l3_off = BPF_CORE_READ(skb, network_header);
+	u32 tail = BPF_CORE_READ(skb, tail);
+	u32 len = 0;
+
+	__builtin_memcpy(&buf->event, event, sizeof(*event));
+	buf->pkt_len = 0;
+
+	if (l3_off != (u16) ~0U && tail > l3_off) {
+		buf->pkt_len = BPF_CORE_READ(skb, len) + (skb_data - skb_head) - l3_off;
+		len = tail - l3_off;
+		if (len > MAX_FULL_CAPTURE_LEN) {
+			len = MAX_FULL_CAPTURE_LEN;
+		}
+		if (bpf_probe_read_kernel(buf->data, len, skb_head + l3_off) < 0) {
+			len = 0;
+		}
+	}
+
+	struct skb_shared_info *shinfo = skb_head + BPF_CORE_READ(skb, end);
+	u8 nr_frags = BPF_CORE_READ(shinfo, nr_frags);
+
+	#pragma unroll
+	for (int i = 0; i < MAX_CAPTURE_FRAGS; i++) {
+		if (i >= nr_frags || !len || len >= MAX_FULL_CAPTURE_LEN) {
+			break;
+		}
+
+		u32 frag_len;
+		void *addr = frag_address(&shinfo->frags[i], cfg, &frag_len);
+		if (!addr) {
+			break;
+		}
+		if (frag_len > MAX_FULL_CAPTURE_LEN - len) {
+			frag_len = MAX_FULL_CAPTURE_LEN - len;
+		}
+		/* Both are below MAX_FULL_CAPTURE_LEN, which the verifier
+		 * knows from the checks */
+		if (len > MAX_FULL_CAPTURE_LEN || frag_len > MAX_FULL_CAPTURE_LEN ||
+		    bpf_probe_read_kernel(buf->data + len, frag_len, addr) < 0) {
+			break;
+		}
+		len += frag_len;
+	}
+	if (len > MAX_FULL_CAPTURE_LEN) {
+		len = MAX_FULL_CAPTURE_LEN;
+	}
+	buf->cap_len = len;
+
+	output_event(ctx, buf, offsetof(struct packet_full_capture, data) + len);
+}
+
+/*
+ * All idle tasks have pid 0, so use the CPU id to tell them apart.
+ */
+static __always_inline u64
+get_ret_stack_key(void) {
+	u64 pid_tgid = bpf_get_current_pid_tgid();
+	if ((u32) pid_tgid == 0) {
+		return (1ULL << 63) | bpf_get_smp_processor_id();
+	}
+	return pid_tgid;
+}
+
+static __always_inline bool
+output_return(struct config *cfg) {
+	return cfg->output_retval || cfg->output_latency;
+}
+
+static __always_inline bool
+track_return(struct config *cfg) {
+	return output_return(cfg) || cfg->latency_hist;
+}
+
+static __always_inline void
+aggregate_event(struct event_t *event) {
+	struct aggregate_key key = {
+		.addr = event->addr,
+		.sport = event->tuple.sport,
+		.dport = event->tuple.dport,
+		.l3_proto = event->tuple.l3_proto,
+		.l4_proto = event->tuple.l4_proto,
+		.type = event->type,
+		.netns = event->meta.netns,
+	};
+	u64 one = 1;
+
+	__builtin_memcpy(&key.saddr, &event->tuple.saddr, sizeof(key.saddr));
+	__builtin_memcpy(&key.daddr, &event->tuple.daddr, sizeof(key.daddr));
+
+	u64 *count = bpf_map_lookup_elem(&aggregates, &key);
+	if (count) {
+		(*count)++;
+	} else {
+		/* The new flows aren't counted once the map is full */
+		bpf_map_update_elem(&aggregates, &key, &one, BPF_NOEXIST);
+	}
+}
+
+/* Outputs the event, or only counts it with --aggregate */
+static __always_inline void
+emit_event(void *ctx, struct event_t *event) {
+	u32 index = 0;
+	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+
+	if (cfg && cfg->aggregate) {
+		aggregate_event(event);
+		return;
+	}
+	output_event(ctx, event, sizeof(*event));
+}
+
+/* The slot of v in latency_hists, from its log2 computed without loops */
+static __always_inline u32
+log2_slot(u64 v) {
+	u32 r, shift;
+
+	if (!v) {
+		return 0;
+	}
+	r = (v > 0xFFFFFFFF) << 5;
+	v >>= r;
+	shift = (v > 0xFFFF) << 4;
+	v >>= shift;
+	r |= shift;
+	shift = (v > 0xFF) << 3;
+	v >>= shift;
+	r |= shift;
+	shift = (v > 0xF) << 2;
+	v >>= shift;
+	r |= shift;
+	shift = (v > 0x3) << 1;
+	v >>= shift;
+	r |= shift;
+	r |= (v >> 1);
+	return r + 1;
+}
+
+static __always_inline void
+count_latency(u64 addr, u64 duration) {
+	struct latency_hist_key key = {
+		.addr = addr,
+		.slot = log2_slot(duration),
+	};
+	u64 one = 1;
+
+	u64 *count = bpf_map_lookup_elem(&latency_hists, &key);
+	if (count) {
+		__sync_fetch_and_add(count, 1);
+	} else if (bpf_map_update_elem(&latency_hists, &key, &one, BPF_NOEXIST)) {
+		/* Created by another CPU in the meantime */
+		count = bpf_map_lookup_elem(&latency_hists, &key);
+		if (count) {
+			__sync_fetch_and_add(count, 1);
+		}
+	}
+}
+
+static __always_inline void
+push_ret(u64 skb, u64 addr, u64 ts) {
+	u64 key = get_ret_stack_key();
+	struct ret_stack *stack = bpf_map_lookup_elem(&ret_stacks, &key);
+	if (!stack) {
+		struct ret_stack empty = {};
+		bpf_map_update_elem(&ret_stacks, &key, &empty, BPF_NOEXIST);
+		stack = bpf_map_lookup_elem(&ret_stacks, &key);
+		if (!stack) {
+			return;
+		}
+	}
+
+	u32 depth = stack->depth;
+	if (depth < MAX_RET_DEPTH) {
+		stack->entries[depth].skb = skb;
+		stack->entries[depth].addr = addr;
+		stack->entries[depth].ts = ts;
+	}
+	stack->depth = depth + 1;
+}
+
 static __always_inline int
-handle_everything(struct sk_buff *skb, struct pt_regs *ctx, bool has_get_func_ip) {
+handle_everything(struct sk_buff *skb, struct pt_regs *ctx, bool has_get_func_ip, u64 param_next) {
 	struct event_t event = {};
 
 	u32 index = 0;
 	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
 
+	event.addr = has_get_func_ip ? bpf_get_func_ip(ctx) : PT_REGS_IP(ctx);
+
 	if (cfg) {
 		if (!filter(skb, cfg)) {
+			if (track_return(cfg)) {
+				push_ret(0, 0, 0);
+			}
 			return 0;
 		}
 
@@ -352,29 +1776,318 @@ handle_everything(struct sk_buff *skb, struct pt_regs *ctx, bool has_get_func_ip
 	}
 
 	event.pid = bpf_get_current_pid_tgid();
-	event.addr = has_get_func_ip ? bpf_get_func_ip(ctx) : PT_REGS_IP(ctx);
 	event.skb_addr = (u64) skb;
 	event.ts = bpf_ktime_get_ns();
+
+	if (cfg && track_return(cfg)) {
+		push_ret((u64) skb, event.addr, event.ts);
+	}
+	if (cfg && cfg->aggregate) {
+		aggregate_event(&event);
+		return 0;
+	}
+	/* Only the returns are reported with the latency */
+	if (cfg && (cfg->output_latency || cfg->latency_hist)) {
+		return 0;
+	}
 	event.cpu_id = bpf_get_smp_processor_id();
+	event.param_next = param_next;
+
+	if (cfg && cfg->capture_full) {
+		output_full_capture(ctx, skb, &event, cfg);
+		return 0;
+	}
+	if (cfg && cfg->capture_len) {
+		output_capture(ctx, skb, &event, cfg);
+		return 0;
+	}
 
-	bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &event, sizeof(event));
+	output_event(ctx, &event, sizeof(event));
 
 	return 0;
 }
 
-#ifdef HAS_KPROBE_MULTI
-#define PWRU_KPROBE_TYPE "kprobe.multi"
-#define PWRU_HAS_GET_FUNC_IP true
-#else
-#define PWRU_KPROBE_TYPE "kprobe"
-#define PWRU_HAS_GET_FUNC_IP false
+static __always_inline int
+handle_return(void *ctx, u64 retval) {
+	struct event_t event = {};
+	u64 key = get_ret_stack_key();
+	u32 index = 0;
+
+	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+	if (!cfg) {
+		return 0;
+	}
+
+	struct ret_stack *stack = bpf_map_lookup_elem(&ret_stacks, &key);
+	if (!stack || stack->depth == 0) {
+		return 0;
+	}
+
+	u32 depth = stack->depth - 1;
+	stack->depth = depth;
+	if (depth >= MAX_RET_DEPTH) {
+		return 0;
+	}
+
+	event.skb_addr = stack->entries[depth].skb;
+	if (!event.skb_addr) {
+		return 0;
+	}
+
+	event.ts = bpf_ktime_get_ns();
+	event.duration = event.ts - stack->entries[depth].ts;
+	if (cfg->latency_hist) {
+		count_latency(stack->entries[depth].addr, event.duration);
+	}
+	if (!output_return(cfg)) {
+		return 0;
+	}
+	if (cfg->latency_threshold && event.duration < cfg->latency_threshold) {
+		return 0;
+	}
+
+	event.type = EVENT_TYPE_RETURN;
+	event.addr = stack->entries[depth].addr;
+	event.pid = bpf_get_current_pid_tgid();
+	event.cpu_id = bpf_get_smp_processor_id();
+	event.param_next = retval;
+
+	emit_event(ctx, &event);
+
+	return 0;
+}
+
+/* Must match the tracepoints in internal/pwru/tracepoint.go */
+#define TP_KFREE_SKB          1
+#define TP_NET_DEV_XMIT       2
+#define TP_NETIF_RECEIVE_SKB  3
+#define TP_NAPI_POLL          4
+#define TP_FIB_TABLE_LOOKUP   5
+
+/*
+ * The tracepoints are reported as the functions, with the tracepoint in
+ * place of the address. There is no return to track.
+ */
+static __always_inline int
+handle_tp(void *ctx, struct sk_buff *skb, u32 tp, u64 param_next) {
+	struct event_t event = {};
+	u32 index = 0;
+
+	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+	if (!cfg || !filter(skb, cfg)) {
+		return 0;
+	}
+
+	set_output(ctx, skb, &event, cfg);
+	event.type = EVENT_TYPE_TRACEPOINT;
+	event.addr = tp;
+	event.pid = bpf_get_current_pid_tgid();
+	event.skb_addr = (u64) skb;
+	event.ts = bpf_ktime_get_ns();
+	event.cpu_id = bpf_get_smp_processor_id();
+	event.param_next = param_next;
+
+	if (cfg->aggregate) {
+		aggregate_event(&event);
+		return 0;
+	}
+	if (cfg->capture_full) {
+		output_full_capture(ctx, skb, &event, cfg);
+		return 0;
+	}
+	if (cfg->capture_len) {
+		output_capture(ctx, skb, &event, cfg);
+		return 0;
+	}
+
+	output_event(ctx, &event, sizeof(event));
+
+	return 0;
+}
+
+#ifndef USE_FENTRY
+
+/* kfree_skb(struct sk_buff *skb, void *location,
+ *           enum skb_drop_reason reason), since 5.17 */
+SEC("raw_tracepoint/kfree_skb")
+int raw_tp_kfree_skb(struct bpf_raw_tracepoint_args *ctx) {
+	return handle_tp(ctx, (struct sk_buff *) ctx->args[0], TP_KFREE_SKB, ctx->args[2]);
+}
+
+/* net_dev_xmit(struct sk_buff *skb, int rc, struct net_device *dev,
+ *              unsigned int skb_len) */
+SEC("raw_tracepoint/net_dev_xmit")
+int raw_tp_net_dev_xmit(struct bpf_raw_tracepoint_args *ctx) {
+	return handle_tp(ctx, (struct sk_buff *) ctx->args[0], TP_NET_DEV_XMIT, (s32) ctx->args[1]);
+}
+
+/* netif_receive_skb(struct sk_buff *skb) */
+SEC("raw_tracepoint/netif_receive_skb")
+int raw_tp_netif_receive_skb(struct bpf_raw_tracepoint_args *ctx) {
+	return handle_tp(ctx, (struct sk_buff *) ctx->args[0], TP_NETIF_RECEIVE_SKB, 0);
+}
+
+/*
+ * napi_poll(struct napi_struct *napi, int work, int budget) has no skb, so
+ * only the device and the number of packets processed are reported. Only the
+ * task and device filters apply.
+ */
+SEC("raw_tracepoint/napi_poll")
+int raw_tp_napi_poll(struct bpf_raw_tracepoint_args *ctx) {
+	struct event_t event = {};
+	u32 index = 0;
+
+	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+	if (!cfg || !config_tuple_empty(cfg) || cfg->filter_pcap || cfg->mark_mask ||
+	    cfg->filter_vlan || cfg->len_min || cfg->len_max || cfg->filter_mpls ||
+	    !filter_task(cfg)) {
+		return 0;
+	}
+
+	struct napi_struct *napi = (struct napi_struct *) ctx->args[0];
+	struct net_device *dev = BPF_CORE_READ(napi, dev);
+	u32 netns = BPF_CORE_READ(dev, nd_net.net, ns.inum);
+	u32 ifindex = BPF_CORE_READ(dev, ifindex);
+	if ((cfg->netns && netns != cfg->netns) || (cfg->ifindex && ifindex != cfg->ifindex)) {
+		return 0;
+	}
+
+	if (cfg->output_meta) {
+		event.meta.netns = netns;
+		event.meta.ifindex = ifindex;
+		event.meta.mtu = BPF_CORE_READ(dev, mtu);
+		BPF_CORE_READ_STR_INTO(&event.meta.ifname, dev, name);
+	}
+	if (cfg->output_stack) {
+		event.print_stack_id = bpf_get_stackid(ctx, &print_stack_map, BPF_F_FAST_STACK_CMP);
+	}
+	event.type = EVENT_TYPE_TRACEPOINT;
+	event.addr = TP_NAPI_POLL;
+	event.pid = bpf_get_current_pid_tgid();
+	/* Not the napi, which would be tracked as an skb never freed */
+	event.skb_addr = 0;
+	event.ts = bpf_ktime_get_ns();
+	event.cpu_id = bpf_get_smp_processor_id();
+	event.param_next = (s32) ctx->args[1];
+
+	emit_event(ctx, &event);
+
+	return 0;
+}
+
+/*
+ * fib_table_lookup(u32 tb_id, const struct flowi4 *flp,
+ *                  const struct fib_nh_common *nhc, int err) has no skb
+ * either, so the selected nexthop is reported instead, with the flow in the
+ * tuple and the nexthop in the route. The task, netns, mark, ifindex (of the
+ * output device) and IPv4 address and protocol filters apply to it.
+ */
+SEC("raw_tracepoint/fib_table_lookup")
+int raw_tp_fib_table_lookup(struct bpf_raw_tracepoint_args *ctx) {
+	struct event_t event = {};
+	u32 index = 0;
+
+	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+	if (!cfg || cfg->ipv6 || cfg->sport.max || cfg->dport.max || cfg->port.max ||
+	    cfg->filter_icmp || cfg->tcp_flags_mask || cfg->filter_dscp || cfg->spi ||
+	    cfg->filter_pcap || cfg->filter_vlan || cfg->len_min || cfg->len_max ||
+	    cfg->filter_mpls || !filter_task(cfg)) {
+		return 0;
+	}
+
+	struct flowi4 *flp = (struct flowi4 *) ctx->args[1];
+	union addr saddr = {}, daddr = {};
+	saddr.v4addr = BPF_CORE_READ(flp, saddr);
+	daddr.v4addr = BPF_CORE_READ(flp, daddr);
+	u8 l4_proto = BPF_CORE_READ(flp, __fl_common.flowic_proto);
+	u32 mark = BPF_CORE_READ(flp, __fl_common.flowic_mark);
+	if ((cfg->filter_saddr && !addr_in_prefix(&saddr_lpm, &saddr, 32)) ||
+	    (cfg->filter_daddr && !addr_in_prefix(&daddr_lpm, &daddr, 32)) ||
+	    (cfg->l4_proto && l4_proto != cfg->l4_proto) ||
+	    (cfg->mark_mask && (mark & cfg->mark_mask) != cfg->mark)) {
+		return 0;
+	}
+
+	/* The nexthop is only set if the lookup succeeded */
+	struct fib_nh_common *nhc = (struct fib_nh_common *) ctx->args[2];
+	struct net_device *dev = nhc ? BPF_CORE_READ(nhc, nhc_dev) : NULL;
+	struct pwru_route *route = &event.route;
+	if (dev) {
+		route->netns = BPF_CORE_READ(dev, nd_net.net, ns.inum);
+		route->ifindex = BPF_CORE_READ(dev, ifindex);
+		BPF_CORE_READ_STR_INTO(&route->ifname, dev, name);
+	}
+	if ((cfg->netns && route->netns != cfg->netns) || (cfg->ifindex && route->ifindex != cfg->ifindex)) {
+		return 0;
+	}
+	if (nhc) {
+		u8 gw_family = BPF_CORE_READ(nhc, nhc_gw_family);
+		if (gw_family == AF_INET) {
+			route->gw_proto = ETH_P_IP;
+			route->gw.v4addr = BPF_CORE_READ(nhc, nhc_gw.ipv4);
+		} else if (gw_family == AF_INET6) {
+			union addr gw = {};
+			BPF_CORE_READ_INTO(&gw, nhc, nhc_gw.ipv6);
+			route->gw_proto = ETH_P_IPV6;
+			route->gw = gw;
+		}
+	}
+	route->table = (u32) ctx->args[0];
+
+	if (cfg->output_tuple) {
+		event.tuple.saddr = saddr;
+		event.tuple.daddr = daddr;
+		event.tuple.l3_proto = ETH_P_IP;
+		event.tuple.l4_proto = l4_proto;
+		if (l4_proto == IPPROTO_TCP || l4_proto == IPPROTO_UDP || l4_proto == IPPROTO_SCTP) {
+			event.tuple.sport = BPF_CORE_READ(flp, uli.ports.sport);
+			event.tuple.dport = BPF_CORE_READ(flp, uli.ports.dport);
+		}
+	}
+	if (cfg->output_meta) {
+		event.meta.netns = route->netns;
+		event.meta.mark = mark;
+	}
+	if (cfg->output_stack) {
+		event.print_stack_id = bpf_get_stackid(ctx, &print_stack_map, BPF_F_FAST_STACK_CMP);
+	}
+	event.type = EVENT_TYPE_TRACEPOINT;
+	event.addr = TP_FIB_TABLE_LOOKUP;
+	event.pid = bpf_get_current_pid_tgid();
+	/* Not the nexthop, which is shared by the flows, and NULL if the
+	 * lookup failed */
+	event.skb_addr = 0;
+	event.ts = bpf_ktime_get_ns();
+	event.cpu_id = bpf_get_smp_processor_id();
+	event.param_next = (s32) ctx->args[3];
+
+	emit_event(ctx, &event);
+
+	return 0;
+}
+
+#ifdef HAS_KPROBE_MULTI
+#define PWRU_KPROBE_TYPE "kprobe.multi"
+#define PWRU_KRETPROBE_TYPE "kretprobe.multi"
+#define PWRU_HAS_GET_FUNC_IP true
+#else
+#define PWRU_KPROBE_TYPE "kprobe"
+#define PWRU_KRETPROBE_TYPE "kretprobe"
+#define PWRU_HAS_GET_FUNC_IP false
 #endif /* HAS_KPROBE_MULTI */
 
+#define PWRU_PARM_NEXT_1(x) PT_REGS_PARM2(x)
+#define PWRU_PARM_NEXT_2(x) PT_REGS_PARM3(x)
+#define PWRU_PARM_NEXT_3(x) PT_REGS_PARM4(x)
+#define PWRU_PARM_NEXT_4(x) PT_REGS_PARM5(x)
+#define PWRU_PARM_NEXT_5(x) 0
+
 #define PWRU_ADD_KPROBE(X)                                                     \
   SEC(PWRU_KPROBE_TYPE "/skb-" #X)                                             \
   int kprobe_skb_##X(struct pt_regs *ctx) {                                    \
     struct sk_buff *skb = (struct sk_buff *) PT_REGS_PARM##X(ctx);             \
-    return handle_everything(skb, ctx, PWRU_HAS_GET_FUNC_IP);                  \
+    return handle_everything(skb, ctx, PWRU_HAS_GET_FUNC_IP,                   \
+                             (u64) PWRU_PARM_NEXT_##X(ctx));                   \
   }
 
 PWRU_ADD_KPROBE(1)
@@ -383,8 +2096,699 @@ PWRU_ADD_KPROBE(3)
 PWRU_ADD_KPROBE(4)
 PWRU_ADD_KPROBE(5)
 
+/*
+ * The functions of --trace-nested-skb receive a pointer to the skb pointer,
+ * e.g. a struct sk_buff ** or a struct with an skb member, whose offset is
+ * the cookie of the probe. bpf_get_attach_cookie() requires >= 5.15, so the
+ * programs are only verified if the flag is set, as for use_ringbuf.
+ */
+volatile const bool nested_skb = false;
+
+static __always_inline int
+handle_nested(void *pskb, struct pt_regs *ctx, bool has_get_func_ip, u64 param_next) {
+	struct sk_buff *skb = NULL;
+
+	bpf_probe_read_kernel(&skb, sizeof(skb), pskb);
+	if (!skb) {
+		u32 index = 0;
+		struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+
+		if (cfg && track_return(cfg)) {
+			push_ret(0, 0, 0);
+		}
+		return 0;
+	}
+
+	return handle_everything(skb, ctx, has_get_func_ip, param_next);
+}
+
+#define PWRU_ADD_KPROBE_NESTED(X)                                              \
+  SEC(PWRU_KPROBE_TYPE "/skb-nested-" #X)                                      \
+  int kprobe_skb_nested_##X(struct pt_regs *ctx) {                             \
+    if (!nested_skb) {                                                         \
+      return 0;                                                                \
+    }                                                                          \
+    void *arg = (void *) PT_REGS_PARM##X(ctx);                                 \
+    return handle_nested(arg + bpf_get_attach_cookie(ctx), ctx,                \
+                         PWRU_HAS_GET_FUNC_IP, (u64) PWRU_PARM_NEXT_##X(ctx)); \
+  }
+
+PWRU_ADD_KPROBE_NESTED(1)
+PWRU_ADD_KPROBE_NESTED(2)
+PWRU_ADD_KPROBE_NESTED(3)
+PWRU_ADD_KPROBE_NESTED(4)
+PWRU_ADD_KPROBE_NESTED(5)
+
+/*
+ * Set the tuple of the socket from the local side to the remote one, e.g.
+ * with the bound address and the port of a listening socket.
+ */
+static __always_inline void
+set_sk_tuple(struct sock *sk, u8 l4_proto, struct tuple *tpl) {
+	u16 family = BPF_CORE_READ(sk, __sk_common.skc_family);
+
+	if (family == AF_INET) {
+		BPF_CORE_READ_INTO(&tpl->saddr.v4addr, sk, __sk_common.skc_rcv_saddr);
+		BPF_CORE_READ_INTO(&tpl->daddr.v4addr, sk, __sk_common.skc_daddr);
+		tpl->l3_proto = ETH_P_IP;
+	} else if (family == AF_INET6) {
+		BPF_CORE_READ_INTO(&tpl->saddr, sk, __sk_common.skc_v6_rcv_saddr);
+		BPF_CORE_READ_INTO(&tpl->daddr, sk, __sk_common.skc_v6_daddr);
+		tpl->l3_proto = ETH_P_IPV6;
+	} else {
+		return;
+	}
+	/* skc_num is in host byte order, unlike skc_dport */
+	tpl->sport = bpf_htons(BPF_CORE_READ(sk, __sk_common.skc_num));
+	tpl->dport = BPF_CORE_READ(sk, __sk_common.skc_dport);
+	tpl->l4_proto = l4_proto;
+}
+
+/*
+ * Filter the socket as the skbs, with the tuple from the local side: the
+ * filters of the skb fields other than the mark don't apply.
+ */
+static __always_inline bool
+filter_sk(struct sock *sk, struct tuple *tpl, struct config *cfg) {
+	if (!filter_sample((struct sk_buff *) sk, cfg) || !filter_task(cfg)) {
+		return false;
+	}
+	if (cfg->netns && BPF_CORE_READ(sk, __sk_common.skc_net.net, ns.inum) != cfg->netns) {
+		return false;
+	}
+	if (cfg->mark_mask && (BPF_CORE_READ(sk, sk_mark) & cfg->mark_mask) != cfg->mark) {
+		return false;
+	}
+
+	u16 l3_proto = tpl->l3_proto;
+	if (cfg->filter_saddr || cfg->filter_daddr) {
+		union addr saddr, daddr;
+		u32 prefixlen = 32;
+
+		if (l3_proto == ETH_P_IPV6) {
+			prefixlen = 128;
+		} else if (l3_proto != ETH_P_IP) {
+			return false;
+		}
+		if ((l3_proto == ETH_P_IPV6) != cfg->ipv6) {
+			return false;
+		}
+
+		__builtin_memcpy(&saddr, &tpl->saddr, sizeof(saddr));
+		__builtin_memcpy(&daddr, &tpl->daddr, sizeof(daddr));
+		if (cfg->filter_saddr && !addr_in_prefix(&saddr_lpm, &saddr, prefixlen)) {
+			return false;
+		}
+		if (cfg->filter_daddr && !addr_in_prefix(&daddr_lpm, &daddr, prefixlen)) {
+			return false;
+		}
+	}
+
+	if (cfg->l4_proto && tpl->l4_proto != cfg->l4_proto) {
+		return false;
+	}
+
+	u16 sport = bpf_ntohs(tpl->sport);
+	u16 dport = bpf_ntohs(tpl->dport);
+	if (cfg->sport.max && !port_in_range(sport, &cfg->sport)) {
+		return false;
+	}
+	if (cfg->dport.max && !port_in_range(dport, &cfg->dport)) {
+		return false;
+	}
+	if (cfg->port.max && !port_in_range(dport, &cfg->port) &&
+	    !port_in_range(sport, &cfg->port)) {
+		return false;
+	}
+	return true;
+}
+
+/*
+ * Report the functions receiving a socket with --type=sk, with the socket in
+ * place of the skb: its address is the one of the events, and its tuple and
+ * details are always set.
+ */
+static __always_inline int
+handle_sk(struct sock *sk, struct pt_regs *ctx, bool has_get_func_ip, u64 param_next) {
+	struct event_t event = {};
+	u32 index = 0;
+
+	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+	if (!cfg) {
+		return 0;
+	}
+
+	event.addr = has_get_func_ip ? bpf_get_func_ip(ctx) : PT_REGS_IP(ctx);
+	set_sk_info(sk, &event.sk);
+	u16 protocol = event.sk.protocol;
+	set_sk_tuple(sk, protocol, &event.tuple);
+
+	if (!filter_sk(sk, &event.tuple, cfg)) {
+		if (track_return(cfg)) {
+			push_ret(0, 0, 0);
+		}
+		return 0;
+	}
+
+	event.meta.netns = BPF_CORE_READ(sk, __sk_common.skc_net.net, ns.inum);
+	event.meta.mark = BPF_CORE_READ(sk, sk_mark);
+	if (cfg->output_stack) {
+		event.print_stack_id = bpf_get_stackid(ctx, &print_stack_map, BPF_F_FAST_STACK_CMP);
+	}
+
+	event.pid = bpf_get_current_pid_tgid();
+	event.skb_addr = (u64) sk;
+	event.ts = bpf_ktime_get_ns();
+
+	if (track_return(cfg)) {
+		push_ret((u64) sk, event.addr, event.ts);
+	}
+	if (cfg->aggregate) {
+		aggregate_event(&event);
+		return 0;
+	}
+	if (cfg->output_latency || cfg->latency_hist) {
+		return 0;
+	}
+	event.cpu_id = bpf_get_smp_processor_id();
+	event.param_next = param_next;
+
+	output_event(ctx, &event, sizeof(event));
+
+	return 0;
+}
+
+#define PWRU_ADD_KPROBE_SK(X)                                                  \
+  SEC(PWRU_KPROBE_TYPE "/sk-" #X)                                              \
+  int kprobe_sk_##X(struct pt_regs *ctx) {                                     \
+    struct sock *sk = (struct sock *) PT_REGS_PARM##X(ctx);                    \
+    return handle_sk(sk, ctx, PWRU_HAS_GET_FUNC_IP,                            \
+                     (u64) PWRU_PARM_NEXT_##X(ctx));                           \
+  }
+
+PWRU_ADD_KPROBE_SK(1)
+PWRU_ADD_KPROBE_SK(2)
+PWRU_ADD_KPROBE_SK(3)
+PWRU_ADD_KPROBE_SK(4)
+PWRU_ADD_KPROBE_SK(5)
+
+SEC(PWRU_KRETPROBE_TYPE "/skb")
+int kretprobe_skb(struct pt_regs *ctx) {
+	return handle_return(ctx, PT_REGS_RC(ctx));
+}
+
+/*
+ * The iptables and nftables types are defined by modules (x_tables and
+ * nf_tables), so the names are only read if they are built into the kernel.
+ * struct xt_table is in the arm64 vmlinux.h, hence the flavor.
+ */
+struct xt_table___pwru {
+	const char name[NF_NAME_LEN];
+} __attribute__((preserve_access_index));
+
+struct nft_table {
+	char *name;
+} __attribute__((preserve_access_index));
+
+struct nft_chain {
+	struct nft_table *table;
+	char *name;
+} __attribute__((preserve_access_index));
+
+/*
+ * The event of a netfilter function is emitted on its return, along with the
+ * verdict. In between, it is kept per task, as for the return values of
+ * --output-retval.
+ */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 8192);
+	__type(key, u64);
+	__type(value, struct event_t);
+} nf_events SEC(".maps");
+
+/* The table functions are called by nf_hook_slow() */
+static __always_inline u64
+nf_event_key(u8 kind) {
+	return get_ret_stack_key() | ((u64) kind << 56);
+}
+
+static __always_inline int
+handle_nf(struct pt_regs *ctx, struct sk_buff *skb, struct nf_hook_state *state, void *priv, u8 kind) {
+	struct event_t event = {};
+	u64 key = nf_event_key(kind);
+	u32 index = 0;
+
+	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+	if (!cfg || !filter(skb, cfg)) {
+		/* Don't report the verdict of a previous call on return */
+		bpf_map_delete_elem(&nf_events, &key);
+		return 0;
+	}
+
+	event.addr = PWRU_HAS_GET_FUNC_IP ? bpf_get_func_ip(ctx) : PT_REGS_IP(ctx);
+	set_output(ctx, skb, &event, cfg);
+	event.pid = bpf_get_current_pid_tgid();
+	event.skb_addr = (u64) skb;
+	event.ts = bpf_ktime_get_ns();
+	event.cpu_id = bpf_get_smp_processor_id();
+
+	event.nf.kind = kind;
+	event.nf.pf = BPF_CORE_READ(state, pf);
+	event.nf.hook = BPF_CORE_READ(state, hook);
+	if (kind == NF_KIND_XT_TABLE && bpf_core_type_exists(struct xt_table___pwru)) {
+		struct xt_table___pwru *table = priv;
+		BPF_CORE_READ_STR_INTO(&event.nf.table, table, name);
+	} else if (kind == NF_KIND_NFT_CHAIN && bpf_core_type_exists(struct nft_chain)) {
+		struct nft_chain *chain = priv;
+		bpf_probe_read_kernel_str(event.nf.chain, sizeof(event.nf.chain), BPF_CORE_READ(chain, name));
+		bpf_probe_read_kernel_str(event.nf.table, sizeof(event.nf.table), BPF_CORE_READ(chain, table, name));
+	}
+
+	bpf_map_update_elem(&nf_events, &key, &event, BPF_ANY);
+	return 0;
+}
+
+/* int nf_hook_slow(struct sk_buff *skb, struct nf_hook_state *state, ...) */
+SEC(PWRU_KPROBE_TYPE "/nf_hook_slow")
+int kprobe_nf_hook_slow(struct pt_regs *ctx) {
+	return handle_nf(ctx, (struct sk_buff *) PT_REGS_PARM1(ctx),
+			 (struct nf_hook_state *) PT_REGS_PARM2(ctx), NULL, NF_KIND_HOOK_SLOW);
+}
+
+/* unsigned int ipt_do_table(void *priv, struct sk_buff *skb,
+ *                           const struct nf_hook_state *state), since 5.16 */
+SEC(PWRU_KPROBE_TYPE "/xt_table")
+int kprobe_nf_xt_table(struct pt_regs *ctx) {
+	return handle_nf(ctx, (struct sk_buff *) PT_REGS_PARM2(ctx),
+			 (struct nf_hook_state *) PT_REGS_PARM3(ctx), (void *) PT_REGS_PARM1(ctx),
+			 NF_KIND_XT_TABLE);
+}
+
+/* unsigned int nft_do_chain_ipv4(void *priv, struct sk_buff *skb,
+ *                                const struct nf_hook_state *state) */
+SEC(PWRU_KPROBE_TYPE "/nft_chain")
+int kprobe_nf_nft_chain(struct pt_regs *ctx) {
+	return handle_nf(ctx, (struct sk_buff *) PT_REGS_PARM2(ctx),
+			 (struct nf_hook_state *) PT_REGS_PARM3(ctx), (void *) PT_REGS_PARM1(ctx),
+			 NF_KIND_NFT_CHAIN);
+}
+
+static __always_inline int
+handle_nf_ret(struct pt_regs *ctx, u8 kind) {
+	u64 key = nf_event_key(kind);
+
+	struct event_t *event = bpf_map_lookup_elem(&nf_events, &key);
+	if (!event) {
+		return 0;
+	}
+
+	event->nf.verdict = PT_REGS_RC(ctx);
+	event->duration = bpf_ktime_get_ns() - event->ts;
+	emit_event(ctx, event);
+	bpf_map_delete_elem(&nf_events, &key);
+
+	return 0;
+}
+
+SEC(PWRU_KRETPROBE_TYPE "/nf_hook_slow")
+int kretprobe_nf_hook_slow(struct pt_regs *ctx) {
+	return handle_nf_ret(ctx, NF_KIND_HOOK_SLOW);
+}
+
+SEC(PWRU_KRETPROBE_TYPE "/xt_table")
+int kretprobe_nf_xt_table(struct pt_regs *ctx) {
+	return handle_nf_ret(ctx, NF_KIND_XT_TABLE);
+}
+
+SEC(PWRU_KRETPROBE_TYPE "/nft_chain")
+int kretprobe_nf_nft_chain(struct pt_regs *ctx) {
+	return handle_nf_ret(ctx, NF_KIND_NFT_CHAIN);
+}
+
+/*
+ * All the XDP programs, attached in the driver or in the generic mode, are run
+ * through the XDP dispatcher, before any skb is allocated. It returns the
+ * verdict of the program, so the event is kept per CPU until the return, as
+ * XDP programs don't nest.
+ */
+struct {
+	__uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+	__uint(max_entries, 1);
+	__type(key, u32);
+	__type(value, struct event_t);
+} xdp_events SEC(".maps");
+
+/*
+ * Return the protocol of the frame at data, which starts with the Ethernet
+ * header and a VLAN tag at most, and set l3_off to the network header.
+ */
+static __always_inline u16
+xdp_eth_proto(void *data, u16 *l3_off) {
+	u16 off = ETH_HLEN;
+	u16 proto;
+
+	bpf_probe_read_kernel(&proto, sizeof(proto), data + offsetof(struct ethhdr, h_proto));
+	proto = bpf_ntohs(proto);
+	if (proto == ETH_P_8021Q || proto == ETH_P_8021AD) {
+		bpf_probe_read_kernel(&proto, sizeof(proto), data + off + 2);
+		proto = bpf_ntohs(proto);
+		off += 4;
+	}
+	*l3_off = off;
+	return proto;
+}
+
+/*
+ * Set the offsets of the L3 and L4 headers of the frame at data, as
+ * xdp_eth_proto(). Return false if it is neither IPv4 nor IPv6.
+ */
+static __always_inline bool
+xdp_offsets(void *data, u16 *l3_off, u16 *l4_off) {
+	u16 off;
+	u8 ip_vsn_ihl;
+	u16 proto = xdp_eth_proto(data, &off);
+
+	if (proto == ETH_P_IP) {
+		bpf_probe_read_kernel(&ip_vsn_ihl, sizeof(ip_vsn_ihl), data + off);
+		*l4_off = off + (ip_vsn_ihl & 0xf) * 4;
+	} else if (proto == ETH_P_IPV6) {
+		*l4_off = off + sizeof(struct ipv6hdr);
+	} else {
+		return false;
+	}
+	*l3_off = off;
+	return true;
+}
+
+static __always_inline bool
+filter_xdp(struct xdp_buff *xdp, struct config *cfg) {
+	/* The mark and the offloaded VLAN tag are set on the skb */
+	if (cfg->mark_mask || cfg->filter_vlan) {
+		return false;
+	}
+	/* The xdp_buff is usually on the stack of the driver, so the packets
+	 * are sampled at random rather than by address */
+	if (cfg->sample_rate > 1 && bpf_get_prandom_u32() % cfg->sample_rate) {
+		return false;
+	}
+	if (!filter_task(cfg)) {
+		return false;
+	}
+
+	struct net_device *dev = BPF_CORE_READ(xdp, rxq, dev);
+	if (cfg->netns && BPF_CORE_READ(dev, nd_net.net, ns.inum) != cfg->netns) {
+		return false;
+	}
+	if (cfg->ifindex && BPF_CORE_READ(dev, ifindex) != cfg->ifindex) {
+		return false;
+	}
+
+	void *data = BPF_CORE_READ(xdp, data);
+	void *data_end = BPF_CORE_READ(xdp, data_end);
+	/* As skb->len on receive, the length of the frame */
+	if (!filter_len(data_end - data, cfg)) {
+		return false;
+	}
+	if (cfg->filter_mpls) {
+		u16 l3_off;
+		u16 proto = xdp_eth_proto(data, &l3_off);
+
+		if (!filter_mpls(data + l3_off, proto, cfg)) {
+			return false;
+		}
+	}
+
+	if (config_tuple_empty(cfg) && !cfg->filter_pcap) {
+		return true;
+	}
+
+	u16 l3_off, l4_off;
+	if (!xdp_offsets(data, &l3_off, &l4_off) || data + l3_off >= data_end) {
+		return false;
+	}
+	if (!config_tuple_empty(cfg) && !filter_headers(data, l3_off, l4_off, cfg)) {
+		return false;
+	}
+
+	u32 len = data_end - data - l3_off;
+	return !cfg->filter_pcap || filter_pcap_data(data + l3_off, len, len);
+}
+
+static __always_inline void
+set_xdp_output(struct pt_regs *ctx, struct xdp_buff *xdp, struct event_t *event, struct config *cfg) {
+	void *data = BPF_CORE_READ(xdp, data);
+	struct net_device *dev = BPF_CORE_READ(xdp, rxq, dev);
+	u16 l3_off, l4_off;
+
+	if (cfg->output_meta) {
+		event->meta.netns = BPF_CORE_READ(dev, nd_net.net, ns.inum);
+		event->meta.ifindex = BPF_CORE_READ(dev, ifindex);
+		event->meta.mtu = BPF_CORE_READ(dev, mtu);
+		BPF_CORE_READ_STR_INTO(&event->meta.ifname, dev, name);
+		event->meta.len = BPF_CORE_READ(xdp, data_end) - data;
+		bpf_probe_read_kernel(&event->meta.protocol, sizeof(event->meta.protocol),
+				      data + offsetof(struct ethhdr, h_proto));
+		if (xdp_offsets(data, &l3_off, &l4_off)) {
+			event->meta.ip_version = get_ip_hdr(data + l3_off, &event->meta.tos,
+							    &event->meta.ttl);
+		} else if (is_mpls(xdp_eth_proto(data, &l3_off))) {
+			u32 lse[MAX_MPLS_LABELS];
+
+			event->meta.mpls_labels = get_mpls_labels(data + l3_off, lse);
+			__builtin_memcpy(event->meta.mpls_lse, lse, sizeof(lse));
+		}
+	}
+
+	if (cfg->output_tuple && xdp_offsets(data, &l3_off, &l4_off)) {
+		set_tuple_headers(data, l3_off, l4_off, &event->tuple);
+		set_tunnel_headers(data, l3_off, l4_off, &event->tunnel);
+	}
+
+	if (cfg->output_eth) {
+		bpf_probe_read_kernel(&event->eth, sizeof(event->eth), data);
+	}
+
+	if (cfg->output_stack) {
+		event->print_stack_id = bpf_get_stackid(ctx, &print_stack_map, BPF_F_FAST_STACK_CMP);
+	}
+}
+
+/* unsigned int bpf_dispatcher_xdp_func(const void *ctx,
+ *                                      const struct bpf_insn *insnsi,
+ *                                      bpf_func_t bpf_func) */
+SEC(PWRU_KPROBE_TYPE "/xdp")
+int kprobe_xdp(struct pt_regs *ctx) {
+	u32 index = 0;
+
+	struct event_t *event = bpf_map_lookup_elem(&xdp_events, &index);
+	if (!event) {
+		return 0;
+	}
+	/* Don't report the verdict of a previous run on return */
+	event->ts = 0;
+
+	struct xdp_buff *xdp = (struct xdp_buff *) PT_REGS_PARM1(ctx);
+	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+	if (!cfg || !filter_xdp(xdp, cfg)) {
+		return 0;
+	}
+
+	__builtin_memset(event, 0, sizeof(*event));
+	set_xdp_output(ctx, xdp, event, cfg);
+	event->type = EVENT_TYPE_XDP;
+	event->pid = bpf_get_current_pid_tgid();
+	/* Not the xdp_buff, which is reused for the next packets of the ring,
+	 * so that the event isn't tracked as an skb */
+	event->skb_addr = 0;
+	event->ts = bpf_ktime_get_ns();
+	event->cpu_id = bpf_get_smp_processor_id();
+
+	/* insnsi is the flexible array at the end of the program */
+	struct bpf_prog *prog = (void *) PT_REGS_PARM2(ctx) - bpf_core_field_offset(struct bpf_prog, insnsi);
+	event->xdp.prog_id = BPF_CORE_READ(prog, aux, id);
+	BPF_CORE_READ_STR_INTO(&event->xdp.prog_name, prog, aux, name);
+	event->xdp.rx_queue = BPF_CORE_READ(xdp, rxq, queue_index);
+
+	return 0;
+}
+
+SEC(PWRU_KRETPROBE_TYPE "/xdp")
+int kretprobe_xdp(struct pt_regs *ctx) {
+	u32 index = 0;
+
+	struct event_t *event = bpf_map_lookup_elem(&xdp_events, &index);
+	if (!event || !event->ts) {
+		return 0;
+	}
+
+	event->xdp.verdict = PT_REGS_RC(ctx);
+	emit_event(ctx, event);
+	event->ts = 0;
+
+	return 0;
+}
+
+/*
+ * The cls_bpf types are defined by the module, so their layout is hardcoded,
+ * until the fields used here, which have not moved since 4.1.
+ */
+struct cls_bpf_head {
+	struct list_head plist;
+};
+
+struct cls_bpf_prog {
+	struct bpf_prog *filter;
+	struct list_head link;
+};
+
+/* The event of the filter is emitted on its return, as for netfilter */
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__uint(max_entries, 8192);
+	__type(key, u64);
+	__type(value, struct event_t);
+} tc_events SEC(".maps");
+
+/* int cls_bpf_classify(struct sk_buff *skb, const struct tcf_proto *tp,
+ *                      struct tcf_result *res) */
+SEC(PWRU_KPROBE_TYPE "/cls_bpf_classify")
+int kprobe_tc(struct pt_regs *ctx) {
+	struct event_t event = {};
+	u64 key = get_ret_stack_key();
+	u32 index = 0;
+
+	struct sk_buff *skb = (struct sk_buff *) PT_REGS_PARM1(ctx);
+	struct config *cfg = bpf_map_lookup_elem(&cfg_map, &index);
+	if (!cfg || !filter(skb, cfg)) {
+		/* Don't report the verdict of a previous call on return */
+		bpf_map_delete_elem(&tc_events, &key);
+		return 0;
+	}
+
+	set_output(ctx, skb, &event, cfg);
+	event.type = EVENT_TYPE_TC;
+	event.pid = bpf_get_current_pid_tgid();
+	event.skb_addr = (u64) skb;
+	event.ts = bpf_ktime_get_ns();
+	event.cpu_id = bpf_get_smp_processor_id();
+
+	/* Only the first program of the filter is reported, the others only
+	 * run if it returns TC_ACT_UNSPEC */
+	struct tcf_proto *tp = (struct tcf_proto *) PT_REGS_PARM2(ctx);
+	struct cls_bpf_head *head = BPF_CORE_READ(tp, root);
+	struct list_head *first;
+	if (bpf_probe_read_kernel(&first, sizeof(first), &head->plist.next) == 0 &&
+	    first != &head->plist) {
+		struct cls_bpf_prog *prog = (void *) first - offsetof(struct cls_bpf_prog, link);
+		struct bpf_prog *filter;
+		bpf_probe_read_kernel(&filter, sizeof(filter), &prog->filter);
+		event.tc.prog_id = BPF_CORE_READ(filter, aux, id);
+		BPF_CORE_READ_STR_INTO(&event.tc.prog_name, filter, aux, name);
+	}
+	if (bpf_core_field_exists(skb->tc_at_ingress)) {
+		event.tc.ingress = BPF_CORE_READ_BITFIELD_PROBED(skb, tc_at_ingress);
+	}
+
+	bpf_map_update_elem(&tc_events, &key, &event, BPF_ANY);
+	return 0;
+}
+
+SEC(PWRU_KRETPROBE_TYPE "/cls_bpf_classify")
+int kretprobe_tc(struct pt_regs *ctx) {
+	u64 key = get_ret_stack_key();
+
+	struct event_t *event = bpf_map_lookup_elem(&tc_events, &key);
+	if (!event) {
+		return 0;
+	}
+
+	event->tc.verdict = PT_REGS_RC(ctx);
+	emit_event(ctx, event);
+	bpf_map_delete_elem(&tc_events, &key);
+
+	return 0;
+}
+
+/* struct sk_buff *skb_clone(struct sk_buff *skb, gfp_t gfp_mask), and the
+ * same for skb_copy(), __pskb_copy_fclone() and skb_copy_expand() */
+SEC(PWRU_KPROBE_TYPE "/skb_clone")
+int kprobe_skb_clone(struct pt_regs *ctx) {
+	u64 key = get_ret_stack_key();
+	u64 skb = PT_REGS_PARM1(ctx);
+
+	bpf_map_update_elem(&clone_origins, &key, &skb, BPF_ANY);
+	return 0;
+}
+
+SEC(PWRU_KRETPROBE_TYPE "/skb_clone")
+int kretprobe_skb_clone(struct pt_regs *ctx) {
+	u64 key = get_ret_stack_key();
+	u64 clone = PT_REGS_RC(ctx);
+
+	u64 *parent = bpf_map_lookup_elem(&clone_origins, &key);
+	if (!parent) {
+		return 0;
+	}
+	if (clone) {
+		bpf_map_update_elem(&skb_parents, &clone, parent, BPF_ANY);
+	}
+	bpf_map_delete_elem(&clone_origins, &key);
+	return 0;
+}
+
+/* void kfree_skbmem(struct sk_buff *skb) */
+SEC(PWRU_KPROBE_TYPE "/kfree_skbmem")
+int kprobe_kfree_skbmem(struct pt_regs *ctx) {
+	u64 skb = PT_REGS_PARM1(ctx);
+
+	bpf_map_delete_elem(&skb_parents, &skb);
+	return 0;
+}
+
+#else /* USE_FENTRY */
+
+/*
+ * The trampolines give access to the arguments and the return value of any
+ * traced function, and to the function address with bpf_get_func_ip(). The
+ * other probes are still attached from the kprobe objects, whose maps are
+ * shared with these programs.
+ */
+#define PWRU_ADD_FENTRY(X)                                                     \
+  SEC("fentry/skb-" #X)                                                        \
+  int fentry_skb_##X(u64 *ctx) {                                               \
+    struct sk_buff *skb = (struct sk_buff *) ctx[X - 1];                       \
+    u64 param_next = 0;                                                        \
+    bpf_get_func_arg(ctx, X, &param_next);                                     \
+    return handle_everything(skb, (struct pt_regs *) ctx, true, param_next);   \
+  }
+
+PWRU_ADD_FENTRY(1)
+PWRU_ADD_FENTRY(2)
+PWRU_ADD_FENTRY(3)
+PWRU_ADD_FENTRY(4)
+PWRU_ADD_FENTRY(5)
+
+SEC("fexit/skb")
+int fexit_skb(u64 *ctx) {
+	u64 retval = 0;
+
+	bpf_get_func_ret(ctx, &retval);
+	return handle_return(ctx, retval);
+}
+
+#undef PWRU_ADD_FENTRY
+
+#endif /* USE_FENTRY */
+
 #undef PWRU_KPROBE
+#undef PWRU_PARM_NEXT_1
+#undef PWRU_PARM_NEXT_2
+#undef PWRU_PARM_NEXT_3
+#undef PWRU_PARM_NEXT_4
+#undef PWRU_PARM_NEXT_5
 #undef PWRU_HAS_GET_FUNC_IP
 #undef PWRU_KPROBE_TYPE
+#undef PWRU_KRETPROBE_TYPE
 
 char __license[] SEC("license") = "GPL";
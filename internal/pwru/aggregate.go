@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+)
+
+// aggregateKey must match struct aggregate_key in bpf/kprobe_pwru.c.
+type aggregateKey struct {
+	Addr    uint64
+	Saddr   [16]byte
+	Daddr   [16]byte
+	Sport   uint16
+	Dport   uint16
+	L3Proto uint16
+	L4Proto uint8
+	Type    uint8
+	Netns   uint32
+	Pad     uint32
+}
+
+type aggregateCount struct {
+	funcName string
+	flow     string // the tuple, or the netns if there is none
+	count    uint64
+}
+
+// Aggregates prints the number of events per function and flow counted by
+// the BPF programs with --aggregate, in place of the events.
+type Aggregates struct {
+	counts   *ebpf.Map
+	funcName func(event *Event) string
+
+	mu sync.Mutex
+}
+
+func NewAggregates(counts *ebpf.Map, funcName func(event *Event) string) *Aggregates {
+	return &Aggregates{counts: counts, funcName: funcName}
+}
+
+// Run prints and resets the counts at each interval, until ctx is done.
+func (a *Aggregates) Run(ctx context.Context, interval time.Duration, w io.Writer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		a.Print(w)
+	}
+}
+
+// Print prints the counts since the last call, and resets them.
+func (a *Aggregates) Print(w io.Writer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	type countKey struct {
+		funcName, flow string
+	}
+	counts := map[countKey]uint64{}
+	var keys []aggregateKey
+	var key aggregateKey
+	var perCPU []uint64
+	iter := a.counts.Iterate()
+	for iter.Next(&key, &perCPU) {
+		keys = append(keys, key)
+		var total uint64
+		for _, n := range perCPU {
+			total += n
+		}
+		k := countKey{
+			funcName: a.funcName(&Event{Type: uint32(key.Type), Addr: key.Addr}),
+			flow:     aggregateFlow(&key),
+		}
+		counts[k] += total
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("Failed to read the aggregates: %s", err)
+	}
+	for _, key := range keys {
+		if err := a.counts.Delete(&key); err != nil {
+			log.Printf("Failed to reset the aggregates: %s", err)
+			break
+		}
+	}
+
+	sorted := make([]aggregateCount, 0, len(counts))
+	for k, n := range counts {
+		sorted = append(sorted, aggregateCount{k.funcName, k.flow, n})
+	}
+	writeAggregates(w, time.Now(), sorted)
+}
+
+func aggregateFlow(key *aggregateKey) string {
+	if key.L3Proto == 0 {
+		return fmt.Sprintf("netns=%d", key.Netns)
+	}
+	tuple := newJSONTuple(&Tuple{
+		Saddr:   key.Saddr,
+		Daddr:   key.Daddr,
+		Sport:   key.Sport,
+		Dport:   key.Dport,
+		L3Proto: key.L3Proto,
+		L4Proto: key.L4Proto,
+	})
+	return fmt.Sprintf("%s->%s(%s)", tuple.Src(), tuple.Dst(), tuple.Proto)
+}
+
+// writeAggregates writes the counts from the most frequent, after the time
+// of the interval.
+func writeAggregates(w io.Writer, now time.Time, counts []aggregateCount) {
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i], counts[j]
+		if a.count != b.count {
+			return a.count > b.count
+		}
+		if a.funcName != b.funcName {
+			return a.funcName < b.funcName
+		}
+		return a.flow < b.flow
+	})
+
+	fmt.Fprintf(w, "%s\n", now.Format("15:04:05"))
+	fmt.Fprintf(w, "%12s %-32s %s\n", "COUNT", "FUNC", "FLOW")
+	for _, c := range counts {
+		fmt.Fprintf(w, "%12d %-32s %s\n", c.count, c.funcName, c.flow)
+	}
+	fmt.Fprintf(w, "\n")
+}
@@ -0,0 +1,49 @@
+package pwru
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+func TestAggregateFlow(t *testing.T) {
+	key := aggregateKey{
+		Saddr:   [16]byte{10, 0, 1, 2},
+		Daddr:   [16]byte{10, 0, 2, 3},
+		Sport:   byteorder.HostToNetwork16(1234),
+		Dport:   byteorder.HostToNetwork16(80),
+		L3Proto: syscall.ETH_P_IP,
+		L4Proto: syscall.IPPROTO_TCP,
+		Netns:   4026531840,
+	}
+	if got, want := aggregateFlow(&key), "10.0.1.2:1234->10.0.2.3:80(tcp)"; got != want {
+		t.Errorf("aggregateFlow() = %q, want %q", got, want)
+	}
+	if got, want := aggregateFlow(&aggregateKey{Netns: 4026531840}), "netns=4026531840"; got != want {
+		t.Errorf("aggregateFlow() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteAggregates(t *testing.T) {
+	counts := []aggregateCount{
+		{"kfree_skbmem", "netns=4026531840", 12},
+		{"ip_rcv", "10.0.1.2:1234->10.0.2.3:80(tcp)", 1234},
+		{"ip_local_deliver", "10.0.1.2:1234->10.0.2.3:80(tcp)", 12},
+	}
+
+	var buf bytes.Buffer
+	writeAggregates(&buf, time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), counts)
+	want := `03:04:05
+       COUNT FUNC                             FLOW
+        1234 ip_rcv                           10.0.1.2:1234->10.0.2.3:80(tcp)
+          12 ip_local_deliver                 10.0.1.2:1234->10.0.2.3:80(tcp)
+          12 kfree_skbmem                     netns=4026531840
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,321 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"golang.org/x/net/bpf"
+)
+
+const (
+	// filterExprStub is the BPF function replaced with the compiled filter
+	// expression. It is called with:
+	//   R1: the packet data from the network header
+	//   R2: the length of the data (at most filterExprDataLen)
+	//   R3: the skb length
+	// and returns true if the packet matches.
+	filterExprStub = "filter_pcap_ebpf_l3"
+	// Must match PCAP_FILTER_LEN in bpf/kprobe_pwru.c
+	filterExprDataLen = 256
+
+	cbpfLabelPrefix = "__filter_expr_"
+)
+
+// Registers of the converted program. R6-R9 are callee-saved, so they can be
+// used freely by the stub.
+const (
+	cbpfData   = asm.R1
+	cbpfLen    = asm.R2
+	cbpfPktLen = asm.R3
+	cbpfA      = asm.R6
+	cbpfX      = asm.R7
+	cbpfTmp    = asm.R8
+	cbpfTmp2   = asm.R9
+)
+
+func cbpfLabel(i int) string {
+	return fmt.Sprintf("%s%d", cbpfLabelPrefix, i)
+}
+
+func cbpfScratch(n int) int16 {
+	return -4 * int16(n+1)
+}
+
+var cbpfALUOps = map[bpf.ALUOp]asm.ALUOp{
+	bpf.ALUOpAdd:        asm.Add,
+	bpf.ALUOpSub:        asm.Sub,
+	bpf.ALUOpMul:        asm.Mul,
+	bpf.ALUOpDiv:        asm.Div,
+	bpf.ALUOpOr:         asm.Or,
+	bpf.ALUOpAnd:        asm.And,
+	bpf.ALUOpShiftLeft:  asm.LSh,
+	bpf.ALUOpShiftRight: asm.RSh,
+	bpf.ALUOpMod:        asm.Mod,
+	bpf.ALUOpXor:        asm.Xor,
+}
+
+var cbpfSizes = map[int]asm.Size{
+	1: asm.Byte,
+	2: asm.Half,
+	4: asm.Word,
+}
+
+// cbpfJump returns the eBPF jump for the cBPF condition, and whether the
+// targets have to be swapped.
+func cbpfJump(cond bpf.JumpTest) (asm.JumpOp, bool, error) {
+	switch cond {
+	case bpf.JumpEqual:
+		return asm.JEq, false, nil
+	case bpf.JumpNotEqual:
+		return asm.JNE, false, nil
+	case bpf.JumpGreaterThan:
+		return asm.JGT, false, nil
+	case bpf.JumpLessThan:
+		return asm.JLT, false, nil
+	case bpf.JumpGreaterOrEqual:
+		return asm.JGE, false, nil
+	case bpf.JumpLessOrEqual:
+		return asm.JLE, false, nil
+	case bpf.JumpBitsSet:
+		return asm.JSet, false, nil
+	case bpf.JumpBitsNotSet:
+		return asm.JSet, true, nil
+	}
+	return 0, false, fmt.Errorf("unsupported jump condition %v", cond)
+}
+
+// cbpfToEBPF converts the cBPF program into the body of filterExprStub.
+// Out of bounds packet loads make the program return false, as in cBPF.
+func cbpfToEBPF(cbpf []bpf.Instruction) (asm.Instructions, error) {
+	reject := cbpfLabelPrefix + "reject"
+	exit := cbpfLabelPrefix + "exit"
+
+	insns := asm.Instructions{
+		asm.Mov.Imm32(cbpfA, 0),
+		asm.Mov.Imm32(cbpfX, 0),
+	}
+	for _, ins := range cbpf {
+		if _, ok := ins.(bpf.LoadScratch); ok {
+			// The verifier rejects reads of uninitialized stack slots
+			for n := 0; n < 16; n++ {
+				insns = append(insns, asm.StoreImm(asm.R10, cbpfScratch(n), 0, asm.Word))
+			}
+			break
+		}
+	}
+
+	// load emits a bounds-checked packet load into dst; off is relative to
+	// the start of the data if index is false, to X otherwise.
+	load := func(dst asm.Register, off uint32, size int, index bool) error {
+		sz, ok := cbpfSizes[size]
+		if !ok {
+			return fmt.Errorf("unsupported load size %d", size)
+		}
+		if off > filterExprDataLen-uint32(size) {
+			insns = append(insns, asm.Ja.Label(reject))
+			return nil
+		}
+		if index {
+			insns = append(insns,
+				asm.Mov.Reg32(cbpfTmp, cbpfX),
+				asm.Add.Imm32(cbpfTmp, int32(off)),
+				// Bound check for the verifier, which doesn't know the data length
+				asm.JGT.Imm(cbpfTmp, int32(filterExprDataLen-size), reject),
+				asm.Mov.Reg(cbpfTmp2, cbpfTmp),
+				asm.Add.Imm(cbpfTmp2, int32(size)),
+				asm.JGT.Reg(cbpfTmp2, cbpfLen, reject),
+				asm.Add.Reg(cbpfTmp, cbpfData),
+				asm.LoadMem(dst, cbpfTmp, 0, sz),
+			)
+		} else {
+			insns = append(insns,
+				asm.JLT.Imm(cbpfLen, int32(off)+int32(size), reject),
+				asm.LoadMem(dst, cbpfData, int16(off), sz),
+			)
+		}
+		// Packet loads are in network byte order
+		if size > 1 {
+			insns = append(insns, asm.HostTo(asm.BE, dst, sz))
+		}
+		return nil
+	}
+
+	for i, ins := range cbpf {
+		start := len(insns)
+		target := func(skip uint32) string {
+			return cbpfLabel(i + 1 + int(skip))
+		}
+
+		switch ins := ins.(type) {
+		case bpf.LoadAbsolute:
+			if err := load(cbpfA, ins.Off, ins.Size, false); err != nil {
+				return nil, err
+			}
+		case bpf.LoadIndirect:
+			if err := load(cbpfA, ins.Off, ins.Size, true); err != nil {
+				return nil, err
+			}
+		case bpf.LoadMemShift:
+			if err := load(cbpfX, ins.Off, 1, false); err != nil {
+				return nil, err
+			}
+			insns = append(insns,
+				asm.And.Imm32(cbpfX, 0xf),
+				asm.LSh.Imm32(cbpfX, 2))
+		case bpf.LoadConstant:
+			dst := cbpfA
+			if ins.Dst == bpf.RegX {
+				dst = cbpfX
+			}
+			insns = append(insns, asm.Mov.Imm32(dst, int32(ins.Val)))
+		case bpf.LoadScratch:
+			dst := cbpfA
+			if ins.Dst == bpf.RegX {
+				dst = cbpfX
+			}
+			insns = append(insns, asm.LoadMem(dst, asm.R10, cbpfScratch(ins.N), asm.Word))
+		case bpf.StoreScratch:
+			src := cbpfA
+			if ins.Src == bpf.RegX {
+				src = cbpfX
+			}
+			insns = append(insns, asm.StoreMem(asm.R10, cbpfScratch(ins.N), src, asm.Word))
+		case bpf.LoadExtension:
+			if ins.Num != bpf.ExtLen {
+				return nil, fmt.Errorf("unsupported extension %v", ins.Num)
+			}
+			insns = append(insns, asm.Mov.Reg32(cbpfA, cbpfPktLen))
+		case bpf.ALUOpConstant:
+			op, ok := cbpfALUOps[ins.Op]
+			if !ok {
+				return nil, fmt.Errorf("unsupported ALU op %v", ins.Op)
+			}
+			if (op == asm.Div || op == asm.Mod) && ins.Val == 0 {
+				insns = append(insns, asm.Ja.Label(reject))
+				break
+			}
+			insns = append(insns, op.Imm32(cbpfA, int32(ins.Val)))
+		case bpf.ALUOpX:
+			op, ok := cbpfALUOps[ins.Op]
+			if !ok {
+				return nil, fmt.Errorf("unsupported ALU op %v", ins.Op)
+			}
+			if op == asm.Div || op == asm.Mod {
+				// Division by zero aborts cBPF programs
+				insns = append(insns, asm.JEq.Imm32(cbpfX, 0, reject))
+			}
+			insns = append(insns, op.Reg32(cbpfA, cbpfX))
+		case bpf.NegateA:
+			insns = append(insns, asm.Neg.Imm32(cbpfA, 0))
+		case bpf.Jump:
+			insns = append(insns, asm.Ja.Label(target(ins.Skip)))
+		case bpf.JumpIf, bpf.JumpIfX:
+			var cond bpf.JumpTest
+			var st, sf uint8
+			var val uint32
+			x := false
+			switch ins := ins.(type) {
+			case bpf.JumpIf:
+				cond, st, sf, val = ins.Cond, ins.SkipTrue, ins.SkipFalse, ins.Val
+			case bpf.JumpIfX:
+				cond, st, sf, x = ins.Cond, ins.SkipTrue, ins.SkipFalse, true
+			}
+			op, swap, err := cbpfJump(cond)
+			if err != nil {
+				return nil, err
+			}
+			if swap {
+				st, sf = sf, st
+			}
+			if x {
+				insns = append(insns, op.Reg32(cbpfA, cbpfX, target(uint32(st))))
+			} else {
+				insns = append(insns, op.Imm32(cbpfA, int32(val), target(uint32(st))))
+			}
+			if sf != 0 {
+				insns = append(insns, asm.Ja.Label(target(uint32(sf))))
+			}
+		case bpf.RetA:
+			insns = append(insns,
+				asm.Mov.Imm(asm.R0, 0),
+				asm.JEq.Imm32(cbpfA, 0, exit),
+				asm.Mov.Imm(asm.R0, 1),
+				asm.Ja.Label(exit))
+		case bpf.RetConstant:
+			ret := int32(0)
+			if ins.Val != 0 {
+				ret = 1
+			}
+			insns = append(insns, asm.Mov.Imm(asm.R0, ret), asm.Ja.Label(exit))
+		case bpf.TXA:
+			insns = append(insns, asm.Mov.Reg32(cbpfA, cbpfX))
+		case bpf.TAX:
+			insns = append(insns, asm.Mov.Reg32(cbpfX, cbpfA))
+		default:
+			return nil, fmt.Errorf("unsupported instruction %v", ins)
+		}
+
+		if i > 0 && len(insns) > start {
+			insns[start] = insns[start].WithSymbol(cbpfLabel(i))
+		}
+	}
+
+	// Jumps past the last instruction are invalid in cBPF, so the label of
+	// the end is only used for robustness.
+	insns = append(insns,
+		asm.Mov.Imm(asm.R0, 0).WithSymbol(reject),
+		asm.Return().WithSymbol(exit),
+	)
+	return insns, nil
+}
+
+// InjectFilterExpr compiles the pcap-filter expression and replaces the body
+// of the filter stub with it in all the programs of the spec.
+func InjectFilterExpr(spec *ebpf.CollectionSpec, expr string) error {
+	cbpf, err := CompileFilterExpr(expr)
+	if err != nil {
+		return err
+	}
+	filter, err := cbpfToEBPF(cbpf)
+	if err != nil {
+		return fmt.Errorf("failed to convert filter expression to eBPF: %w", err)
+	}
+
+	for name, prog := range spec.Programs {
+		start := -1
+		for i, ins := range prog.Instructions {
+			if ins.Symbol() == filterExprStub {
+				start = i
+				break
+			}
+		}
+		if start < 0 {
+			continue
+		}
+		end := len(prog.Instructions)
+		for i := start + 1; i < len(prog.Instructions); i++ {
+			if prog.Instructions[i].Symbol() != "" {
+				end = i
+				break
+			}
+		}
+
+		body := make(asm.Instructions, len(filter))
+		copy(body, filter)
+		// Keep the symbol and the BTF func/line info of the stub
+		body[0] = body[0].WithMetadata(prog.Instructions[start].Metadata)
+
+		insns := make(asm.Instructions, 0, len(prog.Instructions)-(end-start)+len(body))
+		insns = append(insns, prog.Instructions[:start]...)
+		insns = append(insns, body...)
+		insns = append(insns, prog.Instructions[end:]...)
+		prog.Instructions = insns
+		spec.Programs[name] = prog
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// cloneFuncs return a clone or a copy of their first skb argument.
+var cloneFuncs = []string{"skb_clone", "skb_copy", "__pskb_copy_fclone", "skb_copy_expand"}
+
+type ClonePrograms interface {
+	GetKprobeSkbClone() *ebpf.Program
+	GetKretprobeSkbClone() *ebpf.Program
+	GetKprobeKfreeSkbmem() *ebpf.Program
+}
+
+// AttachCloneTracking attaches the programs of --track-clones, which record
+// the parent of the cloned and copied skbs until they are freed.
+func AttachCloneTracking(progs ClonePrograms, kprobeMulti bool) ([]link.Link, error) {
+	links, err := attachKprobe("kfree_skbmem", progs.GetKprobeKfreeSkbmem(), nil, kprobeMulti)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to kfree_skbmem: %w", err)
+	}
+
+	for _, name := range cloneFuncs {
+		l, err := attachKprobe(name, progs.GetKprobeSkbClone(), progs.GetKretprobeSkbClone(), kprobeMulti)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("Not tracking the clones by %s: not found", name)
+			continue
+		}
+		if err != nil {
+			for _, l := range links {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to attach to %s: %w", name, err)
+		}
+		links = append(links, l...)
+	}
+	return links, nil
+}
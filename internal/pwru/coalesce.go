@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"io"
+	"time"
+)
+
+// CoalesceIdle is the time without events after which the event held with
+// --coalesce is printed, so that the last event of a burst isn't delayed
+// until the next one.
+const CoalesceIdle = time.Second
+
+// coalescer holds the last event with --coalesce, so that a run of events of
+// the same skb in the same function, e.g. of a retransmission timer or of a
+// loop, is printed as a single line with its number of events. The returns
+// are only coalesced with the same return value.
+type coalescer struct {
+	w     io.Writer
+	event *eventInfo
+}
+
+// add counts the event if it repeats the held one, and otherwise prints the
+// held one and holds the event instead.
+func (c *coalescer) add(w io.Writer, event *eventInfo, f eventFormatter) {
+	if h := c.event; h != nil && h.SAddr == event.SAddr &&
+		h.Type == event.Type && h.funcName == event.funcName &&
+		(h.Type != EventTypeReturn || h.ParamNext == event.ParamNext) {
+		h.repeats++
+		return
+	}
+	c.flush(f)
+
+	// The captured data is reused by the event reader
+	if event.payload != nil {
+		event.payload = append([]byte(nil), event.payload...)
+	}
+	event.repeats = 1
+	c.w, c.event = w, event
+}
+
+// flush prints the held event, if any.
+func (c *coalescer) flush(f eventFormatter) {
+	if c.event != nil {
+		f.PrintEvent(c.w, c.event)
+	}
+	c.w, c.event = nil, nil
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedFile closes the encoder along with the file.
+type compressedFile struct {
+	io.WriteCloser
+	f *os.File
+}
+
+func (c *compressedFile) Close() error {
+	err := c.WriteCloser.Close()
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// createOutputFile creates the output file, compressed with gzip or zstd if
+// its name ends with .gz or .zst.
+func createOutputFile(path string) (io.WriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return &compressedFile{gzip.NewWriter(f), f}, nil
+	case strings.HasSuffix(path, ".zst"):
+		enc, err := zstd.NewWriter(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		return &compressedFile{enc, f}, nil
+	}
+	return f, nil
+}
+
+// openInputFile opens a file written by createOutputFile, decompressing it
+// according to its name.
+func openInputFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create gzip decoder: %w", err)
+		}
+		return &compressedReader{r, f}, nil
+	case strings.HasSuffix(path, ".zst"):
+		dec, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		return &compressedReader{dec.IOReadCloser(), f}, nil
+	}
+	return f, nil
+}
+
+// compressedReader closes the decoder along with the file.
+type compressedReader struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (c *compressedReader) Close() error {
+	c.ReadCloser.Close()
+	return c.f.Close()
+}
@@ -0,0 +1,55 @@
+package pwru
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCreateOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, decode := range map[string]func(io.Reader) (io.Reader, error){
+		"trace.txt": func(r io.Reader) (io.Reader, error) { return r, nil },
+		"trace.json.gz": func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		"trace.json.zst": func(r io.Reader) (io.Reader, error) {
+			return zstd.NewReader(r)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			w, err := createOutputFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, "ip_rcv\n"); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			r, err := decode(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "ip_rcv\n" {
+				t.Errorf("got %q, want %q", got, "ip_rcv\n")
+			}
+		})
+	}
+}
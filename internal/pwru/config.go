@@ -5,33 +5,48 @@
 package pwru
 
 import (
+	"fmt"
 	"log"
 	"net"
+	"os"
+	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 
 	"github.com/cilium/ebpf"
-
-	"github.com/cilium/pwru/internal/byteorder"
 )
 
 // Version is the pwru version and is set at compile time via LDFLAGS-
 var Version string = "version unknown"
 
+// vlanMaxID is VLAN_VID_MASK in bpf/kprobe_pwru.c
+const vlanMaxID = 0xfff
+
+// portRange mirrors struct port_range in bpf/kprobe_pwru.c.
+type portRange struct {
+	Min uint16
+	Max uint16
+}
+
+func (r portRange) contains(port uint16) bool {
+	return port >= r.Min && port <= r.Max
+}
+
 type FilterCfg struct {
 	FilterNetns uint32
 	FilterMark  uint32
 
 	//Filter l3
-	FilterIPv6  uint8
-	FilterSrcIP [16]byte
-	FilterDstIP [16]byte
+	FilterIPv6   uint8
+	FilterSrcNet uint8
+	FilterDstNet uint8
 
 	//Filter l4
 	FilterProto   uint8
-	FilterSrcPort uint16
-	FilterDstPort uint16
-	FilterPort    uint16
+	FilterSrcPort portRange
+	FilterDstPort portRange
+	FilterPort    portRange
 
 	//TODO: if there are more options later, then you can consider using a bit map
 	OutputRelativeTS uint8
@@ -40,86 +55,460 @@ type FilterCfg struct {
 	OutputSkb        uint8
 	OutputStack      uint8
 
+	CaptureLen       uint16
+	OutputRetval     uint8
+	OutputLatency    uint8
+	LatencyThreshold uint64
+
+	FilterVlan     uint8
+	VlanID         uint16
+	OutputEth      uint8
+	FilterExpr     uint8
+	FilterIfindex  uint32
+	FilterMarkMask uint32
+	FilterPid      uint32
+	FilterComm     [16]byte
+	FilterCgroup   uint8
+	FilterICMP     uint8
+	ICMPType       uint8
+	ICMP6Type      uint8
+	TCPFlags       uint8
+	TCPFlagsMask   uint8
+	FilterTunnel   uint8
+	SampleRate     uint32
+	CaptureFull    uint8
+	PageOffsetBase uint64
+	VmemmapBase    uint64
+	OutputSock     uint8
+	OutputCT       uint8
+	TrackClones    uint8
+	FilterLenMin   uint32
+	FilterLenMax   uint32
+	FilterDSCP     uint8
+	DSCP           uint8
+	FilterSPI      uint32
+	FilterMPLS     uint8
+	MPLSLabel      uint32
+	OutputRoute    uint8
+	LatencyHist    uint8
+	Aggregate      uint8
+
 	Pad byte
 }
 
-func ConfigBPFMap(flags *Flags, cfgMap *ebpf.Map) {
-	cfg := FilterCfg{
-		FilterNetns: flags.FilterNetns,
-		FilterMark:  flags.FilterMark,
+// NewFilterCfg builds the config of the BPF programs from the flags, and
+// exits on invalid flags.
+func NewFilterCfg(flags *Flags) FilterCfg {
+	cfg := FilterCfg{}
+	if flags.FilterVlan != "" {
+		id, err := strconv.ParseUint(flags.FilterVlan, 0, 16)
+		if err != nil || id > vlanMaxID {
+			log.Fatalf("Failed to parse --filter-vlan: invalid VLAN ID %q, expected 0-%d", flags.FilterVlan, vlanMaxID)
+		}
+		cfg.FilterVlan = 1
+		cfg.VlanID = uint16(id)
+	}
+	if flags.FilterNetns != "" {
+		netns, err := parseNetns(flags.FilterNetns)
+		if err != nil {
+			log.Fatalf("Failed to parse --filter-netns: %s", err)
+		}
+		cfg.FilterNetns = netns
+	}
+	if flags.FilterMark != "" {
+		mark, mask, err := parseMark(flags.FilterMark)
+		if err != nil {
+			log.Fatalf("Failed to parse --filter-mark: %s", err)
+		}
+		cfg.FilterMark = mark & mask
+		cfg.FilterMarkMask = mask
+	}
+	if flags.FilterCgroup != "" {
+		cfg.FilterCgroup = 1
 	}
-	if flags.FilterPort > 0 {
-		cfg.FilterPort = byteorder.HostToNetwork16(flags.FilterPort)
+	cfg.FilterPid = flags.FilterPid
+	if flags.FilterComm != "" {
+		if len(flags.FilterComm) >= len(cfg.FilterComm) {
+			log.Fatalf("--filter-comm must be shorter than %d chars", len(cfg.FilterComm))
+		}
+		copy(cfg.FilterComm[:], flags.FilterComm)
+	}
+	if flags.FilterIfindex != 0 && flags.FilterIfname != "" {
+		log.Fatalf("--filter-ifindex and --filter-ifname are mutually exclusive")
+	}
+	cfg.FilterIfindex = flags.FilterIfindex
+	if flags.FilterIfname != "" {
+		ifindex, err := ifnameToIndex(flags.FilterIfname, flags.FilterNetns)
+		if err != nil {
+			log.Fatalf("Failed to resolve --filter-ifname: %s", err)
+		}
+		cfg.FilterIfindex = ifindex
+	}
+	if flags.FilterPort != "" {
+		cfg.FilterPort = mustParsePortRange("filter-port", flags.FilterPort)
 	} else {
-		if flags.FilterSrcPort > 0 {
-			cfg.FilterSrcPort = byteorder.HostToNetwork16(flags.FilterSrcPort)
+		if flags.FilterSrcPort != "" {
+			cfg.FilterSrcPort = mustParsePortRange("filter-src-port", flags.FilterSrcPort)
+		}
+		if flags.FilterDstPort != "" {
+			cfg.FilterDstPort = mustParsePortRange("filter-dst-port", flags.FilterDstPort)
 		}
-		if flags.FilterDstPort > 0 {
-			cfg.FilterDstPort = byteorder.HostToNetwork16(flags.FilterDstPort)
+	}
+	if flags.Sample != "" {
+		rate, err := parseSampleRate(flags.Sample)
+		if err != nil {
+			log.Fatalf("Failed to parse --sample: %s", err)
 		}
+		cfg.SampleRate = rate
+	}
+	if flags.FilterTunnelInner {
+		cfg.FilterTunnel = 1
 	}
 	if flags.OutputSkb {
 		cfg.OutputSkb = 1
 	}
-	if flags.OutputMeta {
+	// The pods are resolved from the netns of the meta, and the recorded
+	// events may be replayed with --output-meta or --output-tuple. The
+	// aggregates are per tuple, or per netns if there is none
+	if flags.OutputMeta || flags.Kube || flags.Record != "" || flags.Aggregate > 0 {
 		cfg.OutputMeta = 1
 	}
-	if flags.OutputTuple {
+	// The flows of the TUI, of --correlate-veth and of --export-dot-per-flow,
+	// and the packets of --track-by=tuple are identified by their tuple
+	if flags.OutputTuple || flags.TUI || flags.Record != "" || flags.CorrelateVeth || flags.ExportDotPerFlow ||
+		flags.Aggregate > 0 || flags.TrackBy == TrackByTuple {
 		cfg.OutputTuple = 1
 	}
-	if flags.OutputStack {
+	if flags.OutputStack || flags.ExportFolded != "" {
 		cfg.OutputStack = 1
 	}
+	if flags.OutputEth {
+		cfg.OutputEth = 1
+	}
+	if flags.OutputSock {
+		cfg.OutputSock = 1
+	}
+	if flags.OutputConntrack {
+		cfg.OutputCT = 1
+	}
+	if flags.OutputRoute {
+		cfg.OutputRoute = 1
+	}
+	if flags.TrackClones {
+		cfg.TrackClones = 1
+	}
+	if flags.FilterLenMax != 0 && flags.FilterLenMax < flags.FilterLenMin {
+		log.Fatalf("--filter-len-max must be greater than --filter-len-min")
+	}
+	cfg.FilterLenMin = flags.FilterLenMin
+	cfg.FilterLenMax = flags.FilterLenMax
+	if flags.FilterDSCP != "" {
+		dscp, err := parseDSCP(flags.FilterDSCP)
+		if err != nil {
+			log.Fatalf("Failed to parse --filter-dscp: %s", err)
+		}
+		cfg.FilterDSCP = 1
+		cfg.DSCP = dscp
+	}
+	cfg.FilterSPI = flags.FilterSPI
+	if flags.FilterMPLS != "" {
+		label, err := parseMPLSLabel(flags.FilterMPLS)
+		if err != nil {
+			log.Fatalf("Failed to parse --filter-mpls-label: %s", err)
+		}
+		cfg.FilterMPLS = 1
+		cfg.MPLSLabel = label
+	}
+	if flags.FilterExpr != "" {
+		cfg.FilterExpr = 1
+	}
+	if flags.OutputRetval {
+		cfg.OutputRetval = 1
+	}
+	if flags.OutputLatency {
+		cfg.OutputLatency = 1
+		cfg.LatencyThreshold = uint64(flags.LatencyThreshold.Nanoseconds())
+	}
+	if flags.LatencyHist {
+		cfg.LatencyHist = 1
+	}
+	if flags.Aggregate > 0 {
+		cfg.Aggregate = 1
+	}
 
-	switch strings.ToLower(flags.FilterProto) {
-	case "tcp":
-		cfg.FilterProto = syscall.IPPROTO_TCP
-	case "udp":
-		cfg.FilterProto = syscall.IPPROTO_UDP
-	case "icmp":
-		cfg.FilterProto = syscall.IPPROTO_ICMP
-	case "icmp6":
-		cfg.FilterProto = syscall.IPPROTO_ICMPV6
+	if flags.OutputPayload < 0 || flags.OutputPayload > MaxCaptureLen {
+		log.Fatalf("--output-payload must be between 0 and %d", MaxCaptureLen)
+	}
+	cfg.CaptureLen = uint16(flags.OutputPayload)
+	if flags.OutputDNS && cfg.CaptureLen < dnsCaptureLen {
+		cfg.CaptureLen = dnsCaptureLen
+	}
+	if flags.PcapFile != "" {
+		cfg.CaptureLen = MaxCaptureLen
+	}
+	if flags.CaptureFile != "" {
+		cfg.CaptureFull = 1
+		// The fragment pages are only located with the x86_64 memory
+		// layout, only the linear data is captured otherwise.
+		if runtime.GOARCH == "amd64" {
+			addrs, err := lookupKsymAddrs("page_offset_base", "vmemmap_base")
+			if err != nil {
+				log.Printf("Failed to locate the fragment pages, only the linear data will be captured: %s", err)
+			} else {
+				cfg.PageOffsetBase = addrs["page_offset_base"]
+				cfg.VmemmapBase = addrs["vmemmap_base"]
+			}
+		}
 	}
 
-	if flags.FilterDstIP != "" {
-		ip := net.ParseIP(flags.FilterDstIP)
-		if ip == nil {
-			log.Fatalf("Failed to parse --filter-dst-ip")
+	if flags.FilterProto != "" {
+		proto, err := parseL4Proto(flags.FilterProto)
+		if err != nil {
+			log.Fatalf("Failed to parse --filter-proto: %s", err)
 		}
-		if ip4 := ip.To4(); ip4 == nil {
-			cfg.FilterIPv6 = 1
-			copy(cfg.FilterDstIP[:], ip.To16()[:])
-		} else {
-			copy(cfg.FilterDstIP[:], ip4[:])
+		cfg.FilterProto = proto
+	}
+
+	if flags.FilterICMPType != "" {
+		var err error
+		cfg.FilterICMP, cfg.ICMPType, cfg.ICMP6Type, err = parseICMPType(flags.FilterICMPType)
+		if err != nil {
+			log.Fatalf("Failed to parse --filter-icmp-type: %s", err)
 		}
 	}
 
-	if flags.FilterSrcIP != "" {
-		ip := net.ParseIP(flags.FilterSrcIP)
-		if ip == nil {
-			log.Fatalf("Failed to parse --filter-src-ip")
+	if flags.FilterTCPFlags != "" {
+		var err error
+		cfg.TCPFlags, cfg.TCPFlagsMask, err = parseTCPFlags(flags.FilterTCPFlags)
+		if err != nil {
+			log.Fatalf("Failed to parse --filter-tcp-flags: %s", err)
 		}
+	}
 
-		versionMatch := true
-		if ip4 := ip.To4(); ip4 == nil {
+	srcNet, dstNet := parseFilterIPs(flags)
+	for _, n := range []*net.IPNet{srcNet, dstNet} {
+		if n != nil && n.IP.To4() == nil {
 			cfg.FilterIPv6 = 1
-			if cfg.FilterIPv6 <= 0 && flags.FilterDstIP != "" {
-				versionMatch = false
-			}
-			copy(cfg.FilterSrcIP[:], ip.To16()[:])
-		} else {
-			if cfg.FilterIPv6 > 0 {
-				versionMatch = false
-			}
-			copy(cfg.FilterSrcIP[:], ip4[:])
-		}
-		if !versionMatch {
-			log.Fatalf("filter-src-ip and filter-dst-ip should have same version.")
 		}
 	}
+	if srcNet != nil {
+		cfg.FilterSrcNet = 1
+	}
+	if dstNet != nil {
+		cfg.FilterDstNet = 1
+	}
+	// ICMP and ICMPv6 are only carried by IPv4 and IPv6 respectively
+	if (srcNet != nil || dstNet != nil) &&
+		((cfg.FilterProto == syscall.IPPROTO_ICMP && cfg.FilterIPv6 == 1) ||
+			(cfg.FilterProto == syscall.IPPROTO_ICMPV6 && cfg.FilterIPv6 == 0)) {
+		log.Fatalf("--filter-proto=%s cannot match the addresses of --filter-src-ip/--filter-dst-ip", flags.FilterProto)
+	}
+	return cfg
+}
 
+func ConfigBPFMap(flags *Flags, cfgMap *ebpf.Map) {
+	cfg := NewFilterCfg(flags)
 	if err := cfgMap.Update(uint32(0), cfg, 0); err != nil {
 		log.Fatalf("Failed to set filter map: %v", err)
 	}
 }
+
+// parseMark parses a mark given as "value[/mask]", the mask defaults to an
+// exact match.
+func parseMark(s string) (uint32, uint32, error) {
+	value, mask, hasMask := strings.Cut(s, "/")
+	mark, err := strconv.ParseUint(value, 0, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid mark %q", value)
+	}
+	if !hasMask {
+		return uint32(mark), 0xffffffff, nil
+	}
+	m, err := strconv.ParseUint(mask, 0, 32)
+	if err != nil || m == 0 {
+		return 0, 0, fmt.Errorf("invalid mask %q", mask)
+	}
+	return uint32(mark), uint32(m), nil
+}
+
+var l4ProtoNames = map[string]uint8{
+	"tcp":    syscall.IPPROTO_TCP,
+	"udp":    syscall.IPPROTO_UDP,
+	"sctp":   syscall.IPPROTO_SCTP,
+	"icmp":   syscall.IPPROTO_ICMP,
+	"icmp6":  syscall.IPPROTO_ICMPV6,
+	"icmpv6": syscall.IPPROTO_ICMPV6,
+	"esp":    syscall.IPPROTO_ESP,
+	"ah":     syscall.IPPROTO_AH,
+}
+
+// parseL4Proto parses an L4 protocol given by name (e.g. "tcp") or number
+// (e.g. 47 for GRE).
+func parseL4Proto(s string) (uint8, error) {
+	if proto, ok := l4ProtoNames[strings.ToLower(s)]; ok {
+		return proto, nil
+	}
+	proto, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || proto == 0 {
+		return 0, fmt.Errorf("invalid protocol %q, expected tcp, udp, sctp, icmp, icmp6, esp, ah or a number", s)
+	}
+	return uint8(proto), nil
+}
+
+// parseDSCP parses a DSCP given by value (e.g. 46) or name (e.g. EF).
+func parseDSCP(s string) (uint8, error) {
+	for dscp, name := range dscpNames {
+		if strings.EqualFold(s, name) {
+			return dscp, nil
+		}
+	}
+	dscp, err := strconv.ParseUint(s, 0, 8)
+	if err != nil || dscp > 63 {
+		return 0, fmt.Errorf("invalid DSCP %q, expected 0-63 or a name (e.g. EF, AF41, CS6)", s)
+	}
+	return uint8(dscp), nil
+}
+
+// parseSampleRate parses a sampling rate given as "1/N" or "N".
+func parseSampleRate(s string) (uint32, error) {
+	rate, err := strconv.ParseUint(strings.TrimPrefix(s, "1/"), 10, 32)
+	if err != nil || rate == 0 {
+		return 0, fmt.Errorf("invalid sampling rate %q, expected 1/N", s)
+	}
+	return uint32(rate), nil
+}
+
+// parsePortRange parses a port given as "port" or "min-max".
+func parsePortRange(s string) (portRange, error) {
+	lo, hi, isRange := strings.Cut(s, "-")
+	min, err := strconv.ParseUint(lo, 10, 16)
+	if err != nil || min == 0 {
+		return portRange{}, fmt.Errorf("invalid port %q", lo)
+	}
+	if !isRange {
+		return portRange{Min: uint16(min), Max: uint16(min)}, nil
+	}
+	max, err := strconv.ParseUint(hi, 10, 16)
+	if err != nil || max < min {
+		return portRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return portRange{Min: uint16(min), Max: uint16(max)}, nil
+}
+
+func mustParsePortRange(name, s string) portRange {
+	r, err := parsePortRange(s)
+	if err != nil {
+		log.Fatalf("Failed to parse --%s: %s", name, err)
+	}
+	return r
+}
+
+var tcpFlagNames = map[string]uint8{
+	"fin": 0x01,
+	"syn": 0x02,
+	"rst": 0x04,
+	"psh": 0x08,
+	"ack": 0x10,
+	"urg": 0x20,
+	"ece": 0x40,
+	"cwr": 0x80,
+}
+
+// parseTCPFlags parses a comma-separated list of TCP flags which have to be
+// set, or unset if prefixed with "!" (e.g. "syn,!ack"). It returns the
+// expected value of the flags under the mask.
+func parseTCPFlags(s string) (uint8, uint8, error) {
+	var value, mask uint8
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		unset := strings.HasPrefix(name, "!")
+		flag, ok := tcpFlagNames[strings.TrimPrefix(name, "!")]
+		if !ok {
+			return 0, 0, fmt.Errorf("unknown TCP flag %q", name)
+		}
+		mask |= flag
+		if !unset {
+			value |= flag
+		}
+	}
+	return value, mask, nil
+}
+
+// ConfigCgroupMap stores the cgroup of --filter-cgroup into the cgroup map.
+func ConfigCgroupMap(flags *Flags, cgroupMap *ebpf.Map) {
+	if flags.FilterCgroup == "" {
+		return
+	}
+
+	f, err := os.Open(flags.FilterCgroup)
+	if err != nil {
+		log.Fatalf("Failed to open --filter-cgroup: %s", err)
+	}
+	defer f.Close()
+
+	if err := cgroupMap.Put(uint32(0), uint32(f.Fd())); err != nil {
+		log.Fatalf("Failed to set cgroup map: %v", err)
+	}
+}
+
+// lpmKey mirrors struct lpm_key in bpf/kprobe_pwru.c.
+type lpmKey struct {
+	Prefixlen uint32
+	Addr      [16]byte
+}
+
+func parseFilterIP(name, s string) *net.IPNet {
+	if s == "" {
+		return nil
+	}
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			log.Fatalf("Failed to parse --%s: %s", name, err)
+		}
+		return n
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		log.Fatalf("Failed to parse --%s", name)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// parseFilterIPs returns the prefixes of --filter-src-ip and --filter-dst-ip,
+// which are nil if unset.
+func parseFilterIPs(flags *Flags) (*net.IPNet, *net.IPNet) {
+	src := parseFilterIP("filter-src-ip", flags.FilterSrcIP)
+	dst := parseFilterIP("filter-dst-ip", flags.FilterDstIP)
+	if src != nil && dst != nil && (src.IP.To4() == nil) != (dst.IP.To4() == nil) {
+		log.Fatalf("filter-src-ip and filter-dst-ip should have same version.")
+	}
+	return src, dst
+}
+
+// ConfigIPMaps stores the prefixes of --filter-src-ip and --filter-dst-ip
+// into the LPM maps.
+func ConfigIPMaps(flags *Flags, saddrMap, daddrMap *ebpf.Map) {
+	src, dst := parseFilterIPs(flags)
+	for _, f := range []struct {
+		n *net.IPNet
+		m *ebpf.Map
+	}{{src, saddrMap}, {dst, daddrMap}} {
+		if f.n == nil {
+			continue
+		}
+		ones, _ := f.n.Mask.Size()
+		key := lpmKey{Prefixlen: uint32(ones)}
+		if ip4 := f.n.IP.To4(); ip4 != nil {
+			copy(key.Addr[:], ip4)
+		} else {
+			copy(key.Addr[:], f.n.IP.To16())
+		}
+		if err := f.m.Put(key, uint8(1)); err != nil {
+			log.Fatalf("Failed to set IP filter map: %v", err)
+		}
+	}
+}
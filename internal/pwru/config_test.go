@@ -0,0 +1,182 @@
+package pwru
+
+import "testing"
+
+func TestParseMark(t *testing.T) {
+	tests := []struct {
+		in         string
+		mark, mask uint32
+		wantErr    bool
+	}{
+		{in: "0x200", mark: 0x200, mask: 0xffffffff},
+		{in: "512", mark: 512, mask: 0xffffffff},
+		{in: "0x200/0xf00", mark: 0x200, mask: 0xf00},
+		{in: "0/0xf00", mark: 0, mask: 0xf00},
+		{in: "0x200/0", wantErr: true},
+		{in: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			mark, mask, err := parseMark(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMark() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mark != tt.mark || mask != tt.mask {
+				t.Errorf("parseMark() = %#x/%#x, want %#x/%#x", mark, mask, tt.mark, tt.mask)
+			}
+		})
+	}
+}
+
+func TestParseFilterIP(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "10.0.0.1", want: "10.0.0.1/32"},
+		{in: "10.1.2.3/8", want: "10.0.0.0/8"},
+		{in: "fd00::1", want: "fd00::1/128"},
+		{in: "fd00::/64", want: "fd00::/64"},
+	}
+	for _, tt := range tests {
+		if got := parseFilterIP("filter-src-ip", tt.in).String(); got != tt.want {
+			t.Errorf("parseFilterIP(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseL4Proto(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint8
+		wantErr bool
+	}{
+		{in: "tcp", want: 6},
+		{in: "UDP", want: 17},
+		{in: "sctp", want: 132},
+		{in: "icmp", want: 1},
+		{in: "icmp6", want: 58},
+		{in: "icmpv6", want: 58},
+		{in: "esp", want: 50},
+		{in: "47", want: 47},
+		{in: "0", wantErr: true},
+		{in: "256", wantErr: true},
+		{in: "quic", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseL4Proto(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseL4Proto(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		} else if got != tt.want {
+			t.Errorf("parseL4Proto(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDSCP(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint8
+		wantErr bool
+	}{
+		{in: "46", want: 46},
+		{in: "EF", want: 46},
+		{in: "af41", want: 34},
+		{in: "CS6", want: 48},
+		{in: "0", want: 0},
+		{in: "63", want: 63},
+		{in: "64", wantErr: true},
+		{in: "AF14", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseDSCP(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDSCP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseDSCP() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    portRange
+		wantErr bool
+	}{
+		{in: "80", want: portRange{80, 80}},
+		{in: "30000-32767", want: portRange{30000, 32767}},
+		{in: "443-443", want: portRange{443, 443}},
+		{in: "0", wantErr: true},
+		{in: "100-50", wantErr: true},
+		{in: "1-65536", wantErr: true},
+		{in: "http", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parsePortRange(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePortRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePortRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTCPFlags(t *testing.T) {
+	tests := []struct {
+		in          string
+		value, mask uint8
+		wantErr     bool
+	}{
+		{in: "syn", value: 0x02, mask: 0x02},
+		{in: "rst", value: 0x04, mask: 0x04},
+		{in: "syn,!ack", value: 0x02, mask: 0x12},
+		{in: "SYN, ACK", value: 0x12, mask: 0x12},
+		{in: "!fin", value: 0, mask: 0x01},
+		{in: "foo", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			value, mask, err := parseTCPFlags(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTCPFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if value != tt.value || mask != tt.mask {
+				t.Errorf("parseTCPFlags() = %#x/%#x, want %#x/%#x", value, mask, tt.value, tt.mask)
+			}
+		})
+	}
+}
+
+func TestParseSampleRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint32
+		wantErr bool
+	}{
+		{in: "1/100", want: 100},
+		{in: "10", want: 10},
+		{in: "1/1", want: 1},
+		{in: "1/0", wantErr: true},
+		{in: "2/100", wantErr: true},
+		{in: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseSampleRate(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSampleRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSampleRate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// configFilterKey sets the pcap-filter expression from the config file, as
+// it is not a flag.
+const configFilterKey = "pcap-filter"
+
+type configEntry struct {
+	line   int
+	key    string
+	values []string
+	list   bool
+}
+
+// LoadConfigFile sets the flags from the --config file, except the ones
+// given on the command line. The keys are the names of the flags, e.g.:
+//
+//	filter-func: ^(ip|ip6)_rcv
+//	output-tuple: true
+//	filter-module:
+//	  - nf_conntrack
+//	  - openvswitch
+//	pcap-filter: tcp and port 443
+//
+// Only this flat subset of YAML is supported, or of TOML (key = value) for
+// the files with the .toml extension, and the quoted strings are taken
+// verbatim, without escape sequences.
+func (f *Flags) LoadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	entries, err := parseConfigFile(string(data), filepath.Ext(path) == ".toml")
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := f.applyConfig(flag.CommandLine, entries); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (f *Flags) applyConfig(fs *flag.FlagSet, entries []configEntry) error {
+	cli := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) {
+		cli[fl.Name] = true
+	})
+
+	for _, e := range entries {
+		if e.key == configFilterKey {
+			if e.list {
+				return fmt.Errorf("line %d: %s is not a list", e.line, e.key)
+			}
+			if f.FilterExpr == "" {
+				f.FilterExpr = e.values[0]
+			}
+			continue
+		}
+
+		fl := fs.Lookup(e.key)
+		if fl == nil || e.key == "config" {
+			return fmt.Errorf("line %d: unknown flag %s", e.line, e.key)
+		}
+		if cli[e.key] {
+			continue
+		}
+		typ := fl.Value.Type()
+		if e.list && !strings.HasSuffix(typ, "Slice") && !strings.HasSuffix(typ, "Array") {
+			return fmt.Errorf("line %d: %s is not a list", e.line, e.key)
+		}
+		for _, v := range e.values {
+			if err := fs.Set(e.key, v); err != nil {
+				return fmt.Errorf("line %d: %w", e.line, err)
+			}
+		}
+	}
+	return nil
+}
+
+func parseConfigFile(data string, toml bool) ([]configEntry, error) {
+	var entries []configEntry
+	// The entry whose value is a block list, i.e. "key:" followed by
+	// "- item" lines in YAML
+	var block *configEntry
+
+	for i, line := range strings.Split(data, "\n") {
+		n := i + 1
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" || (!toml && (line == "---" || line == "...")) {
+			continue
+		}
+
+		if !toml && strings.HasPrefix(line, "-") {
+			if block == nil {
+				return nil, fmt.Errorf("line %d: list item without a key", n)
+			}
+			v, err := unquote(strings.TrimSpace(line[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			block.values = append(block.values, v)
+			continue
+		}
+		if block != nil {
+			entries = append(entries, *block)
+			block = nil
+		}
+
+		sep := ":"
+		if toml {
+			if strings.HasPrefix(line, "[") {
+				return nil, fmt.Errorf("line %d: tables are not supported", n)
+			}
+			sep = "="
+		}
+		key, value, ok := strings.Cut(line, sep)
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected key%s value", n, sep)
+		}
+		key, err := unquote(key)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		e := configEntry{line: n, key: key}
+		switch {
+		case value == "" && !toml:
+			e.list = true
+			block = &e
+			continue
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: unterminated list", n)
+			}
+			e.list = true
+			e.values, err = splitList(value[1 : len(value)-1])
+		default:
+			var v string
+			v, err = unquote(value)
+			e.values = []string{v}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		entries = append(entries, e)
+	}
+	if block != nil {
+		entries = append(entries, *block)
+	}
+	return entries, nil
+}
+
+// stripComment removes the comment starting with # outside of quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitList splits the items of an inline list, e.g. "a", "b".
+func splitList(s string) ([]string, error) {
+	var items []string
+	var quote rune
+	start := 0
+	for i, c := range s + "," {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			item := strings.TrimSpace(s[start:i])
+			start = i + 1
+			if item == "" {
+				continue
+			}
+			v, err := unquote(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string")
+	}
+	return items, nil
+}
+
+func unquote(s string) (string, error) {
+	if len(s) == 0 || (s[0] != '"' && s[0] != '\'') {
+		return s, nil
+	}
+	if len(s) < 2 || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("unterminated string %s", s)
+	}
+	return s[1 : len(s)-1], nil
+}
@@ -0,0 +1,104 @@
+package pwru
+
+import (
+	"reflect"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		toml    bool
+		want    []configEntry
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			data: `---
+# drop-debug
+filter-func: "^kfree_skb" # the drops
+output-tuple: true
+filter-module:
+  - nf_conntrack
+  - 'openvswitch'
+cri-endpoint: unix:///run/crio/crio.sock
+kmods: [a, "b,c"]
+`,
+			want: []configEntry{
+				{line: 3, key: "filter-func", values: []string{"^kfree_skb"}},
+				{line: 4, key: "output-tuple", values: []string{"true"}},
+				{line: 5, key: "filter-module", values: []string{"nf_conntrack", "openvswitch"}, list: true},
+				{line: 8, key: "cri-endpoint", values: []string{"unix:///run/crio/crio.sock"}},
+				{line: 9, key: "kmods", values: []string{"a", "b,c"}, list: true},
+			},
+		},
+		{
+			name: "toml",
+			data: `output-latency = true
+filter-func = ["ip_rcv", "ip_output"]
+pcap-filter = "tcp and port 443"
+`,
+			toml: true,
+			want: []configEntry{
+				{line: 1, key: "output-latency", values: []string{"true"}},
+				{line: 2, key: "filter-func", values: []string{"ip_rcv", "ip_output"}, list: true},
+				{line: 3, key: "pcap-filter", values: []string{"tcp and port 443"}},
+			},
+		},
+		{name: "item without key", data: "- a\n", wantErr: true},
+		{name: "missing separator", data: "output-tuple\n", wantErr: true},
+		{name: "unterminated string", data: "filter-func: \"ip_rcv\n", wantErr: true},
+		{name: "toml table", data: "[flags]\n", toml: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfigFile(tt.data, tt.toml)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConfigFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConfigFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	var f Flags
+	fs := flag.NewFlagSet("pwru", flag.ContinueOnError)
+	fs.BoolVar(&f.OutputTuple, "output-tuple", false, "")
+	fs.StringVar(&f.FilterProto, "filter-proto", "", "")
+	fs.StringArrayVar(&f.FilterFunc, "filter-func", nil, "")
+	if err := fs.Parse([]string{"--filter-proto=udp"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []configEntry{
+		{key: "output-tuple", values: []string{"true"}},
+		{key: "filter-proto", values: []string{"tcp"}},
+		{key: "filter-func", values: []string{"ip_rcv", "ip_output"}, list: true},
+		{key: "pcap-filter", values: []string{"port 443"}},
+	}
+	if err := f.applyConfig(fs, entries); err != nil {
+		t.Fatal(err)
+	}
+	if !f.OutputTuple || f.FilterProto != "udp" || f.FilterExpr != "port 443" ||
+		!reflect.DeepEqual(f.FilterFunc, []string{"ip_rcv", "ip_output"}) {
+		t.Errorf("applyConfig() = %+v", f)
+	}
+
+	for _, e := range []configEntry{
+		{key: "unknown", values: []string{"1"}},
+		{key: "output-tuple", values: []string{"1", "0"}, list: true},
+		{key: "output-tuple", values: []string{"maybe"}},
+	} {
+		fs := flag.NewFlagSet("pwru", flag.ContinueOnError)
+		fs.BoolVar(&f.OutputTuple, "output-tuple", false, "")
+		if err := f.applyConfig(fs, []configEntry{e}); err == nil {
+			t.Errorf("applyConfig(%+v) succeeded, want error", e)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import "strconv"
+
+const (
+	// ctNone must match CT_NONE in bpf/kprobe_pwru.c
+	ctNone = 0xff
+	// IP_CT_UNTRACKED, the skbs skipped by the notrack rules
+	ctUntracked = 7
+)
+
+// The names of enum ip_conntrack_info, as used by the conntrack tool. An skb
+// without an entry is "NONE", which the ctstate matches of iptables and
+// nftables see as INVALID once it went through conntrack.
+var ctInfos = map[uint8]string{
+	0:           "ESTABLISHED",
+	1:           "RELATED",
+	2:           "NEW",
+	3:           "ESTABLISHED_REPLY",
+	4:           "RELATED_REPLY",
+	ctUntracked: "UNTRACKED",
+	ctNone:      "NONE",
+}
+
+func ctInfoToStr(ctinfo uint8) string {
+	if name, ok := ctInfos[ctinfo]; ok {
+		return name
+	}
+	return strconv.Itoa(int(ctinfo))
+}
+
+// hasEntry returns whether the skb has a conntrack entry, with a zone and a
+// mark.
+func (c *Conntrack) hasEntry() bool {
+	return c.CTInfo != ctNone && c.CTInfo != ctUntracked
+}
+
+type jsonConntrack struct {
+	State string  `json:"state"`
+	Zone  *uint16 `json:"zone,omitempty"`
+	Mark  *uint32 `json:"mark,omitempty"`
+}
+
+func newJSONConntrack(c *Conntrack) *jsonConntrack {
+	ct := &jsonConntrack{State: ctInfoToStr(c.CTInfo)}
+	if c.hasEntry() {
+		zone, mark := c.Zone, c.Mark
+		ct.Zone = &zone
+		ct.Mark = &mark
+	}
+	return ct
+}
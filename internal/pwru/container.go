@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	criContainerStatusMethod = "/runtime.v1.RuntimeService/ContainerStatus"
+	criTimeout               = 2 * time.Second
+	// The containers queued beyond are resolved when seen again
+	criQueueLen = 256
+	// The caches are cleared once beyond, as the processes and containers
+	// come and go
+	containerCacheSize = 4096
+)
+
+// The container ID is the last 64 hex chars of the cgroup path, e.g.
+// "cri-containerd-<id>.scope", "crio-<id>.scope", "docker-<id>.scope" or
+// ".../<id>" with the cgroupfs driver.
+var containerIDRe = regexp.MustCompile(`(?m)([0-9a-f]{64})(?:\.scope)?$`)
+
+// containerNames resolves processes to the names of the containers they run
+// in, by looking up the container ID from the cgroup of the process in the
+// CRI runtime (containerd, CRI-O). As with hostNames, the lookups are done
+// in the background, and the events are printed without the name until it
+// has been resolved. Methods are no-ops on a nil *containerNames.
+type containerNames struct {
+	conn   *grpc.ClientConn
+	ids    map[int]string // pid => container ID
+	mu     sync.Mutex
+	names  map[string]string // container ID => name, "" if not resolved (yet)
+	queue  chan string
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newContainerNames(endpoint string) (*containerNames, error) {
+	conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to CRI endpoint %s: %w", endpoint, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &containerNames{
+		conn:   conn,
+		ids:    map[int]string{},
+		names:  map[string]string{},
+		queue:  make(chan string, criQueueLen),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	c.wg.Add(1)
+	go c.resolve()
+	return c, nil
+}
+
+func (c *containerNames) resolve() {
+	defer c.wg.Done()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case id := <-c.queue:
+			name, err := c.containerStatus(id)
+			if err != nil || name == "" {
+				continue
+			}
+			c.mu.Lock()
+			c.names[id] = name
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Name returns the name of the container of the process, or an empty string
+// if the process doesn't run in a container.
+func (c *containerNames) Name(pid int) string {
+	if c == nil || pid == 0 {
+		return ""
+	}
+
+	id, ok := c.ids[pid]
+	if !ok {
+		if len(c.ids) >= containerCacheSize {
+			c.ids = map[int]string{}
+		}
+		id = containerID(pid)
+		c.ids[pid] = id
+	}
+	if id == "" {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := c.names[id]; ok {
+		return name
+	}
+	if len(c.names) >= containerCacheSize {
+		c.names = map[string]string{}
+	}
+	// Cache failures as well, so that the runtime is queried only once
+	select {
+	case c.queue <- id:
+		c.names[id] = ""
+	default:
+	}
+	return ""
+}
+
+func (c *containerNames) Close() {
+	if c == nil {
+		return
+	}
+	c.cancel()
+	c.wg.Wait()
+	c.conn.Close()
+}
+
+// containerStatus calls the CRI ContainerStatus method. The messages are
+// encoded by hand to avoid depending on the whole CRI API, as only the
+// container name is needed.
+func (c *containerNames) containerStatus(id string) (string, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, criTimeout)
+	defer cancel()
+
+	// ContainerStatusRequest{container_id: 1}
+	req := protowire.AppendTag(nil, 1, protowire.BytesType)
+	req = protowire.AppendString(req, id)
+
+	var resp rawMessage
+	if err := c.conn.Invoke(ctx, criContainerStatusMethod, rawMessage(req), &resp, grpc.ForceCodec(rawCodec{})); err != nil {
+		return "", err
+	}
+
+	// ContainerStatusResponse{status: 1} -> ContainerStatus{metadata: 2} ->
+	// ContainerMetadata{name: 1}
+	status := protoField(resp, 1)
+	metadata := protoField(status, 2)
+	return string(protoField(metadata, 1)), nil
+}
+
+// protoField returns the value of the first length-delimited field num of
+// the message.
+func protoField(msg []byte, num protowire.Number) []byte {
+	for len(msg) > 0 {
+		n, typ, l := protowire.ConsumeTag(msg)
+		if l < 0 {
+			return nil
+		}
+		msg = msg[l:]
+		if n == num && typ == protowire.BytesType {
+			v, l := protowire.ConsumeBytes(msg)
+			if l < 0 {
+				return nil
+			}
+			return v
+		}
+		l = protowire.ConsumeFieldValue(n, typ, msg)
+		if l < 0 {
+			return nil
+		}
+		msg = msg[l:]
+	}
+	return nil
+}
+
+type rawMessage []byte
+
+// rawCodec passes the already encoded messages through.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return v.(rawMessage), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*rawMessage) = append(rawMessage(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+func containerID(pid int) string {
+	cgroup, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	return containerIDFromCgroup(cgroup)
+}
+
+func containerIDFromCgroup(cgroup []byte) string {
+	m := containerIDRe.FindSubmatch(cgroup)
+	if m == nil {
+		return ""
+	}
+	return string(m[1])
+}
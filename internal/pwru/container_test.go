@@ -0,0 +1,57 @@
+package pwru
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestContainerIDFromCgroup(t *testing.T) {
+	id := "1f2d3c4b5a6978877665544332211000ffeeddccbbaa99887766554433221100"
+	tests := []struct {
+		name   string
+		cgroup string
+		want   string
+	}{
+		{
+			name:   "containerd systemd",
+			cgroup: "0::/kubepods.slice/kubepods-pod0e7a2c3b_5b0d_4a57_9d3c_2f0c1e7d8f6a.slice/cri-containerd-" + id + ".scope\n",
+			want:   id,
+		},
+		{
+			name:   "cgroup v1 cgroupfs",
+			cgroup: "12:rdma:/\n11:pids:/kubepods/burstable/pod0e7a2c3b-5b0d-4a57-9d3c-2f0c1e7d8f6a/" + id + "\n",
+			want:   id,
+		},
+		{
+			name:   "host process",
+			cgroup: "0::/system.slice/sshd.service\n",
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containerIDFromCgroup([]byte(tt.cgroup)); got != tt.want {
+				t.Errorf("containerIDFromCgroup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtoField(t *testing.T) {
+	// ContainerStatusResponse{status: {id: "abc", metadata: {name: "web", attempt: 1}}}
+	metadata := protowire.AppendTag(nil, 1, protowire.BytesType)
+	metadata = protowire.AppendString(metadata, "web")
+	metadata = protowire.AppendTag(metadata, 2, protowire.VarintType)
+	metadata = protowire.AppendVarint(metadata, 1)
+	status := protowire.AppendTag(nil, 1, protowire.BytesType)
+	status = protowire.AppendString(status, "abc")
+	status = protowire.AppendTag(status, 2, protowire.BytesType)
+	status = protowire.AppendBytes(status, metadata)
+	resp := protowire.AppendTag(nil, 1, protowire.BytesType)
+	resp = protowire.AppendBytes(resp, status)
+
+	if got := string(protoField(protoField(protoField(resp, 1), 2), 1)); got != "web" {
+		t.Errorf("protoField() = %q, want %q", got, "web")
+	}
+}
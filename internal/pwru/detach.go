@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/cilium/ebpf/link"
+)
+
+// DetachLinks closes the links in parallel, as detaching a kprobe waits for
+// an RCU grace period and closing thousands of them one by one takes
+// minutes. A failure doesn't stop the other links from being closed. It
+// returns the number of links closed, and the errors of the others. done, if
+// not nil, is called after each link, from multiple goroutines.
+func DetachLinks(links []link.Link, done func()) (int, []error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		detached int
+		errs     []error
+	)
+
+	work := make(chan link.Link)
+	workers := runtime.NumCPU()
+	if workers > len(links) {
+		workers = len(links)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l := range work {
+				err := l.Close()
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					detached++
+				}
+				mu.Unlock()
+				if done != nil {
+					done()
+				}
+			}
+		}()
+	}
+
+	for _, l := range links {
+		work <- l
+	}
+	close(work)
+	wg.Wait()
+
+	return detached, errs
+}
@@ -0,0 +1,44 @@
+package pwru
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cilium/ebpf/link"
+)
+
+type fakeLink struct {
+	link.Link
+	err    error
+	closed *int32
+}
+
+func (l fakeLink) Close() error {
+	atomic.AddInt32(l.closed, 1)
+	return l.err
+}
+
+func TestDetachLinks(t *testing.T) {
+	var closed, done int32
+	var links []link.Link
+	for i := 0; i < 100; i++ {
+		var err error
+		if i%10 == 0 {
+			err = errors.New("busy")
+		}
+		links = append(links, fakeLink{err: err, closed: &closed})
+	}
+
+	detached, errs := DetachLinks(links, func() { atomic.AddInt32(&done, 1) })
+	if detached != 90 || len(errs) != 10 {
+		t.Errorf("DetachLinks() = %d, %d errors, want 90, 10 errors", detached, len(errs))
+	}
+	if closed != 100 || done != 100 {
+		t.Errorf("closed %d links, done called %d times, want 100", closed, done)
+	}
+
+	if detached, errs := DetachLinks(nil, nil); detached != 0 || errs != nil {
+		t.Errorf("DetachLinks(nil) = %d, %v, want 0, nil", detached, errs)
+	}
+}
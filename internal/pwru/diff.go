@@ -0,0 +1,260 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+const pathSep = " > "
+
+// tracePaths are the function paths of the skbs of a recorded trace, i.e.
+// the functions an skb went through until it was freed.
+type tracePaths struct {
+	name  string
+	skbs  uint64
+	paths map[string]uint64 // path => skbs
+	drops map[string]uint64 // drop point => count
+}
+
+// readTracePaths reads the paths of the events of the record matched by
+// filter.
+func readTracePaths(path string, filter *replayFilter) (*tracePaths, error) {
+	r, err := openRecord(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	o := &output{
+		addr2name:   r.hdr.addr2name(),
+		kprobeMulti: r.hdr.KprobeMulti,
+		dropReasons: r.hdr.DropReasons,
+	}
+	t := &tracePaths{
+		name:  filepath.Base(path),
+		paths: map[string]uint64{},
+		drops: map[string]uint64{},
+	}
+	// The paths of the skbs which haven't been freed yet
+	open := map[uint64][]string{}
+	var order []uint64
+
+	for {
+		var rec recordedEvent
+		if err := r.next(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		event := &rec.Event
+		if event.Type == EventTypeReturn {
+			continue
+		}
+		funcName := o.getFuncName(event)
+		if !filter.match(funcName, event) {
+			continue
+		}
+
+		if dropReasonFuncs[funcName] {
+			t.drops[fmt.Sprintf("%s (%s)", funcName, o.getDropReason(event))]++
+		}
+		if _, ok := open[event.SAddr]; !ok {
+			order = append(order, event.SAddr)
+		}
+		open[event.SAddr] = append(open[event.SAddr], funcName)
+		if skbFreeFuncs[funcName] {
+			t.add(open[event.SAddr])
+			delete(open, event.SAddr)
+		}
+	}
+	// The skbs still alive at the end of the record
+	for _, skb := range order {
+		if funcs, ok := open[skb]; ok {
+			t.add(funcs)
+			delete(open, skb)
+		}
+	}
+	return t, nil
+}
+
+func (t *tracePaths) add(funcs []string) {
+	t.skbs++
+	t.paths[strings.Join(funcs, pathSep)]++
+}
+
+// mostCommon returns the path taken by the most skbs.
+func (t *tracePaths) mostCommon() string {
+	if sorted := sortCounts(t.paths); len(sorted) != 0 {
+		return sorted[0].key
+	}
+	return ""
+}
+
+// divergence returns the function after which path diverges from the closest
+// path of t, i.e. the one with the longest common prefix.
+func (t *tracePaths) divergence(path string) string {
+	funcs := strings.Split(path, pathSep)
+	var longest int
+	for p := range t.paths {
+		other := strings.Split(p, pathSep)
+		n := 0
+		for n < len(funcs) && n < len(other) && funcs[n] == other[n] {
+			n++
+		}
+		if n > longest {
+			longest = n
+		}
+	}
+	if longest == 0 {
+		return ""
+	}
+	return funcs[longest-1]
+}
+
+// DiffRecords compares the paths and the drop points of the skbs of two
+// --record files, e.g. of the same flow on two nodes, and writes the paths
+// and drop points which differ, and the diff of the most common paths. The
+// recorded events are filtered as by Replay.
+func DiffRecords(w io.Writer, flags *Flags, pathA, pathB string) error {
+	filter, err := newReplayFilter(flags)
+	if err != nil {
+		return err
+	}
+	a, err := readTracePaths(pathA, filter)
+	if err != nil {
+		return fmt.Errorf("%s: %w", pathA, err)
+	}
+	b, err := readTracePaths(pathB, filter)
+	if err != nil {
+		return fmt.Errorf("%s: %w", pathB, err)
+	}
+	writeDiff(w, a, b)
+	return nil
+}
+
+func writeDiff(w io.Writer, a, b *tracePaths) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "--- %s: %d skbs, %d paths\n", a.name, a.skbs, len(a.paths))
+	fmt.Fprintf(tw, "+++ %s: %d skbs, %d paths\n", b.name, b.skbs, len(b.paths))
+
+	writeOnlyPaths(tw, "-", a, b)
+	writeOnlyPaths(tw, "+", b, a)
+
+	var common []summaryCount
+	for _, c := range sortCounts(a.paths) {
+		if _, ok := b.paths[c.key]; ok {
+			common = append(common, c)
+		}
+	}
+	if len(common) != 0 {
+		fmt.Fprintf(tw, "\nCommon paths:\n%s\t%s\tPATH\n", a.name, b.name)
+		for _, c := range common {
+			fmt.Fprintf(tw, "%d\t%d\t%s\n", c.count, b.paths[c.key], c.key)
+		}
+	}
+
+	drops := map[string]uint64{}
+	for d, n := range a.drops {
+		drops[d] += n
+	}
+	for d, n := range b.drops {
+		drops[d] += n
+	}
+	var diverging []summaryCount
+	for _, c := range sortCounts(drops) {
+		if a.drops[c.key] != b.drops[c.key] {
+			diverging = append(diverging, c)
+		}
+	}
+	if len(diverging) != 0 {
+		fmt.Fprintf(tw, "\nDrop points:\n%s\t%s\tDROP\n", a.name, b.name)
+		for _, c := range diverging {
+			fmt.Fprintf(tw, "%d\t%d\t%s\n", a.drops[c.key], b.drops[c.key], c.key)
+		}
+	}
+
+	pa, pb := a.mostCommon(), b.mostCommon()
+	if pa != pb && pa != "" && pb != "" {
+		fmt.Fprintf(tw, "\nMost common paths:\n")
+		for _, line := range diffFuncs(strings.Split(pa, pathSep), strings.Split(pb, pathSep)) {
+			fmt.Fprintf(tw, "%s\n", line)
+		}
+	}
+}
+
+// writeOnlyPaths writes the paths of t which are not in other, with the
+// function after which they diverge from the paths of other.
+func writeOnlyPaths(w io.Writer, prefix string, t, other *tracePaths) {
+	var only []summaryCount
+	for _, c := range sortCounts(t.paths) {
+		if _, ok := other.paths[c.key]; !ok {
+			only = append(only, c)
+		}
+	}
+	if len(only) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nPaths only in %s:\n\tSKBS\tDIVERGES AFTER\tPATH\n", t.name)
+	for _, c := range only {
+		after := other.divergence(c.key)
+		if after == "" {
+			after = "-"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", prefix, c.count, after, c.key)
+	}
+}
+
+// diffFuncs returns the lines of the diff of two paths, based on their
+// longest common subsequence: the common functions are prefixed with " ", and
+// the ones only in a or b with "-" or "+" respectively.
+func diffFuncs(a, b []string) []string {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+ "+b[j])
+	}
+	return lines
+}
@@ -0,0 +1,55 @@
+package pwru
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffFuncs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []string
+	}{
+		{
+			a:    "ip_rcv ip_local_deliver tcp_v4_rcv",
+			b:    "ip_rcv ip_local_deliver tcp_v4_rcv",
+			want: []string{"  ip_rcv", "  ip_local_deliver", "  tcp_v4_rcv"},
+		},
+		{
+			a:    "ip_rcv nf_hook_slow ip_local_deliver tcp_v4_rcv",
+			b:    "ip_rcv nf_hook_slow kfree_skb_reason",
+			want: []string{"  ip_rcv", "  nf_hook_slow", "- ip_local_deliver", "- tcp_v4_rcv", "+ kfree_skb_reason"},
+		},
+		{
+			a:    "ip_rcv ip_forward",
+			b:    "ip_rcv ip_route_input_noref ip_forward",
+			want: []string{"  ip_rcv", "+ ip_route_input_noref", "  ip_forward"},
+		},
+	}
+	for _, tt := range tests {
+		if got := diffFuncs(strings.Fields(tt.a), strings.Fields(tt.b)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("diffFuncs(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestTracePathsDivergence(t *testing.T) {
+	tp := &tracePaths{paths: map[string]uint64{}}
+	tp.add([]string{"ip_rcv", "nf_hook_slow", "ip_local_deliver"})
+	tp.add([]string{"ip_rcv", "ip_forward"})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"ip_rcv > nf_hook_slow > kfree_skb_reason", "nf_hook_slow"},
+		{"ip_rcv > ip_forward > ip_output", "ip_forward"},
+		{"ip6_rcv > ip6_forward", ""},
+	}
+	for _, tt := range tests {
+		if got := tp.divergence(tt.path); got != tt.want {
+			t.Errorf("divergence(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
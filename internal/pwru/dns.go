@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsPort = 53
+	// Captured with --output-dns, enough for the header and the question
+	// of most messages
+	dnsCaptureLen = 512
+)
+
+// dnsInfo is the question of a DNS message, decoded with --output-dns.
+type dnsInfo struct {
+	id       uint16
+	response bool
+	rcode    dnsmessage.RCode
+	name     string
+	qtype    dnsmessage.Type
+}
+
+// String returns e.g. "dns=query id=0x1a2b A example.com." or
+// "dns=response id=0x1a2b A example.com. rcode=NXDOMAIN".
+func (d *dnsInfo) String() string {
+	if !d.response {
+		return fmt.Sprintf("dns=query id=0x%x %s %s", d.id, dnsTypeToStr(d.qtype), d.name)
+	}
+	return fmt.Sprintf("dns=response id=0x%x %s %s rcode=%s", d.id, dnsTypeToStr(d.qtype), d.name,
+		dnsRCodeToStr(d.rcode))
+}
+
+// decodeDNS decodes the question of the DNS message of the UDP or TCP
+// packet to or from port 53 captured from the network header. It returns nil
+// for the other packets, and when the message isn't in data, e.g. for the
+// TCP segments following the first one of a message.
+func decodeDNS(data []byte) *dnsInfo {
+	var proto uint8
+	var l4 []byte
+	switch {
+	case len(data) >= 20 && data[0]>>4 == 4:
+		ihl := int(data[0]&0xf) * 4
+		// Only the first fragment has the L4 header
+		if binary.BigEndian.Uint16(data[6:8])&0x1fff != 0 || len(data) < ihl {
+			return nil
+		}
+		proto, l4 = data[9], data[ihl:]
+	case len(data) >= 40 && data[0]>>4 == 6:
+		// As with the pcap-filter expressions, the extension headers are
+		// not skipped
+		proto, l4 = data[6], data[40:]
+	default:
+		return nil
+	}
+
+	var msg []byte
+	switch {
+	case proto == syscall.IPPROTO_UDP && len(l4) >= 8:
+		msg = l4[8:]
+	case proto == syscall.IPPROTO_TCP && len(l4) >= 20:
+		off := int(l4[12]>>4) * 4
+		// The messages are prefixed by their length
+		if len(l4) < off+2 {
+			return nil
+		}
+		msg = l4[off+2:]
+	default:
+		return nil
+	}
+	if sport, dport := binary.BigEndian.Uint16(l4[0:2]), binary.BigEndian.Uint16(l4[2:4]); sport != dnsPort && dport != dnsPort {
+		return nil
+	}
+
+	var p dnsmessage.Parser
+	hdr, err := p.Start(msg)
+	if err != nil {
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil
+	}
+	return &dnsInfo{
+		id:       hdr.ID,
+		response: hdr.Response,
+		rcode:    hdr.RCode,
+		name:     q.Name.String(),
+		qtype:    q.Type,
+	}
+}
+
+func dnsTypeToStr(typ dnsmessage.Type) string {
+	// e.g. TypeAAAA, or the number of the unknown types
+	return strings.TrimPrefix(typ.String(), "Type")
+}
+
+// The mnemonics of the response codes, as printed by dig
+var dnsRCodes = map[dnsmessage.RCode]string{
+	dnsmessage.RCodeSuccess:        "NOERROR",
+	dnsmessage.RCodeFormatError:    "FORMERR",
+	dnsmessage.RCodeServerFailure:  "SERVFAIL",
+	dnsmessage.RCodeNameError:      "NXDOMAIN",
+	dnsmessage.RCodeNotImplemented: "NOTIMP",
+	dnsmessage.RCodeRefused:        "REFUSED",
+}
+
+func dnsRCodeToStr(rcode dnsmessage.RCode) string {
+	if name, ok := dnsRCodes[rcode]; ok {
+		return name
+	}
+	return strconv.Itoa(int(rcode))
+}
+
+type jsonDNS struct {
+	ID       uint16 `json:"id"`
+	Response bool   `json:"response"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	RCode    string `json:"rcode,omitempty"` // responses only
+}
+
+func newJSONDNS(d *dnsInfo) *jsonDNS {
+	j := &jsonDNS{
+		ID:       d.id,
+		Response: d.response,
+		Name:     d.name,
+		Type:     dnsTypeToStr(d.qtype),
+	}
+	if d.response {
+		j.RCode = dnsRCodeToStr(d.rcode)
+	}
+	return j
+}
@@ -0,0 +1,68 @@
+package pwru
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func dnsPacket(t *testing.T, hdr dnsmessage.Header, name string, typ dnsmessage.Type, sport, dport uint16) []byte {
+	b := dnsmessage.NewBuilder(nil, hdr)
+	if err := b.StartQuestions(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// IPv4 and UDP headers, the other fields are not decoded
+	pkt := make([]byte, 28, 28+len(msg))
+	pkt[0] = 0x45
+	pkt[9] = 17
+	binary.BigEndian.PutUint16(pkt[20:], sport)
+	binary.BigEndian.PutUint16(pkt[22:], dport)
+	return append(pkt, msg...)
+}
+
+func TestDecodeDNS(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  []byte
+		want string
+	}{
+		{
+			name: "query",
+			pkt:  dnsPacket(t, dnsmessage.Header{ID: 0x1a2b}, "example.com.", dnsmessage.TypeAAAA, 43210, 53),
+			want: "dns=query id=0x1a2b AAAA example.com.",
+		},
+		{
+			name: "response",
+			pkt:  dnsPacket(t, dnsmessage.Header{ID: 0x1a2b, Response: true, RCode: dnsmessage.RCodeNameError}, "nope.example.com.", dnsmessage.TypeA, 53, 43210),
+			want: "dns=response id=0x1a2b A nope.example.com. rcode=NXDOMAIN",
+		},
+		{
+			name: "other port",
+			pkt:  dnsPacket(t, dnsmessage.Header{}, "example.com.", dnsmessage.TypeA, 43210, 5353),
+		},
+		{
+			name: "truncated",
+			pkt:  dnsPacket(t, dnsmessage.Header{}, "example.com.", dnsmessage.TypeA, 43210, 53)[:34],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			if d := decodeDNS(tt.pkt); d != nil {
+				got = d.String()
+			}
+			if got != tt.want {
+				t.Errorf("decodeDNS() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
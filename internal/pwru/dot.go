@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+type dotNode struct {
+	flow     string // "" unless --export-dot-per-flow
+	funcName string
+}
+
+type dotEdge struct {
+	from, to dotNode
+}
+
+// dotGraph aggregates the paths of the skbs for --export-dot: the nodes are
+// the functions, with their number of events, and the edges the transitions
+// from a function to the next one of an skb, with the number of times they
+// were taken. With perFlow, the functions are drawn in a subgraph per flow.
+type dotGraph struct {
+	path    string
+	perFlow bool
+	nodes   map[dotNode]uint64
+	edges   map[dotEdge]uint64
+	last    map[uint64]dotNode // skb addr => node of its previous event
+}
+
+func newDotGraph(path string, perFlow bool) *dotGraph {
+	return &dotGraph{
+		path:    path,
+		perFlow: perFlow,
+		nodes:   map[dotNode]uint64{},
+		edges:   map[dotEdge]uint64{},
+		last:    map[uint64]dotNode{},
+	}
+}
+
+// add adds the event to the graph. The path of the skb ends if it is freed.
+func (g *dotGraph) add(event *eventInfo, freed bool) {
+	if event.Type != EventTypeReturn {
+		node := dotNode{funcName: event.funcName}
+		if g.perFlow {
+			node.flow = flowKey(event)
+		}
+		g.nodes[node]++
+		if prev, ok := g.last[event.SAddr]; ok {
+			g.edges[dotEdge{prev, node}]++
+		}
+		g.last[event.SAddr] = node
+	}
+	if freed {
+		delete(g.last, event.SAddr)
+	}
+}
+
+func (g *dotGraph) writeFile() error {
+	f, err := createOutputFile(g.path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	g.write(w)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// write writes the graph in the DOT language of Graphviz, e.g. to be
+// rendered with "dot -Tsvg".
+func (g *dotGraph) write(w io.Writer) {
+	nodes := make([]dotNode, 0, len(g.nodes))
+	for n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].flow != nodes[j].flow {
+			return nodes[i].flow < nodes[j].flow
+		}
+		return nodes[i].funcName < nodes[j].funcName
+	})
+
+	// The nodes are named after their function, prefixed with the index of
+	// their flow
+	flows := map[string]int{}
+	id := func(n dotNode) string {
+		if !g.perFlow {
+			return strconv.Quote(n.funcName)
+		}
+		return strconv.Quote(fmt.Sprintf("%d:%s", flows[n.flow], n.funcName))
+	}
+
+	fmt.Fprintf(w, "digraph pwru {\n\tnode [shape=box];\n")
+	for i, n := range nodes {
+		indent := "\t"
+		if g.perFlow {
+			if i == 0 || n.flow != nodes[i-1].flow {
+				if i != 0 {
+					fmt.Fprintf(w, "\t}\n")
+				}
+				flows[n.flow] = len(flows)
+				fmt.Fprintf(w, "\tsubgraph \"cluster_%d\" {\n\t\tlabel=%s;\n", flows[n.flow], strconv.Quote(n.flow))
+			}
+			indent = "\t\t"
+		}
+		fmt.Fprintf(w, "%s%s [label=%s];\n", indent, id(n),
+			strconv.Quote(fmt.Sprintf("%s\n%d", n.funcName, g.nodes[n])))
+	}
+	if g.perFlow && len(nodes) != 0 {
+		fmt.Fprintf(w, "\t}\n")
+	}
+
+	edges := make([]dotEdge, 0, len(g.edges))
+	for e := range g.edges {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.from != b.from {
+			return id(a.from) < id(b.from)
+		}
+		return id(a.to) < id(b.to)
+	})
+	for _, e := range edges {
+		fmt.Fprintf(w, "\t%s -> %s [label=\"%d\"];\n", id(e.from), id(e.to), g.edges[e])
+	}
+	fmt.Fprintf(w, "}\n")
+}
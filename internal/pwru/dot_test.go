@@ -0,0 +1,63 @@
+package pwru
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+)
+
+func TestDotGraph(t *testing.T) {
+	tuple := Tuple{
+		Saddr:   [16]byte{10, 0, 1, 2},
+		Daddr:   [16]byte{10, 0, 2, 3},
+		L3Proto: syscall.ETH_P_IP,
+		L4Proto: syscall.IPPROTO_ICMP,
+	}
+	add := func(g *dotGraph, skb uint64, funcs ...string) {
+		for i, fn := range funcs {
+			g.add(&eventInfo{Event: &Event{SAddr: skb, Tuple: tuple}, funcName: fn}, i == len(funcs)-1)
+		}
+	}
+
+	g := newDotGraph("", false)
+	add(g, 1, "ip_rcv", "ip_local_deliver", "kfree_skbmem")
+	add(g, 2, "ip_rcv", "kfree_skb_reason", "kfree_skbmem")
+	// The address is reused by another skb
+	add(g, 1, "ip_rcv", "ip_local_deliver", "kfree_skbmem")
+
+	var buf bytes.Buffer
+	g.write(&buf)
+	want := `digraph pwru {
+	node [shape=box];
+	"ip_local_deliver" [label="ip_local_deliver\n2"];
+	"ip_rcv" [label="ip_rcv\n3"];
+	"kfree_skb_reason" [label="kfree_skb_reason\n1"];
+	"kfree_skbmem" [label="kfree_skbmem\n3"];
+	"ip_local_deliver" -> "kfree_skbmem" [label="2"];
+	"ip_rcv" -> "ip_local_deliver" [label="2"];
+	"ip_rcv" -> "kfree_skb_reason" [label="1"];
+	"kfree_skb_reason" -> "kfree_skbmem" [label="1"];
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	g = newDotGraph("", true)
+	add(g, 1, "ip_rcv", "kfree_skbmem")
+	buf.Reset()
+	g.write(&buf)
+	want = `digraph pwru {
+	node [shape=box];
+	subgraph "cluster_0" {
+		label="10.0.1.2:0->10.0.2.3:0(icmp)";
+		"0:ip_rcv" [label="ip_rcv\n1"];
+		"0:kfree_skbmem" [label="kfree_skbmem\n1"];
+	}
+	"0:ip_rcv" -> "0:kfree_skbmem" [label="1"];
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
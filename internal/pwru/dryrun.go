@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Rough costs of attaching a probe to a function, for the estimate of
+// --dry-run. A kprobe-multi link is attached to all the functions at once,
+// and a fentry program is verified for each function.
+var attachCosts = map[string]time.Duration{
+	BackendKprobe:      10 * time.Millisecond,
+	BackendKprobeMulti: 10 * time.Microsecond,
+	BackendFentry:      25 * time.Millisecond,
+}
+
+type planProbes struct {
+	name  string
+	count int
+}
+
+// Plan is what pwru would attach, printed by --dry-run.
+type Plan struct {
+	Backend string
+	Funcs   Funcs
+	// Whether the returns of the functions are traced too
+	Returns     bool
+	Tracepoints []string
+	// The probes other than the ones of the functions
+	Extra []planProbes
+
+	// The filter flags which were set
+	Filters         []string
+	FilterExpr      string
+	FilterExprInsns int
+}
+
+// NewPlan validates the filters and compiles the filter expression, and
+// returns the plan of the probes to attach for flags.
+func NewPlan(flags *Flags, funcs Funcs) (*Plan, error) {
+	NewFilterCfg(flags)
+
+	p := &Plan{
+		Backend:     flags.Backend,
+		Funcs:       funcs,
+		Returns:     flags.OutputRetval || flags.OutputLatency || flags.LatencyHist,
+		Tracepoints: flags.Tracepoints,
+		FilterExpr:  flags.FilterExpr,
+	}
+	// As in main(), kprobe-multi is not used for the modules
+	if p.Backend == BackendAuto && len(flags.KMods) != 0 {
+		p.Backend = BackendKprobe
+	}
+	if flags.OutputNetfilter {
+		p.Extra = append(p.Extra, planProbes{"netfilter", 2 * len(NetfilterFuncs)})
+	}
+	if flags.TrackClones {
+		p.Extra = append(p.Extra, planProbes{"clone tracking", 1 + 2*len(cloneFuncs)})
+	}
+	if flags.FilterTraceXDP {
+		p.Extra = append(p.Extra, planProbes{"xdp", 2})
+	}
+	if flags.FilterTraceTC {
+		p.Extra = append(p.Extra, planProbes{"tc", 2})
+	}
+
+	flag.CommandLine.Visit(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Name, "filter-") {
+			p.Filters = append(p.Filters, fmt.Sprintf("--%s=%s", f.Name, f.Value))
+		}
+	})
+
+	if flags.FilterExpr != "" {
+		cbpf, err := CompileFilterExpr(flags.FilterExpr)
+		if err != nil {
+			return nil, err
+		}
+		insns, err := cbpfToEBPF(cbpf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert filter expression to eBPF: %w", err)
+		}
+		p.FilterExprInsns = len(insns)
+	}
+	return p, nil
+}
+
+// Probes returns the number of probes to attach, the tracepoints included.
+func (p *Plan) Probes() int {
+	n := len(p.Funcs) + len(p.Tracepoints)
+	if p.Returns {
+		n += len(p.Funcs)
+	}
+	for _, e := range p.Extra {
+		n += e.count
+	}
+	return n
+}
+
+// AttachTime estimates the time to attach the probes of the functions.
+// The other probes are few enough to be ignored.
+func (p *Plan) AttachTime() time.Duration {
+	backend := p.Backend
+	if backend == BackendAuto {
+		backend = BackendKprobeMulti
+	}
+	n := len(p.Funcs)
+	if p.Returns {
+		n *= 2
+	}
+	return time.Duration(n) * attachCosts[backend]
+}
+
+func (p *Plan) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+
+	backend := p.Backend
+	if backend == BackendAuto {
+		backend = fmt.Sprintf("%s (%s if it can be attached, %s otherwise)", BackendAuto, BackendKprobeMulti, BackendKprobe)
+	}
+	fmt.Fprintf(tw, "Backend:\t%s\n", backend)
+
+	byPos := GetFuncsByPos(p.Funcs)
+	positions := make([]int, 0, len(byPos))
+	for pos := range byPos {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+	var perPos []string
+	for _, pos := range positions {
+		perPos = append(perPos, fmt.Sprintf("skb arg %d: %d", pos, len(byPos[pos])))
+	}
+	if len(perPos) != 0 {
+		fmt.Fprintf(tw, "Functions:\t%d (%s)\n", len(p.Funcs), strings.Join(perPos, ", "))
+	} else {
+		fmt.Fprintf(tw, "Functions:\t0\n")
+	}
+	if p.Returns {
+		fmt.Fprintf(tw, "Returns:\t%d\n", len(p.Funcs))
+	}
+	for _, e := range p.Extra {
+		fmt.Fprintf(tw, "Probes for %s:\t%d\n", e.name, e.count)
+	}
+	if len(p.Tracepoints) != 0 {
+		fmt.Fprintf(tw, "Tracepoints:\t%s\n", strings.Join(p.Tracepoints, ", "))
+	}
+	fmt.Fprintf(tw, "Total probes:\t%d\n", p.Probes())
+
+	filters := "none"
+	if len(p.Filters) != 0 {
+		filters = strings.Join(p.Filters, " ")
+	}
+	fmt.Fprintf(tw, "Filters:\t%s\n", filters)
+	if p.FilterExpr != "" {
+		fmt.Fprintf(tw, "Filter expression:\t%q (%d eBPF instructions)\n", p.FilterExpr, p.FilterExprInsns)
+	}
+	fmt.Fprintf(tw, "Estimated attach time:\t%s\n", p.AttachTime().Round(time.Millisecond))
+}
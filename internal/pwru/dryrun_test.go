@@ -0,0 +1,42 @@
+package pwru
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	p := &Plan{
+		Backend:         BackendKprobe,
+		Funcs:           Funcs{"ip_rcv": 1, "ip_rcv_finish": 3, "kfree_skb_reason": 1},
+		Returns:         true,
+		Tracepoints:     []string{"skb:kfree_skb"},
+		Extra:           []planProbes{{"xdp", 2}},
+		Filters:         []string{"--filter-port=443"},
+		FilterExpr:      "tcp",
+		FilterExprInsns: 12,
+	}
+	if got := p.Probes(); got != 9 {
+		t.Errorf("Probes() = %d, want 9", got)
+	}
+	if got := p.AttachTime(); got != 60*time.Millisecond {
+		t.Errorf("AttachTime() = %s, want 60ms", got)
+	}
+
+	var b bytes.Buffer
+	p.Print(&b)
+	want := `Backend:                kprobe
+Functions:              3 (skb arg 1: 2, skb arg 3: 1)
+Returns:                3
+Probes for xdp:         2
+Tracepoints:            skb:kfree_skb
+Total probes:           9
+Filters:                --filter-port=443
+Filter expression:      "tcp" (12 eBPF instructions)
+Estimated attach time:  60ms
+`
+	if got := b.String(); got != want {
+		t.Errorf("Print() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/link"
+)
+
+const fexitProg = "fexit_skb"
+
+// Fentry attaches the fentry and fexit programs of --backend=fentry. A
+// trampoline program targets a single function, so one program is loaded per
+// traced function. The programs share the maps of the kprobe objects, which
+// still provide the other probes and the fallbacks.
+type Fentry struct {
+	spec *ebpf.CollectionSpec
+	opts ebpf.CollectionOptions
+	// The global data maps of the fentry objects, created once for all the
+	// programs.
+	globals []*ebpf.Map
+}
+
+// NewFentry prepares the loading of the fentry programs from spec, whose
+// maps are replaced with the ones of objs.
+func NewFentry(spec *ebpf.CollectionSpec, objs KProbeMaps, kernelTypes *btf.Spec) (*Fentry, error) {
+	maps := map[string]*ebpf.Map{
+		"cfg_map":          objs.GetCfgMap(),
+		"events":           objs.GetEvents(),
+		"events_rb":        objs.GetEventsRb(),
+		"lost_events":      objs.GetLostEvents(),
+		"print_stack_map":  objs.GetPrintStackMap(),
+		"capture_buf":      objs.GetCaptureBuf(),
+		"full_capture_buf": objs.GetFullCaptureBuf(),
+		"ret_stacks":       objs.GetRetStacks(),
+		"filter_buf_map":   objs.GetFilterBufMap(),
+		"cgroup_map":       objs.GetCgroupMap(),
+		"saddr_lpm":        objs.GetSaddrLpm(),
+		"daddr_lpm":        objs.GetDaddrLpm(),
+		"skb_parents":      objs.GetSkbParents(),
+		"clone_origins":    objs.GetCloneOrigins(),
+		"latency_hists":    objs.GetLatencyHists(),
+		"aggregates":       objs.GetAggregates(),
+	}
+	if withSkb, ok := objs.(KProbeMapsWithOutputSKB); ok {
+		maps["print_skb_map"] = withSkb.GetPrintSkbMap()
+	}
+
+	f := &Fentry{spec: spec}
+	replacements := map[string]*ebpf.Map{}
+	for name, ms := range spec.Maps {
+		if m, ok := maps[name]; ok {
+			replacements[name] = m
+			continue
+		}
+		if !strings.HasPrefix(name, ".") {
+			f.Close()
+			return nil, fmt.Errorf("map %s is not shared with the kprobe objects", name)
+		}
+		m, err := ebpf.NewMap(ms)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create map %s: %w", name, err)
+		}
+		f.globals = append(f.globals, m)
+		replacements[name] = m
+	}
+
+	f.opts.Programs.KernelTypes = kernelTypes
+	f.opts.MapReplacements = replacements
+	return f, nil
+}
+
+func (f *Fentry) load(progName, funcName string) (*ebpf.Program, error) {
+	ps, ok := f.spec.Programs[progName]
+	if !ok {
+		return nil, fmt.Errorf("program %s not found", progName)
+	}
+	ps = ps.Copy()
+	ps.AttachTo = funcName
+
+	spec := &ebpf.CollectionSpec{
+		Maps:      f.spec.Maps,
+		Programs:  map[string]*ebpf.ProgramSpec{progName: ps},
+		Types:     f.spec.Types,
+		ByteOrder: f.spec.ByteOrder,
+	}
+	coll, err := ebpf.NewCollectionWithOptions(spec, f.opts)
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	return coll.DetachProgram(progName), nil
+}
+
+func (f *Fentry) attach(progName, funcName string) (link.Link, error) {
+	prog, err := f.load(progName, funcName)
+	if err != nil {
+		return nil, err
+	}
+	// The link holds a reference to the program
+	defer prog.Close()
+	return link.AttachTracing(link.TracingOptions{Program: prog})
+}
+
+// Attach attaches the fentry program to funcName, whose skb is the argument
+// at pos. It fails if the function can't be traced with a trampoline, e.g.
+// if it is not in the kernel BTF or the trampoline is full, in which case
+// the caller falls back to a kprobe.
+func (f *Fentry) Attach(funcName string, pos int) (link.Link, error) {
+	return f.attach(fmt.Sprintf("fentry_skb_%d", pos), funcName)
+}
+
+// AttachReturn attaches the fexit program to funcName.
+func (f *Fentry) AttachReturn(funcName string) (link.Link, error) {
+	return f.attach(fexitProg, funcName)
+}
+
+func (f *Fentry) Close() {
+	for _, m := range f.globals {
+		m.Close()
+	}
+}
@@ -0,0 +1,603 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/net/bpf"
+)
+
+// This file implements a compiler for a subset of the pcap-filter(7) syntax
+// into classic BPF. The packets are matched from the network header, i.e.
+// as raw IPv4/IPv6 packets. Supported primitives:
+//
+//	ip, ip6, tcp, udp, sctp, icmp, icmp6
+//	[ip|ip6] proto <num|name>
+//	[src|dst] host <addr>
+//	[src|dst] net <cidr>
+//	[tcp|udp|sctp] [src|dst] port <num>
+//	[tcp|udp|sctp] [src|dst] portrange <num>-<num>
+//	len <op> <num>, greater <num>, less <num>
+//
+// combined with and/&&, or/||, not/! and parentheses.
+
+// filterExprAccept is the return value of a matching cBPF program, as with
+// tcpdump it is the snap length.
+const filterExprAccept = 262144
+
+// exprNode is a node of the filter expression tree.
+type exprNode interface{}
+
+type exprAnd struct{ a, b exprNode }
+type exprOr struct{ a, b exprNode }
+type exprNot struct{ a exprNode }
+type exprTrue struct{}
+
+// exprTest is a leaf of the tree comparing a packet field to a value.
+type exprTest struct {
+	load  exprLoad
+	mask  uint32 // if non-zero, the field is masked before the comparison
+	cond  bpf.JumpTest
+	value uint32
+}
+
+type exprLoadKind int
+
+const (
+	loadAbs exprLoadKind = iota // at a fixed offset from the network header
+	loadL4                      // at a fixed offset from the IPv4 L4 header
+	loadLen                     // the packet length
+)
+
+type exprLoad struct {
+	kind exprLoadKind
+	off  uint32
+	size int
+}
+
+func and(nodes ...exprNode) exprNode {
+	n := nodes[0]
+	for _, o := range nodes[1:] {
+		n = exprAnd{n, o}
+	}
+	return n
+}
+
+func or(nodes ...exprNode) exprNode {
+	n := nodes[0]
+	for _, o := range nodes[1:] {
+		n = exprOr{n, o}
+	}
+	return n
+}
+
+func test(kind exprLoadKind, off uint32, size int, cond bpf.JumpTest, value uint32) exprTest {
+	return exprTest{load: exprLoad{kind: kind, off: off, size: size}, cond: cond, value: value}
+}
+
+func isIPv4() exprNode {
+	t := test(loadAbs, 0, 1, bpf.JumpEqual, 0x40)
+	t.mask = 0xf0
+	return t
+}
+
+func isIPv6() exprNode {
+	t := test(loadAbs, 0, 1, bpf.JumpEqual, 0x60)
+	t.mask = 0xf0
+	return t
+}
+
+func isL4Proto(proto uint8) exprNode {
+	return or(
+		and(isIPv4(), test(loadAbs, 9, 1, bpf.JumpEqual, uint32(proto))),
+		and(isIPv6(), test(loadAbs, 6, 1, bpf.JumpEqual, uint32(proto))))
+}
+
+type exprDir int
+
+const (
+	dirAny exprDir = iota // src or dst
+	dirSrc
+	dirDst
+)
+
+func byDir(dir exprDir, src, dst exprNode) exprNode {
+	switch dir {
+	case dirSrc:
+		return src
+	case dirDst:
+		return dst
+	default:
+		return or(src, dst)
+	}
+}
+
+// matchAddr compares the address at off with addr under mask, word by word.
+func matchAddr(off uint32, addr, mask []byte) exprNode {
+	var tests []exprNode
+	for i := 0; i < len(addr); i += 4 {
+		m := binary.BigEndian.Uint32(mask[i:])
+		if m == 0 {
+			continue
+		}
+		t := test(loadAbs, off+uint32(i), 4, bpf.JumpEqual, binary.BigEndian.Uint32(addr[i:])&m)
+		if m != 0xffffffff {
+			t.mask = m
+		}
+		tests = append(tests, t)
+	}
+	if len(tests) == 0 {
+		return exprTrue{}
+	}
+	return and(tests...)
+}
+
+func matchNet(dir exprDir, ipnet *net.IPNet) exprNode {
+	if ip4 := ipnet.IP.To4(); ip4 != nil {
+		mask := ipnet.Mask
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+		return and(isIPv4(), byDir(dir, matchAddr(12, ip4, mask), matchAddr(16, ip4, mask)))
+	}
+	return and(isIPv6(), byDir(dir, matchAddr(8, ipnet.IP, ipnet.Mask), matchAddr(24, ipnet.IP, ipnet.Mask)))
+}
+
+func matchPortRange(protos []uint8, dir exprDir, lo, hi uint16) exprNode {
+	port := func(kind exprLoadKind, off uint32) exprNode {
+		if lo == hi {
+			return test(kind, off, 2, bpf.JumpEqual, uint32(lo))
+		}
+		return and(test(kind, off, 2, bpf.JumpGreaterOrEqual, uint32(lo)),
+			test(kind, off, 2, bpf.JumpLessOrEqual, uint32(hi)))
+	}
+
+	var v4Protos, v6Protos []exprNode
+	for _, p := range protos {
+		v4Protos = append(v4Protos, test(loadAbs, 9, 1, bpf.JumpEqual, uint32(p)))
+		v6Protos = append(v6Protos, test(loadAbs, 6, 1, bpf.JumpEqual, uint32(p)))
+	}
+
+	// Only the first IPv4 fragment has the L4 header
+	notFragment := exprNot{exprTest{load: exprLoad{kind: loadAbs, off: 6, size: 2}, cond: bpf.JumpBitsSet, value: 0x1fff}}
+	// As in tcpdump, IPv6 extension headers are not skipped
+	return or(
+		and(isIPv4(), or(v4Protos...), notFragment, byDir(dir, port(loadL4, 0), port(loadL4, 2))),
+		and(isIPv6(), or(v6Protos...), byDir(dir, port(loadAbs, 40), port(loadAbs, 42))))
+}
+
+var exprProtos = map[string]uint8{
+	"tcp":   syscall.IPPROTO_TCP,
+	"udp":   syscall.IPPROTO_UDP,
+	"sctp":  syscall.IPPROTO_SCTP,
+	"icmp":  syscall.IPPROTO_ICMP,
+	"icmp6": syscall.IPPROTO_ICMPV6,
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func tokenizeFilterExpr(expr string) []string {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			flush()
+		case c == '(' || c == ')':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == '!' || c == '<' || c == '>' || c == '=' || c == '&' || c == '|':
+			flush()
+			op := string(c)
+			if i+1 < len(expr) && strings.ContainsRune("=&|", rune(expr[i+1])) {
+				op += string(expr[i+1])
+				i++
+			}
+			tokens = append(tokens, op)
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	t := p.peek()
+	if t != "" {
+		p.pos++
+	}
+	return t
+}
+
+// parseExpr parses a list of primitives joined by and/or. As in pcap-filter,
+// both have the same precedence and associate left to right.
+func (p *exprParser) parseExpr() (exprNode, error) {
+	n, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op != "and" && op != "&&" && op != "or" && op != "||" {
+			return n, nil
+		}
+		p.next()
+		o, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "and" || op == "&&" {
+			n = exprAnd{n, o}
+		} else {
+			n = exprOr{n, o}
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	switch p.peek() {
+	case "not", "!":
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{n}, nil
+	case "(":
+		p.next()
+		n, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return n, nil
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return p.parsePrimitive()
+}
+
+func (p *exprParser) parsePrimitive() (exprNode, error) {
+	var family string // "ip" or "ip6"
+	var proto string  // one of exprProtos
+	dir := dirAny
+
+	switch t := p.peek(); t {
+	case "ip", "ip6":
+		family = p.next()
+	case "len", "greater", "less":
+		return p.parseLen()
+	default:
+		if _, ok := exprProtos[t]; ok {
+			proto = p.next()
+		}
+	}
+
+	switch p.peek() {
+	case "src":
+		p.next()
+		dir = dirSrc
+	case "dst":
+		p.next()
+		dir = dirDst
+	}
+
+	switch t := p.peek(); t {
+	case "host", "net":
+		p.next()
+		return p.parseAddr(family, proto, dir, t == "net")
+	case "port", "portrange":
+		p.next()
+		return p.parsePort(family, proto, dir, t == "portrange")
+	case "proto":
+		if proto != "" || dir != dirAny {
+			return nil, fmt.Errorf("unexpected %q", t)
+		}
+		p.next()
+		return p.parseProto(family)
+	}
+
+	if dir != dirAny {
+		// "src 10.0.0.1" is a shorthand for "src host 10.0.0.1"
+		return p.parseAddr(family, proto, dir, strings.Contains(p.peek(), "/"))
+	}
+
+	switch {
+	case proto == "icmp":
+		return and(isIPv4(), test(loadAbs, 9, 1, bpf.JumpEqual, syscall.IPPROTO_ICMP)), nil
+	case proto == "icmp6":
+		return and(isIPv6(), test(loadAbs, 6, 1, bpf.JumpEqual, syscall.IPPROTO_ICMPV6)), nil
+	case proto != "":
+		return isL4Proto(exprProtos[proto]), nil
+	case family == "ip":
+		return isIPv4(), nil
+	case family == "ip6":
+		return isIPv6(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported primitive %q", p.peek())
+}
+
+func (p *exprParser) parseAddr(family, proto string, dir exprDir, isNet bool) (exprNode, error) {
+	if proto != "" {
+		return nil, fmt.Errorf("%s can't be combined with host/net", proto)
+	}
+
+	s := p.next()
+	var ipnet *net.IPNet
+	if strings.Contains(s, "/") {
+		if !isNet {
+			return nil, fmt.Errorf("host %s: use net for prefixes", s)
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		ipnet = n
+	} else {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		bits := net.IPv6len * 8
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, net.IPv4len*8
+		}
+		ipnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+
+	isV4 := ipnet.IP.To4() != nil
+	if (family == "ip" && !isV4) || (family == "ip6" && isV4) {
+		return nil, fmt.Errorf("address %s does not match %s", s, family)
+	}
+
+	return matchNet(dir, ipnet), nil
+}
+
+func (p *exprParser) parsePort(family, proto string, dir exprDir, isRange bool) (exprNode, error) {
+	s := p.next()
+	lo, hi := s, s
+	if isRange {
+		var ok bool
+		if lo, hi, ok = strings.Cut(s, "-"); !ok {
+			return nil, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	loPort, err := strconv.ParseUint(lo, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", lo)
+	}
+	hiPort, err := strconv.ParseUint(hi, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", hi)
+	}
+	if loPort > hiPort {
+		loPort, hiPort = hiPort, loPort
+	}
+
+	protos := []uint8{syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_SCTP}
+	switch proto {
+	case "":
+	case "tcp", "udp", "sctp":
+		protos = []uint8{exprProtos[proto]}
+	default:
+		return nil, fmt.Errorf("%s has no ports", proto)
+	}
+
+	n := matchPortRange(protos, dir, uint16(loPort), uint16(hiPort))
+	switch family {
+	case "ip":
+		n = and(isIPv4(), n)
+	case "ip6":
+		n = and(isIPv6(), n)
+	}
+	return n, nil
+}
+
+func (p *exprParser) parseProto(family string) (exprNode, error) {
+	s := p.next()
+	proto, ok := exprProtos[s]
+	if !ok {
+		n, err := strconv.ParseUint(s, 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protocol %q", s)
+		}
+		proto = uint8(n)
+	}
+
+	v4 := and(isIPv4(), test(loadAbs, 9, 1, bpf.JumpEqual, uint32(proto)))
+	v6 := and(isIPv6(), test(loadAbs, 6, 1, bpf.JumpEqual, uint32(proto)))
+	switch family {
+	case "ip":
+		return v4, nil
+	case "ip6":
+		return v6, nil
+	}
+	return or(v4, v6), nil
+}
+
+func (p *exprParser) parseLen() (exprNode, error) {
+	op := p.next()
+	switch op {
+	case "greater":
+		op = ">="
+	case "less":
+		op = "<="
+	default:
+		op = p.next()
+	}
+
+	s := p.next()
+	n, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid length %q", s)
+	}
+
+	conds := map[string]bpf.JumpTest{
+		"=":  bpf.JumpEqual,
+		"==": bpf.JumpEqual,
+		"!=": bpf.JumpNotEqual,
+		">":  bpf.JumpGreaterThan,
+		">=": bpf.JumpGreaterOrEqual,
+		"<":  bpf.JumpLessThan,
+		"<=": bpf.JumpLessOrEqual,
+	}
+	cond, ok := conds[op]
+	if !ok {
+		return nil, fmt.Errorf("invalid operator %q", op)
+	}
+	return test(loadLen, 0, 4, cond, uint32(n)), nil
+}
+
+// exprInsn is a cBPF instruction whose jump targets are labels, which are
+// resolved to relative skips once all the instructions have been emitted.
+type exprInsn struct {
+	ins    bpf.Instruction
+	jt, jf int // labels for conditional jumps, jt only for bpf.Jump
+}
+
+type exprCodegen struct {
+	insns  []exprInsn
+	labels []int // label => instruction index
+}
+
+func (g *exprCodegen) newLabel() int {
+	g.labels = append(g.labels, -1)
+	return len(g.labels) - 1
+}
+
+func (g *exprCodegen) setLabel(l int) {
+	g.labels[l] = len(g.insns)
+}
+
+func (g *exprCodegen) emit(ins bpf.Instruction) {
+	g.insns = append(g.insns, exprInsn{ins: ins, jt: -1, jf: -1})
+}
+
+// gen emits the code for n jumping to t if it matches, to f otherwise.
+func (g *exprCodegen) gen(n exprNode, t, f int) {
+	switch n := n.(type) {
+	case exprAnd:
+		mid := g.newLabel()
+		g.gen(n.a, mid, f)
+		g.setLabel(mid)
+		g.gen(n.b, t, f)
+	case exprOr:
+		mid := g.newLabel()
+		g.gen(n.a, t, mid)
+		g.setLabel(mid)
+		g.gen(n.b, t, f)
+	case exprNot:
+		g.gen(n.a, f, t)
+	case exprTrue:
+		g.insns = append(g.insns, exprInsn{ins: bpf.Jump{}, jt: t, jf: -1})
+	case exprTest:
+		switch n.load.kind {
+		case loadAbs:
+			g.emit(bpf.LoadAbsolute{Off: n.load.off, Size: n.load.size})
+		case loadL4:
+			g.emit(bpf.LoadMemShift{Off: 0})
+			g.emit(bpf.LoadIndirect{Off: n.load.off, Size: n.load.size})
+		case loadLen:
+			g.emit(bpf.LoadExtension{Num: bpf.ExtLen})
+		}
+		if n.mask != 0 {
+			g.emit(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: n.mask})
+		}
+		g.insns = append(g.insns, exprInsn{ins: bpf.JumpIf{Cond: n.cond, Val: n.value}, jt: t, jf: f})
+	}
+}
+
+func (g *exprCodegen) resolve() ([]bpf.Instruction, error) {
+	skip := func(i, label int) (uint32, error) {
+		target := g.labels[label]
+		if target <= i {
+			return 0, fmt.Errorf("backward jump")
+		}
+		return uint32(target - i - 1), nil
+	}
+
+	insns := make([]bpf.Instruction, 0, len(g.insns))
+	for i, insn := range g.insns {
+		switch ins := insn.ins.(type) {
+		case bpf.Jump:
+			s, err := skip(i, insn.jt)
+			if err != nil {
+				return nil, err
+			}
+			ins.Skip = s
+			insns = append(insns, ins)
+		case bpf.JumpIf:
+			st, err := skip(i, insn.jt)
+			if err != nil {
+				return nil, err
+			}
+			sf, err := skip(i, insn.jf)
+			if err != nil {
+				return nil, err
+			}
+			if st > 255 || sf > 255 {
+				return nil, fmt.Errorf("filter expression is too complex")
+			}
+			ins.SkipTrue, ins.SkipFalse = uint8(st), uint8(sf)
+			insns = append(insns, ins)
+		default:
+			insns = append(insns, ins)
+		}
+	}
+	return insns, nil
+}
+
+// CompileFilterExpr compiles the pcap-filter expression into a cBPF program
+// matching packets starting from the network header.
+func CompileFilterExpr(expr string) ([]bpf.Instruction, error) {
+	p := &exprParser{tokens: tokenizeFilterExpr(expr)}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse filter expression: %w", err)
+	}
+	if t := p.peek(); t != "" {
+		return nil, fmt.Errorf("failed to parse filter expression: unexpected %q", t)
+	}
+
+	g := &exprCodegen{}
+	accept, reject := g.newLabel(), g.newLabel()
+	g.gen(n, accept, reject)
+	g.setLabel(accept)
+	g.emit(bpf.RetConstant{Val: filterExprAccept})
+	g.setLabel(reject)
+	g.emit(bpf.RetConstant{Val: 0})
+
+	insns, err := g.resolve()
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile filter expression: %w", err)
+	}
+	return insns, nil
+}
@@ -0,0 +1,116 @@
+package pwru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func ipv4Packet(proto uint8, src, dst string, sport, dport uint16) []byte {
+	pkt := make([]byte, 20+8)
+	pkt[0] = 0x45
+	binary.BigEndian.PutUint16(pkt[2:], uint16(len(pkt)))
+	pkt[9] = proto
+	copy(pkt[12:], net.ParseIP(src).To4())
+	copy(pkt[16:], net.ParseIP(dst).To4())
+	binary.BigEndian.PutUint16(pkt[20:], sport)
+	binary.BigEndian.PutUint16(pkt[22:], dport)
+	return pkt
+}
+
+func ipv6Packet(proto uint8, src, dst string, sport, dport uint16) []byte {
+	pkt := make([]byte, 40+8)
+	pkt[0] = 0x60
+	pkt[6] = proto
+	copy(pkt[8:], net.ParseIP(src).To16())
+	copy(pkt[24:], net.ParseIP(dst).To16())
+	binary.BigEndian.PutUint16(pkt[40:], sport)
+	binary.BigEndian.PutUint16(pkt[42:], dport)
+	return pkt
+}
+
+func TestCompileFilterExpr(t *testing.T) {
+	tcp4 := ipv4Packet(syscall.IPPROTO_TCP, "10.0.0.5", "10.0.1.1", 40000, 443)
+	udp4 := ipv4Packet(syscall.IPPROTO_UDP, "10.0.0.6", "8.8.8.8", 40000, 53)
+	udp6 := ipv6Packet(syscall.IPPROTO_UDP, "fd00::1", "fd00:1::2", 40000, 53)
+	frag4 := ipv4Packet(syscall.IPPROTO_TCP, "10.0.0.5", "10.0.1.1", 40000, 443)
+	binary.BigEndian.PutUint16(frag4[6:], 100)
+
+	tests := []struct {
+		expr string
+		pkt  []byte
+		want bool
+	}{
+		{"tcp and dst port 443 and host 10.0.0.5", tcp4, true},
+		{"tcp and dst port 443 and host 10.0.0.6", tcp4, false},
+		{"tcp and src port 443", tcp4, false},
+		{"tcp port 443", frag4, false},
+		{"udp port 53", udp4, true},
+		{"udp port 53", udp6, true},
+		{"ip6 and udp", udp4, false},
+		{"ip6 and udp", udp6, true},
+		{"src net 10.0.0.0/24", tcp4, true},
+		{"dst net 10.0.0.0/24", tcp4, false},
+		{"net fd00::/64", udp6, true},
+		{"dst net fd00::/64", udp6, false},
+		{"dst host fd00:1::2", udp6, true},
+		{"portrange 400-500", tcp4, true},
+		{"tcp portrange 50-52", udp4, false},
+		{"not tcp", udp4, true},
+		{"!(tcp or udp)", udp6, false},
+		{"icmp or udp and dst 8.8.8.8", udp4, true},
+		{"ip proto udp", udp4, true},
+		{"proto 17", udp6, true},
+		{"len >= 28", tcp4, true},
+		{"greater 29", tcp4, false},
+		{"less 28", tcp4, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			insns, err := CompileFilterExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("CompileFilterExpr() error = %v", err)
+			}
+			vm, err := bpf.NewVM(insns)
+			if err != nil {
+				t.Fatalf("NewVM() error = %v", err)
+			}
+			n, err := vm.Run(tt.pkt)
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if got := n != 0; got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+
+			ebpf, err := cbpfToEBPF(insns)
+			if err != nil {
+				t.Fatalf("cbpfToEBPF() error = %v", err)
+			}
+			if err := ebpf.Marshal(&bytes.Buffer{}, binary.LittleEndian); err != nil {
+				t.Errorf("Marshal() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestCompileFilterExpr_errors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"tcp and",
+		"(tcp",
+		"host 10.0.0.0/8",
+		"ip host fd00::1",
+		"icmp port 80",
+		"port 70000",
+		"foo",
+	} {
+		if _, err := CompileFilterExpr(expr); err == nil {
+			t.Errorf("CompileFilterExpr(%q) succeeded, want an error", expr)
+		}
+	}
+}
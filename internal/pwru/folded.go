@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// foldedStacks counts the events per stack for --export-folded, in the
+// folded format of flamegraph.pl and speedscope: the frames from the
+// outermost one separated by ";", followed by the number of events.
+type foldedStacks struct {
+	path   string
+	counts map[string]uint64
+}
+
+func newFoldedStacks(path string) *foldedStacks {
+	return &foldedStacks{path: path, counts: map[string]uint64{}}
+}
+
+// foldedFrame returns the function of a symbolized address, named as the
+// traced functions, e.g. "ip_rcv" for "ip_rcv+0x5", or "[unknown]".
+func foldedFrame(sym string) string {
+	if strings.HasSuffix(sym, " (unknown)") {
+		return "[unknown]"
+	}
+	name, module, _ := strings.Cut(sym, " ")
+	if i := strings.LastIndex(name, "+0x"); i != -1 {
+		name = name[:i]
+	}
+	if module != "" {
+		name += " " + module
+	}
+	return name
+}
+
+// add counts an event of the function, with its stack from the innermost
+// frame. The function is the leaf of the stack, if not already its innermost
+// frame.
+func (f *foldedStacks) add(funcName string, stack []string) {
+	frames := make([]string, 0, len(stack)+1)
+	for i := len(stack) - 1; i >= 0; i-- {
+		frames = append(frames, foldedFrame(stack[i]))
+	}
+	if len(frames) == 0 || frames[len(frames)-1] != funcName {
+		frames = append(frames, funcName)
+	}
+	f.counts[strings.Join(frames, ";")]++
+}
+
+func (f *foldedStacks) writeFile() error {
+	file, err := createOutputFile(f.path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	f.write(w)
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (f *foldedStacks) write(w io.Writer) {
+	stacks := make([]string, 0, len(f.counts))
+	for s := range f.counts {
+		stacks = append(stacks, s)
+	}
+	sort.Strings(stacks)
+	for _, s := range stacks {
+		fmt.Fprintf(w, "%s %d\n", s, f.counts[s])
+	}
+}
@@ -0,0 +1,26 @@
+package pwru
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFoldedStacks(t *testing.T) {
+	f := newFoldedStacks("")
+	stack := []string{"ip_rcv+0x1", "__netif_receive_skb_one_core+0x85", "0xffffffffc0001234 (unknown)"}
+	f.add("ip_rcv", stack)
+	f.add("ip_rcv", stack)
+	f.add("ovs_vport_receive [openvswitch]", []string{"netdev_frame_hook+0x10 [openvswitch]"})
+	// Without a stack
+	f.add("kfree_skbmem", nil)
+
+	var buf bytes.Buffer
+	f.write(&buf)
+	want := `[unknown];__netif_receive_skb_one_core;ip_rcv 2
+kfree_skbmem 1
+netdev_frame_hook [openvswitch];ovs_vport_receive [openvswitch] 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+)
+
+// eventFormatter writes the printed events in an output format. All the
+// printing goes through the formatter of --output-format, or the one of
+// --output-template if given.
+type eventFormatter interface {
+	// PrintHeader writes the header of the output, if any. It is called
+	// at the start of the output, and of each rotated output file.
+	PrintHeader(w io.Writer)
+	PrintEvent(w io.Writer, event *eventInfo)
+}
+
+// eventFormatterFunc creates a formatter for the output, whose flags and
+// helpers (e.g. newJSONEvent()) it may use.
+type eventFormatterFunc func(o *output) (eventFormatter, error)
+
+var eventFormatters = map[string]eventFormatterFunc{}
+
+// registerEventFormatter makes a formatter available as --output-format=name.
+// It is meant to be called from init(), e.g. in a file next to this one.
+func registerEventFormatter(name string, newFormatter eventFormatterFunc) {
+	if _, ok := eventFormatters[name]; ok {
+		panic(fmt.Sprintf("output format %s registered twice", name))
+	}
+	eventFormatters[name] = newFormatter
+}
+
+// OutputFormats returns the names of the registered output formats.
+func OutputFormats() []string {
+	names := make([]string, 0, len(eventFormatters))
+	for name := range eventFormatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HaveOutputFormat returns whether a formatter is registered for name.
+func HaveOutputFormat(name string) bool {
+	_, ok := eventFormatters[name]
+	return ok
+}
+
+func init() {
+	registerEventFormatter(OutputFormatText, func(o *output) (eventFormatter, error) {
+		return textFormatter{o}, nil
+	})
+	newJSON := func(o *output) (eventFormatter, error) {
+		return jsonFormatter{o}, nil
+	}
+	registerEventFormatter(OutputFormatJSON, newJSON)
+	registerEventFormatter(OutputFormatNDJSON, newJSON)
+	registerEventFormatter(OutputFormatCSV, func(o *output) (eventFormatter, error) {
+		return csvFormatter{o}, nil
+	})
+	registerEventFormatter(OutputFormatNone, func(o *output) (eventFormatter, error) {
+		return noneFormatter{}, nil
+	})
+}
+
+// textFormatter prints a table, with the optional fields appended to the
+// columns.
+type textFormatter struct {
+	o *output
+}
+
+func (f textFormatter) PrintHeader(w io.Writer) {
+	fmt.Fprintf(w, "%18s %6s %16s %24s", "SKB", "CPU", "PROCESS", "FUNC")
+	switch unit := f.o.flags.TimestampUnit; {
+	case f.o.flags.OutputTS == "absolute-date":
+		fmt.Fprintf(w, " %35s", "TIMESTAMP")
+	case f.o.flags.OutputTS == "none":
+	case unit != "" && unit != "ns":
+		fmt.Fprintf(w, " %16s", "TIMESTAMP("+unit+")")
+	default:
+		fmt.Fprintf(w, " %16s", "TIMESTAMP")
+	}
+	if f.o.flags.OutputDelta {
+		fmt.Fprintf(w, " %12s", "DELTA(us)")
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+func (f textFormatter) PrintEvent(w io.Writer, event *eventInfo) {
+	f.o.printText(w, event)
+}
+
+type jsonFormatter struct {
+	o *output
+}
+
+func (f jsonFormatter) PrintHeader(w io.Writer) {}
+
+func (f jsonFormatter) PrintEvent(w io.Writer, event *eventInfo) {
+	f.o.printJSON(w, event)
+}
+
+type templateFormatter struct {
+	o *output
+}
+
+func (f templateFormatter) PrintHeader(w io.Writer) {}
+
+func (f templateFormatter) PrintEvent(w io.Writer, event *eventInfo) {
+	f.o.printTemplate(w, event)
+}
+
+// noneFormatter prints nothing, e.g. to only stream the events via
+// --grpc-addr.
+type noneFormatter struct{}
+
+func (noneFormatter) PrintHeader(w io.Writer)                  {}
+func (noneFormatter) PrintEvent(w io.Writer, event *eventInfo) {}
+
+var csvColumns = []string{
+	"skb", "cpu", "process", "func", "timestamp", "delta_us",
+	"netns", "mark", "ifindex", "len",
+	"saddr", "sport", "daddr", "dport", "proto", "tcp_flags",
+	"retval", "latency_us", "drop_reason",
+}
+
+// csvFormatter prints a fixed set of columns, whatever the output flags, to
+// be loaded e.g. in a spreadsheet. The columns which don't apply to an event
+// are left empty.
+type csvFormatter struct {
+	o *output
+}
+
+func (f csvFormatter) PrintHeader(w io.Writer) {
+	f.write(w, csvColumns)
+}
+
+func (f csvFormatter) PrintEvent(w io.Writer, event *eventInfo) {
+	ev := f.o.newJSONEvent(event, true)
+
+	ts := ev.Time
+	if ev.Timestamp != nil {
+		ts = timestampToStr(*ev.Timestamp, f.o.flags.TimestampUnit)
+	}
+	var latency string
+	if ev.LatencyUs != nil {
+		latency = strconv.FormatFloat(*ev.LatencyUs, 'f', 3, 64)
+	}
+	record := []string{
+		ev.Skb, strconv.Itoa(int(ev.CPU)), event.process(), ev.Func, ts,
+		strconv.FormatFloat(*ev.DeltaUs, 'f', 3, 64),
+		strconv.Itoa(int(ev.Meta.Netns)), fmt.Sprintf("0x%x", ev.Meta.Mark),
+		strconv.Itoa(int(ev.Meta.Ifindex)), strconv.Itoa(int(ev.Meta.Len)),
+		"", "", "", "", "", "",
+		ev.Retval, latency, ev.DropReason,
+	}
+	if event.Tuple.L3Proto != 0 {
+		t := ev.Tuple
+		copy(record[10:16], []string{
+			t.Saddr.String(), strconv.Itoa(int(t.Sport)),
+			t.Daddr.String(), strconv.Itoa(int(t.Dport)),
+			t.Proto, t.Flags,
+		})
+	}
+	f.write(w, record)
+}
+
+func (f csvFormatter) write(w io.Writer, record []string) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(record); err != nil {
+		log.Printf("Failed to write CSV record: %s", err)
+		return
+	}
+	cw.Flush()
+}
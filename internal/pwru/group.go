@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	// The oldest groups are printed beforehand once beyond, as the skbs
+	// missing their free function, e.g. if filtered out, are never done
+	groupMaxSkbs  = 4096
+	groupMaxBytes = 64 << 20
+)
+
+// skbFreeFuncs are the functions which end the lifetime of an skb. Once one
+// of them has been seen, the group of the skb is complete and can be printed.
+var skbFreeFuncs = map[string]bool{
+	"kfree_skbmem":       true,
+	"napi_skb_cache_put": true,
+}
+
+// isSkbDrop returns whether the function frees the skb as dropped, as
+// opposed to consume_skb() or the drop reason functions with SKB_CONSUMED.
+func isSkbDrop(funcName, dropReason string) bool {
+	return funcName == "kfree_skb" || (dropReasonFuncs[funcName] && dropReason != "SKB_CONSUMED")
+}
+
+// skbGroups buffers the rendered events per skb address, or per packet with
+// --track-by=tuple, so that the full path of a single packet can be printed
+// as one block. With onlyDrops, the groups of the skbs which were not
+// dropped are discarded. Beyond maxSkbs groups or maxBytes buffered, the
+// oldest groups are flushed before they are complete.
+type skbGroups struct {
+	bufs      map[uint64]*bytes.Buffer
+	order     []uint64 // skb addrs in order of their first event
+	onlyDrops bool
+	dropped   map[uint64]bool
+	header    string // of the line above the indented groups, with their key
+
+	maxSkbs  int
+	maxBytes int
+	size     int // of the buffers, until last was written to
+	last     *bytes.Buffer
+	lastLen  int
+}
+
+func newSkbGroups(onlyDrops bool) *skbGroups {
+	return &skbGroups{
+		bufs:      map[uint64]*bytes.Buffer{},
+		onlyDrops: onlyDrops,
+		dropped:   map[uint64]bool{},
+		header:    "SKB 0x%x:\n",
+		maxSkbs:   groupMaxSkbs,
+		maxBytes:  groupMaxBytes,
+	}
+}
+
+// drop marks the skb as dropped.
+func (g *skbGroups) drop(skb uint64) {
+	g.dropped[skb] = true
+}
+
+// buffer returns the buffer of the events of the skb, flushing the oldest
+// groups other than the one of the skb to w if over the limits.
+func (g *skbGroups) buffer(w io.Writer, skb uint64, indent bool) *bytes.Buffer {
+	g.account()
+	buf, ok := g.bufs[skb]
+	for len(g.order) > 0 && ((!ok && len(g.bufs) >= g.maxSkbs) || g.size > g.maxBytes) {
+		oldest := g.order[0]
+		if oldest == skb {
+			if len(g.order) == 1 {
+				break
+			}
+			oldest = g.order[1]
+		}
+		g.flush(w, oldest, indent)
+	}
+	if !ok {
+		buf = &bytes.Buffer{}
+		g.bufs[skb] = buf
+		g.order = append(g.order, skb)
+	}
+	g.last, g.lastLen = buf, buf.Len()
+	return buf
+}
+
+// account adds what was written to the last returned buffer to the size.
+func (g *skbGroups) account() {
+	if g.last != nil {
+		g.size += g.last.Len() - g.lastLen
+		g.last = nil
+	}
+}
+
+// flush writes the buffered events of the skb to w, unless it must be
+// dropped and wasn't, and forgets them. If indent is set, the events are
+// printed as an indented block below a line carrying the skb address.
+func (g *skbGroups) flush(w io.Writer, skb uint64, indent bool) {
+	dropped := g.dropped[skb]
+	delete(g.dropped, skb)
+	buf, ok := g.bufs[skb]
+	if !ok {
+		return
+	}
+	g.account()
+	g.size -= buf.Len()
+	delete(g.bufs, skb)
+	for i, addr := range g.order {
+		if addr == skb {
+			g.order = append(g.order[:i], g.order[i+1:]...)
+			break
+		}
+	}
+	if g.onlyDrops && !dropped {
+		return
+	}
+
+	if !indent {
+		w.Write(buf.Bytes())
+		return
+	}
+
+	fmt.Fprintf(w, g.header, skb)
+	scanner := bufio.NewScanner(buf)
+	scanner.Buffer(nil, buf.Len()+1)
+	for scanner.Scan() {
+		fmt.Fprintf(w, "    %s\n", scanner.Text())
+	}
+	fmt.Fprintln(w)
+}
+
+// flushAll writes all the pending groups in order of their first event.
+func (g *skbGroups) flushAll(w io.Writer, indent bool) {
+	for len(g.order) > 0 {
+		g.flush(w, g.order[0], indent)
+	}
+}
@@ -0,0 +1,59 @@
+package pwru
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSkbGroups_limits(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxSkbs  int
+		maxBytes int
+		events   []uint64 // skb of each event
+		want     string   // flushed before the end
+	}{
+		{
+			name:     "within the limits",
+			maxSkbs:  3,
+			maxBytes: 100,
+			events:   []uint64{1, 2, 1, 3},
+			want:     "",
+		},
+		{
+			name:     "too many skbs",
+			maxSkbs:  2,
+			maxBytes: 100,
+			events:   []uint64{1, 2, 1, 3},
+			want:     "1\n1\n",
+		},
+		{
+			name:     "too many bytes",
+			maxSkbs:  3,
+			maxBytes: 5,
+			events:   []uint64{1, 1, 1, 2, 2, 3},
+			want:     "1\n1\n1\n",
+		},
+		{
+			name:     "not the group of the skb",
+			maxSkbs:  3,
+			maxBytes: 3,
+			events:   []uint64{1, 2, 1, 1},
+			want:     "2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newSkbGroups(false)
+			g.maxSkbs, g.maxBytes = tt.maxSkbs, tt.maxBytes
+			var w bytes.Buffer
+			for _, skb := range tt.events {
+				fmt.Fprintf(g.buffer(&w, skb, false), "%d\n", skb)
+			}
+			if got := w.String(); got != tt.want {
+				t.Errorf("flushed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
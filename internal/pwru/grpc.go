@@ -0,0 +1,236 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/cilium/pwru/api/v1/events"
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+// grpcSubscriberQueueLen is the number of events buffered per subscriber.
+// Events are dropped for the subscribers which can't keep up.
+const grpcSubscriberQueueLen = 4096
+
+// grpcServer streams the decoded events to the subscribers of the Events
+// service.
+type grpcServer struct {
+	events.UnimplementedEventsServer
+
+	server *grpc.Server
+
+	mu          sync.Mutex
+	subscribers map[chan *events.Event]struct{}
+}
+
+func newGRPCServer(addr string) (*grpcServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	s := &grpcServer{
+		server:      grpc.NewServer(),
+		subscribers: map[chan *events.Event]struct{}{},
+	}
+	events.RegisterEventsServer(s.server, s)
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil {
+			log.Printf("gRPC server stopped: %s", err)
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *grpcServer) Subscribe(_ *events.SubscribeRequest, stream events.Events_SubscribeServer) error {
+	ch := make(chan *events.Event, grpcSubscriberQueueLen)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case ev, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Publish sends the event to all the subscribers.
+func (s *grpcServer) Publish(event *eventInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.subscribers) == 0 {
+		return
+	}
+
+	ev := &events.Event{
+		Skb:        event.SAddr,
+		Cpu:        event.CPU,
+		Pid:        event.PID,
+		Process:    event.execName,
+		Func:       event.funcName,
+		Timestamp:  event.Timestamp,
+		Stack:      event.stack,
+		SkbDump:    event.skbDump,
+		DropReason: event.dropReason,
+		Pod:        event.pod,
+		Container:  event.container,
+		Payload:    event.payload,
+		Parent:     event.ParentAddr,
+	}
+	if event.Type == EventTypeReturn {
+		ev.Retval = retvalToStr(event.ParamNext)
+	}
+	if event.Meta.Ifindex != 0 || event.Meta.Netns != 0 {
+		ev.Meta = &events.Meta{
+			Netns:     event.Meta.Netns,
+			NetnsName: event.netnsName,
+			Mark:      event.Meta.Mark,
+			Ifindex:   event.Meta.Ifindex,
+			Ifname:    event.ifName,
+			Proto:     uint32(event.Meta.Proto),
+			Mtu:       event.Meta.MTU,
+			Len:       event.Meta.Len,
+			DataLen:   event.Meta.DataLen,
+			NrFrags:   uint32(event.Meta.NrFrags),
+			Linear:    event.Meta.Linear(),
+			IpSummed:  ipSummedToStr(event.Meta.IPSummed),
+
+			Hash:         event.Meta.Hash,
+			QueueMapping: uint32(event.Meta.QueueMapping),
+			Priority:     event.Meta.Priority,
+			TcClassid:    uint32(event.Meta.TCClassid),
+		}
+		if event.Meta.IPSummed == ChecksumPartial {
+			ev.Meta.CsumStart = uint32(event.Meta.CsumStart)
+			ev.Meta.CsumOffset = uint32(event.Meta.CsumOffset)
+		}
+		if event.Meta.VlanPresent != 0 {
+			ev.Meta.VlanPresent = true
+			ev.Meta.VlanId = uint32(event.Meta.VlanID())
+			ev.Meta.VlanPcp = uint32(event.Meta.VlanPCP())
+		}
+	}
+	if event.Tuple.L3Proto != 0 {
+		t := newJSONTuple(&event.Tuple)
+		ev.Tuple = &events.Tuple{
+			Saddr:    t.Saddr.String(),
+			Sport:    uint32(t.Sport),
+			Daddr:    t.Daddr.String(),
+			Dport:    uint32(t.Dport),
+			Proto:    t.Proto,
+			TcpFlags: t.Flags,
+			Seq:      t.Seq,
+			Ack:      t.Ack,
+			IcmpType: t.ICMPType,
+			IcmpCode: uint32(t.ICMPCode),
+		}
+	}
+
+	if event.Eth.Proto != 0 {
+		ev.Eth = &events.Eth{
+			Src:   net.HardwareAddr(event.Eth.Src[:]).String(),
+			Dst:   net.HardwareAddr(event.Eth.Dst[:]).String(),
+			Proto: uint32(byteorder.NetworkToHost16(event.Eth.Proto)),
+		}
+	}
+
+	if event.Sock.Addr != 0 {
+		sk := newJSONSock(&event.Sock, event.sockUser)
+		ev.Sock = &events.Sock{
+			Addr:   event.Sock.Addr,
+			Cookie: sk.Cookie,
+			Proto:  sk.Proto,
+			State:  sk.State,
+			Uid:    event.Sock.UID,
+			User:   sk.User,
+			Gid:    event.Sock.GID,
+		}
+	}
+
+	if event.Type == EventTypeXDP {
+		ev.Xdp = &events.XDP{
+			ProgId:   event.XDP.ProgID,
+			ProgName: cstr(event.XDP.ProgName[:]),
+			RxQueue:  event.XDP.RxQueue,
+			Verdict:  xdpVerdictToStr(event.XDP.Verdict),
+		}
+	}
+
+	if event.Type == EventTypeTC {
+		ev.Tc = &events.TC{
+			ProgId:   event.TC.ProgID,
+			ProgName: cstr(event.TC.ProgName[:]),
+			Dir:      tcDirToStr(event.TC.Ingress),
+			Verdict:  tcVerdictToStr(event.TC.Verdict),
+		}
+	}
+
+	if event.migrated != nil {
+		ev.Migration = &events.Migration{
+			PrevCpu:  event.migrated.cpu,
+			PrevFunc: event.migrated.funcName,
+		}
+	}
+
+	if event.Netfilter.Kind != 0 {
+		nf := newJSONNetfilter(&event.Netfilter)
+		ev.Netfilter = &events.Netfilter{
+			Family:  nf.Family,
+			Hook:    nf.Hook,
+			Table:   nf.Table,
+			Chain:   nf.Chain,
+			Verdict: nf.Verdict,
+		}
+	}
+
+	if event.conntrack != nil {
+		ev.Conntrack = &events.Conntrack{
+			State: ctInfoToStr(event.conntrack.CTInfo),
+			Zone:  uint32(event.conntrack.Zone),
+			Mark:  event.conntrack.Mark,
+		}
+	}
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Stop closes all the streams and stops the server.
+func (s *grpcServer) Stop() {
+	s.mu.Lock()
+	for ch := range s.subscribers {
+		close(ch)
+		delete(s.subscribers, ch)
+	}
+	s.mu.Unlock()
+	s.server.GracefulStop()
+}
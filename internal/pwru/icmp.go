@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+// Must match FILTER_ICMP and FILTER_ICMPV6 in bpf/kprobe_pwru.c
+const (
+	filterICMP   = 1 << 0
+	filterICMPv6 = 1 << 1
+)
+
+// The names follow tcpdump, see "man 7 pcap-filter".
+var icmpTypes = map[uint8]string{
+	0:  "echo-reply",
+	3:  "destination-unreachable",
+	4:  "source-quench",
+	5:  "redirect",
+	8:  "echo-request",
+	9:  "router-advertisement",
+	10: "router-solicitation",
+	11: "time-exceeded",
+	12: "parameter-problem",
+	13: "timestamp-request",
+	14: "timestamp-reply",
+}
+
+var icmp6Types = map[uint8]string{
+	1:   "destination-unreachable",
+	2:   "packet-too-big",
+	3:   "time-exceeded",
+	4:   "parameter-problem",
+	128: "echo-request",
+	129: "echo-reply",
+	133: "router-solicitation",
+	134: "router-advertisement",
+	135: "neighbor-solicitation",
+	136: "neighbor-advertisement",
+	137: "redirect",
+}
+
+// icmpTypeToStr returns the name of the ICMP or ICMPv6 type, or its number
+// if unknown. It returns an empty string for other protocols.
+func icmpTypeToStr(proto, typ uint8) string {
+	var types map[uint8]string
+	switch proto {
+	case syscall.IPPROTO_ICMP:
+		types = icmpTypes
+	case syscall.IPPROTO_ICMPV6:
+		types = icmp6Types
+	default:
+		return ""
+	}
+	if name, ok := types[typ]; ok {
+		return name
+	}
+	return strconv.Itoa(int(typ))
+}
+
+// icmpEcho returns the identifier and the sequence number of the ICMP and
+// ICMPv6 echo messages, from the rest of their header in Tuple.Seq.
+func icmpEcho(t *Tuple) (id, seq uint16, ok bool) {
+	switch {
+	case t.L4Proto == syscall.IPPROTO_ICMP && (t.ICMPType == 0 || t.ICMPType == 8):
+	case t.L4Proto == syscall.IPPROTO_ICMPV6 && (t.ICMPType == 128 || t.ICMPType == 129):
+	default:
+		return 0, 0, false
+	}
+	rest := byteorder.NetworkToHost32(t.Seq)
+	return uint16(rest >> 16), uint16(rest), true
+}
+
+// parseICMPType parses the --filter-icmp-type value, given as a name or a
+// number. It returns which of the ICMP and ICMPv6 types are set, as a name
+// may only exist for one of them. A number is used for both.
+func parseICMPType(s string) (filter uint8, icmpType uint8, icmp6Type uint8, err error) {
+	if n, err := strconv.ParseUint(s, 0, 8); err == nil {
+		return filterICMP | filterICMPv6, uint8(n), uint8(n), nil
+	}
+
+	for typ, name := range icmpTypes {
+		if name == s {
+			filter |= filterICMP
+			icmpType = typ
+		}
+	}
+	for typ, name := range icmp6Types {
+		if name == s {
+			filter |= filterICMPv6
+			icmp6Type = typ
+		}
+	}
+	if filter == 0 {
+		return 0, 0, 0, fmt.Errorf("unknown ICMP type %q", s)
+	}
+	return filter, icmpType, icmp6Type, nil
+}
@@ -0,0 +1,60 @@
+package pwru
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+func TestParseICMPType(t *testing.T) {
+	tests := []struct {
+		in                  string
+		filter, icmp, icmp6 uint8
+		wantErr             bool
+	}{
+		{in: "echo-request", filter: filterICMP | filterICMPv6, icmp: 8, icmp6: 128},
+		{in: "destination-unreachable", filter: filterICMP | filterICMPv6, icmp: 3, icmp6: 1},
+		{in: "packet-too-big", filter: filterICMPv6, icmp6: 2},
+		{in: "source-quench", filter: filterICMP, icmp: 4},
+		{in: "0", filter: filterICMP | filterICMPv6},
+		{in: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			filter, icmp, icmp6, err := parseICMPType(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseICMPType() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if filter != tt.filter || icmp != tt.icmp || icmp6 != tt.icmp6 {
+				t.Errorf("parseICMPType() = %#x, %d, %d, want %#x, %d, %d",
+					filter, icmp, icmp6, tt.filter, tt.icmp, tt.icmp6)
+			}
+		})
+	}
+}
+
+func TestICMPEcho(t *testing.T) {
+	rest := func(id, seq uint16) uint32 {
+		return byteorder.HostToNetwork32(uint32(id)<<16 | uint32(seq))
+	}
+	tests := []struct {
+		name    string
+		tuple   Tuple
+		id, seq uint16
+		ok      bool
+	}{
+		{"echo-request", Tuple{L4Proto: syscall.IPPROTO_ICMP, ICMPType: 8, Seq: rest(1234, 1)}, 1234, 1, true},
+		{"echo-reply6", Tuple{L4Proto: syscall.IPPROTO_ICMPV6, ICMPType: 129, Seq: rest(7, 42)}, 7, 42, true},
+		{"time-exceeded", Tuple{L4Proto: syscall.IPPROTO_ICMP, ICMPType: 11, Seq: rest(1, 1)}, 0, 0, false},
+		{"udp", Tuple{L4Proto: syscall.IPPROTO_UDP, Seq: rest(1, 1)}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, seq, ok := icmpEcho(&tt.tuple)
+			if id != tt.id || seq != tt.seq || ok != tt.ok {
+				t.Errorf("icmpEcho() = %d, %d, %t, want %d, %d, %t", id, seq, ok, tt.id, tt.seq, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// ifnameToIndex returns the ifindex of the device, in the given netns (see
+// --filter-netns) or in the current one.
+func ifnameToIndex(name, netnsArg string) (uint32, error) {
+	h := &netlink.Handle{}
+	if netnsArg != "" {
+		path, err := netnsPath(netnsArg)
+		if err != nil {
+			return 0, err
+		}
+		ns, err := netns.GetFromPath(path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open netns %s: %w", path, err)
+		}
+		defer ns.Close()
+		if h, err = netlink.NewHandleAt(ns); err != nil {
+			return 0, fmt.Errorf("failed to create netlink handle in %s: %w", path, err)
+		}
+		defer h.Delete()
+	}
+
+	link, err := h.LinkByName(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find %s: %w", name, err)
+	}
+	return uint32(link.Attrs().Index), nil
+}
@@ -2,6 +2,7 @@ package pwru
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"sort"
 	"strconv"
@@ -9,8 +10,26 @@ import (
 )
 
 type ksym struct {
-	addr uint64
-	name string
+	addr   uint64
+	name   string
+	module string // empty for vmlinux
+}
+
+// String returns the name of the symbol as in /proc/kallsyms, i.e. followed
+// by the module if any, e.g. "nf_hook_slow" or "ovs_vport_receive [openvswitch]".
+func (s *ksym) String() string {
+	if s.module == "" {
+		return s.name
+	}
+	return s.name + " [" + s.module + "]"
+}
+
+// parseKsymName splits the name of a symbol formatted by String().
+func parseKsymName(name string) (string, string) {
+	if fn, mod, ok := strings.Cut(name, " ["); ok && strings.HasSuffix(mod, "]") {
+		return fn, mod[:len(mod)-1]
+	}
+	return name, ""
 }
 
 type byAddr []*ksym
@@ -24,21 +43,33 @@ type Addr2Name struct {
 	Addr2NameSlice []*ksym
 }
 
-func (a *Addr2Name) findNearestSym(ip uint64) string {
-	total := len(a.Addr2NameSlice)
-	i, j := 0, total
-	for i < j {
-		h := int(uint(i+j) >> 1)
-		if a.Addr2NameSlice[h].addr <= ip {
-			if h+1 < total && a.Addr2NameSlice[h+1].addr > ip {
-				return a.Addr2NameSlice[h].name
-			}
-			i = h + 1
-		} else {
-			j = h
-		}
+// findSym returns the nearest symbol at or below ip, if any, and whether ip
+// is within the known symbols. The end of the last symbol is unknown, so the
+// addresses after it aren't.
+func (a *Addr2Name) findSym(ip uint64) (*ksym, bool) {
+	i := sort.Search(len(a.Addr2NameSlice), func(i int) bool {
+		return a.Addr2NameSlice[i].addr > ip
+	})
+	if i == 0 {
+		return nil, false
 	}
-	return a.Addr2NameSlice[i-1].name
+	return a.Addr2NameSlice[i-1], i < len(a.Addr2NameSlice)
+}
+
+// symbolize returns the symbol of a stack address with the offset and the
+// module, as printed by objdump and in kernel stack traces, e.g.
+// "nf_hook_slow+0x3c [nf_conntrack]". The addresses outside of the known
+// symbols are marked as such, e.g. "0xffffffffc0a12345 (unknown)".
+func (a *Addr2Name) symbolize(ip uint64) string {
+	sym, known := a.findSym(ip)
+	if sym == nil || !known {
+		return fmt.Sprintf("0x%x (unknown)", ip)
+	}
+	s := fmt.Sprintf("%s+0x%x", sym.name, ip-sym.addr)
+	if sym.module != "" {
+		s += " [" + sym.module + "]"
+	}
+	return s
 }
 
 func GetAddrs(funcs Funcs, all bool) (Addr2Name, error) {
@@ -55,16 +86,21 @@ func GetAddrs(funcs Funcs, all bool) (Addr2Name, error) {
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.Split(scanner.Text(), " ")
-		name := line[2]
-		if all || (funcs[name] > 0) {
+		// The symbols of the modules are followed by "\t[module]"
+		name, module, _ := strings.Cut(line[2], "\t")
+		module = strings.TrimSuffix(strings.TrimPrefix(module, "["), "]")
+		sym := &ksym{
+			name:   name,
+			module: module,
+		}
+		// The names of the functions of the modules are suffixed with
+		// the module with kprobe-multi
+		if all || funcs[name] > 0 || funcs[sym.String()] > 0 {
 			addr, err := strconv.ParseUint(line[0], 16, 64)
 			if err != nil {
 				return a2n, err
 			}
-			sym := &ksym{
-				addr: addr,
-				name: name,
-			}
+			sym.addr = addr
 			a2n.Addr2NameMap[addr] = sym
 			if all {
 				a2n.Addr2NameSlice = append(a2n.Addr2NameSlice, sym)
@@ -81,3 +117,45 @@ func GetAddrs(funcs Funcs, all bool) (Addr2Name, error) {
 
 	return a2n, nil
 }
+
+// lookupKsymAddrs returns the addresses of the given kernel symbols, which
+// all have to be found.
+func lookupKsymAddrs(names ...string) (map[string]uint64, error) {
+	want := make(map[string]bool, len(names))
+	for _, name := range names {
+		want[name] = true
+	}
+
+	file, err := os.Open("/proc/kallsyms")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	addrs := make(map[string]uint64, len(names))
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.Fields(scanner.Text())
+		if len(line) < 3 || !want[line[2]] {
+			continue
+		}
+		addr, err := strconv.ParseUint(line[0], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if addr == 0 {
+			return nil, fmt.Errorf("address of %s is hidden, see kptr_restrict", line[2])
+		}
+		addrs[line[2]] = addr
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		if _, ok := addrs[name]; !ok {
+			return nil, fmt.Errorf("symbol %s not found", name)
+		}
+	}
+	return addrs, nil
+}
@@ -2,7 +2,7 @@ package pwru
 
 import "testing"
 
-func TestAddr2Name_findNearestSym(t *testing.T) {
+func TestAddr2Name_symbolize(t *testing.T) {
 	type fields struct {
 		Addr2NameMap   map[uint64]*ksym
 		Addr2NameSlice []*ksym
@@ -32,10 +32,33 @@ func TestAddr2Name_findNearestSym(t *testing.T) {
 				},
 			},
 			args: args{ip: 0x00010},
-			want: "test1",
+			want: "test1+0xf",
 		},
 		{
-			name: "Correctly find symbol that are outside the boundary",
+			name: "Correctly find the symbol of a module",
+			fields: fields{
+				Addr2NameMap: nil,
+				Addr2NameSlice: []*ksym{
+					&ksym{
+						addr: 0x00001,
+						name: "test1",
+					},
+					&ksym{
+						addr:   0x11111,
+						name:   "test2",
+						module: "mod",
+					},
+					&ksym{
+						addr: 0x22222,
+						name: "test3",
+					},
+				},
+			},
+			args: args{ip: 0x11111},
+			want: "test2+0x0 [mod]",
+		},
+		{
+			name: "Mark the addresses that are outside the boundary",
 			fields: fields{
 				Addr2NameMap: nil,
 				Addr2NameSlice: []*ksym{
@@ -50,7 +73,21 @@ func TestAddr2Name_findNearestSym(t *testing.T) {
 				},
 			},
 			args: args{ip: 0x22222},
-			want: "test2",
+			want: "0x22222 (unknown)",
+		},
+		{
+			name: "Mark the addresses that are below the first symbol",
+			fields: fields{
+				Addr2NameMap: nil,
+				Addr2NameSlice: []*ksym{
+					&ksym{
+						addr: 0x11111,
+						name: "test1",
+					},
+				},
+			},
+			args: args{ip: 0x00010},
+			want: "0x10 (unknown)",
 		},
 	}
 	for _, tt := range tests {
@@ -59,9 +96,17 @@ func TestAddr2Name_findNearestSym(t *testing.T) {
 				Addr2NameMap:   tt.fields.Addr2NameMap,
 				Addr2NameSlice: tt.fields.Addr2NameSlice,
 			}
-			if got := a.findNearestSym(tt.args.ip); got != tt.want {
-				t.Errorf("findNearestSym() = %v, want %v", got, tt.want)
+			if got := a.symbolize(tt.args.ip); got != tt.want {
+				t.Errorf("symbolize() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestParseKsymName(t *testing.T) {
+	for _, sym := range []*ksym{{name: "nf_hook_slow"}, {name: "ovs_vport_receive", module: "openvswitch"}} {
+		if name, module := parseKsymName(sym.String()); name != sym.name || module != sym.module {
+			t.Errorf("parseKsymName(%q) = %q, %q", sym.String(), name, module)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// Unknown pods trigger a resync at most once per interval
+	kubeResyncInterval = 5 * time.Second
+)
+
+// The pod UID is part of the cgroup path, e.g.
+// "kubepods-besteffort-pod0e7a2c3b_5b0d_4a57_9d3c_2f0c1e7d8f6a.slice" with
+// the systemd driver, or "kubepods/besteffort/pod0e7a2c3b-5b0d-..." with the
+// cgroupfs one.
+var podUIDRe = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+
+// kubePods resolves processes to the "namespace/name" of the pods they
+// belong to. The pod UID is taken from the cgroup of the process, and the
+// pods of the node are listed from the API server with the in-cluster
+// service account credentials. The unknown pods are listed again in the
+// background, so that the output is never blocked on the API server: the
+// events are printed without the pod until then. Methods are no-ops on a nil
+// *kubePods.
+type kubePods struct {
+	client *http.Client
+	url    string
+	token  string
+	mu     sync.Mutex
+	pods   map[string]string // UID => namespace/name
+	resync chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type kubePodList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			UID       string `json:"uid"`
+		} `json:"metadata"`
+	} `json:"items"`
+}
+
+func newKubePods() (*kubePods, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster (KUBERNETES_SERVICE_HOST/PORT not set)")
+	}
+
+	token, err := os.ReadFile(kubeServiceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+	ca, err := os.ReadFile(kubeServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("failed to parse service account CA")
+	}
+
+	node := os.Getenv("NODE_NAME")
+	if node == "" {
+		if node, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get node name: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k := &kubePods{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		url: fmt.Sprintf("https://%s/api/v1/pods?fieldSelector=%s",
+			net.JoinHostPort(host, port), url.QueryEscape("spec.nodeName="+node)),
+		token:  strings.TrimSpace(string(token)),
+		pods:   map[string]string{},
+		resync: make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if err := k.sync(); err != nil {
+		cancel()
+		return nil, err
+	}
+	k.wg.Add(1)
+	go k.run()
+
+	return k, nil
+}
+
+// run lists the pods again when an unknown pod is seen, at most once per
+// kubeResyncInterval.
+func (k *kubePods) run() {
+	defer k.wg.Done()
+	for {
+		select {
+		case <-k.ctx.Done():
+			return
+		case <-k.resync:
+		}
+		// The errors are retried on the next unknown pod
+		_ = k.sync()
+		select {
+		case <-k.ctx.Done():
+			return
+		case <-time.After(kubeResyncInterval):
+		}
+	}
+}
+
+// Pod returns the "namespace/name" of the pod of the process, or an empty
+// string if the process doesn't belong to a pod.
+func (k *kubePods) Pod(pid int) string {
+	if k == nil || pid == 0 {
+		return ""
+	}
+
+	uid := podUID(pid)
+	if uid == "" {
+		return ""
+	}
+
+	k.mu.Lock()
+	pod, ok := k.pods[uid]
+	k.mu.Unlock()
+	if !ok {
+		select {
+		case k.resync <- struct{}{}:
+		default:
+		}
+	}
+	return pod
+}
+
+func (k *kubePods) Close() {
+	if k == nil {
+		return
+	}
+	k.cancel()
+	k.wg.Wait()
+}
+
+func (k *kubePods) sync() error {
+	req, err := http.NewRequestWithContext(k.ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to list pods: %s", resp.Status)
+	}
+
+	var list kubePodList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return fmt.Errorf("failed to decode pods: %w", err)
+	}
+
+	pods := make(map[string]string, len(list.Items))
+	for _, item := range list.Items {
+		pods[item.Metadata.UID] = item.Metadata.Namespace + "/" + item.Metadata.Name
+	}
+	k.mu.Lock()
+	k.pods = pods
+	k.mu.Unlock()
+
+	return nil
+}
+
+func podUID(pid int) string {
+	cgroup, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return ""
+	}
+	return podUIDFromCgroup(cgroup)
+}
+
+func podUIDFromCgroup(cgroup []byte) string {
+	m := podUIDRe.FindSubmatch(cgroup)
+	if m == nil {
+		return ""
+	}
+	return strings.ReplaceAll(string(m[1]), "_", "-")
+}
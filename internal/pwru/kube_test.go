@@ -0,0 +1,34 @@
+package pwru
+
+import "testing"
+
+func TestPodUIDFromCgroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		cgroup string
+		want   string
+	}{
+		{
+			name:   "systemd driver",
+			cgroup: "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod0e7a2c3b_5b0d_4a57_9d3c_2f0c1e7d8f6a.slice/cri-containerd-1234.scope\n",
+			want:   "0e7a2c3b-5b0d-4a57-9d3c-2f0c1e7d8f6a",
+		},
+		{
+			name:   "cgroupfs driver",
+			cgroup: "12:pids:/kubepods/burstable/pod0e7a2c3b-5b0d-4a57-9d3c-2f0c1e7d8f6a/1234\n",
+			want:   "0e7a2c3b-5b0d-4a57-9d3c-2f0c1e7d8f6a",
+		},
+		{
+			name:   "not a pod",
+			cgroup: "0::/user.slice/user-1000.slice/session-1.scope\n",
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podUIDFromCgroup([]byte(tt.cgroup)); got != tt.want {
+				t.Errorf("podUIDFromCgroup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+)
+
+const latencyHistBarWidth = 52
+
+// latencyHistKey must match struct latency_hist_key in bpf/kprobe_pwru.c.
+type latencyHistKey struct {
+	Addr uint64
+	Slot uint32
+	Pad  uint32
+}
+
+// LatencyHists prints the log2 histograms of the durations of the traced
+// functions counted by the BPF programs with --latency-histogram.
+type LatencyHists struct {
+	hists    *ebpf.Map
+	funcName func(event *Event) string
+
+	mu sync.Mutex
+}
+
+func NewLatencyHists(hists *ebpf.Map, funcName func(event *Event) string) *LatencyHists {
+	return &LatencyHists{hists: hists, funcName: funcName}
+}
+
+// Run prints and resets the histograms at each interval, until ctx is done.
+func (l *LatencyHists) Run(ctx context.Context, interval time.Duration, w io.Writer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fmt.Fprintf(w, "%s\n", time.Now().Format("15:04:05"))
+		l.Print(w)
+	}
+}
+
+// Print prints the histograms counted so far, and resets them.
+func (l *LatencyHists) Print(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hists := map[string][]uint64{}
+	var keys []latencyHistKey
+	var key latencyHistKey
+	var count uint64
+	iter := l.hists.Iterate()
+	for iter.Next(&key, &count) {
+		keys = append(keys, key)
+		if key.Slot >= 65 {
+			continue
+		}
+		name := l.funcName(&Event{Addr: key.Addr})
+		slots := hists[name]
+		if len(slots) <= int(key.Slot) {
+			slots = append(slots, make([]uint64, int(key.Slot)+1-len(slots))...)
+		}
+		slots[key.Slot] += count
+		hists[name] = slots
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("Failed to read the latency histograms: %s", err)
+	}
+	for _, key := range keys {
+		if err := l.hists.Delete(&key); err != nil {
+			log.Printf("Failed to reset the latency histograms: %s", err)
+			break
+		}
+	}
+
+	writeLatencyHists(w, hists)
+}
+
+// writeLatencyHists writes the histograms as bpftrace does, from the first to
+// the last non-empty slot of each function, e.g.:
+//
+//	@ns[ip_rcv]:
+//	[1K, 2K)                    4 |@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@|
+//	[2K, 4K)                    0 |                                                    |
+//	[4K, 8K)                    2 |@@@@@@@@@@@@@@@@@@@@@@@@@@                          |
+func writeLatencyHists(w io.Writer, hists map[string][]uint64) {
+	names := make([]string, 0, len(hists))
+	for name := range hists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		slots := hists[name]
+		first, last := -1, -1
+		var max uint64
+		for i, n := range slots {
+			if n == 0 {
+				continue
+			}
+			if first == -1 {
+				first = i
+			}
+			last = i
+			if n > max {
+				max = n
+			}
+		}
+		if first == -1 {
+			continue
+		}
+
+		fmt.Fprintf(w, "@ns[%s]:\n", name)
+		for i := first; i <= last; i++ {
+			bar := strings.Repeat("@", int(slots[i]*latencyHistBarWidth/max))
+			fmt.Fprintf(w, "%-20s %8d |%-*s|\n", latencyHistSlotLabel(i), slots[i], latencyHistBarWidth, bar)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+// latencyHistSlotLabel returns the range of durations counted in the slot:
+// slot 0 counts the durations of 0ns, and slot n those in [2^(n-1), 2^n).
+func latencyHistSlotLabel(slot int) string {
+	if slot < 2 {
+		return fmt.Sprintf("[%d]", slot)
+	}
+	return fmt.Sprintf("[%s, %s)", latencyHistBound(slot-1), latencyHistBound(slot))
+}
+
+// latencyHistBound returns 2^n with the suffix of its power of 1024, e.g.
+// "4K".
+func latencyHistBound(n int) string {
+	suffixes := []string{"", "K", "M", "G", "T", "P", "E"}
+	i := n / 10
+	if i >= len(suffixes) {
+		i = len(suffixes) - 1
+	}
+	return fmt.Sprintf("%d%s", uint64(1)<<(n-10*i), suffixes[i])
+}
@@ -0,0 +1,49 @@
+package pwru
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLatencyHistSlotLabel(t *testing.T) {
+	tests := []struct {
+		slot int
+		want string
+	}{
+		{0, "[0]"},
+		{1, "[1]"},
+		{2, "[2, 4)"},
+		{10, "[512, 1K)"},
+		{11, "[1K, 2K)"},
+		{21, "[1M, 2M)"},
+		{64, "[8E, 16E)"},
+	}
+	for _, tt := range tests {
+		if got := latencyHistSlotLabel(tt.slot); got != tt.want {
+			t.Errorf("latencyHistSlotLabel(%d) = %q, want %q", tt.slot, got, tt.want)
+		}
+	}
+}
+
+func TestWriteLatencyHists(t *testing.T) {
+	hists := map[string][]uint64{
+		"ip_rcv":       {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 4, 0, 2},
+		"kfree_skbmem": {1},
+		"unused":       {0, 0},
+	}
+
+	var buf bytes.Buffer
+	writeLatencyHists(&buf, hists)
+	want := `@ns[ip_rcv]:
+[1K, 2K)                    4 |@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@|
+[2K, 4K)                    0 |                                                    |
+[4K, 8K)                    2 |@@@@@@@@@@@@@@@@@@@@@@@@@@                          |
+
+@ns[kfree_skbmem]:
+[0]                         1 |@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@|
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
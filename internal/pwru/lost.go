@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/ebpf"
+)
+
+const lostEventsWarnInterval = 5 * time.Second
+
+// LostEvents accounts the events lost because the perf or the ring buffer
+// was full, and warns about them, as the traces are misleading otherwise.
+type LostEvents struct {
+	// Per-CPU counters of the events dropped by the BPF programs when the
+	// ring buffer was full.
+	ringbuf *ebpf.Map
+	perf    uint64
+	metrics *Metrics
+
+	warned uint64
+}
+
+func NewLostEvents(ringbuf *ebpf.Map, metrics *Metrics) *LostEvents {
+	return &LostEvents{ringbuf: ringbuf, metrics: metrics}
+}
+
+// AddPerf accounts the lost samples reported by the perf buffer.
+func (l *LostEvents) AddPerf(n uint64) {
+	atomic.AddUint64(&l.perf, n)
+	l.metrics.AddLostSamples(n)
+}
+
+// Total returns the number of events lost so far.
+func (l *LostEvents) Total() uint64 {
+	total := atomic.LoadUint64(&l.perf)
+
+	var perCPU []uint64
+	if err := l.ringbuf.Lookup(uint32(0), &perCPU); err != nil {
+		log.Printf("Failed to read lost events: %s", err)
+		return total
+	}
+	for _, n := range perCPU {
+		total += n
+	}
+	return total
+}
+
+// Run warns periodically about the events lost since the last warning, until
+// ctx is done.
+func (l *LostEvents) Run(ctx context.Context) {
+	ticker := time.NewTicker(lostEventsWarnInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		total := l.Total()
+		if total > l.warned {
+			log.Printf("Warning: %d events lost in the last %s, consider increasing --event-buffer-pages",
+				total-l.warned, lostEventsWarnInterval)
+			l.warned = total
+		}
+	}
+}
+
+// Report prints the number of events lost overall, if any.
+func (l *LostEvents) Report() {
+	if total := l.Total(); total > 0 {
+		log.Printf("%d events lost, consider increasing --event-buffer-pages", total)
+	}
+}
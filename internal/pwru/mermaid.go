@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// The events beyond are not drawn, to keep the diagram readable
+const mermaidMaxEvents = 500
+
+type mermaidEvent struct {
+	funcName string
+	ts       uint64
+}
+
+// mermaidTrace collects the events of a single skb for --export-mermaid:
+// the one selected with --export-mermaid-skb, or the first one matching the
+// filters, e.g. of a tuple, until it is freed.
+type mermaidTrace struct {
+	path   string
+	skb    uint64 // 0 until the first skb is seen if not selected
+	title  string
+	events []mermaidEvent
+	done   bool
+}
+
+func newMermaidTrace(path string, skb uint64) *mermaidTrace {
+	return &mermaidTrace{path: path, skb: skb}
+}
+
+// add adds the event if it is one of the selected skb.
+func (m *mermaidTrace) add(event *eventInfo, freed bool) {
+	if m.done || (m.skb != 0 && event.SAddr != m.skb) {
+		return
+	}
+	if m.skb == 0 {
+		m.skb = event.SAddr
+	}
+	if m.title == "" {
+		m.title = fmt.Sprintf("skb 0x%x", m.skb)
+		if event.Tuple.L3Proto != 0 {
+			m.title += " " + flowKey(event)
+		}
+	}
+	if event.Type != EventTypeReturn && len(m.events) < mermaidMaxEvents {
+		m.events = append(m.events, mermaidEvent{event.funcName, event.Timestamp})
+	}
+	m.done = freed
+}
+
+func (m *mermaidTrace) writeFile() error {
+	f, err := createOutputFile(m.path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	m.write(w)
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// write writes the events as a Mermaid flowchart, e.g. to be pasted in a
+// GitHub issue within a ```mermaid block: a node per event, with the time
+// since the first event, and the time between the events on the edges. The
+// times are signed, as the events of different CPUs may be slightly out of
+// order.
+func (m *mermaidTrace) write(w io.Writer) {
+	if m.title != "" {
+		fmt.Fprintf(w, "---\ntitle: %s\n---\n", m.title)
+	}
+	fmt.Fprintf(w, "flowchart TD\n")
+	for i, e := range m.events {
+		fmt.Fprintf(w, "    e%d[\"%s<br/>%+.3fus\"]\n", i, e.funcName, float64(int64(e.ts-m.events[0].ts))/1000)
+	}
+	for i := 1; i < len(m.events); i++ {
+		fmt.Fprintf(w, "    e%d -->|%.3fus| e%d\n", i-1, float64(int64(m.events[i].ts-m.events[i-1].ts))/1000, i)
+	}
+}
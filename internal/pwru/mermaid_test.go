@@ -0,0 +1,42 @@
+package pwru
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMermaidTrace(t *testing.T) {
+	m := newMermaidTrace("", 0)
+	for _, e := range []struct {
+		skb      uint64
+		funcName string
+		ts       uint64
+		freed    bool
+	}{
+		{0x1000, "ip_rcv", 1000, false},
+		// Another skb
+		{0x2000, "ip_rcv", 1500, false},
+		{0x1000, "ip_rcv_core", 2500, false},
+		{0x1000, "kfree_skbmem", 4000, true},
+		// The address is reused by another skb
+		{0x1000, "ip_rcv", 5000, false},
+	} {
+		m.add(&eventInfo{Event: &Event{SAddr: e.skb, Timestamp: e.ts}, funcName: e.funcName}, e.freed)
+	}
+
+	var buf bytes.Buffer
+	m.write(&buf)
+	want := `---
+title: skb 0x1000
+---
+flowchart TD
+    e0["ip_rcv<br/>+0.000us"]
+    e1["ip_rcv_core<br/>+1.500us"]
+    e2["kfree_skbmem<br/>+3.000us"]
+    e0 -->|1.500us| e1
+    e1 -->|1.500us| e2
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
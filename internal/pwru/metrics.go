@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Metrics are exposed in the Prometheus text format via --metrics-addr. All
+// methods are no-ops on a nil *Metrics, so callers don't need to check
+// whether the endpoint has been enabled.
+type Metrics struct {
+	mu             sync.Mutex
+	events         uint64
+	eventsByFunc   map[string]uint64
+	lostSamples    uint64
+	attachedProbes int
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		eventsByFunc: map[string]uint64{},
+	}
+}
+
+// Serve starts serving the metrics on addr at /metrics in the background.
+func (m *Metrics) Serve(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.write(w)
+	})
+
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Printf("Metrics server stopped: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+func (m *Metrics) IncEvent(funcName string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.events++
+	m.eventsByFunc[funcName]++
+	m.mu.Unlock()
+}
+
+func (m *Metrics) AddLostSamples(n uint64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.lostSamples += n
+	m.mu.Unlock()
+}
+
+func (m *Metrics) SetAttachedProbes(n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.attachedProbes = n
+	m.mu.Unlock()
+}
+
+func (m *Metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP pwru_events_total Number of events received from the kernel.")
+	fmt.Fprintln(w, "# TYPE pwru_events_total counter")
+	fmt.Fprintf(w, "pwru_events_total %d\n", m.events)
+
+	fmt.Fprintln(w, "# HELP pwru_function_events_total Number of events received per kernel function.")
+	fmt.Fprintln(w, "# TYPE pwru_function_events_total counter")
+	funcs := make([]string, 0, len(m.eventsByFunc))
+	for fn := range m.eventsByFunc {
+		funcs = append(funcs, fn)
+	}
+	sort.Strings(funcs)
+	for _, fn := range funcs {
+		fmt.Fprintf(w, "pwru_function_events_total{func=%q} %d\n", fn, m.eventsByFunc[fn])
+	}
+
+	fmt.Fprintln(w, "# HELP pwru_lost_samples_total Number of samples lost due to a full perf buffer.")
+	fmt.Fprintln(w, "# TYPE pwru_lost_samples_total counter")
+	fmt.Fprintf(w, "pwru_lost_samples_total %d\n", m.lostSamples)
+
+	fmt.Fprintln(w, "# HELP pwru_attached_probes Number of attached probes.")
+	fmt.Fprintln(w, "# TYPE pwru_attached_probes gauge")
+	fmt.Fprintf(w, "pwru_attached_probes %d\n", m.attachedProbes)
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+const mplsMaxLabel = 1<<20 - 1
+
+// mplsLabel is a decoded label stack entry (RFC 3032).
+type mplsLabel struct {
+	label  uint32
+	tc     uint8
+	bottom bool
+	ttl    uint8
+}
+
+func newMPLSLabel(lse uint32) mplsLabel {
+	lse = byteorder.NetworkToHost32(lse)
+	return mplsLabel{
+		label:  lse >> 12,
+		tc:     uint8(lse>>9) & 0x7,
+		bottom: lse&0x100 != 0,
+		ttl:    uint8(lse),
+	}
+}
+
+func (m *Meta) mplsLabels() []mplsLabel {
+	n := int(m.MPLSLabels)
+	if n > len(m.MPLSLSE) {
+		n = len(m.MPLSLSE)
+	}
+	labels := make([]mplsLabel, n)
+	for i := range labels {
+		labels[i] = newMPLSLabel(m.MPLSLSE[i])
+	}
+	return labels
+}
+
+func (m *Meta) hasMPLSLabel(label uint32) bool {
+	for _, l := range m.mplsLabels() {
+		if l.label == label {
+			return true
+		}
+	}
+	return false
+}
+
+// mplsLabelsToStr returns the label stack from the top, as label/TC/S/TTL,
+// e.g. "16001/0/0/64,24/0/1/64".
+func mplsLabelsToStr(m *Meta) string {
+	var labels []string
+	for _, l := range m.mplsLabels() {
+		var s uint8
+		if l.bottom {
+			s = 1
+		}
+		labels = append(labels, fmt.Sprintf("%d/%d/%d/%d", l.label, l.tc, s, l.ttl))
+	}
+	return strings.Join(labels, ",")
+}
+
+type jsonMPLSLabel struct {
+	Label  uint32 `json:"label"`
+	TC     uint8  `json:"tc"`
+	Bottom bool   `json:"s"`
+	TTL    uint8  `json:"ttl"`
+}
+
+func newJSONMPLSLabels(m *Meta) []jsonMPLSLabel {
+	var labels []jsonMPLSLabel
+	for _, l := range m.mplsLabels() {
+		labels = append(labels, jsonMPLSLabel{l.label, l.tc, l.bottom, l.ttl})
+	}
+	return labels
+}
+
+// parseMPLSLabel parses the --filter-mpls-label value, a 20 bits label.
+func parseMPLSLabel(s string) (uint32, error) {
+	label, err := strconv.ParseUint(s, 0, 32)
+	if err != nil || label > mplsMaxLabel {
+		return 0, fmt.Errorf("invalid MPLS label %q, expected 0-%d", s, mplsMaxLabel)
+	}
+	return uint32(label), nil
+}
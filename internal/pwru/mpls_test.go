@@ -0,0 +1,50 @@
+package pwru
+
+import (
+	"testing"
+
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+func TestMPLSLabelsToStr(t *testing.T) {
+	lse := func(label uint32, tc uint8, bottom bool, ttl uint8) uint32 {
+		v := label<<12 | uint32(tc)<<9 | uint32(ttl)
+		if bottom {
+			v |= 0x100
+		}
+		return byteorder.HostToNetwork32(v)
+	}
+	m := Meta{MPLSLabels: 2, MPLSLSE: [MaxMPLSLabels]uint32{lse(16001, 0, false, 64), lse(24, 5, true, 63)}}
+
+	if got, want := mplsLabelsToStr(&m), "16001/0/0/64,24/5/1/63"; got != want {
+		t.Errorf("mplsLabelsToStr() = %q, want %q", got, want)
+	}
+	if !m.hasMPLSLabel(24) || m.hasMPLSLabel(0) {
+		t.Errorf("hasMPLSLabel() of %s", mplsLabelsToStr(&m))
+	}
+}
+
+func TestParseMPLSLabel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint32
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "16001", want: 16001},
+		{in: "1048575", want: 1048575},
+		{in: "1048576", wantErr: true},
+		{in: "foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseMPLSLabel(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMPLSLabel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseMPLSLabel() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
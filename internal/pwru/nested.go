@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+)
+
+// nestedSkbConst is the constant of bpf/kprobe_pwru.c enabling the
+// NestedPrograms.
+const nestedSkbConst = "nested_skb"
+
+// NestedPrograms trace the functions receiving the skb in another argument
+// with --trace-nested-skb, by the position of the argument. The skb pointer
+// is read at the offset given by the cookie of the probe.
+type NestedPrograms interface {
+	GetKprobeSkbNested1() *ebpf.Program
+	GetKprobeSkbNested2() *ebpf.Program
+	GetKprobeSkbNested3() *ebpf.Program
+	GetKprobeSkbNested4() *ebpf.Program
+	GetKprobeSkbNested5() *ebpf.Program
+}
+
+// ConfigNestedSkb enables the NestedPrograms. Otherwise, they are loaded but
+// don't use bpf_get_attach_cookie(), which older kernels would reject.
+func ConfigNestedSkb(spec *ebpf.CollectionSpec, enabled bool) error {
+	if err := spec.RewriteConstants(map[string]interface{}{
+		nestedSkbConst: enabled,
+	}); err != nil {
+		return fmt.Errorf("failed to rewrite %s: %w", nestedSkbConst, err)
+	}
+	return nil
+}
+
+// NestedSkbArg is the argument of a function holding the skb: a struct
+// sk_buff **, or a pointer to a struct with the skb pointer at Offset.
+type NestedSkbArg struct {
+	Pos    int
+	Offset uint64
+}
+
+// NestedFuncs are the functions without an skb argument, but with one of
+// their arguments holding it.
+type NestedFuncs map[string]NestedSkbArg
+
+// nestedSkbContainers are the structs passed in place of the skb, with their
+// member holding it. The other structs with an skb member, e.g. struct
+// inet_frag_queue or struct napi_struct, hold other skbs than the one being
+// processed.
+var nestedSkbContainers = map[string]string{
+	"nf_queue_entry": "skb",
+	"nft_pktinfo":    "skb",
+}
+
+// nestedSkbArg returns the first argument of the function holding the skb,
+// if any: a struct sk_buff **, or a pointer to one of nestedSkbContainers.
+func nestedSkbArg(fnProto *btf.FuncProto) (NestedSkbArg, bool) {
+	for i, p := range fnProto.Params {
+		if i >= 5 {
+			break
+		}
+		ptr, ok := p.Type.(*btf.Pointer)
+		if !ok {
+			continue
+		}
+		if isSkbPointer(ptr.Target) {
+			return NestedSkbArg{Pos: i + 1}, true
+		}
+		strct, ok := btf.UnderlyingType(ptr.Target).(*btf.Struct)
+		if !ok {
+			continue
+		}
+		member, ok := nestedSkbContainers[strct.Name]
+		if !ok {
+			continue
+		}
+		if off, ok := skbMemberOffset(strct.Members, member); ok {
+			return NestedSkbArg{Pos: i + 1, Offset: off}, true
+		}
+	}
+	return NestedSkbArg{}, false
+}
+
+// skbMemberOffset returns the offset in bytes of the struct sk_buff * member
+// of the given name, looking into the anonymous structs and unions too.
+func skbMemberOffset(members []btf.Member, name string) (uint64, bool) {
+	for _, m := range members {
+		if m.Name == name {
+			return uint64(m.Offset.Bytes()), isSkbPointer(m.Type)
+		}
+		if m.Name != "" {
+			continue
+		}
+		var inner []btf.Member
+		switch t := btf.UnderlyingType(m.Type).(type) {
+		case *btf.Struct:
+			inner = t.Members
+		case *btf.Union:
+			inner = t.Members
+		}
+		if off, ok := skbMemberOffset(inner, name); ok {
+			return uint64(m.Offset.Bytes()) + off, true
+		}
+	}
+	return 0, false
+}
+
+func isSkbPointer(typ btf.Type) bool {
+	ptr, ok := btf.UnderlyingType(typ).(*btf.Pointer)
+	if !ok {
+		return false
+	}
+	strct, ok := btf.UnderlyingType(ptr.Target).(*btf.Struct)
+	return ok && strct.Name == "sk_buff"
+}
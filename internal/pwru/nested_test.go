@@ -0,0 +1,103 @@
+package pwru
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/cilium/ebpf/btf"
+)
+
+func TestNestedSkbArg(t *testing.T) {
+	u64 := &btf.Int{Name: "u64", Size: 8}
+	skb := &btf.Pointer{Target: &btf.Struct{Name: "sk_buff"}}
+	ptrTo := func(name string, members ...btf.Member) btf.FuncParam {
+		return btf.FuncParam{Type: &btf.Pointer{Target: &btf.Struct{Name: name, Members: members}}}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		params []btf.FuncParam
+		want   NestedSkbArg
+		ok     bool
+	}{
+		{
+			name:   "struct sk_buff **",
+			params: []btf.FuncParam{{Type: u64}, {Type: &btf.Pointer{Target: skb}}},
+			want:   NestedSkbArg{Pos: 2},
+			ok:     true,
+		},
+		{
+			name: "container",
+			params: []btf.FuncParam{ptrTo("nf_queue_entry",
+				btf.Member{Name: "list", Type: u64},
+				btf.Member{Name: "skb", Type: skb, Offset: 64},
+			)},
+			want: NestedSkbArg{Pos: 1, Offset: 8},
+			ok:   true,
+		},
+		{
+			name: "const container",
+			params: []btf.FuncParam{{Type: u64}, {Type: &btf.Pointer{Target: &btf.Const{Type: &btf.Struct{
+				Name:    "nft_pktinfo",
+				Members: []btf.Member{{Name: "skb", Type: skb}},
+			}}}}},
+			want: NestedSkbArg{Pos: 2},
+			ok:   true,
+		},
+		{
+			name: "anonymous union",
+			params: []btf.FuncParam{{Type: u64}, {Type: u64}, ptrTo("nft_pktinfo",
+				btf.Member{Name: "a", Type: u64},
+				btf.Member{Type: &btf.Union{Members: []btf.Member{
+					{Name: "b", Type: u64},
+					{Name: "skb", Type: skb, Offset: 0},
+				}}, Offset: 128},
+			)},
+			want: NestedSkbArg{Pos: 3, Offset: 16},
+			ok:   true,
+		},
+		{
+			name: "other skb member",
+			params: []btf.FuncParam{ptrTo("inet_frag_queue",
+				btf.Member{Name: "fragments_tail", Type: skb},
+			)},
+		},
+		{
+			name: "sixth argument",
+			params: []btf.FuncParam{{Type: u64}, {Type: u64}, {Type: u64}, {Type: u64}, {Type: u64},
+				{Type: &btf.Pointer{Target: skb}}},
+		},
+	} {
+		got, ok := nestedSkbArg(&btf.FuncProto{Params: tt.params})
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("nestedSkbArg(%s) = %+v, %v, want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNestedSkbArg_kernel(t *testing.T) {
+	spec, err := btf.LoadKernelSpec()
+	if errors.Is(err, os.ErrNotExist) {
+		t.Skip("no kernel BTF")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{
+		"__netif_receive_skb_core": true,  // struct sk_buff **pskb
+		"nf_reinject":              true,  // struct nf_queue_entry *entry
+		"inet_frag_kill":           false, // struct inet_frag_queue *q
+		"napi_gro_frags":           false, // struct napi_struct *napi
+	} {
+		var fn *btf.Func
+		if err := spec.TypeByName(name, &fn); err != nil {
+			t.Logf("%s: %s", name, err)
+			continue
+		}
+		if _, got := nestedSkbArg(fn.Type.(*btf.FuncProto)); got != want {
+			t.Errorf("nestedSkbArg(%s) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// Must match NF_KIND_* in bpf/kprobe_pwru.c
+const (
+	nfKindHookSlow = 1
+	nfKindXtTable  = 2
+	nfKindNftChain = 3
+)
+
+// NetfilterFuncs are traced by the dedicated programs of --output-netfilter,
+// by kind, instead of the generic ones.
+var NetfilterFuncs = map[string]int{
+	"nf_hook_slow":              nfKindHookSlow,
+	"ipt_do_table":              nfKindXtTable,
+	"ip6t_do_table":             nfKindXtTable,
+	"arpt_do_table":             nfKindXtTable,
+	"nft_do_chain_ipv4":         nfKindNftChain,
+	"nft_do_chain_ipv6":         nfKindNftChain,
+	"nft_do_chain_inet":         nfKindNftChain,
+	"nft_do_chain_inet_ingress": nfKindNftChain,
+	"nft_do_chain_arp":          nfKindNftChain,
+	"nft_do_chain_bridge":       nfKindNftChain,
+	"nft_do_chain_netdev":       nfKindNftChain,
+}
+
+type NetfilterPrograms interface {
+	GetKprobeNfHookSlow() *ebpf.Program
+	GetKprobeNfXtTable() *ebpf.Program
+	GetKprobeNfNftChain() *ebpf.Program
+	GetKretprobeNfHookSlow() *ebpf.Program
+	GetKretprobeNfXtTable() *ebpf.Program
+	GetKretprobeNfNftChain() *ebpf.Program
+}
+
+// AttachNetfilter attaches the programs of --output-netfilter to the
+// NetfilterFuncs found in the kernel, e.g. the nftables ones are missing
+// unless nf_tables is loaded.
+func AttachNetfilter(progs NetfilterPrograms, kprobeMulti bool) ([]link.Link, error) {
+	kprobes := map[int]*ebpf.Program{
+		nfKindHookSlow: progs.GetKprobeNfHookSlow(),
+		nfKindXtTable:  progs.GetKprobeNfXtTable(),
+		nfKindNftChain: progs.GetKprobeNfNftChain(),
+	}
+	kretprobes := map[int]*ebpf.Program{
+		nfKindHookSlow: progs.GetKretprobeNfHookSlow(),
+		nfKindXtTable:  progs.GetKretprobeNfXtTable(),
+		nfKindNftChain: progs.GetKretprobeNfNftChain(),
+	}
+
+	var links []link.Link
+	for name, kind := range NetfilterFuncs {
+		l, err := attachKprobe(name, kprobes[kind], kretprobes[kind], kprobeMulti)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			for _, l := range links {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to attach to %s: %w", name, err)
+		}
+		links = append(links, l...)
+	}
+	if len(links) == 0 {
+		return nil, fmt.Errorf("none of the netfilter functions found")
+	}
+	return links, nil
+}
+
+// Values of enum nf_inet_hooks, along with the netdev and arp ones
+var (
+	nfInetHooks   = []string{"PREROUTING", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING", "INGRESS"}
+	nfNetdevHooks = []string{"INGRESS", "EGRESS"}
+	nfArpHooks    = []string{"IN", "OUT", "FORWARD"}
+)
+
+// nfProtos maps the NFPROTO_* families to their names in nft.
+var nfProtos = map[uint8]string{
+	1:  "inet",
+	2:  "ip",
+	3:  "arp",
+	5:  "netdev",
+	7:  "bridge",
+	10: "ip6",
+}
+
+func nfHookToStr(pf, hook uint8) string {
+	hooks := nfInetHooks
+	switch nfProtos[pf] {
+	case "netdev":
+		hooks = nfNetdevHooks
+	case "arp":
+		hooks = nfArpHooks
+	}
+	if int(hook) < len(hooks) {
+		return hooks[hook]
+	}
+	return strconv.Itoa(int(hook))
+}
+
+func nfProtoToStr(pf uint8) string {
+	if name, ok := nfProtos[pf]; ok {
+		return name
+	}
+	return strconv.Itoa(int(pf))
+}
+
+var nfVerdicts = []string{"DROP", "ACCEPT", "STOLEN", "QUEUE", "REPEAT", "STOP"}
+
+// nfVerdictToStr returns the verdict of the netfilter function. The
+// iptables and nftables ones return NF_* verdicts, nf_hook_slow() returns 1
+// if the skb is accepted, 0 if it is stolen or queued, or an errno if it is
+// dropped.
+func nfVerdictToStr(kind uint8, verdict int32) string {
+	if kind == nfKindHookSlow {
+		switch {
+		case verdict == 1:
+			return "ACCEPT"
+		case verdict == 0:
+			return "STOLEN"
+		default:
+			return fmt.Sprintf("DROP(%d)", verdict)
+		}
+	}
+	// The upper bits hold the queue number or the errno of a drop
+	if v := verdict & 0xff; int(v) < len(nfVerdicts) {
+		return nfVerdicts[v]
+	}
+	return fmt.Sprintf("0x%x", uint32(verdict))
+}
+
+// cstr returns the NUL-terminated string of the buffer.
+func cstr(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
+
+type jsonNetfilter struct {
+	Family  string `json:"family"`
+	Hook    string `json:"hook"`
+	Table   string `json:"table,omitempty"`
+	Chain   string `json:"chain,omitempty"`
+	Verdict string `json:"verdict"`
+}
+
+func newJSONNetfilter(nf *Netfilter) *jsonNetfilter {
+	return &jsonNetfilter{
+		Family:  nfProtoToStr(nf.PF),
+		Hook:    nfHookToStr(nf.PF, nf.Hook),
+		Table:   cstr(nf.Table[:]),
+		Chain:   cstr(nf.Chain[:]),
+		Verdict: nfVerdictToStr(nf.Kind, nf.Verdict),
+	}
+}
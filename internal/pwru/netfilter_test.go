@@ -0,0 +1,44 @@
+package pwru
+
+import "testing"
+
+func TestNfVerdictToStr(t *testing.T) {
+	tests := []struct {
+		kind    uint8
+		verdict int32
+		want    string
+	}{
+		{nfKindHookSlow, 1, "ACCEPT"},
+		{nfKindHookSlow, 0, "STOLEN"},
+		{nfKindHookSlow, -1, "DROP(-1)"},
+		{nfKindXtTable, 0, "DROP"},
+		{nfKindNftChain, 1, "ACCEPT"},
+		// NF_DROP_ERR(-EPERM)
+		{nfKindNftChain, 1 << 16, "DROP"},
+		// NF_QUEUE_NR(3)
+		{nfKindXtTable, 3<<16 | 3, "QUEUE"},
+	}
+	for _, tt := range tests {
+		if got := nfVerdictToStr(tt.kind, tt.verdict); got != tt.want {
+			t.Errorf("nfVerdictToStr(%d, 0x%x) = %q, want %q", tt.kind, tt.verdict, got, tt.want)
+		}
+	}
+}
+
+func TestNfHookToStr(t *testing.T) {
+	tests := []struct {
+		pf, hook uint8
+		want     string
+	}{
+		{2, 0, "PREROUTING"},
+		{10, 4, "POSTROUTING"},
+		{5, 1, "EGRESS"},
+		{3, 1, "OUT"},
+		{2, 9, "9"},
+	}
+	for _, tt := range tests {
+		if got := nfHookToStr(tt.pf, tt.hook); got != tt.want {
+			t.Errorf("nfHookToStr(%d, %d) = %q, want %q", tt.pf, tt.hook, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	namedNetnsDir = "/var/run/netns"
+	// Unknown netns trigger a rescan at most once per interval
+	netnsRescanInterval = time.Second
+)
+
+// netnsNames maps netns inodes to human-readable names. Named netns (i.e.
+// "ip netns add") are looked up in /var/run/netns, the others are named
+// after the command of the first process found in /proc using them.
+type netnsNames struct {
+	names    map[uint32]string
+	pids     map[uint32]int // a process using the netns
+	lastScan time.Time
+}
+
+func newNetnsNames() *netnsNames {
+	n := &netnsNames{}
+	n.scan()
+	return n
+}
+
+// Name returns the name of the netns, or an empty string if unknown.
+func (n *netnsNames) Name(inode uint32) string {
+	if n == nil || inode == 0 {
+		return ""
+	}
+	n.lookup(inode)
+	return n.names[inode]
+}
+
+// Pid returns a process using the netns, or 0 if none has been found.
+func (n *netnsNames) Pid(inode uint32) int {
+	if n == nil || inode == 0 {
+		return 0
+	}
+	n.lookup(inode)
+	return n.pids[inode]
+}
+
+func (n *netnsNames) lookup(inode uint32) {
+	if _, ok := n.names[inode]; !ok && time.Since(n.lastScan) > netnsRescanInterval {
+		n.scan()
+	}
+}
+
+func (n *netnsNames) scan() {
+	n.lastScan = time.Now()
+	names := map[uint32]string{}
+	pids := map[uint32]int{}
+
+	if entries, err := os.ReadDir(namedNetnsDir); err == nil {
+		for _, entry := range entries {
+			var st unix.Stat_t
+			if err := unix.Stat(filepath.Join(namedNetnsDir, entry.Name()), &st); err != nil {
+				continue
+			}
+			names[uint32(st.Ino)] = entry.Name()
+		}
+	}
+
+	procs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range procs {
+		link, err := os.Readlink(filepath.Join(dir, "ns/net"))
+		if err != nil {
+			continue
+		}
+		// The link is of the form "net:[4026531840]"
+		inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "net:["), "]"), 10, 32)
+		if err != nil {
+			continue
+		}
+		if _, ok := pids[uint32(inode)]; ok {
+			continue
+		}
+		pid, _ := strconv.Atoi(filepath.Base(dir))
+		pids[uint32(inode)] = pid
+		if _, ok := names[uint32(inode)]; ok {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil {
+			continue
+		}
+		names[uint32(inode)] = strings.TrimSpace(string(comm))
+	}
+
+	n.names = names
+	n.pids = pids
+}
+
+// parseNetns returns the inode of the netns given by its inode, path or name.
+func parseNetns(s string) (uint32, error) {
+	if inode, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(inode), nil
+	}
+
+	path := s
+	if !strings.Contains(s, "/") {
+		path = filepath.Join(namedNetnsDir, s)
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	return uint32(st.Ino), nil
+}
+
+// netnsPath returns a path to the netns given by its inode, path or name.
+func netnsPath(s string) (string, error) {
+	if inode, err := strconv.ParseUint(s, 10, 32); err == nil {
+		pid := newNetnsNames().Pid(uint32(inode))
+		if pid == 0 {
+			return "", fmt.Errorf("no process found in netns %d", inode)
+		}
+		return fmt.Sprintf("/proc/%d/ns/net", pid), nil
+	}
+	if !strings.Contains(s, "/") {
+		return filepath.Join(namedNetnsDir, s), nil
+	}
+	return s, nil
+}
@@ -0,0 +1,33 @@
+package pwru
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseNetns(t *testing.T) {
+	inode, err := parseNetns("4026531840")
+	if err != nil || inode != 4026531840 {
+		t.Errorf("parseNetns(inode) = %d, %v", inode, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "netns")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		t.Fatal(err)
+	}
+	inode, err = parseNetns(path)
+	if err != nil || inode != uint32(st.Ino) {
+		t.Errorf("parseNetns(path) = %d, %v, want %d", inode, err, st.Ino)
+	}
+
+	if _, err := parseNetns("does-not-exist"); err == nil {
+		t.Errorf("parseNetns(unknown name) succeeded, want an error")
+	}
+}
@@ -0,0 +1,264 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	otelBatchSize     = 512
+	otelFlushInterval = 5 * time.Second
+	otelQueueSize     = 16 // batches waiting to be sent
+	otelSpanKindInt   = 1  // SPAN_KIND_INTERNAL
+)
+
+// OTLP/HTTP JSON encoding, see
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value uint64) otlpAttribute {
+	v := strconv.FormatUint(value, 10)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &v}}
+}
+
+// skbTrace is the trace of a single skb. The root span covers the whole
+// lifetime, and each kernel function hit is a child span lasting until the
+// next function hit of the same skb.
+type skbTrace struct {
+	traceID string
+	rootID  string
+	start   uint64
+	pending *otlpSpan // the last function span, waiting for its end time
+}
+
+// otelExporter converts events into OpenTelemetry traces, and sends them to
+// an OTLP/HTTP collector. The batches are sent in the background, so that a
+// slow collector doesn't delay the reading of the events, and are dropped
+// once otelQueueSize of them are waiting.
+type otelExporter struct {
+	url        string
+	client     *http.Client
+	monoToReal int64
+	traces     map[uint64]*skbTrace
+	spans      []otlpSpan
+	lastFlush  time.Time
+	batches    chan []otlpSpan
+	sent       chan struct{} // closed once the batches are sent
+	dropped    int           // spans of the dropped batches
+}
+
+func newOtelExporter(endpoint string, monoToReal int64) *otelExporter {
+	e := &otelExporter{
+		url:        strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		client:     &http.Client{Timeout: 10 * time.Second},
+		monoToReal: monoToReal,
+		traces:     map[uint64]*skbTrace{},
+		lastFlush:  time.Now(),
+		batches:    make(chan []otlpSpan, otelQueueSize),
+		sent:       make(chan struct{}),
+	}
+	go e.send()
+	return e
+}
+
+func (e *otelExporter) ts(ts uint64) string {
+	return strconv.FormatInt(int64(ts)+e.monoToReal, 10)
+}
+
+// Add records a function hit of the skb.
+func (e *otelExporter) Add(event *eventInfo) {
+	tr, ok := e.traces[event.SAddr]
+	if !ok {
+		tr = &skbTrace{
+			traceID: randomID(16),
+			rootID:  randomID(8),
+			start:   event.Timestamp,
+		}
+		e.traces[event.SAddr] = tr
+	}
+	if tr.pending != nil {
+		tr.pending.EndTimeUnixNano = e.ts(event.Timestamp)
+		e.spans = append(e.spans, *tr.pending)
+	}
+
+	attrs := []otlpAttribute{
+		otlpString("skb", fmt.Sprintf("0x%x", event.SAddr)),
+		otlpInt("cpu", uint64(event.CPU)),
+		otlpString("process", event.execName),
+	}
+	if meta := event.Meta; meta.Ifindex != 0 || meta.Netns != 0 {
+		attrs = append(attrs,
+			otlpInt("netns", uint64(meta.Netns)),
+			otlpInt("mark", uint64(meta.Mark)),
+			otlpInt("ifindex", uint64(meta.Ifindex)),
+			otlpInt("len", uint64(meta.Len)),
+			otlpInt("mtu", uint64(meta.MTU)))
+	}
+	if event.Tuple.L3Proto != 0 {
+		tuple := newJSONTuple(&event.Tuple)
+		attrs = append(attrs,
+			otlpString("src", tuple.Src()),
+			otlpString("dst", tuple.Dst()),
+			otlpString("proto", tuple.Proto))
+	}
+
+	tr.pending = &otlpSpan{
+		TraceID:           tr.traceID,
+		SpanID:            randomID(8),
+		ParentSpanID:      tr.rootID,
+		Name:              event.funcName,
+		Kind:              otelSpanKindInt,
+		StartTimeUnixNano: e.ts(event.Timestamp),
+		EndTimeUnixNano:   e.ts(event.Timestamp),
+		Attributes:        attrs,
+	}
+
+	if len(e.spans) >= otelBatchSize || time.Since(e.lastFlush) > otelFlushInterval {
+		e.flush()
+	}
+}
+
+// End completes the trace of the skb, e.g. once it has been freed.
+func (e *otelExporter) End(skb uint64) {
+	tr, ok := e.traces[skb]
+	if !ok {
+		return
+	}
+	delete(e.traces, skb)
+
+	end := tr.pending.EndTimeUnixNano
+	e.spans = append(e.spans, *tr.pending, otlpSpan{
+		TraceID:           tr.traceID,
+		SpanID:            tr.rootID,
+		Name:              fmt.Sprintf("skb 0x%x", skb),
+		Kind:              otelSpanKindInt,
+		StartTimeUnixNano: e.ts(tr.start),
+		EndTimeUnixNano:   end,
+		Attributes:        []otlpAttribute{otlpString("skb", fmt.Sprintf("0x%x", skb))},
+	})
+}
+
+// Close completes all the pending traces, and waits for them to be sent.
+func (e *otelExporter) Close() {
+	for skb := range e.traces {
+		e.End(skb)
+	}
+	e.flush()
+	close(e.batches)
+	<-e.sent
+	if e.dropped > 0 {
+		log.Printf("Dropped %d OTLP spans, the collector is too slow", e.dropped)
+	}
+}
+
+// flush queues the spans to be sent, or drops them if the queue is full.
+func (e *otelExporter) flush() {
+	e.lastFlush = time.Now()
+	if len(e.spans) == 0 {
+		return
+	}
+
+	select {
+	case e.batches <- e.spans:
+	default:
+		e.dropped += len(e.spans)
+	}
+	e.spans = nil
+}
+
+func (e *otelExporter) send() {
+	defer close(e.sent)
+	for spans := range e.batches {
+		e.post(spans)
+	}
+}
+
+func (e *otelExporter) post(spans []otlpSpan) {
+	req := otlpTraces{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: []otlpAttribute{otlpString("service.name", "pwru")}},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "pwru", Version: Version},
+				Spans: spans,
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(&req)
+	if err != nil {
+		log.Printf("Failed to encode OTLP traces: %s", err)
+		return
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to export OTLP traces: %s", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		log.Printf("Failed to export OTLP traces: %s", resp.Status)
+	}
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
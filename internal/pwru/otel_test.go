@@ -0,0 +1,28 @@
+package pwru
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOtelExporter_slowCollector(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	e := newOtelExporter(srv.URL, 0)
+	// The first batch blocks the sender, the next ones fill the queue
+	for i := 0; i < otelQueueSize+3; i++ {
+		e.spans = append(e.spans, otlpSpan{Name: "ip_rcv"})
+		e.flush()
+	}
+	if e.dropped == 0 {
+		t.Errorf("dropped = 0, want the spans over the queue size")
+	}
+
+	close(release)
+	e.Close()
+}
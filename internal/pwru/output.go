@@ -5,14 +5,25 @@
 package pwru
 
 import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math"
 	"net"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/template"
+	"time"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
 	ps "github.com/mitchellh/go-ps"
 
 	"github.com/cilium/pwru/internal/byteorder"
@@ -21,59 +32,1311 @@ import (
 type output struct {
 	flags         *Flags
 	lastSeenSkb   map[uint64]uint64 // skb addr => last seen TS
+	lastSkbHop    map[uint64]skbHop // skb addr => last CPU and function
+	skbGens       *skbGenerations
+	packets       *packetTracker // --track-by=tuple
 	printSkbMap   *ebpf.Map
 	printStackMap *ebpf.Map
 	addr2name     Addr2Name
-	writer        io.Writer
+	writer        *bufio.Writer
+	file          io.WriteCloser
+	rotator       *rotatingFile // set if the output file is rotated
+	flushEvents   bool
+	pcap          *pcapWriter
+	capture       *pcapWriter // --capture-file
+	captured      uint64      // number of packets in the capture file
+	groups        *skbGroups
+	coalesce      *coalescer // --coalesce
+	vethFlows     *vethFlows // --correlate-veth
+	dot           *dotGraph  // --export-dot
+	mermaid       *mermaidTrace
+	folded        *foldedStacks
+	tmpl          *template.Template
+	formatter     eventFormatter
+	recorder      *recorder // --record
+	otel          *otelExporter
+	metrics       *Metrics
+	grpc          *grpcServer
+	dropReasons   map[uint64]string
 	kprobeMulti   bool
+	monoToReal    int64
+	firstTS       uint64 // of the first event, for --timestamp=relative-start
+	hostNames     *hostNames
+	services      services // --resolve-ports
+	netnsNames    *netnsNames
+	kubePods      *kubePods
+	containers    *containerNames
+	summary       *summary
+	tui           *tui
+	userNames     userNames
 }
 
 func NewOutput(flags *Flags, printSkbMap *ebpf.Map, printStackMap *ebpf.Map,
-	addr2Name Addr2Name, kprobeMulti bool) (*output, error) {
+	addr2Name Addr2Name, kprobeMulti bool, metrics *Metrics, btfSpec *btf.Spec) (*output, error) {
 
-	writer := os.Stdout
+	var file io.WriteCloser = os.Stdout
+	var rotator *rotatingFile
 
-	if flags.OutputFile != "" {
-		file, err := os.Create(flags.OutputFile)
+	if flags.OutputFile != "" && (flags.OutputFileMaxSize != "" || flags.OutputFileRotateInterval > 0) {
+		var maxSize int64
+		if flags.OutputFileMaxSize != "" {
+			size, err := parseSize(flags.OutputFileMaxSize)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse --output-file-max-size: %w", err)
+			}
+			maxSize = size
+		}
+		r, err := newRotatingFile(flags.OutputFile, maxSize, flags.OutputFileMaxFiles, flags.OutputFileRotateInterval)
+		if err != nil {
+			return nil, err
+		}
+		file = r
+		rotator = r
+	} else if flags.OutputFile != "" {
+		f, err := createOutputFile(flags.OutputFile)
+		if err != nil {
+			return nil, err
+		}
+		file = f
+	}
+
+	var pcap *pcapWriter
+	if flags.PcapFile != "" {
+		w, err := newPcapWriter(flags.PcapFile, MaxCaptureLen)
+		if err != nil {
+			return nil, err
+		}
+		pcap = w
+	}
+
+	var capture *pcapWriter
+	if flags.CaptureFile != "" {
+		w, err := newPcapWriter(flags.CaptureFile, MaxFullCaptureLen)
 		if err != nil {
 			return nil, err
 		}
-		writer = file
+		capture = w
 	}
 
-	return &output{
+	if _, ok := timestampUnits[flags.TimestampUnit]; !ok && flags.TimestampUnit != "" {
+		return nil, fmt.Errorf("invalid timestamp unit %s", flags.TimestampUnit)
+	}
+
+	var monoToReal int64
+	if flags.OutputTS == "absolute-date" || flags.OtelEndpoint != "" || flags.Record != "" {
+		offset, err := monotonicToRealtimeOffset()
+		if err != nil {
+			return nil, err
+		}
+		monoToReal = offset
+	}
+
+	var tmpl *template.Template
+	if flags.OutputTemplate != "" {
+		t, err := template.New("output").Parse(flags.OutputTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse output template: %w", err)
+		}
+		tmpl = t
+	}
+
+	var otel *otelExporter
+	if flags.OtelEndpoint != "" {
+		otel = newOtelExporter(flags.OtelEndpoint, monoToReal)
+	}
+
+	var grpcSrv *grpcServer
+	if flags.GRPCAddr != "" {
+		srv, err := newGRPCServer(flags.GRPCAddr)
+		if err != nil {
+			return nil, err
+		}
+		grpcSrv = srv
+	}
+
+	var netns *netnsNames
+	if flags.OutputMeta || flags.Kube {
+		netns = newNetnsNames()
+	}
+
+	var hosts *hostNames
+	if flags.ResolveNames {
+		hosts = newHostNames(net.DefaultResolver.LookupAddr)
+	}
+
+	var svcs services
+	if flags.ResolvePorts {
+		s, err := loadServices(servicesFile)
+		if err != nil {
+			log.Printf("Failed to load the service names: %s", err)
+		}
+		svcs = s
+	}
+
+	var pods *kubePods
+	if flags.Kube {
+		k, err := newKubePods()
+		if err != nil {
+			return nil, err
+		}
+		pods = k
+	}
+
+	var containers *containerNames
+	if flags.OutputContainer {
+		c, err := newContainerNames(flags.CRIEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		containers = c
+	}
+
+	var sum *summary
+	if flags.Summary {
+		sum = newSummary()
+	}
+
+	var groups *skbGroups
+	if flags.GroupBySkb || flags.OnlyDrops {
+		groups = newSkbGroups(flags.OnlyDrops)
+	}
+
+	var packets *packetTracker
+	switch flags.TrackBy {
+	case "", TrackBySkb:
+	case TrackByTuple:
+		packets = newPacketTracker()
+	default:
+		return nil, fmt.Errorf("invalid --track-by %q (available: %s, %s)", flags.TrackBy, TrackBySkb, TrackByTuple)
+	}
+	if packets != nil && groups != nil {
+		groups.header = "PACKET %d:\n"
+	}
+
+	var coalesce *coalescer
+	if flags.Coalesce {
+		coalesce = &coalescer{}
+	}
+
+	var vethFlows *vethFlows
+	if flags.CorrelateVeth {
+		vethFlows = newVethFlows()
+	}
+
+	var dot *dotGraph
+	if flags.ExportDot != "" {
+		dot = newDotGraph(flags.ExportDot, flags.ExportDotPerFlow)
+	}
+
+	var mermaid *mermaidTrace
+	if flags.ExportMermaid != "" {
+		var skb uint64
+		if flags.ExportMermaidSkb != "" {
+			var err error
+			if skb, err = strconv.ParseUint(flags.ExportMermaidSkb, 0, 64); err != nil {
+				return nil, fmt.Errorf("invalid --export-mermaid-skb %q: %w", flags.ExportMermaidSkb, err)
+			}
+		}
+		mermaid = newMermaidTrace(flags.ExportMermaid, skb)
+	}
+
+	var folded *foldedStacks
+	if flags.ExportFolded != "" {
+		folded = newFoldedStacks(flags.ExportFolded)
+	}
+
+	o := &output{
 		flags:         flags,
 		lastSeenSkb:   map[uint64]uint64{},
+		lastSkbHop:    map[uint64]skbHop{},
+		skbGens:       newSkbGenerations(),
+		packets:       packets,
 		printSkbMap:   printSkbMap,
 		printStackMap: printStackMap,
 		addr2name:     addr2Name,
-		writer:        writer,
-		kprobeMulti:   kprobeMulti,
-	}, nil
+		writer:        bufio.NewWriter(file),
+		file:          file,
+		rotator:       rotator,
+		// Traces written to a file are only flushed when the buffer is full,
+		// unless the NDJSON streaming contract asks for every event to be
+		// flushed immediately.
+		flushEvents: flags.OutputFile == "" || flags.OutputFormat == OutputFormatNDJSON,
+		pcap:        pcap,
+		capture:     capture,
+		groups:      groups,
+		coalesce:    coalesce,
+		vethFlows:   vethFlows,
+		dot:         dot,
+		mermaid:     mermaid,
+		folded:      folded,
+		tmpl:        tmpl,
+		otel:        otel,
+		metrics:     metrics,
+		grpc:        grpcSrv,
+		dropReasons: GetDropReasons(btfSpec),
+		kprobeMulti: kprobeMulti,
+		monoToReal:  monoToReal,
+		hostNames:   hosts,
+		services:    svcs,
+		netnsNames:  netns,
+		kubePods:    pods,
+		containers:  containers,
+		summary:     sum,
+		userNames:   userNames{},
+	}
+
+	if tmpl != nil {
+		o.formatter = templateFormatter{o}
+	} else {
+		newFormatter, ok := eventFormatters[flags.OutputFormat]
+		if !ok {
+			return nil, fmt.Errorf("invalid output format %s", flags.OutputFormat)
+		}
+		f, err := newFormatter(o)
+		if err != nil {
+			return nil, err
+		}
+		o.formatter = f
+	}
+
+	if flags.Record != "" {
+		hdr := newRecordHeader(addr2Name, kprobeMulti, monoToReal, o.dropReasons)
+		r, err := newRecorder(flags.Record, hdr)
+		if err != nil {
+			return nil, err
+		}
+		o.recorder = r
+	}
+
+	// Last, as the terminal is left in raw mode on the errors above
+	if flags.TUI {
+		t, err := newTUI()
+		if err != nil {
+			return nil, err
+		}
+		o.tui = t
+	}
+	return o, nil
+}
+
+// FlushCoalesced prints the event held by --coalesce, if any, e.g. once no
+// event came for CoalesceIdle.
+func (o *output) FlushCoalesced() {
+	if o.coalesce == nil || o.coalesce.event == nil {
+		return
+	}
+	o.coalesce.flush(o.formatter)
+	o.flush()
+}
+
+// Close flushes any buffered output and closes the output files.
+func (o *output) Close() error {
+	o.tui.Close()
+	if o.coalesce != nil {
+		o.coalesce.flush(o.formatter)
+	}
+	if o.groups != nil {
+		o.groups.flushAll(o.writer, o.indentGroups())
+	}
+	if o.otel != nil {
+		o.otel.Close()
+	}
+	if o.grpc != nil {
+		o.grpc.Stop()
+	}
+	o.hostNames.Close()
+	o.kubePods.Close()
+	o.containers.Close()
+	// Close everything even on errors, so that no trace or export is lost
+	var errs []error
+	if o.pcap != nil {
+		if err := o.pcap.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if o.capture != nil {
+		if err := o.capture.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if o.recorder != nil {
+		if err := o.recorder.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if o.dot != nil {
+		if err := o.dot.writeFile(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write --export-dot file: %w", err))
+		}
+	}
+	if o.mermaid != nil {
+		if err := o.mermaid.writeFile(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write --export-mermaid file: %w", err))
+		}
+	}
+	if o.folded != nil {
+		if err := o.folded.writeFile(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write --export-folded file: %w", err))
+		}
+	}
+	if err := o.writer.Flush(); err != nil {
+		errs = append(errs, err)
+	}
+	if o.file != os.Stdout {
+		if err := o.file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return joinErrors(errs)
+}
+
+// joinErrors returns the error of errs, or one with all their messages if
+// more than one, as errors.Join requires Go 1.20.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// Fatalf is log.Fatalf, restoring the terminal of the TUI first, which
+// would otherwise be left in raw mode and hide the message.
+func (o *output) Fatalf(format string, v ...interface{}) {
+	o.tui.Close()
+	log.Fatalf(format, v...)
+}
+
+// PrintSummary writes the summary of the printed events, if enabled.
+func (o *output) PrintSummary(w io.Writer) {
+	if o.summary == nil {
+		return
+	}
+	// Leave the alternate screen of the TUI, which is cleared
+	o.tui.Close()
+	o.summary.write(w, o.skbGens.skbs)
+}
+
+// tuiOnStdout returns whether the TUI replaces the output, which is only
+// printed if written to a file.
+func (o *output) tuiOnStdout() bool {
+	return o.tui != nil && o.file == os.Stdout
+}
+
+// indentGroups returns whether the events of --group-by-skb are indented
+// under a line with the skb, which would break the formats with a record
+// per line.
+func (o *output) indentGroups() bool {
+	switch o.formatter.(type) {
+	case textFormatter, templateFormatter:
+		return true
+	}
+	return false
 }
 
 func (o *output) PrintHeader() {
-	fmt.Fprintf(o.writer, "%18s %6s %16s %24s", "SKB", "CPU", "PROCESS", "FUNC")
-	if o.flags.OutputTS != "none" {
-		fmt.Fprintf(o.writer, " %16s", "TIMESTAMP")
+	if o.tuiOnStdout() {
+		return
+	}
+	o.formatter.PrintHeader(o.writer)
+	o.flush()
+}
+
+// jsonEvent is the structure emitted per event with --output-format=json,
+// and the data passed to --output-template.
+type jsonEvent struct {
+	Skb        string     `json:"skb"`
+	CPU        uint32     `json:"cpu"`
+	Process    string     `json:"process"`
+	Container  string     `json:"container,omitempty"`
+	Func       string     `json:"func"`
+	Timestamp  *uint64    `json:"timestamp,omitempty"`
+	Time       string     `json:"time,omitempty"`
+	DeltaUs    *float64   `json:"delta_us,omitempty"`
+	Meta       *jsonMeta  `json:"meta,omitempty"`
+	Tuple      *jsonTuple `json:"tuple,omitempty"`
+	Eth        *jsonEth   `json:"eth,omitempty"`
+	Stack      []string   `json:"stack,omitempty"`
+	SkbDump    string     `json:"skb_dump,omitempty"`
+	DropReason string     `json:"drop_reason,omitempty"`
+	Pod        string     `json:"pod,omitempty"`
+	Retval     string     `json:"retval,omitempty"`
+	LatencyUs  *float64   `json:"latency_us,omitempty"`
+	Payload    string     `json:"payload,omitempty"` // hex
+	DNS        *jsonDNS   `json:"dns,omitempty"`
+	EventID    uint64     `json:"event_id,omitempty"`
+	SkbGen     uint32     `json:"skb_gen,omitempty"`
+	FlowID     uint64     `json:"flow_id,omitempty"`
+	Count      uint64     `json:"count,omitempty"` // with --coalesce
+	Sock       *jsonSock  `json:"sock,omitempty"`
+
+	Conntrack *jsonConntrack `json:"conntrack,omitempty"`
+	Netfilter *jsonNetfilter `json:"netfilter,omitempty"`
+	Parent    string         `json:"parent,omitempty"`
+	// Set if the previous event of the skb was on another CPU
+	PrevCPU  *uint32 `json:"prev_cpu,omitempty"`
+	PrevFunc string  `json:"prev_func,omitempty"`
+
+	XDP *jsonXDP `json:"xdp,omitempty"`
+	TC  *jsonTC  `json:"tc,omitempty"`
+
+	Tunnel *jsonTunnel `json:"tunnel,omitempty"`
+	Route  *jsonRoute  `json:"route,omitempty"`
+
+	TracepointArg string `json:"tracepoint_arg,omitempty"` // e.g. rc=0
+}
+
+type jsonMeta struct {
+	Netns     uint32  `json:"netns"`
+	NetnsName string  `json:"netns_name,omitempty"`
+	Mark      uint32  `json:"mark"`
+	Ifindex   uint32  `json:"ifindex"`
+	Ifname    string  `json:"ifname,omitempty"`
+	Proto     uint16  `json:"proto"`
+	MTU       uint32  `json:"mtu"`
+	Len       uint32  `json:"len"`
+	DataLen   uint32  `json:"data_len"`
+	NrFrags   uint8   `json:"nr_frags"`
+	Linear    bool    `json:"linear"`
+	VlanID    *uint16 `json:"vlan_id,omitempty"`
+	VlanPCP   *uint8  `json:"vlan_pcp,omitempty"`
+
+	IPSummed string `json:"ip_summed"`
+	// Only set for CHECKSUM_PARTIAL
+	CsumStart  *uint16 `json:"csum_start,omitempty"`
+	CsumOffset *uint16 `json:"csum_offset,omitempty"`
+
+	Hash         uint32 `json:"hash"`
+	QueueMapping uint16 `json:"queue_mapping"`
+	Priority     string `json:"priority"`
+	TCClassid    uint16 `json:"tc_classid"`
+	// Only set for IPv4 and IPv6
+	DSCP    *uint8          `json:"dscp,omitempty"`
+	ECN     string          `json:"ecn,omitempty"`
+	MPLS    []jsonMPLSLabel `json:"mpls,omitempty"`
+	TTL     *uint8          `json:"ttl,omitempty"`
+	PrevTTL *uint8          `json:"prev_ttl,omitempty"`
+	// Set if the TTL changed out of the forwarding path
+	TTLChangedAfter string `json:"ttl_changed_after,omitempty"`
+}
+
+type jsonEth struct {
+	Src   string `json:"src"`
+	Dst   string `json:"dst"`
+	Proto uint16 `json:"proto"`
+}
+
+type jsonTuple struct {
+	Saddr net.IP `json:"saddr"`
+	Sport uint16 `json:"sport"`
+	Daddr net.IP `json:"daddr"`
+	Dport uint16 `json:"dport"`
+	Proto string `json:"proto"`
+	Flags string `json:"tcp_flags,omitempty"`
+	Seq   uint32 `json:"seq,omitempty"`
+	Ack   uint32 `json:"ack,omitempty"`
+	VTag  uint32 `json:"sctp_vtag,omitempty"`
+	SPI   uint32 `json:"spi,omitempty"`
+	// Only set for ICMP and ICMPv6
+	ICMPType string `json:"icmp_type,omitempty"`
+	ICMPCode uint8  `json:"icmp_code,omitempty"`
+	// Only set for the echo requests and replies
+	ICMPID  *uint16 `json:"icmp_id,omitempty"`
+	ICMPSeq *uint16 `json:"icmp_seq,omitempty"`
+	// The IPv6 extension headers before the L4 header, if any
+	IPv6ExtHdrs []string `json:"ipv6_exthdrs,omitempty"`
+	// Only set with --resolve-names, once resolved
+	Shost string `json:"shost,omitempty"`
+	Dhost string `json:"dhost,omitempty"`
+	// Only set with --resolve-ports, for the known ports
+	Sservice string `json:"sservice,omitempty"`
+	Dservice string `json:"dservice,omitempty"`
+}
+
+func newJSONTuple(t *Tuple) *jsonTuple {
+	jt := &jsonTuple{
+		Saddr: addrToIP(t.L3Proto, t.Saddr),
+		Sport: byteorder.NetworkToHost16(t.Sport),
+		Daddr: addrToIP(t.L3Proto, t.Daddr),
+		Dport: byteorder.NetworkToHost16(t.Dport),
+		Proto: protoToStr(t.L4Proto),
+		Flags: tcpFlagsToStr(t.L4Proto, t.TCPFlags),
+
+		IPv6ExtHdrs: ipv6ExtHdrsToStrs(t.IPv6ExtHdrs),
+	}
+	if typ := icmpTypeToStr(t.L4Proto, t.ICMPType); typ != "" {
+		jt.ICMPType = typ
+		jt.ICMPCode = t.ICMPCode
+	}
+	if id, seq, ok := icmpEcho(t); ok {
+		jt.ICMPID, jt.ICMPSeq = &id, &seq
+	}
+	if t.L4Proto == syscall.IPPROTO_TCP {
+		jt.Seq = byteorder.NetworkToHost32(t.Seq)
+		jt.Ack = byteorder.NetworkToHost32(t.AckSeq)
+	} else if t.L4Proto == syscall.IPPROTO_SCTP {
+		jt.VTag = byteorder.NetworkToHost32(t.Seq)
+	} else if isIPsec(t.L4Proto) {
+		jt.SPI = byteorder.NetworkToHost32(t.SPI)
+		jt.Seq = byteorder.NetworkToHost32(t.Seq)
+	}
+	return jt
+}
+
+// Src returns the source address and port, e.g. for use in templates.
+func (t *jsonTuple) Src() string {
+	return net.JoinHostPort(t.Saddr.String(), strconv.Itoa(int(t.Sport)))
+}
+
+// Dst returns the destination address and port.
+func (t *jsonTuple) Dst() string {
+	return net.JoinHostPort(t.Daddr.String(), strconv.Itoa(int(t.Dport)))
+}
+
+// eventInfo holds the decoded fields of an event which are shared between
+// the output formats.
+type eventInfo struct {
+	*Event
+	execName   string
+	container  string // name of the container of the process, if any
+	funcName   string
+	ts         uint64
+	delta      uint64 // ns since the previous event of the same skb
+	stack      []string
+	skbDump    string
+	dropReason string   // set for the functions in dropReasonFuncs
+	ifName     string   // name of the meta ifindex, if known
+	netnsName  string   // name of the meta netns, if known
+	saddrName  string   // name of the tuple saddr, with --resolve-names
+	daddrName  string   // name of the tuple daddr, with --resolve-names
+	pod        string   // namespace/name of the pod owning the netns, with --kube
+	payload    []byte   // first bytes from the network header, with --output-payload
+	dns        *dnsInfo // with --output-dns
+	eventID    uint64   // number of the packet in the --capture-file, if captured
+	skbGen     uint32   // number of the previous skbs at the address
+	flowID     uint64   // with --correlate-veth
+	repeats    uint64   // number of coalesced events, with --coalesce
+	sockUser   string   // name of the owner of the socket, with --output-sock
+
+	conntrack *Conntrack // with --output-conntrack
+	migrated  *skbHop    // previous CPU of the skb, if it is another one
+	ttlChange *ttlChange // previous TTL of the skb, if it is another one
+
+	tracepointArg string // e.g. rc=0, for EventTypeTracepoint
+}
+
+type skbHop struct {
+	cpu      uint32
+	funcName string
+
+	// The last TTL seen in the IP header of the skb, and whether the skb went
+	// through a forwarding function since, i.e. the TTL may be decremented
+	ttl       uint8
+	hasTTL    bool
+	forwarded bool
+}
+
+type ttlChange struct {
+	ttl       uint8
+	funcName  string // of the previous event
+	forwarded bool   // false if the TTL changed out of the forwarding path
+}
+
+// ttlForwardFuncs decrement the TTL or hop limit of the forwarded packets.
+var ttlForwardFuncs = map[string]bool{
+	"ip_forward":     true,
+	"ip6_forward":    true,
+	"ip_mr_forward":  true,
+	"ip6_mr_forward": true,
+}
+
+// process returns the executable name, along with the container name if
+// any, e.g. "nginx@web".
+func (e *eventInfo) process() string {
+	if e.container != "" {
+		return e.execName + "@" + e.container
 	}
-	fmt.Fprintf(o.writer, "\n")
+	return e.execName
 }
 
-func (o *output) Print(event *Event) {
+func (o *output) Print(event *Event, pkt *Packet) {
 	p, err := ps.FindProcess(int(event.PID))
 	execName := "<empty>"
 	if err == nil && p != nil {
 		execName = p.Executable()
 	}
+
+	rec := &recordedEvent{
+		Event:    *event,
+		Packet:   pkt,
+		ExecName: execName,
+	}
+	if (o.flags.OutputStack || o.folded != nil) && event.PrintStackId > 0 {
+		rec.Stack = o.getStack(event)
+	}
+	if o.flags.OutputSkb {
+		rec.SkbDump = o.getSkbDump(event)
+	}
+	if o.recorder != nil {
+		o.recorder.write(rec)
+	}
+	o.print(rec)
+}
+
+// print prints an event along with what was looked up from the kernel, live
+// or from a --record file.
+func (o *output) print(rec *recordedEvent) {
+	event, pkt, execName := &rec.Event, rec.Packet, rec.ExecName
+	funcName := o.getFuncName(event)
+	freed := o.skbFreed(event, funcName)
+
+	// The events are keyed on the skb, or on its packet with
+	// --track-by=tuple, which is done once its last skb is freed. The
+	// events without an skb, e.g. of fib_table_lookup(), aren't tracked.
+	tracked := event.SAddr != 0
+	skb, done := event.SAddr, freed && tracked
+	var skbGen uint32
+	if tracked {
+		var reused bool
+		skbGen, reused = o.skbGens.update(event, freed)
+		if o.packets != nil {
+			skb, done = o.packets.track(event, freed)
+		} else if reused {
+			// Forget the previous skb at the address, which isn't the
+			// same packet
+			delete(o.lastSeenSkb, skb)
+			delete(o.lastSkbHop, skb)
+			if o.groups != nil {
+				o.groups.flush(o.writer, skb, o.indentGroups())
+			}
+		}
+	}
+
 	ts := event.Timestamp
-	if o.flags.OutputTS == "relative" {
-		if last, found := o.lastSeenSkb[event.SAddr]; found {
-			ts = ts - last
+	last, found := o.lastSeenSkb[skb]
+	var delta uint64
+	if found && tracked {
+		delta = event.Timestamp - last
+	}
+	if o.firstTS == 0 {
+		o.firstTS = event.Timestamp
+	}
+	switch o.flags.OutputTS {
+	case "relative":
+		ts = delta
+	case "relative-start":
+		ts = event.Timestamp - o.firstTS
+	}
+	if tracked {
+		o.lastSeenSkb[skb] = event.Timestamp
+	}
+
+	// The skb moved to another CPU since the previous event, e.g. queued
+	// by RPS with enqueue_to_backlog()
+	var migrated *skbHop
+	hop, ok := o.lastSkbHop[skb]
+	if ok && tracked && hop.cpu != event.CPU {
+		migrated = &hop
+	}
+	next := skbHop{
+		cpu:       event.CPU,
+		funcName:  funcName,
+		ttl:       hop.ttl,
+		hasTTL:    hop.hasTTL,
+		forwarded: hop.forwarded || ttlForwardFuncs[funcName],
+	}
+	// The TTL changed since the previous event, e.g. decremented by
+	// ip_forward(), or set by a netfilter rule or a BPF program
+	var ttlChanged *ttlChange
+	if event.Meta.IPVersion != 0 && tracked {
+		if hop.hasTTL && hop.ttl != event.Meta.TTL {
+			ttlChanged = &ttlChange{hop.ttl, hop.funcName, hop.forwarded}
+			next.forwarded = ttlForwardFuncs[funcName]
+		}
+		next.ttl, next.hasTTL = event.Meta.TTL, true
+	}
+	if tracked {
+		o.lastSkbHop[skb] = next
+	}
+	o.metrics.IncEvent(funcName)
+
+	comment := fmt.Sprintf("func=%s skb=0x%x cpu=%d process=%s", funcName, event.SAddr, event.CPU, execName)
+	if o.pcap != nil && pkt != nil {
+		pcapPkt := *pkt
+		if len(pcapPkt.Data) > MaxCaptureLen {
+			pcapPkt.Data = pcapPkt.Data[:MaxCaptureLen]
+		}
+		o.pcap.WritePacket(event, &pcapPkt, comment)
+	}
+
+	// The packets are numbered as the frames in Wireshark
+	var eventID uint64
+	if o.capture != nil && pkt != nil && len(pkt.Data) > 0 {
+		o.captured++
+		eventID = o.captured
+		o.capture.WritePacket(event, pkt, fmt.Sprintf("event_id=%d %s", eventID, comment))
+	}
+
+	info := &eventInfo{
+		Event:     event,
+		execName:  execName,
+		container: o.containers.Name(int(event.PID)),
+		funcName:  funcName,
+		ts:        ts,
+		delta:     delta,
+		eventID:   eventID,
+		skbGen:    skbGen,
+		migrated:  migrated,
+		ttlChange: ttlChanged,
+	}
+
+	if o.packets != nil && tracked {
+		info.flowID = skb
+	} else if o.vethFlows != nil && tracked {
+		info.flowID = o.vethFlows.flowID(event, funcName, pkt, freed)
+	}
+
+	if o.flags.OutputDNS && pkt != nil {
+		info.dns = decodeDNS(pkt.Data)
+	}
+
+	if o.flags.OutputPayload > 0 && pkt != nil {
+		info.payload = pkt.Data
+		if len(info.payload) > o.flags.OutputPayload {
+			info.payload = info.payload[:o.flags.OutputPayload]
+		}
+	}
+
+	if dropReasonFuncs[funcName] && event.Type != EventTypeReturn {
+		info.dropReason = o.getDropReason(event)
+	}
+
+	if o.flags.OnlyDrops && event.Type != EventTypeReturn && isSkbDrop(funcName, info.dropReason) {
+		o.groups.drop(skb)
+	}
+
+	if event.Type == EventTypeTracepoint {
+		info.tracepointArg = tracepointArg(event)
+	}
+
+	if o.summary != nil {
+		o.summary.add(info)
+	}
+
+	if o.dot != nil {
+		o.dot.add(info, freed)
+	}
+
+	if o.mermaid != nil {
+		o.mermaid.add(info, freed)
+	}
+
+	if o.folded != nil && event.Type != EventTypeReturn {
+		o.folded.add(funcName, rec.Stack)
+	}
+
+	if o.flags.OutputMeta {
+		info.ifName = cstr(event.Meta.Ifname[:])
+		info.netnsName = o.netnsNames.Name(event.Meta.Netns)
+	}
+
+	if o.hostNames != nil && event.Tuple.L3Proto != 0 {
+		info.saddrName = o.hostNames.Name(addrToIP(event.Tuple.L3Proto, event.Tuple.Saddr))
+		info.daddrName = o.hostNames.Name(addrToIP(event.Tuple.L3Proto, event.Tuple.Daddr))
+	}
+
+	if o.kubePods != nil {
+		info.pod = o.kubePods.Pod(o.netnsNames.Pid(event.Meta.Netns))
+	}
+
+	if o.flags.OutputConntrack {
+		info.conntrack = &event.Conntrack
+	}
+
+	if o.flags.OutputSock && event.Sock.Addr != 0 {
+		info.sockUser = o.userNames.Name(event.Sock.UID)
+	}
+
+	if o.flags.OutputStack {
+		info.stack = rec.Stack
+		if depth := o.flags.StackDepth; depth > 0 && len(info.stack) > depth {
+			info.stack = info.stack[:depth]
+		}
+	}
+
+	if o.flags.OutputSkb {
+		info.skbDump = rec.SkbDump
+	}
+
+	defer o.flush()
+
+	var w io.Writer = o.writer
+	if o.groups != nil && tracked {
+		w = o.groups.buffer(o.writer, skb, o.indentGroups())
+	} else if o.flags.OnlyDrops {
+		// Not of a dropped skb
+		w = io.Discard
+	}
+
+	if o.grpc != nil {
+		o.grpc.Publish(info)
+	}
+
+	if o.tui != nil {
+		o.tui.add(info)
+	}
+
+	// The TUI replaces the output on stdout
+	if !o.tuiOnStdout() {
+		if o.coalesce != nil {
+			o.coalesce.add(w, info, o.formatter)
 		} else {
-			ts = 0
+			o.formatter.PrintEvent(w, info)
+		}
+	}
+
+	if o.otel != nil && event.Type != EventTypeReturn && tracked {
+		o.otel.Add(info)
+	}
+
+	if freed {
+		// The address may be reused by another skb
+		if o.coalesce != nil {
+			o.coalesce.flush(o.formatter)
+		}
+		if o.otel != nil {
+			o.otel.End(event.SAddr)
+		}
+	}
+	if done && o.groups != nil {
+		o.groups.flush(o.writer, skb, o.indentGroups())
+	}
+}
+
+// skbFreed returns whether the skb is done after the event. When tracking the
+// returns, the skb is done once the free function returns.
+func (o *output) skbFreed(event *Event, funcName string) bool {
+	trackReturn := o.flags.OutputRetval || o.flags.OutputLatency
+	return skbFreeFuncs[funcName] && (event.Type == EventTypeReturn) == trackReturn
+}
+
+func (o *output) printText(w io.Writer, event *eventInfo) {
+	fmt.Fprintf(w, "%18s %6s %16s %24s", fmt.Sprintf("0x%x", event.SAddr),
+		fmt.Sprintf("%d", event.CPU), fmt.Sprintf("[%s]", event.process()), event.funcName)
+	if o.flags.OutputTS == "absolute-date" {
+		fmt.Fprintf(w, " %35s", o.absoluteDate(event.ts))
+	} else if o.flags.OutputTS != "none" {
+		fmt.Fprintf(w, " %16s", timestampToStr(event.ts, o.flags.TimestampUnit))
+	}
+	if o.flags.OutputDelta {
+		fmt.Fprintf(w, " %12.3f", float64(event.delta)/1000)
+	}
+
+	if event.eventID != 0 {
+		fmt.Fprintf(w, " event_id=%d", event.eventID)
+	}
+
+	if event.skbGen != 0 {
+		fmt.Fprintf(w, " skb_gen=%d", event.skbGen)
+	}
+
+	if event.ParentAddr != 0 {
+		fmt.Fprintf(w, " parent=0x%x", event.ParentAddr)
+	}
+
+	if event.flowID != 0 {
+		fmt.Fprintf(w, " flow_id=%d", event.flowID)
+	}
+
+	if event.repeats > 1 {
+		fmt.Fprintf(w, " x%d", event.repeats)
+	}
+
+	if event.migrated != nil {
+		fmt.Fprintf(w, " cpu=%d->%d prev_func=%s", event.migrated.cpu, event.CPU, event.migrated.funcName)
+	}
+
+	if o.flags.OutputMeta {
+		ifindex := strconv.Itoa(int(event.Meta.Ifindex))
+		if event.ifName != "" {
+			ifindex = fmt.Sprintf("%s(%d)", event.ifName, event.Meta.Ifindex)
+		}
+		netns := strconv.Itoa(int(event.Meta.Netns))
+		if event.netnsName != "" {
+			netns = fmt.Sprintf("%s(%d)", event.netnsName, event.Meta.Netns)
+		}
+		fmt.Fprintf(w, " netns=%s mark=0x%x ifindex=%s proto=%x mtu=%d len=%d", netns, event.Meta.Mark, ifindex, event.Meta.Proto, event.Meta.MTU, event.Meta.Len)
+		fmt.Fprintf(w, " data_len=%d nr_frags=%d linear=%t", event.Meta.DataLen, event.Meta.NrFrags, event.Meta.Linear())
+		fmt.Fprintf(w, " ip_summed=%s", ipSummedToStr(event.Meta.IPSummed))
+		if event.Meta.IPSummed == ChecksumPartial {
+			fmt.Fprintf(w, " csum_start=%d csum_offset=%d", event.Meta.CsumStart, event.Meta.CsumOffset)
+		}
+		fmt.Fprintf(w, " hash=0x%x queue_mapping=%d", event.Meta.Hash, event.Meta.QueueMapping)
+		fmt.Fprintf(w, " priority=%s tc_classid=0x%x", priorityToStr(event.Meta.Priority), event.Meta.TCClassid)
+		if event.Meta.VlanPresent != 0 {
+			fmt.Fprintf(w, " vlan=%d pcp=%d", event.Meta.VlanID(), event.Meta.VlanPCP())
+		}
+		if event.Meta.MPLSLabels != 0 {
+			fmt.Fprintf(w, " mpls=%s", mplsLabelsToStr(&event.Meta))
+		}
+		if event.Meta.IPVersion != 0 {
+			fmt.Fprintf(w, " dscp=%s ecn=%s", dscpToStr(event.Meta.DSCP()), ecnToStr(event.Meta.ECN()))
+			if c := event.ttlChange; c != nil {
+				fmt.Fprintf(w, " ttl=%d->%d", c.ttl, event.Meta.TTL)
+				if !c.forwarded {
+					fmt.Fprintf(w, " ttl_changed_after=%s", c.funcName)
+				}
+			} else {
+				fmt.Fprintf(w, " ttl=%d", event.Meta.TTL)
+			}
+		}
+	}
+
+	if event.pod != "" {
+		fmt.Fprintf(w, " pod=%s", event.pod)
+	}
+
+	if event.dropReason != "" {
+		fmt.Fprintf(w, " reason=%s", event.dropReason)
+	}
+
+	if event.Type == EventTypeReturn && o.flags.OutputRetval {
+		fmt.Fprintf(w, " retval=%s", retvalToStr(event.ParamNext))
+	}
+
+	if arg := event.tracepointArg; arg != "" {
+		fmt.Fprintf(w, " %s", arg)
+	}
+
+	if event.Type == EventTypeReturn && o.flags.OutputLatency {
+		fmt.Fprintf(w, " latency=%.3fus", float64(event.Duration)/1000)
+	}
+
+	if o.flags.OutputEth {
+		fmt.Fprintf(w, " %s->%s(%#04x)", net.HardwareAddr(event.Eth.Src[:]), net.HardwareAddr(event.Eth.Dst[:]),
+			byteorder.NetworkToHost16(event.Eth.Proto))
+	}
+
+	if o.flags.OutputSock && event.Sock.Addr != 0 {
+		fmt.Fprintf(w, " sk=0x%x cookie=%d sk_proto=%s sk_state=%s", event.Sock.Addr, event.Sock.Cookie,
+			sockProtoToStr(event.Sock.Protocol), sockStateToStr(event.Sock.State))
+		if event.Sock.UID != SockIDUnknown {
+			uid := strconv.Itoa(int(event.Sock.UID))
+			if event.sockUser != "" {
+				uid = fmt.Sprintf("%s(%s)", uid, event.sockUser)
+			}
+			fmt.Fprintf(w, " uid=%s", uid)
+		}
+		if event.Sock.GID != SockIDUnknown {
+			fmt.Fprintf(w, " gid=%d", event.Sock.GID)
+		}
+	}
+
+	if nf := &event.Netfilter; nf.Kind != 0 {
+		fmt.Fprintf(w, " nf=%s/%s", nfProtoToStr(nf.PF), nfHookToStr(nf.PF, nf.Hook))
+		if table := cstr(nf.Table[:]); table != "" {
+			fmt.Fprintf(w, " table=%s", table)
+		}
+		if chain := cstr(nf.Chain[:]); chain != "" {
+			fmt.Fprintf(w, " chain=%s", chain)
+		}
+		fmt.Fprintf(w, " verdict=%s", nfVerdictToStr(nf.Kind, nf.Verdict))
+	}
+
+	if event.Route.Ifindex != 0 {
+		fmt.Fprintf(w, " %s", routeToStr(&event.Route))
+	}
+
+	if event.Type == EventTypeXDP {
+		fmt.Fprintf(w, " xdp_prog=%d rx_queue=%d verdict=%s", event.XDP.ProgID, event.XDP.RxQueue,
+			xdpVerdictToStr(event.XDP.Verdict))
+	}
+
+	if event.Type == EventTypeTC {
+		fmt.Fprintf(w, " tc_prog=%d dir=%s verdict=%s", event.TC.ProgID, tcDirToStr(event.TC.Ingress),
+			tcVerdictToStr(event.TC.Verdict))
+	}
+
+	if ct := event.conntrack; ct != nil {
+		fmt.Fprintf(w, " ct=%s", ctInfoToStr(ct.CTInfo))
+		if ct.hasEntry() {
+			fmt.Fprintf(w, " ct_zone=%d ct_mark=0x%x", ct.Zone, ct.Mark)
+		}
+	}
+
+	if o.flags.OutputTuple {
+		proto := protoToStr(event.Tuple.L4Proto)
+		if typ := icmpTypeToStr(event.Tuple.L4Proto, event.Tuple.ICMPType); typ != "" {
+			proto += " " + typ
+			if event.Tuple.ICMPCode != 0 {
+				proto += fmt.Sprintf(" code=%d", event.Tuple.ICMPCode)
+			}
+			if id, seq, ok := icmpEcho(&event.Tuple); ok {
+				proto += fmt.Sprintf(" id=%d seq=%d", id, seq)
+			}
+		}
+		fmt.Fprintf(w, " %s:%s->%s:%s(%s)",
+			hostAddr(event.saddrName, addrToStr(event.Tuple.L3Proto, event.Tuple.Saddr)),
+			o.services.portToStr(event.Tuple.L4Proto, byteorder.NetworkToHost16(event.Tuple.Sport)),
+			hostAddr(event.daddrName, addrToStr(event.Tuple.L3Proto, event.Tuple.Daddr)),
+			o.services.portToStr(event.Tuple.L4Proto, byteorder.NetworkToHost16(event.Tuple.Dport)),
+			proto)
+		if event.Tuple.IPv6ExtHdrs != 0 {
+			fmt.Fprintf(w, " ipv6_exthdrs=%s", strings.Join(ipv6ExtHdrsToStrs(event.Tuple.IPv6ExtHdrs), ","))
+		}
+		if flags := tcpFlagsToStr(event.Tuple.L4Proto, event.Tuple.TCPFlags); flags != "" {
+			fmt.Fprintf(w, " [%s]", flags)
+		}
+		if event.Tuple.L4Proto == syscall.IPPROTO_TCP {
+			fmt.Fprintf(w, " seq=%d ack=%d",
+				byteorder.NetworkToHost32(event.Tuple.Seq), byteorder.NetworkToHost32(event.Tuple.AckSeq))
+		} else if event.Tuple.L4Proto == syscall.IPPROTO_SCTP {
+			fmt.Fprintf(w, " vtag=0x%x", byteorder.NetworkToHost32(event.Tuple.Seq))
+		} else if isIPsec(event.Tuple.L4Proto) {
+			fmt.Fprintf(w, " spi=0x%x seq=%d",
+				byteorder.NetworkToHost32(event.Tuple.SPI), byteorder.NetworkToHost32(event.Tuple.Seq))
+		}
+		if event.Tunnel.Type != 0 {
+			fmt.Fprintf(w, " %s", tunnelToStr(&event.Tunnel))
+		}
+	}
+
+	if event.dns != nil {
+		fmt.Fprintf(w, " %s", event.dns)
+	}
+
+	if o.flags.StackSingleLine && len(event.stack) > 0 {
+		fmt.Fprintf(w, " stack=%s", strings.Join(event.stack, "<-"))
+	} else {
+		for _, sym := range event.stack {
+			fmt.Fprintf(w, "\n%s", sym)
+		}
+	}
+
+	if event.skbDump != "" {
+		fmt.Fprintf(w, "\n%s", event.skbDump)
+	}
+
+	if len(event.payload) > 0 {
+		fmt.Fprintf(w, "\n%s", hexdump(event.payload))
+	}
+
+	fmt.Fprintln(w)
+}
+
+// absoluteDate converts a bpf_ktime_get_ns() timestamp to wall-clock time.
+func (o *output) absoluteDate(ts uint64) string {
+	return time.Unix(0, int64(ts)+o.monoToReal).Format("2006-01-02T15:04:05.000000000Z07:00")
+}
+
+// timestampUnits are the units of --timestamp-unit, in ns, and the number
+// of decimals which keep the ns precision.
+var timestampUnits = map[string]struct {
+	ns       uint64
+	decimals int
+}{
+	"ns": {1, 0},
+	"us": {1e3, 3},
+	"ms": {1e6, 6},
+	"s":  {1e9, 9},
+}
+
+// timestampToStr formats a timestamp in ns in the --timestamp-unit, e.g.
+// "1234.567891" in ms.
+func timestampToStr(ts uint64, unit string) string {
+	u, ok := timestampUnits[unit]
+	if !ok || u.ns == 1 {
+		return strconv.FormatUint(ts, 10)
+	}
+	return fmt.Sprintf("%d.%0*d", ts/u.ns, u.decimals, ts%u.ns)
+}
+
+func (o *output) flush() {
+	if o.rotator != nil && o.rotator.due(o.writer.Buffered()) {
+		// Rotate between events
+		if err := o.writer.Flush(); err != nil {
+			log.Printf("Failed to flush output: %s", err)
+		}
+		if err := o.rotator.rotate(); err != nil {
+			o.Fatalf("Failed to rotate output file: %s", err)
+		}
+		o.PrintHeader()
+		return
+	}
+
+	if !o.flushEvents {
+		return
+	}
+	if err := o.writer.Flush(); err != nil {
+		log.Printf("Failed to flush output: %s", err)
+	}
+}
+
+func (o *output) printJSON(w io.Writer, event *eventInfo) {
+	ev := o.newJSONEvent(event, false)
+	if err := json.NewEncoder(w).Encode(ev); err != nil {
+		log.Printf("Failed to encode event: %s", err)
+	}
+}
+
+func (o *output) printTemplate(w io.Writer, event *eventInfo) {
+	if err := o.tmpl.Execute(w, o.newJSONEvent(event, true)); err != nil {
+		log.Printf("Failed to execute output template: %s", err)
+	}
+	fmt.Fprintln(w)
+}
+
+// newJSONEvent converts the event into its structured representation. Unless
+// all is set, only the fields requested by the output flags are populated.
+func (o *output) newJSONEvent(event *eventInfo, all bool) *jsonEvent {
+	ev := &jsonEvent{
+		Skb:        fmt.Sprintf("0x%x", event.SAddr),
+		CPU:        event.CPU,
+		Process:    event.execName,
+		Container:  event.container,
+		Func:       event.funcName,
+		Stack:      event.stack,
+		SkbDump:    event.skbDump,
+		DropReason: event.dropReason,
+		Pod:        event.pod,
+		Payload:    hex.EncodeToString(event.payload),
+		EventID:    event.eventID,
+		SkbGen:     event.skbGen,
+	}
+	if event.dns != nil {
+		ev.DNS = newJSONDNS(event.dns)
+	}
+	if event.Type == EventTypeReturn && o.flags.OutputRetval {
+		ev.Retval = retvalToStr(event.ParamNext)
+	}
+	if event.Type == EventTypeReturn && o.flags.OutputLatency {
+		latency := float64(event.Duration) / 1000
+		ev.LatencyUs = &latency
+	}
+	if o.flags.OutputTS == "absolute-date" {
+		ev.Time = o.absoluteDate(event.ts)
+	} else if o.flags.OutputTS != "none" {
+		ev.Timestamp = &event.ts
+	}
+	if all || o.flags.OutputDelta {
+		delta := float64(event.delta) / 1000
+		ev.DeltaUs = &delta
+	}
+	if all || o.flags.OutputMeta {
+		ev.Meta = &jsonMeta{
+			Netns:     event.Meta.Netns,
+			NetnsName: event.netnsName,
+			Mark:      event.Meta.Mark,
+			Ifindex:   event.Meta.Ifindex,
+			Ifname:    event.ifName,
+			Proto:     event.Meta.Proto,
+			MTU:       event.Meta.MTU,
+			Len:       event.Meta.Len,
+			DataLen:   event.Meta.DataLen,
+			NrFrags:   event.Meta.NrFrags,
+			Linear:    event.Meta.Linear(),
+			IPSummed:  ipSummedToStr(event.Meta.IPSummed),
+
+			Hash:         event.Meta.Hash,
+			QueueMapping: event.Meta.QueueMapping,
+			Priority:     priorityToStr(event.Meta.Priority),
+			TCClassid:    event.Meta.TCClassid,
+		}
+		if event.Meta.IPSummed == ChecksumPartial {
+			start, offset := event.Meta.CsumStart, event.Meta.CsumOffset
+			ev.Meta.CsumStart = &start
+			ev.Meta.CsumOffset = &offset
+		}
+		if event.Meta.VlanPresent != 0 {
+			vlan := event.Meta.VlanID()
+			pcp := event.Meta.VlanPCP()
+			ev.Meta.VlanID = &vlan
+			ev.Meta.VlanPCP = &pcp
+		}
+		ev.Meta.MPLS = newJSONMPLSLabels(&event.Meta)
+		if event.Meta.IPVersion != 0 {
+			dscp := event.Meta.DSCP()
+			ev.Meta.DSCP = &dscp
+			ev.Meta.ECN = ecnToStr(event.Meta.ECN())
+			ttl := event.Meta.TTL
+			ev.Meta.TTL = &ttl
+			if c := event.ttlChange; c != nil {
+				prev := c.ttl
+				ev.Meta.PrevTTL = &prev
+				if !c.forwarded {
+					ev.Meta.TTLChangedAfter = c.funcName
+				}
+			}
+		}
+	}
+	if all || o.flags.OutputTuple {
+		ev.Tuple = newJSONTuple(&event.Tuple)
+		ev.Tuple.Shost, ev.Tuple.Dhost = event.saddrName, event.daddrName
+		ev.Tuple.Sservice = o.services.Name(event.Tuple.L4Proto, ev.Tuple.Sport)
+		ev.Tuple.Dservice = o.services.Name(event.Tuple.L4Proto, ev.Tuple.Dport)
+		if event.Tunnel.Type != 0 {
+			ev.Tunnel = newJSONTunnel(&event.Tunnel)
+		}
+	}
+	if (all || o.flags.OutputSock) && event.Sock.Addr != 0 {
+		ev.Sock = newJSONSock(&event.Sock, event.sockUser)
+	}
+	if event.Netfilter.Kind != 0 {
+		ev.Netfilter = newJSONNetfilter(&event.Netfilter)
+	}
+	if event.Route.Ifindex != 0 {
+		ev.Route = newJSONRoute(&event.Route)
+	}
+	if event.Type == EventTypeXDP {
+		ev.XDP = newJSONXDP(&event.XDP)
+	}
+	if event.Type == EventTypeTC {
+		ev.TC = newJSONTC(&event.TC)
+	}
+	ev.TracepointArg = event.tracepointArg
+	if event.ParentAddr != 0 {
+		ev.Parent = fmt.Sprintf("0x%x", event.ParentAddr)
+	}
+	if event.flowID != 0 {
+		ev.FlowID = event.flowID
+	}
+	if event.repeats > 1 {
+		ev.Count = event.repeats
+	}
+	if event.migrated != nil {
+		cpu := event.migrated.cpu
+		ev.PrevCPU = &cpu
+		ev.PrevFunc = event.migrated.funcName
+	}
+	if all || o.flags.OutputConntrack {
+		ev.Conntrack = newJSONConntrack(&event.Conntrack)
+	}
+	if all || o.flags.OutputEth {
+		ev.Eth = &jsonEth{
+			Src:   net.HardwareAddr(event.Eth.Src[:]).String(),
+			Dst:   net.HardwareAddr(event.Eth.Dst[:]).String(),
+			Proto: byteorder.NetworkToHost16(event.Eth.Proto),
 		}
 	}
+	return ev
+}
+
+func (o *output) getFuncName(event *Event) string {
+	switch event.Type {
+	case EventTypeXDP:
+		return xdpFuncName(&event.XDP)
+	case EventTypeTC:
+		return tcFuncName(&event.TC)
+	case EventTypeTracepoint:
+		return tracepointName(event.Addr)
+	}
+
 	var addr uint64
 	// XXX: not sure why the -1 offset is needed on x86 but not on arm64
 	switch runtime.GOARCH {
@@ -93,48 +1356,59 @@ func (o *output) Print(event *Event) {
 		// See https://lore.kernel.org/bpf/20220811091526.172610-5-jolsa@kernel.org/
 		// for more ctx.
 		funcName = ksym.name
+	} else if ksym, ok := o.addr2name.Addr2NameMap[event.Addr]; ok {
+		// The address from bpf_get_func_ip() in the fentry programs, mixed
+		// with the kprobe ones when they are used as a fallback
+		funcName = ksym.name
 	} else {
 		funcName = fmt.Sprintf("0x%x", addr)
 	}
-	fmt.Fprintf(o.writer, "%18s %6s %16s %24s", fmt.Sprintf("0x%x", event.SAddr),
-		fmt.Sprintf("%d", event.CPU), fmt.Sprintf("[%s]", execName), funcName)
-	if o.flags.OutputTS != "none" {
-		fmt.Fprintf(o.writer, " %16d", ts)
-	}
-	o.lastSeenSkb[event.SAddr] = event.Timestamp
+	return funcName
+}
 
-	if o.flags.OutputMeta {
-		fmt.Fprintf(o.writer, " netns=%d mark=0x%x ifindex=%d proto=%x mtu=%d len=%d", event.Meta.Netns, event.Meta.Mark, event.Meta.Ifindex, event.Meta.Proto, event.Meta.MTU, event.Meta.Len)
+// FuncName returns the name of the traced function of the event, e.g. for the
+// latency histograms and the aggregates counted by the BPF programs.
+func (o *output) FuncName(event *Event) string {
+	return o.getFuncName(event)
+}
+
+func (o *output) getDropReason(event *Event) string {
+	if name, ok := o.dropReasons[event.ParamNext]; ok {
+		return name
 	}
+	return fmt.Sprintf("%d", event.ParamNext)
+}
 
-	if o.flags.OutputTuple {
-		fmt.Fprintf(o.writer, " %s:%d->%s:%d(%s)",
-			addrToStr(event.Tuple.L3Proto, event.Tuple.Saddr), byteorder.NetworkToHost16(event.Tuple.Sport),
-			addrToStr(event.Tuple.L3Proto, event.Tuple.Daddr), byteorder.NetworkToHost16(event.Tuple.Dport),
-			protoToStr(event.Tuple.L4Proto))
-	}
-
-	if o.flags.OutputStack && event.PrintStackId > 0 {
-		var stack StackData
-		id := uint32(event.PrintStackId)
-		if err := o.printStackMap.Lookup(&id, &stack); err == nil {
-			for _, ip := range stack.IPs {
-				if ip > 0 {
-					fmt.Fprintf(o.writer, "\n%s", o.addr2name.findNearestSym(ip))
-				}
+func (o *output) getStack(event *Event) []string {
+	var stack StackData
+	var syms []string
+	id := uint32(event.PrintStackId)
+	if err := o.printStackMap.Lookup(&id, &stack); err == nil {
+		for _, ip := range stack.IPs {
+			if ip > 0 {
+				syms = append(syms, o.addr2name.symbolize(ip))
 			}
 		}
-		_ = o.printStackMap.Delete(&id)
 	}
+	_ = o.printStackMap.Delete(&id)
+	return syms
+}
 
-	if o.flags.OutputSkb {
-		id := uint32(event.PrintSkbId)
-		if str, err := o.printSkbMap.LookupBytes(&id); err == nil {
-			fmt.Fprintf(o.writer, "\n%s", string(str))
-		}
+func (o *output) getSkbDump(event *Event) string {
+	id := uint32(event.PrintSkbId)
+	if str, err := o.printSkbMap.LookupBytes(&id); err == nil {
+		return string(str)
 	}
+	return ""
+}
 
-	fmt.Fprintln(o.writer)
+// retvalToStr prints error codes and small integers (e.g. netfilter verdicts)
+// in decimal, and anything else (e.g. pointers) in hex.
+func retvalToStr(ret uint64) string {
+	if v := int64(ret); v >= -4095 && v <= math.MaxInt32 {
+		return strconv.FormatInt(v, 10)
+	}
+	return fmt.Sprintf("0x%x", ret)
 }
 
 func protoToStr(proto uint8) string {
@@ -143,6 +1417,12 @@ func protoToStr(proto uint8) string {
 		return "tcp"
 	case syscall.IPPROTO_UDP:
 		return "udp"
+	case syscall.IPPROTO_SCTP:
+		return "sctp"
+	case syscall.IPPROTO_ESP:
+		return "esp"
+	case syscall.IPPROTO_AH:
+		return "ah"
 	case syscall.IPPROTO_ICMP:
 		return "icmp"
 	case syscall.IPPROTO_ICMPV6:
@@ -152,6 +1432,96 @@ func protoToStr(proto uint8) string {
 	}
 }
 
+// The bits of Tuple.IPv6ExtHdrs, set by ipv6_skip_exthdrs()
+const (
+	ipv6ExtHdrHopOpts = 1 << iota
+	ipv6ExtHdrRouting
+	ipv6ExtHdrFragment
+	ipv6ExtHdrDstOpts
+)
+
+// ipv6ExtHdrNames are in the order of the headers recommended by RFC 8200.
+var ipv6ExtHdrNames = []struct {
+	bit  uint8
+	name string
+}{
+	{ipv6ExtHdrHopOpts, "hopopts"},
+	{ipv6ExtHdrDstOpts, "dstopts"},
+	{ipv6ExtHdrRouting, "routing"},
+	{ipv6ExtHdrFragment, "fragment"},
+}
+
+// ipv6ExtHdrsToStrs returns the names of the IPv6 extension headers.
+func ipv6ExtHdrsToStrs(exthdrs uint8) []string {
+	var names []string
+	for _, h := range ipv6ExtHdrNames {
+		if exthdrs&h.bit != 0 {
+			names = append(names, h.name)
+		}
+	}
+	return names
+}
+
+func isIPsec(proto uint8) bool {
+	return proto == syscall.IPPROTO_ESP || proto == syscall.IPPROTO_AH
+}
+
+// ipSummedToStr returns the CHECKSUM_* name of skb->ip_summed, without the
+// prefix.
+func ipSummedToStr(ipSummed uint8) string {
+	switch ipSummed {
+	case ChecksumNone:
+		return "NONE"
+	case ChecksumUnnecessary:
+		return "UNNECESSARY"
+	case ChecksumComplete:
+		return "COMPLETE"
+	case ChecksumPartial:
+		return "PARTIAL"
+	default:
+		return strconv.Itoa(int(ipSummed))
+	}
+}
+
+// dscpNames are the names of the standard DSCPs (RFC 2474, 2597, 3246).
+var dscpNames = map[uint8]string{
+	0: "CS0", 8: "CS1", 16: "CS2", 24: "CS3", 32: "CS4", 40: "CS5", 48: "CS6", 56: "CS7",
+	10: "AF11", 12: "AF12", 14: "AF13",
+	18: "AF21", 20: "AF22", 22: "AF23",
+	26: "AF31", 28: "AF32", 30: "AF33",
+	34: "AF41", 36: "AF42", 38: "AF43",
+	44: "VA", 46: "EF",
+}
+
+func dscpToStr(dscp uint8) string {
+	if name, ok := dscpNames[dscp]; ok {
+		return name
+	}
+	return strconv.Itoa(int(dscp))
+}
+
+func ecnToStr(ecn uint8) string {
+	switch ecn {
+	case 0:
+		return "Not-ECT"
+	case 1:
+		return "ECT(1)"
+	case 2:
+		return "ECT(0)"
+	default:
+		return "CE"
+	}
+}
+
+// priorityToStr renders skb->priority as a tc class handle (e.g. 1:10) if it
+// refers to one, i.e. has a major number, as a plain number otherwise.
+func priorityToStr(priority uint32) string {
+	if priority>>16 == 0 {
+		return strconv.Itoa(int(priority))
+	}
+	return fmt.Sprintf("%x:%x", priority>>16, priority&0xffff)
+}
+
 func addrToStr(proto uint16, addr [16]byte) string {
 	switch proto {
 	case syscall.ETH_P_IP:
@@ -162,3 +1532,77 @@ func addrToStr(proto uint16, addr [16]byte) string {
 		return ""
 	}
 }
+
+func addrToIP(proto uint16, addr [16]byte) net.IP {
+	switch proto {
+	case syscall.ETH_P_IP:
+		return net.IP(addr[:4])
+	case syscall.ETH_P_IPV6:
+		return net.IP(addr[:])
+	default:
+		return nil
+	}
+}
+
+// hexdump renders the data as in "tcpdump -X", with 16 bytes per line.
+func hexdump(data []byte) string {
+	var b strings.Builder
+	for off := 0; off < len(data); off += 16 {
+		end := off + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		line := data[off:end]
+
+		if off > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "\t0x%04x:  ", off)
+		for i := 0; i < 16; i++ {
+			if i < len(line) {
+				fmt.Fprintf(&b, "%02x", line[i])
+			} else {
+				b.WriteString("  ")
+			}
+			if i%2 == 1 {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteByte(' ')
+		for _, c := range line {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// tcpFlagsToStr renders the TCP flags in the tcpdump notation, e.g. "S." for
+// SYN-ACK.
+func tcpFlagsToStr(proto uint8, flags uint8) string {
+	if proto != syscall.IPPROTO_TCP || flags == 0 {
+		return ""
+	}
+
+	var s []byte
+	for _, f := range []struct {
+		mask uint8
+		c    byte
+	}{
+		{0x01, 'F'},
+		{0x02, 'S'},
+		{0x04, 'R'},
+		{0x08, 'P'},
+		{0x20, 'U'},
+		{0x40, 'E'},
+		{0x80, 'W'},
+		{0x10, '.'},
+	} {
+		if flags&f.mask != 0 {
+			s = append(s, f.c)
+		}
+	}
+	return string(s)
+}
@@ -0,0 +1,405 @@
+package pwru
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"syscall"
+	"testing"
+	"text/template"
+
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+func TestOutput_printTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	o := &output{
+		flags:  &Flags{OutputTS: "none"},
+		writer: bufio.NewWriter(&buf),
+		tmpl:   template.Must(template.New("").Parse("{{.Func}} {{.Tuple.Src}}->{{.Tuple.Dst}}({{.Tuple.Proto}})")),
+	}
+
+	event := &Event{
+		Tuple: Tuple{
+			Saddr:   [16]byte{10, 0, 0, 1},
+			Daddr:   [16]byte{10, 0, 0, 2},
+			Sport:   byteorder.HostToNetwork16(1234),
+			Dport:   byteorder.HostToNetwork16(80),
+			L3Proto: syscall.ETH_P_IP,
+			L4Proto: syscall.IPPROTO_TCP,
+		},
+	}
+	o.printTemplate(o.writer, &eventInfo{Event: event, funcName: "ip_rcv"})
+	o.writer.Flush()
+
+	if got, want := buf.String(), "ip_rcv 10.0.0.1:1234->10.0.0.2:80(tcp)\n"; got != want {
+		t.Errorf("printTemplate() = %q, want %q", got, want)
+	}
+}
+
+func TestOutput_printTextSCTP(t *testing.T) {
+	var buf bytes.Buffer
+	o := &output{
+		flags:  &Flags{OutputTS: "none", OutputTuple: true},
+		writer: bufio.NewWriter(&buf),
+	}
+
+	event := &Event{
+		Tuple: Tuple{
+			Saddr:   [16]byte{10, 0, 0, 1},
+			Daddr:   [16]byte{10, 0, 0, 2},
+			Sport:   byteorder.HostToNetwork16(38412),
+			Dport:   byteorder.HostToNetwork16(36412),
+			L3Proto: syscall.ETH_P_IP,
+			L4Proto: syscall.IPPROTO_SCTP,
+			Seq:     byteorder.HostToNetwork32(0x1234abcd),
+		},
+	}
+	o.printText(o.writer, &eventInfo{Event: event, funcName: "sctp_rcv"})
+	o.writer.Flush()
+
+	if got, want := buf.String(), " 10.0.0.1:38412->10.0.0.2:36412(sctp) vtag=0x1234abcd\n"; !strings.HasSuffix(got, want) {
+		t.Errorf("printText() = %q, want suffix %q", got, want)
+	}
+}
+
+func TestNewJSONTuple_ipsec(t *testing.T) {
+	jt := newJSONTuple(&Tuple{
+		L3Proto: syscall.ETH_P_IP,
+		L4Proto: syscall.IPPROTO_ESP,
+		SPI:     byteorder.HostToNetwork32(0xc0ffee),
+		Seq:     byteorder.HostToNetwork32(42),
+	})
+	if jt.Proto != "esp" || jt.SPI != 0xc0ffee || jt.Seq != 42 {
+		t.Errorf("newJSONTuple() = %+v, want esp spi=0xc0ffee seq=42", jt)
+	}
+}
+
+func TestCSVFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	o := &output{flags: &Flags{OutputTS: "none"}}
+	f := csvFormatter{o}
+
+	f.PrintHeader(&buf)
+	f.PrintEvent(&buf, &eventInfo{
+		Event: &Event{
+			SAddr: 0xffff0001,
+			CPU:   2,
+			Meta:  Meta{Netns: 4026531840, Mark: 0x10, Ifindex: 3, Len: 60},
+			Tuple: Tuple{
+				Saddr:    [16]byte{10, 0, 0, 1},
+				Daddr:    [16]byte{10, 0, 0, 2},
+				Sport:    byteorder.HostToNetwork16(1234),
+				Dport:    byteorder.HostToNetwork16(80),
+				L3Proto:  syscall.ETH_P_IP,
+				L4Proto:  syscall.IPPROTO_TCP,
+				TCPFlags: 0x02,
+			},
+		},
+		execName: "curl",
+		funcName: "ip_rcv",
+		delta:    1500,
+	})
+
+	want := `skb,cpu,process,func,timestamp,delta_us,netns,mark,ifindex,len,saddr,sport,daddr,dport,proto,tcp_flags,retval,latency_us,drop_reason
+0xffff0001,2,curl,ip_rcv,,1.500,4026531840,0x10,3,60,10.0.0.1,1234,10.0.0.2,80,tcp,S,,,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("csvFormatter =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestOutput_timestamps(t *testing.T) {
+	tests := []struct {
+		ts   string
+		want string
+	}{
+		{"current", "1000 1500 1700 "},
+		{"relative", "0 500 0 "},
+		{"relative-start", "0 500 700 "},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		o := &output{
+			flags:       &Flags{OutputTS: tt.ts},
+			lastSeenSkb: map[uint64]uint64{},
+			lastSkbHop:  map[uint64]skbHop{},
+			skbGens:     newSkbGenerations(),
+			writer:      bufio.NewWriter(&buf),
+			tmpl:        template.Must(template.New("").Parse("{{.Timestamp}} ")),
+		}
+		o.formatter = templateFormatter{o}
+
+		o.print(&recordedEvent{Event: Event{SAddr: 1, Timestamp: 1000}})
+		o.print(&recordedEvent{Event: Event{SAddr: 1, Timestamp: 1500}})
+		o.print(&recordedEvent{Event: Event{SAddr: 2, Timestamp: 1700}})
+		o.writer.Flush()
+
+		if got := strings.ReplaceAll(buf.String(), "\n", ""); got != tt.want {
+			t.Errorf("--timestamp=%s: got %q, want %q", tt.ts, got, tt.want)
+		}
+	}
+}
+
+func TestOutput_printTextStack(t *testing.T) {
+	stack := []string{"kfree_skb_reason+0x0", "nf_hook_slow+0x8c", "ip_rcv+0x3f"}
+	tests := []struct {
+		flags Flags
+		want  string
+	}{
+		{
+			flags: Flags{OutputStack: true},
+			want:  "\nkfree_skb_reason+0x0\nnf_hook_slow+0x8c\nip_rcv+0x3f\n",
+		},
+		{
+			flags: Flags{OutputStack: true, StackDepth: 2},
+			want:  "\nkfree_skb_reason+0x0\nnf_hook_slow+0x8c\n",
+		},
+		{
+			flags: Flags{OutputStack: true, StackDepth: 2, StackSingleLine: true},
+			want:  " stack=kfree_skb_reason+0x0<-nf_hook_slow+0x8c\n",
+		},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		tt.flags.OutputTS = "none"
+		o := &output{
+			flags:       &tt.flags,
+			lastSeenSkb: map[uint64]uint64{},
+			lastSkbHop:  map[uint64]skbHop{},
+			skbGens:     newSkbGenerations(),
+			writer:      bufio.NewWriter(&buf),
+		}
+		o.formatter = textFormatter{o}
+
+		o.print(&recordedEvent{Event: Event{SAddr: 1, PrintStackId: 1}, Stack: stack})
+		o.writer.Flush()
+
+		if got := buf.String(); !strings.HasSuffix(got, tt.want) {
+			t.Errorf("%+v: got %q, want suffix %q", tt.flags, got, tt.want)
+		}
+	}
+}
+
+func TestOutput_ttlChange(t *testing.T) {
+	meta := func(ttl uint8) Meta { return Meta{IPVersion: 4, TTL: ttl} }
+	a2n := Addr2Name{Addr2NameMap: map[uint64]*ksym{
+		0x1000: {addr: 0x1000, name: "ip_forward"},
+		0x2000: {addr: 0x2000, name: "ip_forward_finish"},
+		0x3000: {addr: 0x3000, name: "nf_hook_slow"},
+		0x4000: {addr: 0x4000, name: "ip_output"},
+	}}
+	events := []struct {
+		addr uint64
+		ttl  uint8
+		want string
+	}{
+		{0x1000, 64, " ttl=64\n"},
+		{0x2000, 63, " ttl=64->63\n"},
+		{0x3000, 63, " ttl=63\n"},
+		{0x4000, 1, " ttl=63->1 ttl_changed_after=nf_hook_slow\n"},
+	}
+
+	var buf bytes.Buffer
+	o := &output{
+		flags:       &Flags{OutputTS: "none", OutputMeta: true},
+		lastSeenSkb: map[uint64]uint64{},
+		lastSkbHop:  map[uint64]skbHop{},
+		skbGens:     newSkbGenerations(),
+		addr2name:   a2n,
+		kprobeMulti: true,
+		writer:      bufio.NewWriter(&buf),
+	}
+	o.formatter = textFormatter{o}
+	for _, e := range events {
+		buf.Reset()
+		o.print(&recordedEvent{Event: Event{Addr: e.addr, SAddr: 1, Meta: meta(e.ttl)}})
+		o.writer.Flush()
+		if got := buf.String(); !strings.HasSuffix(got, e.want) {
+			t.Errorf("got %q, want suffix %q", got, e.want)
+		}
+	}
+}
+
+func TestOutput_onlyDrops(t *testing.T) {
+	a2n := Addr2Name{Addr2NameMap: map[uint64]*ksym{
+		0x1000: {addr: 0x1000, name: "ip_rcv"},
+		0x2000: {addr: 0x2000, name: "kfree_skb_reason"},
+		0x3000: {addr: 0x3000, name: "kfree_skbmem"},
+	}}
+	var buf bytes.Buffer
+	o := &output{
+		flags:       &Flags{OutputTS: "none", OnlyDrops: true},
+		lastSeenSkb: map[uint64]uint64{},
+		lastSkbHop:  map[uint64]skbHop{},
+		skbGens:     newSkbGenerations(),
+		addr2name:   a2n,
+		kprobeMulti: true,
+		dropReasons: map[uint64]string{1: "SKB_CONSUMED", 2: "NOT_SPECIFIED"},
+		writer:      bufio.NewWriter(&buf),
+		groups:      newSkbGroups(true),
+	}
+	o.formatter = textFormatter{o}
+	for _, e := range []Event{
+		// Freed without being dropped
+		{Addr: 0x1000, SAddr: 1},
+		{Addr: 0x3000, SAddr: 1},
+		// Dropped
+		{Addr: 0x1000, SAddr: 2},
+		{Addr: 0x2000, SAddr: 2, ParamNext: 2},
+		{Addr: 0x3000, SAddr: 2},
+		// Consumed
+		{Addr: 0x2000, SAddr: 3, ParamNext: 1},
+		{Addr: 0x3000, SAddr: 3},
+	} {
+		o.print(&recordedEvent{Event: e})
+	}
+	o.writer.Flush()
+
+	got := buf.String()
+	if !strings.HasPrefix(got, "SKB 0x2:\n") || strings.Count(got, "\n") != 5 ||
+		!strings.Contains(got, "reason=NOT_SPECIFIED") {
+		t.Errorf("got %q, want the events of the dropped skb 0x2 only", got)
+	}
+}
+
+func TestOutput_coalesce(t *testing.T) {
+	a2n := Addr2Name{Addr2NameMap: map[uint64]*ksym{
+		0x1000: {addr: 0x1000, name: "tcp_retransmit_skb"},
+		0x2000: {addr: 0x2000, name: "kfree_skbmem"},
+	}}
+	var buf bytes.Buffer
+	o := &output{
+		flags:       &Flags{OutputTS: "none", Coalesce: true},
+		lastSeenSkb: map[uint64]uint64{},
+		lastSkbHop:  map[uint64]skbHop{},
+		skbGens:     newSkbGenerations(),
+		addr2name:   a2n,
+		kprobeMulti: true,
+		writer:      bufio.NewWriter(&buf),
+		coalesce:    &coalescer{},
+	}
+	o.formatter = textFormatter{o}
+	for _, e := range []Event{
+		{Addr: 0x1000, SAddr: 1},
+		{Addr: 0x1000, SAddr: 1},
+		{Addr: 0x1000, SAddr: 1},
+		{Addr: 0x1000, SAddr: 2},
+		{Addr: 0x1000, SAddr: 1},
+		{Addr: 0x2000, SAddr: 1},
+		// The returns with another value aren't coalesced
+		{Addr: 0x1000, SAddr: 3, Type: EventTypeReturn},
+		{Addr: 0x1000, SAddr: 3, Type: EventTypeReturn},
+		{Addr: 0x1000, SAddr: 3, Type: EventTypeReturn, ParamNext: 1},
+	} {
+		o.print(&recordedEvent{Event: e})
+	}
+	// The last event is held until the reader is idle
+	o.writer.Flush()
+	if n := strings.Count(buf.String(), "\n"); n != 5 {
+		t.Fatalf("got %q, want 5 lines before FlushCoalesced()", buf.String())
+	}
+	o.FlushCoalesced()
+	o.writer.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("got %q, want 6 lines", buf.String())
+	}
+	for i, line := range lines {
+		want := map[int]string{0: " x3", 4: " x2"}[i]
+		if want != "" && !strings.HasSuffix(line, want) {
+			t.Errorf("line %d = %q, want the%s count", i, line, want)
+		}
+		if want == "" && strings.Contains(line, " x") {
+			t.Errorf("line %d = %q, want no count", i, line)
+		}
+	}
+}
+
+func TestTimestampToStr(t *testing.T) {
+	tests := []struct {
+		unit string
+		want string
+	}{
+		{"", "1234567891"},
+		{"ns", "1234567891"},
+		{"us", "1234567.891"},
+		{"ms", "1234.567891"},
+		{"s", "1.234567891"},
+	}
+	for _, tt := range tests {
+		if got := timestampToStr(1234567891, tt.unit); got != tt.want {
+			t.Errorf("timestampToStr(%q) = %q, want %q", tt.unit, got, tt.want)
+		}
+	}
+	if got := timestampToStr(5, "ms"); got != "0.000005" {
+		t.Errorf("timestampToStr(5, ms) = %q, want 0.000005", got)
+	}
+}
+
+func TestTcpFlagsToStr(t *testing.T) {
+	tests := []struct {
+		name  string
+		proto uint8
+		flags uint8
+		want  string
+	}{
+		{name: "SYN", proto: syscall.IPPROTO_TCP, flags: 0x02, want: "S"},
+		{name: "SYN-ACK", proto: syscall.IPPROTO_TCP, flags: 0x12, want: "S."},
+		{name: "PSH-ACK", proto: syscall.IPPROTO_TCP, flags: 0x18, want: "P."},
+		{name: "RST", proto: syscall.IPPROTO_TCP, flags: 0x04, want: "R"},
+		{name: "FIN-ACK", proto: syscall.IPPROTO_TCP, flags: 0x11, want: "F."},
+		{name: "UDP", proto: syscall.IPPROTO_UDP, flags: 0x12, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tcpFlagsToStr(tt.proto, tt.flags); got != tt.want {
+				t.Errorf("tcpFlagsToStr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPv6ExtHdrsToStrs(t *testing.T) {
+	tests := []struct {
+		exthdrs uint8
+		want    string
+	}{
+		{0, ""},
+		{ipv6ExtHdrFragment, "fragment"},
+		{ipv6ExtHdrHopOpts | ipv6ExtHdrRouting, "hopopts,routing"},
+		{ipv6ExtHdrFragment | ipv6ExtHdrDstOpts | ipv6ExtHdrHopOpts, "hopopts,dstopts,fragment"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(ipv6ExtHdrsToStrs(tt.exthdrs), ","); got != tt.want {
+			t.Errorf("ipv6ExtHdrsToStrs(%#x) = %q, want %q", tt.exthdrs, got, tt.want)
+		}
+	}
+}
+
+func TestHexdump(t *testing.T) {
+	data := []byte("E\x00\x00\x54\x00\x00\x40\x00\x40\x01\x00\x00\x7f\x00\x00\x01abc")
+	want := "\t0x0000:  4500 0054 0000 4000 4001 0000 7f00 0001  E..T..@.@.......\n" +
+		"\t0x0010:  6162 63                                  abc"
+	if got := hexdump(data); got != want {
+		t.Errorf("hexdump() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestPriorityToStr(t *testing.T) {
+	tests := []struct {
+		priority uint32
+		want     string
+	}{
+		{0, "0"},
+		{6, "6"},
+		{0x10010, "1:10"},
+		{0xffff0001, "ffff:1"},
+	}
+	for _, tt := range tests {
+		if got := priorityToStr(tt.priority); got != tt.want {
+			t.Errorf("priorityToStr(0x%x) = %q, want %q", tt.priority, got, tt.want)
+		}
+	}
+}
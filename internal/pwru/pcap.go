@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+)
+
+const (
+	pcapngBlockSHB = 0x0a0d0d0a
+	pcapngBlockIDB = 0x00000001
+	pcapngBlockEPB = 0x00000006
+
+	pcapngByteOrderMagic = 0x1a2b3c4d
+
+	pcapngOptEnd       = 0
+	pcapngOptComment   = 1
+	pcapngOptIfTsresol = 9
+
+	// The BPF program captures packets starting from the network header,
+	// so the link type is raw IPv4/IPv6.
+	linkTypeRaw = 101
+)
+
+// pcapWriter writes captured packets into a pcapng file. Every packet block
+// is annotated with the kernel function which has seen the packet.
+type pcapWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	// Offset to convert bpf_ktime_get_ns() timestamps to wall-clock time
+	monoToReal int64
+}
+
+func newPcapWriter(path string, snapLen uint32) (*pcapWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := monotonicToRealtimeOffset()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	w := &pcapWriter{
+		file:       file,
+		writer:     bufio.NewWriter(file),
+		monoToReal: offset,
+	}
+
+	// Section Header Block: byte-order magic, version 1.0, unknown length
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint16(shb[6:], 0)
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	w.writeBlock(pcapngBlockSHB, shb, nil)
+
+	// Interface Description Block with nanosecond timestamp resolution
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], linkTypeRaw)
+	binary.LittleEndian.PutUint32(idb[4:], snapLen)
+	w.writeBlock(pcapngBlockIDB, idb, pcapngOption(pcapngOptIfTsresol, []byte{9}))
+
+	return w, nil
+}
+
+// WritePacket writes an Enhanced Packet Block for the given event.
+func (w *pcapWriter) WritePacket(event *Event, pkt *Packet, comment string) {
+	ts := uint64(int64(event.Timestamp) + w.monoToReal)
+
+	epb := make([]byte, 20, 20+len(pkt.Data)+3)
+	binary.LittleEndian.PutUint32(epb[0:], 0)
+	binary.LittleEndian.PutUint32(epb[4:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(epb[8:], uint32(ts))
+	binary.LittleEndian.PutUint32(epb[12:], uint32(len(pkt.Data)))
+	binary.LittleEndian.PutUint32(epb[16:], pkt.Len)
+	epb = append(epb, pad4(pkt.Data)...)
+
+	w.writeBlock(pcapngBlockEPB, epb, pcapngOption(pcapngOptComment, []byte(comment)))
+}
+
+func (w *pcapWriter) Close() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+func (w *pcapWriter) writeBlock(typ uint32, body []byte, opts []byte) {
+	if opts != nil {
+		opts = append(opts, pcapngOption(pcapngOptEnd, nil)...)
+	}
+	total := uint32(12 + len(body) + len(opts))
+
+	hdr := make([]byte, 8)
+	binary.LittleEndian.PutUint32(hdr[0:], typ)
+	binary.LittleEndian.PutUint32(hdr[4:], total)
+	w.writer.Write(hdr)
+	w.writer.Write(body)
+	w.writer.Write(opts)
+	binary.Write(w.writer, binary.LittleEndian, total)
+}
+
+func pcapngOption(code uint16, value []byte) []byte {
+	opt := make([]byte, 4, 4+len(value)+3)
+	binary.LittleEndian.PutUint16(opt[0:], code)
+	binary.LittleEndian.PutUint16(opt[2:], uint16(len(value)))
+	return append(opt, pad4(value)...)
+}
+
+func pad4(b []byte) []byte {
+	if n := len(b) % 4; n != 0 {
+		return append(b[:len(b):len(b)], make([]byte, 4-n)...)
+	}
+	return b
+}
@@ -0,0 +1,53 @@
+package pwru
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPcapWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pcapng")
+	w, err := newPcapWriter(path, MaxCaptureLen)
+	if err != nil {
+		t.Fatalf("newPcapWriter() error = %v", err)
+	}
+	event := &Event{Timestamp: 1000}
+	w.WritePacket(event, &Packet{Len: 100, Data: []byte{0x45, 0, 0, 100, 1}}, "func=ip_rcv")
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []uint32
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("truncated block: %d bytes left", len(data))
+		}
+		typ := binary.LittleEndian.Uint32(data[0:])
+		total := binary.LittleEndian.Uint32(data[4:])
+		if total%4 != 0 || int(total) > len(data) {
+			t.Fatalf("block 0x%x has invalid length %d", typ, total)
+		}
+		if trailer := binary.LittleEndian.Uint32(data[total-4:]); trailer != total {
+			t.Fatalf("block 0x%x trailing length = %d, want %d", typ, trailer, total)
+		}
+		types = append(types, typ)
+		data = data[total:]
+	}
+
+	want := []uint32{pcapngBlockSHB, pcapngBlockIDB, pcapngBlockEPB}
+	if len(types) != len(want) {
+		t.Fatalf("got blocks %x, want %x", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Errorf("block %d type = 0x%x, want 0x%x", i, types[i], want[i])
+		}
+	}
+}
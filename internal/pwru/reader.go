@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+	"github.com/cilium/ebpf/perf"
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+const (
+	// ringbufMap is the BPF_MAP_TYPE_RINGBUF map of bpf/kprobe_pwru.c, and
+	// ringbufConst the constant enabling its use.
+	ringbufMap   = "events_rb"
+	ringbufConst = "use_ringbuf"
+
+	// Minimum size of the per-CPU perf buffers with --capture-file, for a
+	// few full packets to fit.
+	minCaptureBuffer = 64 << 10
+)
+
+// ErrReaderClosed is returned by EventReader.Read once the reader is closed.
+var ErrReaderClosed = os.ErrClosed
+
+// EventRecord is a raw event read from the perf or the ring buffer.
+type EventRecord struct {
+	RawSample []byte
+	// Only reported by the perf buffer, the ring buffer doesn't overwrite
+	// unread events.
+	LostSamples uint64
+}
+
+// EventReader reads the events emitted by the BPF programs.
+type EventReader interface {
+	Read() (EventRecord, error)
+	// SetDeadline makes Read return os.ErrDeadlineExceeded once t is
+	// reached without events, or never if t is zero.
+	SetDeadline(t time.Time)
+	Close() error
+}
+
+// HaveRingbuf returns whether the kernel supports BPF ring buffers (>= 5.8).
+func HaveRingbuf() bool {
+	return features.HaveMapType(ebpf.RingBuf) == nil
+}
+
+// ringbufSize returns the size of the ring buffer holding as much as the
+// per-CPU perf buffers, rounded up to a power of 2 as required by the kernel.
+func ringbufSize(perCPUBuffer int) uint32 {
+	want := perCPUBuffer * runtime.NumCPU()
+	size := os.Getpagesize()
+	for size < want {
+		size <<= 1
+	}
+	return uint32(size)
+}
+
+// EventBufferSizes returns the size in bytes of the per-CPU perf buffers and
+// of the ring buffer. --event-buffer-pages sets both, otherwise the ring
+// buffer is sized as all the --per-cpu-buffer buffers, which are enlarged
+// to hold the full packets of --capture-file.
+func EventBufferSizes(flags *Flags) (int, uint32, error) {
+	pages := flags.EventBufferPages
+	if pages == 0 {
+		perCPU := flags.PerCPUBuffer
+		if flags.CaptureFile != "" && perCPU < minCaptureBuffer {
+			perCPU = minCaptureBuffer
+		}
+		return perCPU, ringbufSize(perCPU), nil
+	}
+	if pages < 0 || pages&(pages-1) != 0 {
+		return 0, 0, fmt.Errorf("--event-buffer-pages must be a power of 2, got %d", pages)
+	}
+	size := pages * os.Getpagesize()
+	return size, uint32(size), nil
+}
+
+// ConfigRingbuf selects the ring buffer or the perf buffer for the delivery
+// of the events. The code using the other one is removed by the verifier.
+func ConfigRingbuf(spec *ebpf.CollectionSpec, useRingbuf bool, size uint32) error {
+	if err := spec.RewriteConstants(map[string]interface{}{
+		ringbufConst: useRingbuf,
+	}); err != nil {
+		return fmt.Errorf("failed to rewrite %s: %w", ringbufConst, err)
+	}
+
+	m, ok := spec.Maps[ringbufMap]
+	if !ok {
+		return fmt.Errorf("map %s not found", ringbufMap)
+	}
+	if useRingbuf {
+		m.MaxEntries = size
+	} else {
+		// The map is unused, but it has to be created. Older kernels
+		// don't know about ring buffers.
+		spec.Maps[ringbufMap] = &ebpf.MapSpec{
+			Name:       m.Name,
+			Type:       ebpf.Array,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 1,
+		}
+	}
+	return nil
+}
+
+// NewEventReader returns a reader of the ring buffer if useRingbuf is set, of
+// the perf buffer otherwise.
+func NewEventReader(events, eventsRingbuf *ebpf.Map, useRingbuf bool, perCPUBuffer int) (EventReader, error) {
+	if useRingbuf {
+		rd, err := ringbuf.NewReader(eventsRingbuf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create ring buffer reader: %w", err)
+		}
+		return &ringbufReader{rd}, nil
+	}
+
+	rd, err := perf.NewReader(events, perCPUBuffer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create perf event reader: %w", err)
+	}
+	return &perfReader{rd}, nil
+}
+
+type perfReader struct {
+	rd *perf.Reader
+}
+
+func (r *perfReader) Read() (EventRecord, error) {
+	record, err := r.rd.Read()
+	if err != nil {
+		return EventRecord{}, err
+	}
+	return EventRecord{RawSample: record.RawSample, LostSamples: record.LostSamples}, nil
+}
+
+func (r *perfReader) SetDeadline(t time.Time) {
+	r.rd.SetDeadline(t)
+}
+
+func (r *perfReader) Close() error {
+	return r.rd.Close()
+}
+
+type ringbufReader struct {
+	rd *ringbuf.Reader
+}
+
+func (r *ringbufReader) Read() (EventRecord, error) {
+	record, err := r.rd.Read()
+	if err != nil {
+		return EventRecord{}, err
+	}
+	return EventRecord{RawSample: record.RawSample}, nil
+}
+
+func (r *ringbufReader) SetDeadline(t time.Time) {
+	r.rd.SetDeadline(t)
+}
+
+func (r *ringbufReader) Close() error {
+	return r.rd.Close()
+}
@@ -0,0 +1,270 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"syscall"
+
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+// recordMagic starts the --record files, followed by a gob stream of a
+// recordHeader and of the recordedEvents.
+const recordMagic = "PWRU-RECORD-1\n"
+
+// recordHeader is the snapshot of what is needed from the kernel to print
+// the recorded events.
+type recordHeader struct {
+	KprobeMulti bool
+	MonoToReal  int64
+	Ksyms       map[uint64]string
+	DropReasons map[uint64]string
+}
+
+// recordedEvent is a raw event, along with what is looked up when it is
+// printed and is gone by the time it is replayed.
+type recordedEvent struct {
+	Event    Event
+	Packet   *Packet
+	ExecName string
+	Stack    []string // with --output-stack
+	SkbDump  string   // with --output-skb
+}
+
+// recorder writes the events to the --record file.
+type recorder struct {
+	file io.WriteCloser
+	w    *bufio.Writer
+	enc  *gob.Encoder
+}
+
+func newRecorder(path string, hdr *recordHeader) (*recorder, error) {
+	f, err := createOutputFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{file: f, w: bufio.NewWriter(f)}
+	r.enc = gob.NewEncoder(r.w)
+
+	if _, err := r.w.WriteString(recordMagic); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := r.enc.Encode(hdr); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write the record header: %w", err)
+	}
+	return r, nil
+}
+
+func (r *recorder) write(rec *recordedEvent) {
+	if err := r.enc.Encode(rec); err != nil {
+		log.Printf("Failed to record event: %s", err)
+	}
+}
+
+func (r *recorder) Close() error {
+	if err := r.w.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+func newRecordHeader(addr2name Addr2Name, kprobeMulti bool, monoToReal int64, dropReasons map[uint64]string) *recordHeader {
+	hdr := &recordHeader{
+		KprobeMulti: kprobeMulti,
+		MonoToReal:  monoToReal,
+		Ksyms:       make(map[uint64]string, len(addr2name.Addr2NameMap)),
+		DropReasons: dropReasons,
+	}
+	for addr, sym := range addr2name.Addr2NameMap {
+		hdr.Ksyms[addr] = sym.String()
+	}
+	return hdr
+}
+
+func (hdr *recordHeader) addr2name() Addr2Name {
+	a2n := Addr2Name{Addr2NameMap: make(map[uint64]*ksym, len(hdr.Ksyms))}
+	for addr, name := range hdr.Ksyms {
+		fn, module := parseKsymName(name)
+		sym := &ksym{addr: addr, name: fn, module: module}
+		a2n.Addr2NameMap[addr] = sym
+		a2n.Addr2NameSlice = append(a2n.Addr2NameSlice, sym)
+	}
+	sort.Sort(byAddr(a2n.Addr2NameSlice))
+	return a2n
+}
+
+// recordReader reads the events of a --record file.
+type recordReader struct {
+	file io.ReadCloser
+	dec  *gob.Decoder
+	hdr  recordHeader
+}
+
+func openRecord(path string) (*recordReader, error) {
+	f, err := openInputFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(f)
+	magic := make([]byte, len(recordMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != recordMagic {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a pwru record", path)
+	}
+	r := &recordReader{file: f, dec: gob.NewDecoder(br)}
+	if err := r.dec.Decode(&r.hdr); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read the record header: %w", err)
+	}
+	return r, nil
+}
+
+// next reads the next event, and returns io.EOF at the end of the record.
+func (r *recordReader) next(rec *recordedEvent) error {
+	if err := r.dec.Decode(rec); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			// The recording may have been interrupted
+			return io.EOF
+		}
+		return fmt.Errorf("failed to read event: %w", err)
+	}
+	return nil
+}
+
+func (r *recordReader) Close() error {
+	return r.file.Close()
+}
+
+// Replay prints the events of a --record file with the output flags, and
+// the filters of replayFilter, until ctx is done. It returns the number of
+// printed events.
+func Replay(ctx context.Context, flags *Flags, path string) (uint64, error) {
+	r, err := openRecord(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	hdr := &r.hdr
+
+	filter, err := newReplayFilter(flags)
+	if err != nil {
+		return 0, err
+	}
+
+	o, err := NewOutput(flags, nil, nil, hdr.addr2name(), hdr.KprobeMulti, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer o.Close()
+	o.dropReasons = hdr.DropReasons
+	o.monoToReal = hdr.MonoToReal
+	o.PrintHeader()
+
+	var printed uint64
+	for ctx.Err() == nil {
+		var rec recordedEvent
+		if err := r.next(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return printed, err
+		}
+		if !filter.match(o.getFuncName(&rec.Event), &rec.Event) {
+			continue
+		}
+		o.print(&rec)
+		printed++
+		if flags.LimitEvents != 0 && printed >= flags.LimitEvents {
+			break
+		}
+	}
+	return printed, nil
+}
+
+// replayFilter applies the filters of the recorded events which can be
+// checked on the events: the functions, and the filters of the meta and of
+// the tuple other than the addresses.
+type replayFilter struct {
+	funcs    []*regexp.Regexp
+	excludes []*regexp.Regexp
+	cfg      FilterCfg
+}
+
+func newReplayFilter(flags *Flags) (*replayFilter, error) {
+	funcs, err := compileFuncPatterns(flags.FilterFunc)
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := compileExcludePatterns(flags.ExcludeFunc)
+	if err != nil {
+		return nil, err
+	}
+	return &replayFilter{funcs: funcs, excludes: excludes, cfg: NewFilterCfg(flags)}, nil
+}
+
+func (f *replayFilter) match(funcName string, event *Event) bool {
+	if !matchFunc(f.funcs, funcName) || (len(f.excludes) != 0 && matchFunc(f.excludes, funcName)) {
+		return false
+	}
+
+	cfg := &f.cfg
+	if cfg.FilterNetns != 0 && event.Meta.Netns != cfg.FilterNetns {
+		return false
+	}
+	if cfg.FilterMarkMask != 0 && event.Meta.Mark&cfg.FilterMarkMask != cfg.FilterMark {
+		return false
+	}
+	if cfg.FilterIfindex != 0 && event.Meta.Ifindex != cfg.FilterIfindex {
+		return false
+	}
+	if cfg.FilterPid != 0 && event.PID != cfg.FilterPid {
+		return false
+	}
+	if cfg.FilterDSCP != 0 && (event.Meta.IPVersion == 0 || event.Meta.DSCP() != cfg.DSCP) {
+		return false
+	}
+	if cfg.FilterMPLS != 0 && !event.Meta.hasMPLSLabel(cfg.MPLSLabel) {
+		return false
+	}
+	if (cfg.FilterLenMin != 0 && event.Meta.Len < cfg.FilterLenMin) ||
+		(cfg.FilterLenMax != 0 && event.Meta.Len > cfg.FilterLenMax) {
+		return false
+	}
+
+	t := &event.Tuple
+	if cfg.FilterProto != 0 && t.L4Proto != cfg.FilterProto {
+		return false
+	}
+	if cfg.FilterSPI != 0 && (!isIPsec(t.L4Proto) || byteorder.NetworkToHost32(t.SPI) != cfg.FilterSPI) {
+		return false
+	}
+	if cfg.FilterSrcPort.Max != 0 || cfg.FilterDstPort.Max != 0 || cfg.FilterPort.Max != 0 {
+		if t.L4Proto != syscall.IPPROTO_TCP && t.L4Proto != syscall.IPPROTO_UDP && t.L4Proto != syscall.IPPROTO_SCTP {
+			return false
+		}
+		sport, dport := byteorder.NetworkToHost16(t.Sport), byteorder.NetworkToHost16(t.Dport)
+		if cfg.FilterSrcPort.Max != 0 && !cfg.FilterSrcPort.contains(sport) {
+			return false
+		}
+		if cfg.FilterDstPort.Max != 0 && !cfg.FilterDstPort.contains(dport) {
+			return false
+		}
+		if cfg.FilterPort.Max != 0 && !cfg.FilterPort.contains(sport) && !cfg.FilterPort.contains(dport) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package pwru
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "trace.pwru.gz")
+
+	a2n := Addr2Name{Addr2NameMap: map[uint64]*ksym{
+		0x1000: {addr: 0x1000, name: "ip_rcv"},
+		0x2000: {addr: 0x2000, name: "kfree_skbmem"},
+	}}
+	r, err := newRecorder(path, newRecordHeader(a2n, true, 0, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.write(&recordedEvent{Event: Event{Addr: 0x1000, SAddr: 0xffff0001, PID: 42}, ExecName: "curl"})
+	r.write(&recordedEvent{Event: Event{Addr: 0x2000, SAddr: 0xffff0001, PID: 42}, ExecName: "curl"})
+	r.write(&recordedEvent{Event: Event{Addr: 0x1000, SAddr: 0xffff0002, PID: 7}, ExecName: "ping"})
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		flags Flags
+		want  []string
+	}{
+		{
+			name: "all",
+			want: []string{"ip_rcv", "kfree_skbmem", "ip_rcv"},
+		},
+		{
+			name:  "filter-func",
+			flags: Flags{FilterFunc: []string{"ip_.*"}},
+			want:  []string{"ip_rcv", "ip_rcv"},
+		},
+		{
+			name:  "filter-pid",
+			flags: Flags{FilterPid: 42, ExcludeFunc: []string{"kfree_*"}},
+			want:  []string{"ip_rcv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := tt.flags
+			flags.OutputFormat = OutputFormatText
+			flags.OutputTS = "none"
+			flags.OutputFile = filepath.Join(dir, tt.name+".txt")
+
+			printed, err := Replay(context.Background(), &flags, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if printed != uint64(len(tt.want)) {
+				t.Errorf("Replay() = %d events, want %d", printed, len(tt.want))
+			}
+
+			data, err := os.ReadFile(flags.OutputFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(data)), "\n")[1:]
+			if len(lines) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(tt.want), data)
+			}
+			for i, line := range lines {
+				if !strings.Contains(line, tt.want[i]) {
+					t.Errorf("line %d = %q, want %s", i, line, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := Replay(context.Background(), &Flags{OutputFormat: OutputFormatText}, filepath.Join(dir, "all.txt")); err == nil {
+		t.Errorf("Replay() of a text output succeeded")
+	}
+}
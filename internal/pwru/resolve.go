@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	resolveTimeout = 2 * time.Second
+	resolveWorkers = 4
+	// The addresses queued beyond are resolved when seen again
+	resolveQueueLen = 1024
+)
+
+// hostNames reverse-resolves the addresses of the tuples with --resolve-names.
+// The lookups are done in the background, so that the output is never
+// blocked on DNS: the events are printed without the name until it has been
+// resolved, and the names (or their absence) are cached for the lifetime of
+// pwru. Methods are no-ops on a nil *hostNames.
+type hostNames struct {
+	mu     sync.Mutex
+	names  map[string]string // addr => name, "" if not resolved (yet)
+	queue  chan string
+	lookup func(ctx context.Context, addr string) ([]string, error)
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newHostNames starts the workers resolving the addresses with lookup, e.g.
+// net.DefaultResolver.LookupAddr.
+func newHostNames(lookup func(ctx context.Context, addr string) ([]string, error)) *hostNames {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &hostNames{
+		names:  map[string]string{},
+		queue:  make(chan string, resolveQueueLen),
+		lookup: lookup,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for i := 0; i < resolveWorkers; i++ {
+		h.wg.Add(1)
+		go h.resolve()
+	}
+	return h
+}
+
+func (h *hostNames) resolve() {
+	defer h.wg.Done()
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case addr := <-h.queue:
+			ctx, cancel := context.WithTimeout(h.ctx, resolveTimeout)
+			names, err := h.lookup(ctx, addr)
+			cancel()
+			if err != nil || len(names) == 0 {
+				continue
+			}
+			h.mu.Lock()
+			h.names[addr] = strings.TrimSuffix(names[0], ".")
+			h.mu.Unlock()
+		}
+	}
+}
+
+// Name returns the name of the address, or an empty string if it is unknown
+// or still being resolved.
+func (h *hostNames) Name(ip net.IP) string {
+	if h == nil || ip == nil {
+		return ""
+	}
+	addr := ip.String()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if name, ok := h.names[addr]; ok {
+		return name
+	}
+	select {
+	case h.queue <- addr:
+		h.names[addr] = ""
+	default:
+	}
+	return ""
+}
+
+func (h *hostNames) Close() {
+	if h == nil {
+		return
+	}
+	h.cancel()
+	h.wg.Wait()
+}
+
+// hostAddr returns the address prefixed with the name of the host, if
+// known, e.g. "dns.google(8.8.8.8)".
+func hostAddr(name, addr string) string {
+	if name == "" {
+		return addr
+	}
+	return name + "(" + addr + ")"
+}
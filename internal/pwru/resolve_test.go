@@ -0,0 +1,56 @@
+package pwru
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHostNames(t *testing.T) {
+	lookups := make(chan string, 10)
+	h := newHostNames(func(ctx context.Context, addr string) ([]string, error) {
+		lookups <- addr
+		if addr == "10.0.0.1" {
+			return []string{"web.example."}, nil
+		}
+		return nil, errors.New("no such host")
+	})
+	defer h.Close()
+
+	for _, tt := range []struct {
+		addr string
+		want string
+	}{
+		{"10.0.0.1", "web.example"},
+		{"10.0.0.2", ""},
+	} {
+		ip := net.ParseIP(tt.addr)
+		if name := h.Name(ip); name != "" {
+			t.Errorf("Name(%s) = %q before the lookup, want \"\"", tt.addr, name)
+		}
+		select {
+		case <-lookups:
+		case <-time.After(time.Second):
+			t.Fatalf("%s not looked up", tt.addr)
+		}
+		deadline := time.Now().Add(time.Second)
+		for h.Name(ip) != tt.want && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if name := h.Name(ip); name != tt.want {
+			t.Errorf("Name(%s) = %q, want %q", tt.addr, name, tt.want)
+		}
+	}
+	// The cached names aren't looked up again
+	select {
+	case addr := <-lookups:
+		t.Errorf("%s looked up twice", addr)
+	default:
+	}
+
+	if got, want := hostAddr("web.example", "10.0.0.1"), "web.example(10.0.0.1)"; got != want {
+		t.Errorf("hostAddr() = %q, want %q", got, want)
+	}
+}
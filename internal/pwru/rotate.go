@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotatingFile is the --output-file, rotated once it exceeds maxSize bytes
+// or has been open for interval. The rotated files are renamed with the
+// suffixes .1 (the most recent) to .maxFiles, and the older ones removed.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	interval time.Duration
+
+	f      io.WriteCloser
+	size   int64 // uncompressed
+	opened time.Time
+}
+
+func newRotatingFile(path string, maxSize int64, maxFiles int, interval time.Duration) (*rotatingFile, error) {
+	if maxFiles < 1 {
+		return nil, fmt.Errorf("at least one rotated file has to be kept")
+	}
+	r := &rotatingFile{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+		interval: interval,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := createOutputFile(r.path)
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.size = 0
+	r.opened = time.Now()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
+
+// due returns whether the file has to be rotated, with buffered bytes yet to
+// be written.
+func (r *rotatingFile) due(buffered int) bool {
+	if r.maxSize > 0 && r.size+int64(buffered) >= r.maxSize {
+		return true
+	}
+	return r.interval > 0 && time.Since(r.opened) >= r.interval
+}
+
+func (r *rotatingFile) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
+
+// rotate closes the current file, shifts the rotated ones and opens a new
+// file. The buffered output has to be flushed beforehand.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(r.rotatedPath(r.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := r.maxFiles - 1; n > 0; n-- {
+		if err := os.Rename(r.rotatedPath(n), r.rotatedPath(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.rotatedPath(1)); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+var sizeUnits = map[string]int64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+}
+
+// parseSize parses a size in bytes, optionally with a K, M or G suffix
+// (e.g. 100M).
+func parseSize(s string) (int64, error) {
+	num := strings.TrimSuffix(strings.ToUpper(s), "B")
+	unit := ""
+	if len(num) > 0 {
+		if _, ok := sizeUnits[num[len(num)-1:]]; ok {
+			unit = num[len(num)-1:]
+			num = num[:len(num)-1]
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * sizeUnits[unit], nil
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// The names of the route types, as printed by "ip route"
+var routeTypeNames = map[uint8]string{
+	unix.RTN_UNICAST:     "unicast",
+	unix.RTN_LOCAL:       "local",
+	unix.RTN_BROADCAST:   "broadcast",
+	unix.RTN_ANYCAST:     "anycast",
+	unix.RTN_MULTICAST:   "multicast",
+	unix.RTN_BLACKHOLE:   "blackhole",
+	unix.RTN_UNREACHABLE: "unreachable",
+	unix.RTN_PROHIBIT:    "prohibit",
+	unix.RTN_THROW:       "throw",
+	unix.RTN_NAT:         "nat",
+	unix.RTN_XRESOLVE:    "xresolve",
+}
+
+func routeTypeToStr(typ uint8) string {
+	if name, ok := routeTypeNames[typ]; ok {
+		return name
+	}
+	return strconv.Itoa(int(typ))
+}
+
+// routeTableToStr returns the name of the reserved tables, as in
+// /etc/iproute2/rt_tables, or the number of the table.
+func routeTableToStr(table uint32) string {
+	switch table {
+	case unix.RT_TABLE_DEFAULT:
+		return "default"
+	case unix.RT_TABLE_MAIN:
+		return "main"
+	case unix.RT_TABLE_LOCAL:
+		return "local"
+	}
+	return strconv.FormatUint(uint64(table), 10)
+}
+
+// routeToStr returns the output device of the route, prefixed with its name
+// if known, and its gateway, type and table if known, e.g.
+// "route_dev=eth0(2) route_gw=10.0.0.1 route_type=unicast".
+func routeToStr(r *Route) string {
+	dev := strconv.Itoa(int(r.Ifindex))
+	if ifName := cstr(r.Ifname[:]); ifName != "" {
+		dev = fmt.Sprintf("%s(%d)", ifName, r.Ifindex)
+	}
+	s := "route_dev=" + dev
+	if r.GwProto != 0 {
+		s += " route_gw=" + addrToStr(r.GwProto, r.Gw)
+	}
+	if r.Type != 0 {
+		s += " route_type=" + routeTypeToStr(r.Type)
+	}
+	if r.Table != 0 {
+		s += " route_table=" + routeTableToStr(r.Table)
+	}
+	return s
+}
+
+type jsonRoute struct {
+	Ifindex uint32 `json:"ifindex"`
+	Ifname  string `json:"ifname,omitempty"`
+	Gateway string `json:"gateway,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Table   string `json:"table,omitempty"`
+}
+
+func newJSONRoute(r *Route) *jsonRoute {
+	j := &jsonRoute{
+		Ifindex: r.Ifindex,
+		Ifname:  cstr(r.Ifname[:]),
+		Gateway: addrToStr(r.GwProto, r.Gw),
+	}
+	if r.Type != 0 {
+		j.Type = routeTypeToStr(r.Type)
+	}
+	if r.Table != 0 {
+		j.Table = routeTableToStr(r.Table)
+	}
+	return j
+}
@@ -0,0 +1,51 @@
+package pwru
+
+import (
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestRouteToStr(t *testing.T) {
+	tests := []struct {
+		route Route
+		want  string
+	}{
+		{
+			route: Route{
+				Ifindex: 2,
+				Ifname:  [16]byte{'e', 't', 'h', '0'},
+				GwProto: syscall.ETH_P_IP,
+				Gw:      [16]byte{10, 0, 0, 1},
+				Type:    unix.RTN_UNICAST,
+			},
+			want: "route_dev=eth0(2) route_gw=10.0.0.1 route_type=unicast",
+		},
+		{
+			route: Route{Ifindex: 1, Type: unix.RTN_LOCAL},
+			want:  "route_dev=1 route_type=local",
+		},
+		{
+			route: Route{
+				Ifindex: 3,
+				Ifname:  [16]byte{'e', 't', 'h', '1'},
+				GwProto: syscall.ETH_P_IPV6,
+				Gw:      [16]byte{0xfe, 0x80, 15: 1},
+				Type:    unix.RTN_UNICAST,
+				Table:   unix.RT_TABLE_MAIN,
+			},
+			want: "route_dev=eth1(3) route_gw=[fe80::1] route_type=unicast route_table=main",
+		},
+		{
+			// From fib:fib_table_lookup, without the type
+			route: Route{Ifindex: 4, Table: 100},
+			want:  "route_dev=4 route_table=100",
+		},
+	}
+	for _, tt := range tests {
+		if got := routeToStr(&tt.route); got != tt.want {
+			t.Errorf("routeToStr() = %q, want %q", got, tt.want)
+		}
+	}
+}
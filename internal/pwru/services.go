@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const servicesFile = "/etc/services"
+
+var serviceProtos = map[string]uint8{
+	"tcp":  syscall.IPPROTO_TCP,
+	"udp":  syscall.IPPROTO_UDP,
+	"sctp": syscall.IPPROTO_SCTP,
+}
+
+type serviceKey struct {
+	proto uint8
+	port  uint16
+}
+
+// services maps the ports to the service names of /etc/services, per L4
+// protocol, for --resolve-ports.
+type services map[serviceKey]string
+
+func loadServices(path string) (services, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseServices(f), nil
+}
+
+// parseServices parses the lines of services(5), e.g. "https 443/tcp". The
+// first name of a port wins, as with getservbyport(3).
+func parseServices(r io.Reader) services {
+	s := services{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		portStr, protoStr, ok := strings.Cut(fields[1], "/")
+		if !ok {
+			continue
+		}
+		proto, ok := serviceProtos[protoStr]
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil {
+			continue
+		}
+		key := serviceKey{proto, uint16(port)}
+		if _, ok := s[key]; !ok {
+			s[key] = fields[0]
+		}
+	}
+	return s
+}
+
+// Name returns the service name of the port, or an empty string if unknown.
+func (s services) Name(proto uint8, port uint16) string {
+	return s[serviceKey{proto, port}]
+}
+
+// portToStr returns the port, followed by its service name if known, e.g.
+// "443(https)".
+func (s services) portToStr(proto uint8, port uint16) string {
+	if name := s.Name(proto, port); name != "" {
+		return strconv.Itoa(int(port)) + "(" + name + ")"
+	}
+	return strconv.Itoa(int(port))
+}
@@ -0,0 +1,45 @@
+package pwru
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParseServices(t *testing.T) {
+	s := parseServices(strings.NewReader(`# Network services
+ssh		22/tcp				# SSH Remote Login Protocol
+domain		53/tcp
+domain		53/udp
+http		80/tcp		www		# WorldWideWeb HTTP
+www-alt		80/tcp
+https		443/tcp
+ddp		37/ddp
+bogus		99999/tcp
+`))
+
+	tests := []struct {
+		proto uint8
+		port  uint16
+		want  string
+	}{
+		{syscall.IPPROTO_TCP, 22, "22(ssh)"},
+		{syscall.IPPROTO_UDP, 53, "53(domain)"},
+		{syscall.IPPROTO_TCP, 80, "80(http)"},
+		{syscall.IPPROTO_UDP, 443, "443"},
+		{syscall.IPPROTO_TCP, 8080, "8080"},
+	}
+	for _, tt := range tests {
+		if got := s.portToStr(tt.proto, tt.port); got != tt.want {
+			t.Errorf("portToStr(%d, %d) = %q, want %q", tt.proto, tt.port, got, tt.want)
+		}
+	}
+	if len(s) != 5 {
+		t.Errorf("parsed %d services, want 5", len(s))
+	}
+
+	var none services
+	if got := none.portToStr(syscall.IPPROTO_TCP, 443); got != "443" {
+		t.Errorf("portToStr() without services = %q, want \"443\"", got)
+	}
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+type skbGen struct {
+	gen   uint32
+	freed bool // by the last event of the address
+	tuple Tuple
+}
+
+// skbGenerations tells apart the skbs allocated at the same address, as the
+// addresses of the freed skbs are reused by the next ones. The generation
+// of an address is incremented at the first event after the skb was freed,
+// or if the tuple changed to one of another packet, for the frees which
+// were missed, e.g. when the free functions were not traced. The inner tuple
+// of the encapsulated packets is compared, as the encapsulation changes both
+// sides of the outer one.
+type skbGenerations struct {
+	gens map[uint64]*skbGen
+	skbs int // distinct skbs, i.e. pairs of address and generation
+}
+
+func newSkbGenerations() *skbGenerations {
+	return &skbGenerations{gens: map[uint64]*skbGen{}}
+}
+
+// update returns the generation of the skb of the event, and whether it is
+// a new skb at the address of a previous one.
+func (g *skbGenerations) update(event *Event, freed bool) (uint32, bool) {
+	s, ok := g.gens[event.SAddr]
+	if !ok {
+		s = &skbGen{}
+		g.gens[event.SAddr] = s
+		g.skbs++
+	}
+	tuple := packetTuple(event)
+	reused := ok && (s.freed || otherPacket(&s.tuple, tuple))
+	if reused {
+		s.gen++
+		g.skbs++
+	}
+	s.freed = freed
+	if tuple.L3Proto != 0 {
+		s.tuple = *tuple
+	}
+	return s.gen, reused
+}
+
+// packetTuple returns the tuple of the packet carried by the skb of the
+// event, i.e. the inner tuple if it is encapsulated.
+func packetTuple(event *Event) *Tuple {
+	if event.Tunnel.Type != 0 && event.Tunnel.Inner.L3Proto != 0 {
+		return &event.Tunnel.Inner
+	}
+	return &event.Tuple
+}
+
+// otherPacket returns whether the tuples are of different packets, i.e. both
+// of their sides differ. The NAT changes a side only, and the tuples of
+// different protocols, e.g. across an encapsulation, are not compared.
+func otherPacket(prev, t *Tuple) bool {
+	if prev.L3Proto == 0 || t.L3Proto == 0 || prev.L3Proto != t.L3Proto || prev.L4Proto != t.L4Proto {
+		return false
+	}
+	src := prev.Saddr == t.Saddr && prev.Sport == t.Sport
+	dst := prev.Daddr == t.Daddr && prev.Dport == t.Dport
+	return !src && !dst
+}
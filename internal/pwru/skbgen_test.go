@@ -0,0 +1,65 @@
+package pwru
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestSkbGenerations(t *testing.T) {
+	tuple := Tuple{
+		Saddr:   [16]byte{10, 0, 1, 2},
+		Daddr:   [16]byte{10, 0, 2, 3},
+		Sport:   1234,
+		Dport:   80,
+		L3Proto: syscall.ETH_P_IP,
+		L4Proto: syscall.IPPROTO_TCP,
+	}
+	snat := tuple
+	snat.Saddr = [16]byte{192, 168, 0, 1}
+	snat.Sport = 4321
+	other := tuple
+	other.Saddr = [16]byte{10, 0, 1, 4}
+	other.Daddr = [16]byte{10, 0, 2, 5}
+	// UDP in VXLAN, also UDP
+	udp := tuple
+	udp.L4Proto = syscall.IPPROTO_UDP
+	udp.Dport = 53
+	vxlan := Tuple{
+		Saddr:   [16]byte{172, 16, 0, 1},
+		Daddr:   [16]byte{172, 16, 0, 2},
+		Sport:   49152,
+		Dport:   4789,
+		L3Proto: syscall.ETH_P_IP,
+		L4Proto: syscall.IPPROTO_UDP,
+	}
+	encap := Tunnel{Type: tunnelVXLAN, Inner: udp}
+
+	tests := []struct {
+		name       string
+		event      Event
+		freed      bool
+		wantGen    uint32
+		wantReused bool
+	}{
+		{"first skb", Event{SAddr: 1, Tuple: tuple}, false, 0, false},
+		{"same skb", Event{SAddr: 1, Tuple: tuple}, false, 0, false},
+		{"source NAT", Event{SAddr: 1, Tuple: snat}, false, 0, false},
+		{"no tuple", Event{SAddr: 1}, false, 0, false},
+		{"freed", Event{SAddr: 1, Tuple: snat}, true, 0, false},
+		{"address reused", Event{SAddr: 1, Tuple: tuple}, false, 1, true},
+		{"another address", Event{SAddr: 2, Tuple: tuple}, false, 0, false},
+		{"missed free", Event{SAddr: 1, Tuple: other}, false, 2, true},
+		{"before encapsulation", Event{SAddr: 3, Tuple: udp}, false, 0, false},
+		{"encapsulated", Event{SAddr: 3, Tuple: vxlan, Tunnel: encap}, false, 0, false},
+	}
+	g := newSkbGenerations()
+	for _, tt := range tests {
+		gen, reused := g.update(&tt.event, tt.freed)
+		if gen != tt.wantGen || reused != tt.wantReused {
+			t.Errorf("%s: update() = %d, %t, want %d, %t", tt.name, gen, reused, tt.wantGen, tt.wantReused)
+		}
+	}
+	if g.skbs != 5 {
+		t.Errorf("skbs = %d, want 5", g.skbs)
+	}
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+
+	"github.com/cilium/ebpf"
+)
+
+// SockPrograms trace the functions by the position of their struct sock
+// argument with --type=sk.
+type SockPrograms interface {
+	GetKprobeSk1() *ebpf.Program
+	GetKprobeSk2() *ebpf.Program
+	GetKprobeSk3() *ebpf.Program
+	GetKprobeSk4() *ebpf.Program
+	GetKprobeSk5() *ebpf.Program
+}
+
+// SkbOnlyFlags are the packet filters which don't apply to the sockets, and
+// the probes of the skbs, which --type=sk doesn't support.
+var SkbOnlyFlags = []string{
+	"filter-ifindex", "filter-ifname", "filter-vlan", "filter-dscp",
+	"filter-len-min", "filter-len-max", "filter-spi", "filter-mpls-label",
+	"filter-icmp-type", "filter-tcp-flags", "filter-tunnel-inner",
+	"tracepoints", "filter-trace-xdp", "filter-trace-tc", "track-clones",
+	"output-netfilter",
+}
+
+// The states of include/net/tcp_states.h, as printed by ss. The UDP and raw
+// sockets use them too.
+var sockStates = map[uint8]string{
+	1:  "ESTAB",
+	2:  "SYN-SENT",
+	3:  "SYN-RECV",
+	4:  "FIN-WAIT-1",
+	5:  "FIN-WAIT-2",
+	6:  "TIME-WAIT",
+	7:  "UNCONN",
+	8:  "CLOSE-WAIT",
+	9:  "LAST-ACK",
+	10: "LISTEN",
+	11: "CLOSING",
+	12: "NEW-SYN-RECV",
+}
+
+func sockStateToStr(state uint8) string {
+	if name, ok := sockStates[state]; ok {
+		return name
+	}
+	return strconv.Itoa(int(state))
+}
+
+func sockProtoToStr(proto uint16) string {
+	if proto <= 0xff {
+		if name := protoToStr(uint8(proto)); name != "" {
+			return name
+		}
+	}
+	return strconv.Itoa(int(proto))
+}
+
+// userNames caches the names of the socket owners, which are looked up in
+// the user database of the host.
+type userNames map[uint32]string
+
+// Name returns the name of the user, or "" if unknown.
+func (u userNames) Name(uid uint32) string {
+	if uid == SockIDUnknown {
+		return ""
+	}
+	if name, ok := u[uid]; ok {
+		return name
+	}
+	var name string
+	if usr, err := user.LookupId(strconv.Itoa(int(uid))); err == nil {
+		name = usr.Username
+	}
+	u[uid] = name
+	return name
+}
+
+type jsonSock struct {
+	Addr   string  `json:"addr"`
+	Cookie uint64  `json:"cookie,omitempty"`
+	Proto  string  `json:"proto"`
+	State  string  `json:"state"`
+	UID    *uint32 `json:"uid,omitempty"`
+	User   string  `json:"user,omitempty"`
+	GID    *uint32 `json:"gid,omitempty"`
+}
+
+func newJSONSock(s *Sock, user string) *jsonSock {
+	sk := &jsonSock{
+		Addr:   fmt.Sprintf("0x%x", s.Addr),
+		Cookie: s.Cookie,
+		Proto:  sockProtoToStr(s.Protocol),
+		State:  sockStateToStr(s.State),
+		User:   user,
+	}
+	if s.UID != SockIDUnknown {
+		uid := s.UID
+		sk.UID = &uid
+	}
+	if s.GID != SockIDUnknown {
+		gid := s.GID
+		sk.GID = &gid
+	}
+	return sk
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// summary aggregates the printed events, to be reported on exit.
+type summary struct {
+	events uint64
+	byFunc map[string]uint64
+	byCPU  map[uint32]uint64
+	drops  map[string]uint64 // by drop reason
+}
+
+func newSummary() *summary {
+	return &summary{
+		byFunc: map[string]uint64{},
+		byCPU:  map[uint32]uint64{},
+		drops:  map[string]uint64{},
+	}
+}
+
+func (s *summary) add(event *eventInfo) {
+	s.events++
+	s.byFunc[event.funcName]++
+	s.byCPU[event.CPU]++
+	if dropReasonFuncs[event.funcName] && event.Type != EventTypeReturn {
+		reason := event.dropReason
+		if reason == "" {
+			reason = "UNKNOWN"
+		}
+		s.drops[reason]++
+	}
+}
+
+type summaryCount struct {
+	key   string
+	count uint64
+}
+
+// sortCounts returns the counts by decreasing count, then by key.
+func sortCounts(counts map[string]uint64) []summaryCount {
+	sorted := make([]summaryCount, 0, len(counts))
+	for k, n := range counts {
+		sorted = append(sorted, summaryCount{k, n})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].key < sorted[j].key
+	})
+	return sorted
+}
+
+func (s *summary) write(w io.Writer, skbs int) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "Summary: %d events, %d distinct skbs\n", s.events, skbs)
+
+	fmt.Fprintf(tw, "\nFUNC\tEVENTS\n")
+	for _, c := range sortCounts(s.byFunc) {
+		fmt.Fprintf(tw, "%s\t%d\n", c.key, c.count)
+	}
+
+	cpus := make([]uint32, 0, len(s.byCPU))
+	for cpu := range s.byCPU {
+		cpus = append(cpus, cpu)
+	}
+	sort.Slice(cpus, func(i, j int) bool { return cpus[i] < cpus[j] })
+	fmt.Fprintf(tw, "\nCPU\tEVENTS\n")
+	for _, cpu := range cpus {
+		fmt.Fprintf(tw, "%d\t%d\n", cpu, s.byCPU[cpu])
+	}
+
+	if len(s.drops) > 0 {
+		fmt.Fprintf(tw, "\nDROP REASON\tCOUNT\n")
+		for _, c := range sortCounts(s.drops) {
+			fmt.Fprintf(tw, "%s\t%d\n", c.key, c.count)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package pwru
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	s := newSummary()
+	for _, e := range []*eventInfo{
+		{Event: &Event{CPU: 1}, funcName: "ip_rcv"},
+		{Event: &Event{CPU: 0}, funcName: "ip_rcv"},
+		{Event: &Event{CPU: 0}, funcName: "ip_rcv_core"},
+		{Event: &Event{CPU: 1}, funcName: "kfree_skb_reason", dropReason: "NO_SOCKET"},
+	} {
+		s.add(e)
+	}
+
+	var buf bytes.Buffer
+	s.write(&buf, 2)
+
+	want := `Summary: 4 events, 2 distinct skbs
+
+FUNC              EVENTS
+ip_rcv            2
+ip_rcv_core       1
+kfree_skb_reason  1
+
+CPU  EVENTS
+0    2
+1    2
+
+DROP REASON  COUNT
+NO_SOCKET    1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("write() =\n%s\nwant:\n%s", got, want)
+	}
+}
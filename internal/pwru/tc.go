@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// tcClassifyFunc runs the BPF programs of a tc filter, and returns the
+// verdict in the direct-action mode.
+const tcClassifyFunc = "cls_bpf_classify"
+
+type TCPrograms interface {
+	GetKprobeTc() *ebpf.Program
+	GetKretprobeTc() *ebpf.Program
+}
+
+// AttachTC attaches the programs of --filter-trace-tc, which report the skbs
+// processed by the tc BPF filters along with their verdicts.
+func AttachTC(progs TCPrograms, kprobeMulti bool) ([]link.Link, error) {
+	links, err := attachKprobe(tcClassifyFunc, progs.GetKprobeTc(), progs.GetKretprobeTc(), kprobeMulti)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s not found, is the cls_bpf module loaded?", tcClassifyFunc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to %s: %w", tcClassifyFunc, err)
+	}
+	return links, nil
+}
+
+// Values of the TC_ACT_* verdicts, from TC_ACT_OK
+var tcActions = []string{"TC_ACT_OK", "TC_ACT_RECLASSIFY", "TC_ACT_SHOT", "TC_ACT_PIPE", "TC_ACT_STOLEN",
+	"TC_ACT_QUEUED", "TC_ACT_REPEAT", "TC_ACT_REDIRECT", "TC_ACT_TRAP"}
+
+func tcVerdictToStr(verdict int32) string {
+	switch {
+	case verdict == -1:
+		return "TC_ACT_UNSPEC"
+	case verdict >= 0 && int(verdict) < len(tcActions):
+		return tcActions[verdict]
+	}
+	return strconv.Itoa(int(verdict))
+}
+
+func tcDirToStr(ingress uint8) string {
+	if ingress != 0 {
+		return "ingress"
+	}
+	return "egress"
+}
+
+// tcFuncName is printed as the function of the tc events, e.g.
+// tc/cil_from_netdev, or the ID of the program if it has no name.
+func tcFuncName(tc *TC) string {
+	name := cstr(tc.ProgName[:])
+	if name == "" {
+		name = strconv.Itoa(int(tc.ProgID))
+	}
+	return "tc/" + name
+}
+
+type jsonTC struct {
+	ProgID  uint32 `json:"prog_id"`
+	Dir     string `json:"dir"`
+	Verdict string `json:"verdict"`
+}
+
+func newJSONTC(tc *TC) *jsonTC {
+	return &jsonTC{
+		ProgID:  tc.ProgID,
+		Dir:     tcDirToStr(tc.Ingress),
+		Verdict: tcVerdictToStr(tc.Verdict),
+	}
+}
@@ -0,0 +1,22 @@
+package pwru
+
+import "testing"
+
+func TestTCVerdictToStr(t *testing.T) {
+	tests := []struct {
+		verdict int32
+		want    string
+	}{
+		{-1, "TC_ACT_UNSPEC"},
+		{0, "TC_ACT_OK"},
+		{2, "TC_ACT_SHOT"},
+		{7, "TC_ACT_REDIRECT"},
+		{42, "42"},
+		{-2, "-2"},
+	}
+	for _, tt := range tests {
+		if got := tcVerdictToStr(tt.verdict); got != tt.want {
+			t.Errorf("tcVerdictToStr(%d) = %q, want %q", tt.verdict, got, tt.want)
+		}
+	}
+}
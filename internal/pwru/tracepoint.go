@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// tracepoints can be attached to with --tracepoints, in addition to the
+// kprobes. They are stable across kernel versions, and cheaper than kprobes.
+// The indexes must match TP_* in bpf/kprobe_pwru.c.
+var tracepoints = []string{
+	"",
+	"skb:kfree_skb",
+	"net:net_dev_xmit",
+	"net:netif_receive_skb",
+	"napi:napi_poll",
+	"fib:fib_table_lookup",
+}
+
+type TracepointPrograms interface {
+	GetRawTpKfreeSkb() *ebpf.Program
+	GetRawTpNetDevXmit() *ebpf.Program
+	GetRawTpNetifReceiveSkb() *ebpf.Program
+	GetRawTpNapiPoll() *ebpf.Program
+	GetRawTpFibTableLookup() *ebpf.Program
+}
+
+// CheckTracepoints returns an error if one of the names is not a supported
+// tracepoint.
+func CheckTracepoints(names []string) error {
+	for _, name := range names {
+		if tracepointID(name) == 0 {
+			return fmt.Errorf("unsupported tracepoint %q (supported: %s)", name,
+				strings.Join(tracepoints[1:], ", "))
+		}
+	}
+	return nil
+}
+
+func tracepointID(name string) int {
+	for id, tp := range tracepoints {
+		if id > 0 && tp == name {
+			return id
+		}
+	}
+	return 0
+}
+
+// AttachTracepoints attaches the programs of --tracepoints, as raw
+// tracepoints.
+func AttachTracepoints(progs TracepointPrograms, names []string) ([]link.Link, error) {
+	programs := []*ebpf.Program{
+		nil,
+		progs.GetRawTpKfreeSkb(),
+		progs.GetRawTpNetDevXmit(),
+		progs.GetRawTpNetifReceiveSkb(),
+		progs.GetRawTpNapiPoll(),
+		progs.GetRawTpFibTableLookup(),
+	}
+
+	var links []link.Link
+	for _, name := range names {
+		// The raw tracepoints are named without their system
+		_, event, _ := strings.Cut(name, ":")
+		l, err := link.AttachRawTracepoint(link.RawTracepointOptions{
+			Name:    event,
+			Program: programs[tracepointID(name)],
+		})
+		if err != nil {
+			for _, l := range links {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to attach to %s: %w", name, err)
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+func tracepointName(id uint64) string {
+	if id > 0 && id < uint64(len(tracepoints)) {
+		return tracepoints[id]
+	}
+	return fmt.Sprintf("tracepoint(%d)", id)
+}
+
+// tracepointArg returns the argument reported along with the tracepoint,
+// e.g. rc=0 for net:net_dev_xmit, or an empty string.
+func tracepointArg(event *Event) string {
+	switch tracepointName(event.Addr) {
+	case "net:net_dev_xmit":
+		return fmt.Sprintf("rc=%d", int32(event.ParamNext))
+	case "napi:napi_poll":
+		return fmt.Sprintf("work=%d", int32(event.ParamNext))
+	case "fib:fib_table_lookup":
+		return fmt.Sprintf("err=%d", int32(event.ParamNext))
+	}
+	return ""
+}
@@ -0,0 +1,33 @@
+package pwru
+
+import "testing"
+
+func TestCheckTracepoints(t *testing.T) {
+	if err := CheckTracepoints([]string{"skb:kfree_skb", "napi:napi_poll"}); err != nil {
+		t.Errorf("CheckTracepoints() = %v, want nil", err)
+	}
+	for _, name := range []string{"kfree_skb", "skb:consume_skb", ""} {
+		if err := CheckTracepoints([]string{name}); err == nil {
+			t.Errorf("CheckTracepoints(%q) = nil, want an error", name)
+		}
+	}
+}
+
+func TestTracepointArg(t *testing.T) {
+	tests := []struct {
+		tp    string
+		param uint64
+		want  string
+	}{
+		{"net:net_dev_xmit", 0, "rc=0"},
+		{"net:net_dev_xmit", uint64(0xffffffff), "rc=-1"},
+		{"napi:napi_poll", 4, "work=4"},
+		{"net:netif_receive_skb", 0, ""},
+	}
+	for _, tt := range tests {
+		event := &Event{Addr: uint64(tracepointID(tt.tp)), ParamNext: tt.param}
+		if got := tracepointArg(event); got != tt.want {
+			t.Errorf("tracepointArg(%s, %d) = %q, want %q", tt.tp, tt.param, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import "syscall"
+
+// packetKey identifies a packet by its tuple, along with the TCP sequence
+// and acknowledgment numbers (or the rest of the ICMP header) and the IPv4
+// ID to tell apart the packets of a flow. The UDP packets without an ID, i.e.
+// of IPv6 or with DF set, can't be told apart while in flight. The inner
+// tuple is used for the encapsulated packets, so that the key is the same
+// before and after the encapsulation. The packets without a tuple are
+// identified by their skb.
+type packetKey struct {
+	l3Proto      uint16
+	l4Proto      uint8
+	saddr, daddr [16]byte
+	sport, dport uint16
+	seq, ackSeq  uint32
+	ipID         uint16
+	skb          uint64
+}
+
+func newPacketKey(event *Event) packetKey {
+	t := packetTuple(event)
+	if t.L3Proto == 0 {
+		return packetKey{skb: event.SAddr}
+	}
+	key := packetKey{
+		l3Proto: t.L3Proto,
+		l4Proto: t.L4Proto,
+		saddr:   t.Saddr,
+		daddr:   t.Daddr,
+		sport:   t.Sport,
+		dport:   t.Dport,
+		ipID:    t.IPID,
+	}
+	switch t.L4Proto {
+	case syscall.IPPROTO_TCP:
+		// The pure ACKs have the same sequence number
+		key.seq, key.ackSeq = t.Seq, t.AckSeq
+	case syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6:
+		key.seq = t.Seq
+	}
+	return key
+}
+
+type trackedPacket struct {
+	id   uint64
+	key  packetKey
+	skbs int // not freed yet
+}
+
+// packetTracker follows the packets across the skbs carrying them with
+// --track-by=tuple: an skb belongs to the packet of the tuple of its first
+// event, e.g. of the original skb for a copy, until it is freed, so that
+// the NAT doesn't change its packet. A packet is done once all of its skbs
+// are freed.
+type packetTracker struct {
+	next    uint64
+	skbs    map[uint64]*trackedPacket // skb addr => packet, until freed
+	packets map[packetKey]*trackedPacket
+}
+
+func newPacketTracker() *packetTracker {
+	return &packetTracker{
+		skbs:    map[uint64]*trackedPacket{},
+		packets: map[packetKey]*trackedPacket{},
+	}
+}
+
+// track returns the ID of the packet of the skb of the event, and whether
+// the packet is done after the event, i.e. its last skb was freed.
+func (t *packetTracker) track(event *Event, freed bool) (uint64, bool) {
+	p, ok := t.skbs[event.SAddr]
+	if !ok {
+		key := newPacketKey(event)
+		if p, ok = t.packets[key]; !ok {
+			t.next++
+			p = &trackedPacket{id: t.next, key: key}
+			t.packets[key] = p
+		}
+		p.skbs++
+		t.skbs[event.SAddr] = p
+	}
+	if !freed {
+		return p.id, false
+	}
+
+	delete(t.skbs, event.SAddr)
+	p.skbs--
+	if p.skbs > 0 {
+		return p.id, false
+	}
+	delete(t.packets, p.key)
+	return p.id, true
+}
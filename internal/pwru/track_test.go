@@ -0,0 +1,62 @@
+package pwru
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestPacketTracker(t *testing.T) {
+	tuple := Tuple{
+		Saddr:   [16]byte{10, 0, 1, 2},
+		Daddr:   [16]byte{10, 0, 2, 3},
+		Sport:   1234,
+		Dport:   53,
+		L3Proto: syscall.ETH_P_IP,
+		L4Proto: syscall.IPPROTO_UDP,
+		IPID:    1,
+	}
+	snat := tuple
+	snat.Saddr = [16]byte{192, 168, 0, 1}
+	next := tuple
+	next.IPID = 2
+	encap := Tunnel{Type: 1, Inner: tuple}
+	ack := Tuple{
+		Saddr:   tuple.Daddr,
+		Daddr:   tuple.Saddr,
+		Sport:   80,
+		Dport:   1234,
+		L3Proto: syscall.ETH_P_IP,
+		L4Proto: syscall.IPPROTO_TCP,
+		Seq:     100,
+		AckSeq:  200,
+	}
+	nextAck := ack
+	nextAck.AckSeq = 300
+
+	tests := []struct {
+		name     string
+		event    Event
+		freed    bool
+		wantID   uint64
+		wantDone bool
+	}{
+		{"first skb", Event{SAddr: 0x1000, Tuple: tuple}, false, 1, false},
+		{"next packet of the flow", Event{SAddr: 0x2000, Tuple: next}, false, 2, false},
+		{"source NAT", Event{SAddr: 0x1000, Tuple: snat}, false, 1, false},
+		{"copy", Event{SAddr: 0x3000, Tuple: tuple}, false, 1, false},
+		{"original freed", Event{SAddr: 0x1000, Tuple: snat}, true, 1, false},
+		{"encapsulated copy", Event{SAddr: 0x3000, Tunnel: encap}, false, 1, false},
+		{"copy freed", Event{SAddr: 0x3000, Tunnel: encap}, true, 1, true},
+		{"retransmission", Event{SAddr: 0x1000, Tuple: tuple}, false, 3, false},
+		{"no tuple", Event{SAddr: 0x4000}, false, 4, false},
+		{"pure ACK", Event{SAddr: 0x5000, Tuple: ack}, false, 5, false},
+		{"next pure ACK", Event{SAddr: 0x6000, Tuple: nextAck}, false, 6, false},
+	}
+	p := newPacketTracker()
+	for _, tt := range tests {
+		id, done := p.track(&tt.event, tt.freed)
+		if id != tt.wantID || done != tt.wantDone {
+			t.Errorf("%s: track() = %d, %t, want %d, %t", tt.name, id, done, tt.wantID, tt.wantDone)
+		}
+	}
+}
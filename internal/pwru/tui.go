@@ -0,0 +1,407 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	tuiRefreshInterval = time.Second
+	// An skb is active if it has been seen during this interval.
+	tuiActiveInterval = 5 * time.Second
+	tuiMaxFlows       = 1024
+	tuiFlowPathLen    = 32
+)
+
+const (
+	tuiSortRate = iota
+	tuiSortTotal
+	tuiSortName
+	tuiSortMax
+)
+
+var tuiSortNames = [tuiSortMax]string{"rate", "total", "name"}
+
+type tuiFunc struct {
+	total uint64
+	prev  uint64 // total at the previous refresh
+	rate  float64
+}
+
+type tuiHop struct {
+	funcName string
+	ts       uint64
+}
+
+type tuiFlow struct {
+	key      string
+	events   uint64
+	lastSeen time.Time
+	path     []tuiHop // the most recent function hits
+}
+
+// tui is a top-like live view of the traced functions and flows, enabled
+// with --tui. Events are added from the output, and the screen is redrawn
+// every tuiRefreshInterval.
+type tui struct {
+	mu sync.Mutex
+
+	events  uint64
+	drops   uint64
+	funcs   map[string]*tuiFunc
+	skbs    map[uint64]time.Time
+	flows   map[string]*tuiFlow
+	lastLog string
+
+	sortBy    int
+	showFlows bool
+	selected  int
+	// The flow whose path is shown, the order of the flows changes as
+	// events come in.
+	detailKey string
+
+	fd        int
+	state     *term.State
+	logOutput io.Writer
+	done      chan struct{}
+	closed    bool
+	closeOnce sync.Once
+}
+
+func newTUI() (*tui, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, fmt.Errorf("--tui requires a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set the terminal to raw mode: %w", err)
+	}
+
+	t := &tui{
+		funcs:     map[string]*tuiFunc{},
+		skbs:      map[uint64]time.Time{},
+		flows:     map[string]*tuiFlow{},
+		fd:        fd,
+		state:     state,
+		logOutput: log.Writer(),
+		done:      make(chan struct{}),
+	}
+	// The logs would mess up the screen, so the last one is shown in the
+	// status line instead.
+	log.SetOutput(tuiLogWriter{t})
+
+	// Switch to the alternate screen and hide the cursor
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+	go t.readKeys()
+	go t.run()
+	return t, nil
+}
+
+type tuiLogWriter struct {
+	t *tui
+}
+
+func (w tuiLogWriter) Write(p []byte) (int, error) {
+	w.t.mu.Lock()
+	w.t.lastLog = strings.TrimSpace(string(p))
+	w.t.mu.Unlock()
+	return len(p), nil
+}
+
+// Close restores the terminal. It is safe to call it multiple times.
+func (t *tui) Close() {
+	if t == nil {
+		return
+	}
+	t.closeOnce.Do(func() {
+		close(t.done)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.closed = true
+		fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[?1049l")
+		_ = term.Restore(t.fd, t.state)
+		log.SetOutput(t.logOutput)
+	})
+}
+
+func flowKey(event *eventInfo) string {
+	if event.Tuple.L3Proto == 0 {
+		return fmt.Sprintf("skb 0x%x", event.SAddr)
+	}
+	tuple := newJSONTuple(&event.Tuple)
+	return fmt.Sprintf("%s->%s(%s)", tuple.Src(), tuple.Dst(), tuple.Proto)
+}
+
+func (t *tui) add(event *eventInfo) {
+	now := time.Now()
+	key := flowKey(event)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events++
+	f, ok := t.funcs[event.funcName]
+	if !ok {
+		f = &tuiFunc{}
+		t.funcs[event.funcName] = f
+	}
+	f.total++
+	if dropReasonFuncs[event.funcName] && event.Type != EventTypeReturn {
+		t.drops++
+	}
+	t.skbs[event.SAddr] = now
+
+	flow, ok := t.flows[key]
+	if !ok {
+		if len(t.flows) >= tuiMaxFlows {
+			t.evictFlow()
+		}
+		flow = &tuiFlow{key: key}
+		t.flows[key] = flow
+	}
+	flow.events++
+	flow.lastSeen = now
+	flow.path = append(flow.path, tuiHop{event.funcName, event.Timestamp})
+	if len(flow.path) > tuiFlowPathLen {
+		flow.path = flow.path[len(flow.path)-tuiFlowPathLen:]
+	}
+}
+
+// evictFlow removes the least recently seen flow.
+func (t *tui) evictFlow() {
+	var oldest *tuiFlow
+	for _, f := range t.flows {
+		if oldest == nil || f.lastSeen.Before(oldest.lastSeen) {
+			oldest = f
+		}
+	}
+	if oldest != nil {
+		delete(t.flows, oldest.key)
+	}
+}
+
+func (t *tui) run() {
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		t.mu.Lock()
+		t.refresh()
+		t.draw()
+		t.mu.Unlock()
+
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh updates the rates and forgets the inactive skbs.
+func (t *tui) refresh() {
+	for _, f := range t.funcs {
+		f.rate = float64(f.total-f.prev) / tuiRefreshInterval.Seconds()
+		f.prev = f.total
+	}
+	now := time.Now()
+	for skb, seen := range t.skbs {
+		if now.Sub(seen) > tuiActiveInterval {
+			delete(t.skbs, skb)
+		}
+	}
+}
+
+func (t *tui) readKeys() {
+	buf := make([]byte, 8)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case <-t.done:
+			return
+		default:
+		}
+
+		t.mu.Lock()
+		quit := t.handleKey(buf[:n])
+		if !quit {
+			t.draw()
+		}
+		t.mu.Unlock()
+
+		if quit {
+			// Go through the same path as Ctrl-C without the TUI, which
+			// can't be received in raw mode.
+			_ = syscall.Kill(os.Getpid(), syscall.SIGINT)
+			return
+		}
+	}
+}
+
+// handleKey applies the key press, and returns true if the user asked to
+// quit.
+func (t *tui) handleKey(key []byte) bool {
+	switch string(key) {
+	case "q", "\x03":
+		return true
+	case "f", "\t":
+		t.showFlows = !t.showFlows
+		t.detailKey = ""
+	case "s":
+		t.sortBy = (t.sortBy + 1) % tuiSortMax
+	case "k", "\x1b[A":
+		if t.selected > 0 {
+			t.selected--
+		}
+	case "j", "\x1b[B":
+		t.selected++
+	case "\r", "\n":
+		if t.detailKey != "" {
+			t.detailKey = ""
+		} else if flows := t.sortedFlows(); t.showFlows && t.selected < len(flows) {
+			t.detailKey = flows[t.selected].key
+		}
+	case "\x1b":
+		t.detailKey = ""
+	}
+	return false
+}
+
+func (t *tui) sortedFuncs() []string {
+	names := make([]string, 0, len(t.funcs))
+	for name := range t.funcs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := t.funcs[names[i]], t.funcs[names[j]]
+		switch {
+		case t.sortBy == tuiSortRate && a.rate != b.rate:
+			return a.rate > b.rate
+		case t.sortBy != tuiSortName && a.total != b.total:
+			return a.total > b.total
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func (t *tui) sortedFlows() []*tuiFlow {
+	flows := make([]*tuiFlow, 0, len(t.flows))
+	for _, f := range t.flows {
+		flows = append(flows, f)
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		if !flows[i].lastSeen.Equal(flows[j].lastSeen) {
+			return flows[i].lastSeen.After(flows[j].lastSeen)
+		}
+		return flows[i].key < flows[j].key
+	})
+	return flows
+}
+
+func (t *tui) draw() {
+	if t.closed {
+		return
+	}
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	// Header, column names and status line
+	rows := height - 3
+	if rows < 1 {
+		rows = 1
+	}
+
+	var b bytes.Buffer
+	line := func(reverse bool, format string, args ...interface{}) {
+		s := fmt.Sprintf(format, args...)
+		if len(s) > width {
+			s = s[:width]
+		}
+		if reverse {
+			s = "\x1b[7m" + s + strings.Repeat(" ", width-len(s)) + "\x1b[0m"
+		}
+		b.WriteString(s + "\x1b[K\r\n")
+	}
+
+	b.WriteString("\x1b[H")
+	line(true, "pwru: %d events, %d active skbs, %d drops (%d/%d flows)",
+		t.events, len(t.skbs), t.drops, len(t.flows), tuiMaxFlows)
+
+	switch {
+	case !t.showFlows:
+		line(false, "%-48s %12s %12s", "FUNC", "RATE/s", "TOTAL")
+		for i, name := range t.sortedFuncs() {
+			if i >= rows {
+				break
+			}
+			f := t.funcs[name]
+			line(false, "%-48s %12.0f %12d", name, f.rate, f.total)
+		}
+	case t.detailKey != "" && t.flows[t.detailKey] != nil:
+		flow := t.flows[t.detailKey]
+		line(false, "%-48s %12s", "PATH OF "+flow.key, "+TIME(us)")
+		start := len(flow.path) - rows
+		if start < 0 {
+			start = 0
+		}
+		for _, hop := range flow.path[start:] {
+			line(false, "%-48s %12.3f", hop.funcName, float64(int64(hop.ts-flow.path[0].ts))/1000)
+		}
+	default:
+		flows := t.sortedFlows()
+		if t.selected >= len(flows) {
+			t.selected = len(flows) - 1
+		}
+		if t.selected < 0 {
+			t.selected = 0
+		}
+		line(false, "%-56s %10s %-24s", "FLOW", "EVENTS", "LAST FUNC")
+		// Scroll to keep the selected flow visible
+		first := 0
+		if t.selected >= rows {
+			first = t.selected - rows + 1
+		}
+		for i := first; i < len(flows) && i < first+rows; i++ {
+			f := flows[i]
+			line(i == t.selected, "%-56s %10d %-24s", f.key, f.events, f.path[len(f.path)-1].funcName)
+		}
+	}
+
+	// Clear the rest of the screen, and print the status line at the bottom
+	b.WriteString("\x1b[J")
+	fmt.Fprintf(&b, "\x1b[%d;1H", height)
+	view := "flows"
+	if t.showFlows {
+		view = "functions"
+	}
+	status := fmt.Sprintf("[f] %s [s] sort by %s [j/k] select [enter] path [q] quit",
+		view, tuiSortNames[t.sortBy])
+	if t.lastLog != "" {
+		status += " | " + t.lastLog
+	}
+	if len(status) > width {
+		status = status[:width]
+	}
+	b.WriteString(status)
+
+	_, _ = os.Stdout.Write(b.Bytes())
+}
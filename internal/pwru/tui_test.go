@@ -0,0 +1,36 @@
+package pwru
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTUISortedFuncs(t *testing.T) {
+	ui := &tui{
+		funcs: map[string]*tuiFunc{},
+		skbs:  map[uint64]time.Time{},
+		flows: map[string]*tuiFlow{},
+	}
+	for _, fn := range []string{"ip_rcv", "ip_rcv", "ip_rcv", "tcp_v4_rcv", "ip_local_deliver", "ip_local_deliver"} {
+		ui.add(&eventInfo{Event: &Event{SAddr: 1}, funcName: fn})
+	}
+	ui.refresh()
+	ui.add(&eventInfo{Event: &Event{SAddr: 1}, funcName: "tcp_v4_rcv"})
+	ui.add(&eventInfo{Event: &Event{SAddr: 1}, funcName: "tcp_v4_rcv"})
+
+	for sortBy, want := range map[int][]string{
+		tuiSortRate:  {"ip_rcv", "ip_local_deliver", "tcp_v4_rcv"},
+		tuiSortTotal: {"ip_rcv", "tcp_v4_rcv", "ip_local_deliver"},
+		tuiSortName:  {"ip_local_deliver", "ip_rcv", "tcp_v4_rcv"},
+	} {
+		ui.sortBy = sortBy
+		if got := ui.sortedFuncs(); !reflect.DeepEqual(got, want) {
+			t.Errorf("sortedFuncs() by %s = %v, want %v", tuiSortNames[sortBy], got, want)
+		}
+	}
+
+	if len(ui.flows) != 1 || ui.flows["skb 0x1"].events != 8 {
+		t.Errorf("unexpected flows %v", ui.flows)
+	}
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+// Values of Tunnel.Type, as TUNNEL_* in the BPF programs
+const (
+	tunnelVXLAN  = 1
+	tunnelGeneve = 2
+	tunnelGRE    = 3
+	tunnelNVGRE  = 4
+)
+
+func tunnelTypeToStr(typ uint8) string {
+	switch typ {
+	case tunnelVXLAN:
+		return "vxlan"
+	case tunnelGeneve:
+		return "geneve"
+	case tunnelGRE:
+		return "gre"
+	case tunnelNVGRE:
+		return "nvgre"
+	}
+	return strconv.Itoa(int(typ))
+}
+
+// tunnelKeyToStr returns the key of the tunnel as named by its encapsulation,
+// e.g. "vni=42", or an empty string for GRE without a key.
+func tunnelKeyToStr(tun *Tunnel) string {
+	switch tun.Type {
+	case tunnelVXLAN, tunnelGeneve:
+		return fmt.Sprintf("vni=%d", tun.Key)
+	case tunnelNVGRE:
+		// The VSID is in the upper 24 bits, followed by the flow ID
+		return fmt.Sprintf("vsid=%d flow_id=%d", tun.Key>>8, tun.Key&0xff)
+	case tunnelGRE:
+		if tun.Key != 0 {
+			return fmt.Sprintf("key=0x%x", tun.Key)
+		}
+	}
+	return ""
+}
+
+// tunnelToStr returns the encapsulation and the inner tuple of the packet,
+// e.g. "tunnel=vxlan vni=42 inner=10.0.1.2:8080->10.0.2.3:43210(tcp)".
+func tunnelToStr(tun *Tunnel) string {
+	s := "tunnel=" + tunnelTypeToStr(tun.Type)
+	if key := tunnelKeyToStr(tun); key != "" {
+		s += " " + key
+	}
+	t := &tun.Inner
+	return fmt.Sprintf("%s inner=%s:%d->%s:%d(%s)", s,
+		addrToStr(t.L3Proto, t.Saddr), byteorder.NetworkToHost16(t.Sport),
+		addrToStr(t.L3Proto, t.Daddr), byteorder.NetworkToHost16(t.Dport),
+		protoToStr(t.L4Proto))
+}
+
+type jsonTunnel struct {
+	Type  string     `json:"type"`
+	Key   uint32     `json:"key,omitempty"`
+	Inner *jsonTuple `json:"inner"`
+}
+
+func newJSONTunnel(tun *Tunnel) *jsonTunnel {
+	return &jsonTunnel{
+		Type:  tunnelTypeToStr(tun.Type),
+		Key:   tun.Key,
+		Inner: newJSONTuple(&tun.Inner),
+	}
+}
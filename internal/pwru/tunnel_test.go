@@ -0,0 +1,45 @@
+package pwru
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/cilium/pwru/internal/byteorder"
+)
+
+func TestTunnelToStr(t *testing.T) {
+	inner := Tuple{
+		Saddr:   [16]byte{10, 0, 1, 2},
+		Daddr:   [16]byte{10, 0, 2, 3},
+		Sport:   byteorder.HostToNetwork16(43210),
+		Dport:   byteorder.HostToNetwork16(8080),
+		L3Proto: syscall.ETH_P_IP,
+		L4Proto: syscall.IPPROTO_TCP,
+	}
+	tests := []struct {
+		tun  Tunnel
+		want string
+	}{
+		{
+			tun:  Tunnel{Type: tunnelVXLAN, Key: 42, Inner: inner},
+			want: "tunnel=vxlan vni=42 inner=10.0.1.2:43210->10.0.2.3:8080(tcp)",
+		},
+		{
+			tun:  Tunnel{Type: tunnelGRE, Inner: inner},
+			want: "tunnel=gre inner=10.0.1.2:43210->10.0.2.3:8080(tcp)",
+		},
+		{
+			tun:  Tunnel{Type: tunnelGRE, Key: 0x10, Inner: inner},
+			want: "tunnel=gre key=0x10 inner=10.0.1.2:43210->10.0.2.3:8080(tcp)",
+		},
+		{
+			tun:  Tunnel{Type: tunnelNVGRE, Key: 5000<<8 | 7, Inner: inner},
+			want: "tunnel=nvgre vsid=5000 flow_id=7 inner=10.0.1.2:43210->10.0.2.3:8080(tcp)",
+		},
+	}
+	for _, tt := range tests {
+		if got := tunnelToStr(&tt.tun); got != tt.want {
+			t.Errorf("tunnelToStr() = %q, want %q", got, tt.want)
+		}
+	}
+}
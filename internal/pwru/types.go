@@ -7,6 +7,7 @@ package pwru
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/cilium/ebpf"
 	flag "github.com/spf13/pflag"
@@ -14,92 +15,429 @@ import (
 
 const (
 	MaxStackDepth = 50
+	// MaxCaptureLen must be below MAX_CAPTURE_LEN in bpf/kprobe_pwru.c
+	MaxCaptureLen = 2047
+	// MaxFullCaptureLen must match MAX_FULL_CAPTURE_LEN
+	MaxFullCaptureLen = 16000
+	// MaxMPLSLabels must match MAX_MPLS_LABELS
+	MaxMPLSLabels = 4
 
 	BackendKprobe      = "kprobe"
 	BackendKprobeMulti = "kprobe-multi"
+	BackendFentry      = "fentry"
+	BackendAuto        = "auto"
+
+	OutputFormatText   = "text"
+	OutputFormatJSON   = "json"
+	OutputFormatNDJSON = "ndjson"
+	OutputFormatCSV    = "csv"
+	OutputFormatNone   = "none"
+
+	TrackBySkb   = "skb"
+	TrackByTuple = "tuple"
+
+	TraceTypeSkb = "skb"
+	TraceTypeSk  = "sk"
+
+	EventTypeEntry      = 0
+	EventTypeReturn     = 1
+	EventTypeXDP        = 2
+	EventTypeTC         = 3
+	EventTypeTracepoint = 4
+
+	// skb->ip_summed
+	ChecksumNone        = 0
+	ChecksumUnnecessary = 1
+	ChecksumComplete    = 2
+	ChecksumPartial     = 3
+
+	SockIDUnknown = ^uint32(0)
 )
 
 type Flags struct {
 	ShowVersion bool
+	ListFuncs   bool
+	DryRun      bool
+	ConfigFile  string
 
 	KernelBTF string
 
-	FilterNetns   uint32
-	FilterMark    uint32
-	FilterFunc    string
+	FilterNetns   string
+	FilterMark    string
+	FilterVlan    string
+	FilterDSCP    string
+	FilterLenMin  uint32
+	FilterLenMax  uint32
+	FilterSPI     uint32
+	FilterMPLS    string
+	FilterIfindex uint32
+	FilterIfname  string
+	FilterPid     uint32
+	FilterComm    string
+	FilterCgroup  string
+	FilterExpr    string // pcap-filter expression from the arguments
+	FilterFunc    []string
+	ExcludeFunc   []string
 	FilterProto   string
 	FilterSrcIP   string
 	FilterDstIP   string
-	FilterSrcPort uint16
-	FilterDstPort uint16
-	FilterPort    uint16
+	FilterSrcPort string
+	FilterDstPort string
+	FilterPort    string
+
+	FilterICMPType string
+	FilterTCPFlags string
+
+	FilterTunnelInner bool
+	FilterTraceXDP    bool
+	FilterTraceTC     bool
+
+	Sample string
 
 	OutputTS         string
+	TimestampUnit    string
+	OutputDelta      bool
 	OutputMeta       bool
 	OutputTuple      bool
+	ResolveNames     bool
+	ResolvePorts     bool
+	OutputEth        bool
+	OutputSock       bool
+	OutputConntrack  bool
+	OutputNetfilter  bool
+	OutputRoute      bool
+	OutputPayload    int
+	OutputDNS        bool
 	OutputSkb        bool
 	OutputStack      bool
-	OutputLimitLines uint64
+	StackDepth       int
+	StackSingleLine  bool
+	OutputRetval     bool
+	OutputLatency    bool
+	LatencyThreshold time.Duration
+	LatencyHist      bool
+	HistInterval     time.Duration
+	Aggregate        time.Duration
+	LimitEvents      uint64
+	Timeout          time.Duration
+	Summary          bool
+	TUI              bool
 	OutputFile       string
+	OutputFormat     string
+	OutputTemplate   string
+	PcapFile         string
+	CaptureFile      string
+	Record           string
+	ExportDot        string
+	ExportDotPerFlow bool
+	ExportMermaid    string
+	ExportMermaidSkb string
+	ExportFolded     string
+	GroupBySkb       bool
+	Coalesce         bool
+	TrackBy          string
+	OnlyDrops        bool
+	TrackClones      bool
+	CorrelateVeth    bool
+	OtelEndpoint     string
+
+	// Rotation of the output file
+	OutputFileMaxSize        string
+	OutputFileMaxFiles       int
+	OutputFileRotateInterval time.Duration
 
 	PerCPUBuffer int
+	Ringbuf      bool
 	KMods        []string
+	Tracepoints  []string
+	FilterModule []string
 	AllKMods     bool
 
+	EventBufferPages int
+
 	ReadyFile string
 
-	Backend string
+	MetricsAddr string
+	GRPCAddr    string
+	Kube        bool
+
+	OutputContainer bool
+	CRIEndpoint     string
+
+	Backend        string
+	TraceType      string
+	TraceNestedSkb bool
 }
 
 func (f *Flags) SetFlags() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [pcap-filter]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s replay [options] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s diff [options] <file> <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Available pcap-filter: see \"man 7 pcap-filter\" (only a subset is supported)\n")
+		fmt.Fprintf(os.Stderr, "    Available options:\n")
+		flag.PrintDefaults()
+	}
+
 	flag.BoolVar(&f.ShowVersion, "version", false, "show pwru version and exit")
+	flag.StringVar(&f.ConfigFile, "config", "", "read the flags from the given YAML or TOML file (e.g. pwru.yaml), the command line flags override it")
+	flag.BoolVar(&f.ListFuncs, "list-funcs", false, "list the functions to attach to for the given filters, with their module and skb argument position, and exit")
+	flag.BoolVar(&f.DryRun, "dry-run", false, "print the probes to attach, the backend and the filters without loading anything into the kernel, and exit")
 	flag.StringVar(&f.KernelBTF, "kernel-btf", "", "specify kernel BTF file")
 	flag.StringSliceVar(&f.KMods, "kmods", nil, "list of kernel modules names to attach to")
 	flag.BoolVar(&f.AllKMods, "all-kmods", false, "attach to all available kernel modules")
-	flag.StringVar(&f.FilterFunc, "filter-func", "", "filter kernel functions to be probed by name (exact match, supports RE2 regular expression)")
-	flag.StringVar(&f.FilterProto, "filter-proto", "", "filter L4 protocol (tcp, udp, icmp, icmp6)")
-	flag.StringVar(&f.FilterSrcIP, "filter-src-ip", "", "filter source IP addr")
-	flag.StringVar(&f.FilterDstIP, "filter-dst-ip", "", "filter destination IP addr")
-	flag.Uint32Var(&f.FilterNetns, "filter-netns", 0, "filter netns inode")
-	flag.Uint32Var(&f.FilterMark, "filter-mark", 0, "filter skb mark")
-	flag.Uint16Var(&f.FilterSrcPort, "filter-src-port", 0, "filter source port")
-	flag.Uint16Var(&f.FilterDstPort, "filter-dst-port", 0, "filter destination port")
-	flag.Uint16Var(&f.FilterPort, "filter-port", 0, "filter either destination or source port")
-	flag.StringVar(&f.OutputTS, "timestamp", "none", "print timestamp per skb (\"current\", \"relative\", \"none\")")
+	flag.StringSliceVar(&f.Tracepoints, "tracepoints", nil, "also attach to the given tracepoints (skb:kfree_skb, net:net_dev_xmit, net:netif_receive_skb, napi:napi_poll, fib:fib_table_lookup)")
+	flag.StringSliceVar(&f.FilterModule, "filter-module", nil, "only attach to the functions of the given kernel modules (e.g. nf_conntrack,openvswitch)")
+	flag.StringArrayVar(&f.FilterFunc, "filter-func", nil, "filter kernel functions to be probed by name (exact match, supports RE2 regular expression, can be repeated)")
+	flag.StringArrayVar(&f.ExcludeFunc, "exclude-func", nil, "exclude kernel functions matching the glob (e.g. '*_lock*') or RE2 regular expression from the probed functions, can be repeated")
+	flag.StringVar(&f.FilterProto, "filter-proto", "", "filter L4 protocol (tcp, udp, sctp, icmp, icmp6, esp, ah, or a protocol number), can be combined with the address and port filters")
+	flag.StringVar(&f.FilterICMPType, "filter-icmp-type", "", "filter ICMP/ICMPv6 type by name (e.g. destination-unreachable) or number")
+	flag.StringVar(&f.FilterTCPFlags, "filter-tcp-flags", "", "filter TCP flags which have to be set, or unset if prefixed with '!' (e.g. syn,!ack)")
+	flag.BoolVar(&f.FilterTunnelInner, "filter-tunnel-inner", false, "apply the L3/L4 filters to the inner headers of VXLAN, Geneve and GRE encapsulated packets")
+	flag.BoolVar(&f.FilterTraceTC, "filter-trace-tc", false, "trace the tc BPF programs (cls_bpf filters), printing their return code, for the skbs dropped or redirected by them")
+	flag.BoolVar(&f.FilterTraceXDP, "filter-trace-xdp", false, "trace the XDP programs, printing their verdict, for the packets dropped or redirected before the skb allocation")
+	flag.StringVar(&f.FilterSrcIP, "filter-src-ip", "", "filter source IP addr or prefix (e.g. 10.0.0.0/8)")
+	flag.StringVar(&f.FilterDstIP, "filter-dst-ip", "", "filter destination IP addr or prefix (e.g. fd00::/64)")
+	flag.StringVar(&f.FilterNetns, "filter-netns", "", "filter netns by inode, path (e.g. /proc/1234/ns/net) or name (from /var/run/netns)")
+	flag.StringVar(&f.FilterMark, "filter-mark", "", "filter skb mark, optionally with a mask (e.g. 0x200/0xf00)")
+	flag.Uint32Var(&f.FilterIfindex, "filter-ifindex", 0, "filter skb ifindex")
+	flag.StringVar(&f.FilterIfname, "filter-ifname", "", "filter skb interface name (resolved in the --filter-netns netns if set)")
+	flag.Uint32Var(&f.FilterPid, "filter-pid", 0, "filter by the PID of the task processing the skb")
+	flag.StringVar(&f.FilterComm, "filter-comm", "", "filter by the command name of the task processing the skb (e.g. curl)")
+	flag.StringVar(&f.FilterCgroup, "filter-cgroup", "", "filter by the cgroup v2 (or its descendants) of the task processing the skb (e.g. /sys/fs/cgroup/system.slice/nginx.service)")
+	flag.StringVar(&f.FilterVlan, "filter-vlan", "", "filter VLAN ID (0 for the priority-tagged frames)")
+	flag.StringVar(&f.FilterDSCP, "filter-dscp", "", "filter the DSCP of the IPv4 TOS or IPv6 traffic class, by value (0-63) or name (e.g. EF, AF41, CS6)")
+	flag.Uint32Var(&f.FilterLenMin, "filter-len-min", 0, "filter skbs whose length (skb->len) is at least the given number of bytes")
+	flag.Uint32Var(&f.FilterLenMax, "filter-len-max", 0, "filter skbs whose length (skb->len) is at most the given number of bytes")
+	flag.Uint32Var(&f.FilterSPI, "filter-spi", 0, "filter the IPsec ESP and AH packets by SPI (e.g. 0xc0ffee)")
+	flag.StringVar(&f.FilterMPLS, "filter-mpls-label", "", "filter the MPLS packets with the given label in their (top 4) label stack entries")
+	flag.StringVar(&f.FilterSrcPort, "filter-src-port", "", "filter source port or port range (e.g. 30000-32767)")
+	flag.StringVar(&f.FilterDstPort, "filter-dst-port", "", "filter destination port or port range (e.g. 30000-32767)")
+	flag.StringVar(&f.FilterPort, "filter-port", "", "filter either destination or source port or port range (e.g. 30000-32767)")
+	flag.StringVar(&f.Sample, "sample", "", "only trace 1 in N of the matching skbs (e.g. 1/100), chosen by hashing the skb address")
+	flag.StringVar(&f.OutputTS, "timestamp", "none", "print timestamp per skb (\"current\", \"relative\" to the previous event of the skb, \"relative-start\" to the first event, \"absolute-date\", \"none\")")
+	flag.StringVar(&f.TimestampUnit, "timestamp-unit", "ns", "unit of the printed timestamps (\"ns\", \"us\", \"ms\", \"s\"), with the decimals down to the ns")
+	flag.BoolVar(&f.OutputDelta, "output-delta", false, "print time elapsed since the previous event of the same skb in microseconds")
 	flag.BoolVar(&f.OutputMeta, "output-meta", false, "print skb metadata")
 	flag.BoolVar(&f.OutputTuple, "output-tuple", false, "print L4 tuple")
+	flag.BoolVar(&f.ResolveNames, "resolve-names", false, "print the host names of the tuple addresses, reverse-resolved in the background (the events seen before the name is resolved are printed without it)")
+	flag.BoolVar(&f.ResolvePorts, "resolve-ports", false, "print the service names of the tuple ports from /etc/services, e.g. 443(https)")
+	flag.BoolVar(&f.OutputEth, "output-eth", false, "print source and destination MAC addresses")
+	flag.BoolVar(&f.OutputNetfilter, "output-netfilter", false, "trace nf_hook_slow and the iptables and nftables tables, printing the hook, table, chain and verdict on return")
+	flag.BoolVar(&f.OutputConntrack, "output-conntrack", false, "print the conntrack state (e.g. ESTABLISHED, or NONE which iptables matches as INVALID), zone and mark of the skb")
+	flag.BoolVar(&f.OutputRoute, "output-route", false, "print the output device, gateway, type and table of the route of the skb")
+	flag.BoolVar(&f.OutputSock, "output-sock", false, "print the address, cookie, protocol, state and owner of the socket of the skb")
+	flag.IntVar(&f.OutputPayload, "output-payload", 0, "print a hexdump of the given number of bytes of the packet from the network header")
+	flag.BoolVar(&f.OutputDNS, "output-dns", false, "decode the question and the response code of the DNS messages of the packets to or from port 53")
 	flag.BoolVar(&f.OutputSkb, "output-skb", false, "print skb")
 	flag.BoolVar(&f.OutputStack, "output-stack", false, "print stack")
-	flag.Uint64Var(&f.OutputLimitLines, "output-limit-lines", 0, "exit the program after the number of events has been received/printed")
+	flag.IntVar(&f.StackDepth, "stack-depth", 0, "with --output-stack, only print the given number of innermost frames (0 for all)")
+	flag.BoolVar(&f.StackSingleLine, "stack-single-line", false, "with --output-stack, print the stack at the end of the event line (e.g. stack=a<-b<-c) instead of one frame per line")
+	flag.BoolVar(&f.OutputRetval, "output-retval", false, "attach kretprobes to print the return value of the traced functions")
+	flag.BoolVar(&f.OutputLatency, "output-latency", false, "attach kretprobes to print the time spent in each traced function instead of the function entries")
+	flag.DurationVar(&f.LatencyThreshold, "latency-threshold", 0, "with --output-latency, only print the calls which took at least the given duration (e.g. 100us)")
+	flag.BoolVar(&f.LatencyHist, "latency-histogram", false, "attach kretprobes to print log2 histograms of the time spent in each traced function on exit, instead of the events")
+	flag.DurationVar(&f.HistInterval, "latency-histogram-interval", 0, "with --latency-histogram, also print and reset the histograms at the given interval (e.g. 10s)")
+	flag.DurationVar(&f.Aggregate, "aggregate", 0, "count the events per function and tuple (or netns) in the BPF programs, and print the counts at the given interval (e.g. 10s) instead of the events")
+	flag.Uint64Var(&f.LimitEvents, "limit-events", 0, "detach and exit the program after the number of events has been printed")
+	flag.BoolVar(&f.Summary, "summary", false, "print the number of events per function, per CPU and per drop reason to stderr on exit")
+	flag.BoolVar(&f.TUI, "tui", false, "show a live view of the functions by hit rate, of the active skbs and of the flows with their function path, instead of printing the events")
+	flag.DurationVar(&f.Timeout, "timeout", 0, "detach and exit the program after the given duration (e.g. 30s)")
+	flag.Uint64Var(&f.LimitEvents, "output-limit-lines", 0, "exit the program after the number of events has been received/printed")
+	_ = flag.CommandLine.MarkDeprecated("output-limit-lines", "use --limit-events instead")
 	flag.IntVar(&f.PerCPUBuffer, "per-cpu-buffer", os.Getpagesize(), "per CPU buffer in bytes")
+	flag.IntVar(&f.EventBufferPages, "event-buffer-pages", 0, "size in pages (power of 2) of the per CPU perf buffer, or of the ring buffer, overrides --per-cpu-buffer")
+	flag.BoolVar(&f.Ringbuf, "ringbuf", true, "deliver events via a BPF ring buffer (sized as all the per CPU buffers) if supported by the kernel (>= 5.8), instead of the perf buffer")
+
+	flag.StringVar(&f.OutputFile, "output-file", "", "write traces to file, compressed if its name ends with .gz or .zst")
+	flag.StringVar(&f.OutputFileMaxSize, "output-file-max-size", "", "rotate --output-file once it reaches the given uncompressed size (e.g. 100M)")
+	flag.IntVar(&f.OutputFileMaxFiles, "output-file-max-files", 5, "number of rotated output files to keep")
+	flag.DurationVar(&f.OutputFileRotateInterval, "output-file-rotate-interval", 0, "rotate --output-file at the given interval (e.g. 1h)")
+	flag.StringVar(&f.OutputFormat, "output-format", OutputFormatText,
+		fmt.Sprintf("output format ('%s', '%s', '%s' to flush every event, '%s', '%s' e.g. to only stream events via --grpc-addr)",
+			OutputFormatText, OutputFormatJSON, OutputFormatNDJSON, OutputFormatCSV, OutputFormatNone))
+
+	flag.StringVar(&f.OutputTemplate, "output-template", "", "render each event with the given Go text/template (e.g. '{{.Func}} {{.Tuple.Src}}->{{.Tuple.Dst}}')")
+	flag.BoolVar(&f.TrackClones, "track-clones", false, "print the skb which an skb was cloned or copied from (by skb_clone, skb_copy or pskb_copy) as its parent")
+	flag.BoolVar(&f.CorrelateVeth, "correlate-veth", false, "print a flow_id shared by the skbs of a packet, linking the new skbs of the packets crossing a veth pair by their tuple (and captured data if any, required for the UDP packets without an IPv4 ID, e.g. of IPv6), and the clones with --track-clones")
+	flag.BoolVar(&f.GroupBySkb, "group-by-skb", false, "buffer events and print them grouped per skb once the skb is freed (or on exit)")
+	flag.StringVar(&f.TrackBy, "track-by", TrackBySkb, "key the groups, the relative timestamps and the flow IDs on the \"skb\" address, or on the \"tuple\" with the IPv4 ID or the TCP sequence and ack numbers, to follow a packet across the skbs carrying it (the UDP packets without an IPv4 ID, e.g. of IPv6, in flight at the same time are merged)")
+	flag.BoolVar(&f.Coalesce, "coalesce", false, "print the consecutive events of the same skb in the same function as one line, with their number (e.g. x12)")
+	flag.BoolVar(&f.OnlyDrops, "only-drops", false, "only print the skbs dropped by kfree_skb or kfree_skb_reason, grouped per skb with all their events once the skb is freed")
+	flag.StringVar(&f.OtelEndpoint, "otel-endpoint", "", "export each skb as an OpenTelemetry trace to the given OTLP/HTTP endpoint (e.g. http://localhost:4318)")
+	flag.StringVar(&f.PcapFile, "pcap-file", "", "write captured packets to pcapng file, annotated with kernel function names")
+	flag.StringVar(&f.CaptureFile, "capture-file", "", "write the full packets, including paged data, to pcapng file, numbered by the event_id printed in the trace")
+	flag.StringVar(&f.Record, "record", "", "record the raw events to file, along with the kernel symbols, to print them later with 'pwru replay <file>'")
+	flag.StringVar(&f.ExportDot, "export-dot", "", "write the graph of the function transitions of the skbs, with their counts, to the given Graphviz DOT file on exit")
+	flag.BoolVar(&f.ExportDotPerFlow, "export-dot-per-flow", false, "with --export-dot, draw the functions of each flow (tuple) in their own subgraph")
+	flag.StringVar(&f.ExportMermaid, "export-mermaid", "", "write the functions of an skb with their timing to the given Mermaid flowchart file on exit, for the first skb matching the filters unless --export-mermaid-skb is set")
+	flag.StringVar(&f.ExportMermaidSkb, "export-mermaid-skb", "", "with --export-mermaid, the address of the skb to draw (e.g. 0xffff8881054c2e00)")
+	flag.StringVar(&f.ExportFolded, "export-folded", "", "write the number of events per stack to the given file on exit, in the folded format of flamegraph.pl and speedscope (captures the stacks as --output-stack)")
+
+	flag.StringVar(&f.MetricsAddr, "metrics-addr", "", "serve Prometheus metrics on the given address (e.g. :9090)")
 
-	flag.StringVar(&f.OutputFile, "output-file", "", "write traces to file")
+	flag.BoolVar(&f.OutputContainer, "output-container", false, "print the name of the container of the process, resolved via the CRI runtime")
+	flag.StringVar(&f.CRIEndpoint, "cri-endpoint", "unix:///run/containerd/containerd.sock", "CRI runtime endpoint for --output-container (e.g. unix:///var/run/crio/crio.sock)")
+	flag.BoolVar(&f.Kube, "kube", false, "annotate events with the namespace/name of the pod owning the netns (in-cluster API server access required)")
+	flag.StringVar(&f.GRPCAddr, "grpc-addr", "", "stream events over gRPC (api/v1/events) on the given address (e.g. :50051)")
 
 	flag.StringVar(&f.ReadyFile, "ready-file", "", "create file after all BPF progs are attached")
 	flag.Lookup("ready-file").Hidden = true
 
-	flag.StringVar(&f.Backend, "backend", "",
-		fmt.Sprintf("Tracing backend('%s', '%s'). Will auto-detect if not specified.", BackendKprobe, BackendKprobeMulti))
+	flag.StringVar(&f.Backend, "backend", BackendAuto,
+		fmt.Sprintf("Tracing backend('%s', '%s', '%s', '%s'). '%s' uses '%s' if it can be attached to the traced functions, '%s' otherwise.",
+			BackendKprobe, BackendKprobeMulti, BackendFentry, BackendAuto, BackendAuto, BackendKprobeMulti, BackendKprobe))
+	flag.StringVar(&f.TraceType, "type", TraceTypeSkb, fmt.Sprintf("trace the functions taking an skb ('%s'), or a struct sock ('%s') to print the sockets with their tuple from the local side", TraceTypeSkb, TraceTypeSk))
+	flag.BoolVar(&f.TraceNestedSkb, "trace-nested-skb", false, "also trace the functions receiving the skb in another argument, a struct sk_buff ** or a struct holding it (struct nf_queue_entry, struct nft_pktinfo) (requires >= 5.15 kernel)")
 }
 
 type Tuple struct {
-	Saddr   [16]byte
-	Daddr   [16]byte
-	Sport   uint16
-	Dport   uint16
-	L3Proto uint16
-	L4Proto uint8
-	Pad     uint8
+	Saddr    [16]byte
+	Daddr    [16]byte
+	Sport    uint16
+	Dport    uint16
+	L3Proto  uint16
+	L4Proto  uint8
+	TCPFlags uint8
+	Seq      uint32 // or the SCTP verification tag, the ESP and AH sequence number, or the rest of the ICMP header
+	AckSeq   uint32
+	ICMPType uint8
+	ICMPCode uint8
+
+	IPv6ExtHdrs uint8  // ipv6ExtHdr* bits of the extension headers
+	SPI         uint32 // ESP and AH only
+	IPID        uint16 // IPv4 only
 }
 
 type Meta struct {
-	Netns   uint32
-	Mark    uint32
+	Netns       uint32
+	Mark        uint32
+	Ifindex     uint32
+	Len         uint32
+	MTU         uint32
+	Proto       uint16
+	VlanPresent uint8
+	Pad         uint8
+	VlanTCI     uint16
+	DataLen     uint32
+	NrFrags     uint8
+	IPSummed    uint8
+	CsumStart   uint16
+	CsumOffset  uint16
+
+	Hash         uint32
+	QueueMapping uint16
+	Priority     uint32
+	TCClassid    uint16
+
+	IPVersion uint8 // 0 if the network header isn't IPv4 or IPv6
+	TOS       uint8
+	TTL       uint8 // or hop limit
+
+	MPLSLabels uint8 // number of label stack entries in MPLSLSE
+	MPLSLSE    [MaxMPLSLabels]uint32
+
+	// The name of the device when the event was emitted, as the device may
+	// be gone or in another netns by the time the event is printed
+	Ifname [16]byte
+}
+
+// Linear returns whether all the data of the skb is in its head, i.e. it
+// has no paged data.
+func (m *Meta) Linear() bool {
+	return m.DataLen == 0
+}
+
+// VlanID returns the VLAN ID from the tag control information.
+func (m *Meta) VlanID() uint16 {
+	return m.VlanTCI & 0x0fff
+}
+
+// VlanPCP returns the priority code point from the tag control information.
+func (m *Meta) VlanPCP() uint8 {
+	return uint8(m.VlanTCI >> 13)
+}
+
+// DSCP returns the differentiated services code point of the IPv4 TOS or
+// IPv6 traffic class.
+func (m *Meta) DSCP() uint8 {
+	return m.TOS >> 2
+}
+
+// ECN returns the explicit congestion notification bits.
+func (m *Meta) ECN() uint8 {
+	return m.TOS & 0x3
+}
+
+type Eth struct {
+	Dst   [6]byte
+	Src   [6]byte
+	Proto uint16
+}
+
+// Sock is the socket the skb belongs to, if Addr is set.
+type Sock struct {
+	Addr     uint64
+	Cookie   uint64
+	Protocol uint16
+	State    uint8
+	UID      uint32 // SockIDUnknown if unknown
+	GID      uint32
+}
+
+// Conntrack is the conntrack entry of the skb.
+type Conntrack struct {
+	CTInfo uint8 // enum ip_conntrack_info
+	Zone   uint16
+	Mark   uint32
+}
+
+// Netfilter is the hook traversed by the skb, set by the --output-netfilter
+// programs if Kind is set.
+type Netfilter struct {
+	Kind    uint8
+	PF      uint8
+	Hook    uint8
+	Verdict int32
+	Table   [32]byte
+	Chain   [32]byte // nftables only
+}
+
+// XDP is the XDP program run on the packet, for EventTypeXDP.
+type XDP struct {
+	ProgID   uint32
+	ProgName [16]byte
+	RxQueue  uint32
+	Verdict  uint32
+}
+
+// TC is the first tc BPF program of the filter run on the skb, for
+// EventTypeTC.
+type TC struct {
+	ProgID   uint32
+	ProgName [16]byte
+	Ingress  uint8
+	Verdict  int32
+}
+
+// Tunnel is the encapsulation of the packet, if Type is set, and its inner
+// tuple.
+type Tunnel struct {
+	Type  uint8
+	Key   uint32 // VNI of VXLAN and Geneve, key of GRE, VSID and flow ID of NVGRE
+	Inner Tuple
+}
+
+// Route is the route of the skb with --output-route, or the nexthop selected
+// by the fib:fib_table_lookup tracepoint, if Ifindex is set.
+type Route struct {
+	Netns   uint32 // of the output device
 	Ifindex uint32
-	Len     uint32
-	MTU     uint32
-	Proto   uint16
-	Pad     uint16
+	Ifname  [16]byte
+	GwProto uint16 // as Tuple.L3Proto, 0 without a gateway
+	Gw      [16]byte
+	Type    uint8  // RTN_*, 0 if unknown
+	Table   uint32 // 0 if unknown
 }
 
 type StackData struct {
@@ -117,12 +455,49 @@ type Event struct {
 	Tuple        Tuple
 	PrintStackId int64
 	CPU          uint32
+	ParamNext    uint64 // the return value for EventTypeReturn
+	Duration     uint64 // ns spent in the function for EventTypeReturn
+	Eth          Eth
+	Sock         Sock
+	Conntrack    Conntrack
+	Netfilter    Netfilter
+	ParentAddr   uint64 // with --track-clones
+	XDP          XDP
+	TC           TC
+	Tunnel       Tunnel // with --output-tuple
+	Route        Route
+}
+
+// CaptureHeader precedes the packet data captured by the BPF program.
+type CaptureHeader struct {
+	PktLen uint32
+	CapLen uint32
+}
+
+// Packet holds the packet bytes captured along with an event, starting at
+// the network header.
+type Packet struct {
+	Len  uint32
+	Data []byte
 }
 
 type KProbeMaps interface {
 	GetCfgMap() *ebpf.Map
 	GetEvents() *ebpf.Map
+	GetEventsRb() *ebpf.Map
+	GetLostEvents() *ebpf.Map
 	GetPrintStackMap() *ebpf.Map
+	GetCgroupMap() *ebpf.Map
+	GetSaddrLpm() *ebpf.Map
+	GetDaddrLpm() *ebpf.Map
+	GetCaptureBuf() *ebpf.Map
+	GetFullCaptureBuf() *ebpf.Map
+	GetRetStacks() *ebpf.Map
+	GetFilterBufMap() *ebpf.Map
+	GetSkbParents() *ebpf.Map
+	GetCloneOrigins() *ebpf.Map
+	GetLatencyHists() *ebpf.Map
+	GetAggregates() *ebpf.Map
 }
 
 type KProbeMapsWithOutputSKB interface {
@@ -136,6 +511,14 @@ type KProbePrograms interface {
 	GetKprobeSkb3() *ebpf.Program
 	GetKprobeSkb4() *ebpf.Program
 	GetKprobeSkb5() *ebpf.Program
+	GetKretprobeSkb() *ebpf.Program
+	NestedPrograms
+	SockPrograms
+	NetfilterPrograms
+	ClonePrograms
+	XDPPrograms
+	TCPrograms
+	TracepointPrograms
 }
 
 type KProbeObjects interface {
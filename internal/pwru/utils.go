@@ -7,15 +7,21 @@ package pwru
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/btf"
 	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
 )
 
 type Funcs map[string]int
@@ -42,17 +48,82 @@ func getAvailableFilterFunctions() (map[string]struct{}, error) {
 	return availableFuncs, nil
 }
 
-func GetFuncs(pattern string, spec *btf.Spec, kmods []string, kprobeMulti bool) (Funcs, error) {
+// compileFuncPatterns compiles the --filter-func patterns.
+func compileFuncPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	regs := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		reg, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile regular expression %v", err)
+		}
+		regs = append(regs, reg)
+	}
+	return regs, nil
+}
+
+var funcGlobChars = regexp.MustCompile(`^[\w*?]+$`)
+
+// compileExcludePatterns compiles the --exclude-func patterns, which are
+// either globs (only made of identifier chars, '*' and '?') or regular
+// expressions.
+func compileExcludePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	globs := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		if funcGlobChars.MatchString(pattern) {
+			pattern = strings.ReplaceAll(pattern, "*", ".*")
+			pattern = strings.ReplaceAll(pattern, "?", ".")
+		}
+		globs[i] = pattern
+	}
+	return compileFuncPatterns(globs)
+}
+
+// matchFunc returns whether the whole function name is matched by one of the
+// patterns. All functions match if there are no patterns.
+func matchFunc(regs []*regexp.Regexp, fnName string) bool {
+	if len(regs) == 0 {
+		return true
+	}
+	for _, reg := range regs {
+		if reg.FindString(fnName) == fnName {
+			return true
+		}
+	}
+	return false
+}
+
+// traceTypeStructs are the structs of the arguments of the traced functions
+// per --type.
+var traceTypeStructs = map[string]string{
+	TraceTypeSkb: "sk_buff",
+	TraceTypeSk:  "sock",
+}
+
+// GetFuncs returns the skb-accepting functions of the kernel and of kmods, or
+// the struct sock accepting ones for TraceTypeSk. If onlyKmods is set, the
+// functions of vmlinux are skipped. The other functions of TraceTypeSkb with
+// an argument holding the skb are returned as NestedFuncs.
+func GetFuncs(patterns, excludes []string, spec *btf.Spec, kmods []string, onlyKmods, kprobeMulti bool, traceType string) (Funcs, NestedFuncs, error) {
 	funcs := Funcs{}
+	nested := NestedFuncs{}
+
+	argStruct, ok := traceTypeStructs[traceType]
+	if !ok {
+		return nil, nil, fmt.Errorf("invalid --type %s (available: %s, %s)", traceType, TraceTypeSkb, TraceTypeSk)
+	}
 
 	type iterator struct {
 		kmod string
 		iter *btf.TypesIterator
 	}
 
-	reg, err := regexp.Compile(pattern)
+	regs, err := compileFuncPatterns(patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+	excludeRegs, err := compileExcludePatterns(excludes)
 	if err != nil {
-		return nil, fmt.Errorf("failed to compile regular expression %v", err)
+		return nil, nil, err
 	}
 
 	availableFuncs, err := getAvailableFilterFunctions()
@@ -60,18 +131,21 @@ func GetFuncs(pattern string, spec *btf.Spec, kmods []string, kprobeMulti bool)
 		log.Printf("Failed to retrieve available ftrace functions (is /sys/kernel/debug/tracing mounted?): %s", err)
 	}
 
-	iters := []iterator{{"", spec.Iterate()}}
+	var iters []iterator
+	if !onlyKmods {
+		iters = append(iters, iterator{"", spec.Iterate()})
+	}
 	for _, module := range kmods {
 		path := filepath.Join("/sys/kernel/btf", module)
 		f, err := os.Open(path)
 		if err != nil {
-			return nil, fmt.Errorf("failed to open %s: %v", path, err)
+			return nil, nil, fmt.Errorf("failed to open %s: %v", path, err)
 		}
 		defer f.Close()
 
 		modSpec, err := btf.LoadSplitSpecFromReader(f, spec)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load %s btf: %v", module, err)
+			return nil, nil, fmt.Errorf("failed to load %s btf: %v", module, err)
 		}
 		iters = append(iters, iterator{module, modSpec.Iterate()})
 	}
@@ -86,7 +160,7 @@ func GetFuncs(pattern string, spec *btf.Spec, kmods []string, kprobeMulti bool)
 
 			fnName := string(fn.Name)
 
-			if pattern != "" && reg.FindString(fnName) != fnName {
+			if !matchFunc(regs, fnName) || (len(excludeRegs) > 0 && matchFunc(excludeRegs, fnName)) {
 				continue
 			}
 
@@ -98,16 +172,16 @@ func GetFuncs(pattern string, spec *btf.Spec, kmods []string, kprobeMulti bool)
 				continue
 			}
 
+			name := fnName
+			if kprobeMulti && it.kmod != "" {
+				name = fmt.Sprintf("%s [%s]", fnName, it.kmod)
+			}
 			fnProto := fn.Type.(*btf.FuncProto)
 			i := 1
 			for _, p := range fnProto.Params {
 				if ptr, ok := p.Type.(*btf.Pointer); ok {
 					if strct, ok := ptr.Target.(*btf.Struct); ok {
-						if strct.Name == "sk_buff" && i <= 5 {
-							name := fnName
-							if kprobeMulti && it.kmod != "" {
-								name = fmt.Sprintf("%s [%s]", fnName, it.kmod)
-							}
+						if strct.Name == argStruct && i <= 5 {
 							funcs[name] = i
 							continue
 						}
@@ -115,10 +189,15 @@ func GetFuncs(pattern string, spec *btf.Spec, kmods []string, kprobeMulti bool)
 				}
 				i += 1
 			}
+			if _, ok := funcs[name]; !ok && traceType == TraceTypeSkb {
+				if arg, ok := nestedSkbArg(fnProto); ok {
+					nested[name] = arg
+				}
+			}
 		}
 	}
 
-	return funcs, nil
+	return funcs, nested, nil
 }
 
 func GetFuncsByPos(funcs Funcs) map[int][]string {
@@ -129,8 +208,67 @@ func GetFuncsByPos(funcs Funcs) map[int][]string {
 	return ret
 }
 
-// Very hacky way to check whether multi-link kprobe is supported.
-func HaveBPFLinkKprobeMulti() bool {
+// PrintFuncs writes the functions for --list-funcs, sorted by name, along
+// with their module and the position of the skb argument. The functions of
+// the modules are expected to be named "<func> [<module>]", as returned by
+// GetFuncs() for kprobe-multi.
+func PrintFuncs(w io.Writer, funcs Funcs) {
+	names := make([]string, 0, len(funcs))
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintf(tw, "FUNC\tMODULE\tSKB_ARG\n")
+	for _, name := range names {
+		fn, module := name, "vmlinux"
+		if i := strings.Index(name, " ["); i > 0 && strings.HasSuffix(name, "]") {
+			fn, module = name[:i], name[i+2:len(name)-1]
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\n", fn, module, funcs[name])
+	}
+}
+
+// dropReasonFuncs are the functions which receive the drop reason as the
+// argument following the skb.
+var dropReasonFuncs = map[string]bool{
+	"kfree_skb_reason":   true,
+	"sk_skb_reason_drop": true,
+	"skb:kfree_skb":      true,
+}
+
+// GetDropReasons returns the names of enum skb_drop_reason values, without
+// the SKB_DROP_REASON_ prefix. It returns nil for kernels without drop
+// reasons (< 5.17), or without a spec.
+func GetDropReasons(spec *btf.Spec) map[uint64]string {
+	if spec == nil {
+		return nil
+	}
+	typ, err := spec.AnyTypeByName("skb_drop_reason")
+	if err != nil {
+		return nil
+	}
+	enum, ok := typ.(*btf.Enum)
+	if !ok {
+		return nil
+	}
+
+	reasons := make(map[uint64]string, len(enum.Values))
+	for _, v := range enum.Values {
+		reasons[v.Value] = strings.TrimPrefix(v.Name, "SKB_DROP_REASON_")
+	}
+	return reasons
+}
+
+// ProbeKprobeMulti checks whether multi-link kprobes can be used, by
+// attaching a dummy kprobe-multi program to the functions to trace. Some
+// kernels support kprobe-multi, but fail to attach it to some of the
+// functions (e.g. the ones from modules), which would otherwise only be
+// found in the middle of the attachment.
+func ProbeKprobeMulti(symbols []string) error {
 	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
 		Name: "probe_kpm_link",
 		Type: ebpf.Kprobe,
@@ -142,16 +280,61 @@ func HaveBPFLinkKprobeMulti() bool {
 		License:    "MIT",
 	})
 	if err != nil {
-		return false
+		return fmt.Errorf("failed to load kprobe-multi program: %w", err)
 	}
 	defer prog.Close()
 
-	opts := link.KprobeMultiOptions{Symbols: []string{"vprintk"}}
-	link, err := link.KretprobeMulti(prog, opts)
+	opts := link.KprobeMultiOptions{Symbols: symbols}
+	link, err := link.KprobeMulti(prog, opts)
 	if err != nil {
-		return false
+		return err
 	}
 	defer link.Close()
 
-	return true
+	return nil
+}
+
+// attachKprobe attaches the entry program, and the return one if not nil, to
+// the function. The return is attached first for the entries to be reported.
+func attachKprobe(name string, entry, ret *ebpf.Program, kprobeMulti bool) ([]link.Link, error) {
+	var links []link.Link
+	for _, p := range []struct {
+		prog *ebpf.Program
+		ret  bool
+	}{{ret, true}, {entry, false}} {
+		if p.prog == nil {
+			continue
+		}
+
+		var l link.Link
+		var err error
+		switch {
+		case kprobeMulti && p.ret:
+			l, err = link.KretprobeMulti(p.prog, link.KprobeMultiOptions{Symbols: []string{name}})
+		case kprobeMulti:
+			l, err = link.KprobeMulti(p.prog, link.KprobeMultiOptions{Symbols: []string{name}})
+		case p.ret:
+			l, err = link.Kretprobe(name, p.prog, nil)
+		default:
+			l, err = link.Kprobe(name, p.prog, nil)
+		}
+		if err != nil {
+			for _, l := range links {
+				l.Close()
+			}
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+// monotonicToRealtimeOffset returns the offset in nanoseconds to add to
+// CLOCK_MONOTONIC (used by bpf_ktime_get_ns()) to get the wall-clock time.
+func monotonicToRealtimeOffset() (int64, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0, fmt.Errorf("failed to get monotonic time: %w", err)
+	}
+	return time.Now().UnixNano() - ts.Nano(), nil
 }
@@ -0,0 +1,66 @@
+package pwru
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMatchFunc(t *testing.T) {
+	regs, err := compileFuncPatterns([]string{"^(ip|ip6)_(rcv|output)", "tcp_v4_.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for fn, want := range map[string]bool{
+		"ip_rcv":           true,
+		"ip6_output":       true,
+		"ip_rcv_core":      false,
+		"tcp_v4_rcv":       true,
+		"__tcp_v4_rcv":     false,
+		"kfree_skb_reason": false,
+	} {
+		if got := matchFunc(regs, fn); got != want {
+			t.Errorf("matchFunc(%q) = %v, want %v", fn, got, want)
+		}
+	}
+
+	if !matchFunc(nil, "ip_rcv") {
+		t.Errorf("matchFunc() without patterns should match everything")
+	}
+}
+
+func TestCompileExcludePatterns(t *testing.T) {
+	regs, err := compileExcludePatterns([]string{"__kfree_skb", "*_lock*", "^skb_(clone|copy)$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for fn, want := range map[string]bool{
+		"__kfree_skb":       true,
+		"kfree_skb":         false,
+		"_raw_spin_lock_bh": true,
+		"skb_clone":         true,
+		"skb_clone_sk":      false,
+	} {
+		if got := matchFunc(regs, fn); got != want {
+			t.Errorf("matchFunc(%q) = %v, want %v", fn, got, want)
+		}
+	}
+}
+
+func TestPrintFuncs(t *testing.T) {
+	var b bytes.Buffer
+	PrintFuncs(&b, Funcs{
+		"kfree_skb_reason":                1,
+		"ovs_vport_receive [openvswitch]": 2,
+		"ip_rcv":                          1,
+	})
+	want := `FUNC               MODULE       SKB_ARG
+ip_rcv             vmlinux      1
+kfree_skb_reason   vmlinux      1
+ovs_vport_receive  openvswitch  2
+`
+	if got := b.String(); got != want {
+		t.Errorf("PrintFuncs() =\n%s\nwant\n%s", got, want)
+	}
+}
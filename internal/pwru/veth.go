@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"hash/fnv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// The maximum time between a packet crossing a veth pair and the first
+	// event of a new skb carrying it
+	vethLinkWindow = uint64(time.Second)
+	// The packets beyond are pruned once older than vethLinkWindow
+	vethMaxPackets = 4096
+)
+
+// vethPacketKey identifies a packet across the skbs carrying it. The headers
+// from the network one are not modified by the veth pairs, so that the
+// tuple, and the captured data if any, are the same on both sides. The
+// packets are only linked by their key if it tells apart the packets of a
+// flow, i.e. with the captured data, the TCP sequence number (or the rest of
+// the ICMP header) or the IPv4 ID.
+type vethPacketKey struct {
+	tuple    Tuple
+	dataHash uint64
+}
+
+type vethPacket struct {
+	flowID uint64
+	ts     uint64
+}
+
+// vethFlows assigns the flow IDs of --correlate-veth: the events of an skb
+// share its flow ID, which the clones (with --track-clones) inherit, and so
+// does a new skb carrying a packet which crossed a veth pair, e.g. when the
+// peer with an XDP program copies the skb, so that the path of a packet from
+// a container to another one reads as one flow.
+type vethFlows struct {
+	next    uint64
+	skbs    map[uint64]uint64 // skb addr => flow ID, until the skb is freed
+	packets map[vethPacketKey]vethPacket
+}
+
+func newVethFlows() *vethFlows {
+	return &vethFlows{
+		skbs:    map[uint64]uint64{},
+		packets: map[vethPacketKey]vethPacket{},
+	}
+}
+
+func newVethPacketKey(event *Event, pkt *Packet) (vethPacketKey, bool) {
+	if event.Tuple.L3Proto == 0 {
+		return vethPacketKey{}, false
+	}
+	key := vethPacketKey{tuple: event.Tuple}
+	if pkt != nil && len(pkt.Data) > 0 {
+		h := fnv.New64a()
+		h.Write(pkt.Data)
+		key.dataHash = h.Sum64()
+		return key, true
+	}
+	switch event.Tuple.L4Proto {
+	case syscall.IPPROTO_TCP, syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6:
+		return key, true
+	}
+	// e.g. the UDP packets of IPv6, or with DF set
+	return key, event.Tuple.IPID != 0
+}
+
+func isVethFunc(funcName string) bool {
+	return strings.HasPrefix(funcName, "veth_")
+}
+
+// flowID returns the flow ID of the skb of the event, which is forgotten if
+// the skb is freed.
+func (f *vethFlows) flowID(event *Event, funcName string, pkt *Packet, freed bool) uint64 {
+	key, hasKey := newVethPacketKey(event, pkt)
+
+	id, ok := f.skbs[event.SAddr]
+	if !ok {
+		parent, hasParent := f.skbs[event.ParentAddr]
+		p, crossed := f.packets[key]
+		// The events of different CPUs may be slightly out of order
+		crossed = crossed && hasKey && (p.ts > event.Timestamp || event.Timestamp-p.ts <= vethLinkWindow)
+		switch {
+		case event.ParentAddr != 0 && hasParent:
+			id = parent
+		case crossed:
+			id = p.flowID
+			delete(f.packets, key)
+		default:
+			f.next++
+			id = f.next
+		}
+		f.skbs[event.SAddr] = id
+	}
+
+	if hasKey && isVethFunc(funcName) {
+		if len(f.packets) >= vethMaxPackets {
+			f.prune(event.Timestamp)
+		}
+		f.packets[key] = vethPacket{flowID: id, ts: event.Timestamp}
+	}
+	// The address may be reused by another skb
+	if freed {
+		delete(f.skbs, event.SAddr)
+	}
+	return id
+}
+
+func (f *vethFlows) prune(now uint64) {
+	for key, p := range f.packets {
+		if now > p.ts && now-p.ts > vethLinkWindow {
+			delete(f.packets, key)
+		}
+	}
+}
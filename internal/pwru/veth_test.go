@@ -0,0 +1,96 @@
+package pwru
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestVethFlows(t *testing.T) {
+	tuple := Tuple{
+		Saddr:   [16]byte{10, 0, 1, 2},
+		Daddr:   [16]byte{10, 0, 2, 3},
+		L3Proto: syscall.ETH_P_IP,
+		L4Proto: syscall.IPPROTO_UDP,
+		IPID:    1,
+	}
+	other := tuple
+	other.Daddr = [16]byte{10, 0, 2, 4}
+	noID := tuple
+	noID.IPID = 0
+
+	tests := []struct {
+		name     string
+		event    Event
+		funcName string
+		freed    bool
+		want     uint64
+	}{
+		{
+			name:     "first skb",
+			event:    Event{SAddr: 0x1000, Timestamp: 1000, Tuple: tuple},
+			funcName: "veth_xmit",
+			want:     1,
+		},
+		{
+			name:     "new skb of the packet on the peer",
+			event:    Event{SAddr: 0x2000, Timestamp: 2000, Tuple: tuple},
+			funcName: "__netif_receive_skb",
+			want:     1,
+		},
+		{
+			name:     "skb of another packet",
+			event:    Event{SAddr: 0x3000, Timestamp: 3000, Tuple: other},
+			funcName: "__netif_receive_skb",
+			want:     2,
+		},
+		{
+			name:     "clone",
+			event:    Event{SAddr: 0x4000, Timestamp: 4000, Tuple: other, ParentAddr: 0x3000},
+			funcName: "skb_clone",
+			want:     2,
+		},
+		{
+			name:     "freed skb",
+			event:    Event{SAddr: 0x2000, Timestamp: 5000, Tuple: tuple},
+			funcName: "kfree_skbmem",
+			freed:    true,
+			want:     1,
+		},
+		{
+			name:     "reused address",
+			event:    Event{SAddr: 0x2000, Timestamp: 6000, Tuple: other},
+			funcName: "ip_rcv",
+			want:     3,
+		},
+		{
+			name:     "skb crossing the veth",
+			event:    Event{SAddr: 0x5000, Timestamp: 7000, Tuple: other},
+			funcName: "veth_xmit",
+			want:     4,
+		},
+		{
+			name:     "packet seen at the veth too long ago",
+			event:    Event{SAddr: 0x6000, Timestamp: 7000 + 2*vethLinkWindow, Tuple: other},
+			funcName: "__netif_receive_skb",
+			want:     5,
+		},
+		{
+			name:     "packet without an ID crossing the veth",
+			event:    Event{SAddr: 0x7000, Timestamp: 8000 + 2*vethLinkWindow, Tuple: noID},
+			funcName: "veth_xmit",
+			want:     6,
+		},
+		{
+			name:     "next packet without an ID",
+			event:    Event{SAddr: 0x8000, Timestamp: 9000 + 2*vethLinkWindow, Tuple: noID},
+			funcName: "__netif_receive_skb",
+			want:     7,
+		},
+	}
+	f := newVethFlows()
+	for _, tt := range tests {
+		if got := f.flowID(&tt.event, tt.funcName, nil, tt.freed); got != tt.want {
+			t.Errorf("%s: flowID() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
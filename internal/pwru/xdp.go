@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-2.0-only
+/* Copyright (C) 2023 Authors of Cilium */
+
+package pwru
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// xdpDispatcherFunc runs all the XDP programs, in the driver or in the
+// generic mode, and returns their verdict.
+const xdpDispatcherFunc = "bpf_dispatcher_xdp_func"
+
+type XDPPrograms interface {
+	GetKprobeXdp() *ebpf.Program
+	GetKretprobeXdp() *ebpf.Program
+}
+
+// AttachXDP attaches the programs of --filter-trace-xdp, which report the
+// packets processed by the XDP programs along with their verdicts.
+func AttachXDP(progs XDPPrograms, kprobeMulti bool) ([]link.Link, error) {
+	links, err := attachKprobe(xdpDispatcherFunc, progs.GetKprobeXdp(), progs.GetKretprobeXdp(), kprobeMulti)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to %s: %w", xdpDispatcherFunc, err)
+	}
+	return links, nil
+}
+
+// Values of enum xdp_action
+var xdpActions = []string{"XDP_ABORTED", "XDP_DROP", "XDP_PASS", "XDP_TX", "XDP_REDIRECT"}
+
+func xdpVerdictToStr(verdict uint32) string {
+	if int(verdict) < len(xdpActions) {
+		return xdpActions[verdict]
+	}
+	return strconv.Itoa(int(verdict))
+}
+
+// xdpFuncName is printed as the function of the XDP events, e.g.
+// xdp/xdp_prog_func, or the ID of the program if it has no name.
+func xdpFuncName(x *XDP) string {
+	name := cstr(x.ProgName[:])
+	if name == "" {
+		name = strconv.Itoa(int(x.ProgID))
+	}
+	return "xdp/" + name
+}
+
+type jsonXDP struct {
+	ProgID  uint32 `json:"prog_id"`
+	RxQueue uint32 `json:"rx_queue"`
+	Verdict string `json:"verdict"`
+}
+
+func newJSONXDP(x *XDP) *jsonXDP {
+	return &jsonXDP{
+		ProgID:  x.ProgID,
+		RxQueue: x.RxQueue,
+		Verdict: xdpVerdictToStr(x.Verdict),
+	}
+}
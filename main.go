@@ -13,13 +13,14 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	pb "github.com/cheggaaa/pb/v3"
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/btf"
 	"github.com/cilium/ebpf/link"
-	"github.com/cilium/ebpf/perf"
 	flag "github.com/spf13/pflag"
 	"golang.org/x/sys/unix"
 
@@ -29,13 +30,35 @@ import (
 func main() {
 	flags := pwru.Flags{}
 	flags.SetFlags()
-	flag.Parse()
+	// The subcommands working on --record files
+	var cmd string
+	if len(os.Args) > 1 && (os.Args[1] == "replay" || os.Args[1] == "diff") {
+		cmd = os.Args[1]
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+		flags.FilterExpr = strings.Join(flag.Args(), " ")
+	}
+	if flags.ConfigFile != "" {
+		if err := flags.LoadConfigFile(flags.ConfigFile); err != nil {
+			log.Fatalf("Failed to load --config: %s", err)
+		}
+	}
 
 	if flags.ShowVersion {
 		fmt.Printf("pwru %s\n", pwru.Version)
 		os.Exit(0)
 	}
 
+	switch cmd {
+	case "replay":
+		replayRecord(&flags)
+		os.Exit(0)
+	case "diff":
+		diffRecords(&flags)
+		os.Exit(0)
+	}
+
 	if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &unix.Rlimit{
 		Cur: 4096,
 		Max: 4096,
@@ -49,8 +72,18 @@ func main() {
 		log.Fatalf("Failed to set temporary rlimit: %s", err)
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if !pwru.HaveOutputFormat(flags.OutputFormat) {
+		log.Fatalf("Invalid output format %s (available: %s)", flags.OutputFormat,
+			strings.Join(pwru.OutputFormats(), ", "))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 	defer stop()
+	if flags.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flags.Timeout)
+		defer cancel()
+	}
 
 	var btfSpec *btf.Spec
 	var err error
@@ -77,112 +110,284 @@ func main() {
 		}
 	}
 
-	var useKprobeMulti bool
-	if flags.Backend != "" && (flags.Backend != pwru.BackendKprobe && flags.Backend != pwru.BackendKprobeMulti) {
+	if len(flags.FilterModule) != 0 {
+		if flags.AllKMods || len(flags.KMods) != 0 {
+			log.Fatalf("--filter-module cannot be used with --kmods or --all-kmods")
+		}
+		flags.KMods = flags.FilterModule
+	}
+
+	switch flags.Backend {
+	case pwru.BackendAuto, pwru.BackendKprobe, pwru.BackendKprobeMulti, pwru.BackendFentry:
+	default:
 		log.Fatalf("Invalid tracing backend %s", flags.Backend)
 	}
-	// Until https://lore.kernel.org/bpf/20221025134148.3300700-1-jolsa@kernel.org/
-	// has been backported to the stable, kprobe-multi cannot be used when attaching
-	// to kmods.
-	if flags.Backend == "" && len(flags.KMods) == 0 {
-		useKprobeMulti = pwru.HaveBPFLinkKprobeMulti()
-	} else if flags.Backend == pwru.BackendKprobeMulti {
-		useKprobeMulti = true
+	useKprobeMulti := flags.Backend == pwru.BackendKprobeMulti
+
+	// The returns are printed per event, and only their functions would
+	// be counted
+	if flags.Aggregate > 0 && (flags.OutputRetval || flags.OutputLatency) {
+		log.Fatalf("--aggregate cannot be used with --output-retval or --output-latency")
+	}
+
+	if err := pwru.CheckTracepoints(flags.Tracepoints); err != nil {
+		log.Fatalf("Invalid --tracepoints: %s", err)
+	}
+
+	// The sockets are printed with their tuple, and the filters of the
+	// packets don't apply
+	if flags.TraceType == pwru.TraceTypeSk {
+		if flags.Backend == pwru.BackendFentry {
+			log.Fatalf("--type=%s cannot be used with --backend=%s", pwru.TraceTypeSk, pwru.BackendFentry)
+		}
+		if flags.FilterExpr != "" {
+			log.Fatalf("The filter expression is not supported with --type=%s", pwru.TraceTypeSk)
+		}
+		for _, name := range pwru.SkbOnlyFlags {
+			if flag.CommandLine.Changed(name) {
+				log.Fatalf("--%s cannot be used with --type=%s", name, pwru.TraceTypeSk)
+			}
+		}
+		flags.OutputTuple = true
+		flags.OutputSock = true
 	}
 
-	funcs, err := pwru.GetFuncs(flags.FilterFunc, btfSpec, flags.KMods, useKprobeMulti)
+	// The names are suffixed with the module with kprobe-multi, which is
+	// printed by --list-funcs.
+	funcs, nested, err := pwru.GetFuncs(flags.FilterFunc, flags.ExcludeFunc, btfSpec, flags.KMods,
+		len(flags.FilterModule) != 0, useKprobeMulti || flags.ListFuncs, flags.TraceType)
 	if err != nil {
-		log.Fatalf("Failed to get skb-accepting functions: %s", err)
+		log.Fatalf("Failed to get the functions to trace: %s", err)
+	}
+	if flags.TraceNestedSkb {
+		for name, arg := range nested {
+			funcs[name] = arg.Pos
+		}
+	} else {
+		nested = nil
+	}
+	if flags.ListFuncs {
+		pwru.PrintFuncs(os.Stdout, funcs)
+		os.Exit(0)
 	}
-	if len(funcs) <= 0 {
+	if len(funcs) <= 0 && len(flags.Tracepoints) == 0 {
 		log.Fatalf("Cannot find a matching kernel function")
 	}
-	addr2name, err := pwru.GetAddrs(funcs, flags.OutputStack || len(flags.KMods) != 0)
+	if flags.OutputNetfilter {
+		for name := range pwru.NetfilterFuncs {
+			funcs[name] = 1
+		}
+	}
+	addr2name, err := pwru.GetAddrs(funcs, flags.OutputStack || flags.ExportFolded != "" || len(flags.KMods) != 0)
 	if err != nil {
 		log.Fatalf("Failed to get function addrs: %s", err)
 	}
+	if flags.OutputNetfilter {
+		// Traced by the dedicated programs instead, which report the
+		// verdicts
+		for name := range pwru.NetfilterFuncs {
+			delete(funcs, name)
+		}
+	}
+
+	if flags.DryRun {
+		plan, err := pwru.NewPlan(&flags, funcs)
+		if err != nil {
+			log.Fatalf("Invalid filter expression: %s", err)
+		}
+		plan.Print(os.Stdout)
+		os.Exit(0)
+	}
+
+	backend := flags.Backend
+	if backend == pwru.BackendAuto {
+		backend = pwru.BackendKprobe
+		// Until https://lore.kernel.org/bpf/20221025134148.3300700-1-jolsa@kernel.org/
+		// has been backported to the stable, kprobe-multi cannot be used when attaching
+		// to kmods.
+		if len(flags.KMods) == 0 {
+			symbols := []string{"vprintk"}
+			if len(funcs) != 0 {
+				symbols = symbols[:0]
+				for name := range funcs {
+					symbols = append(symbols, name)
+				}
+			}
+			if err := pwru.ProbeKprobeMulti(symbols); err != nil {
+				log.Printf("Cannot use kprobe-multi, falling back to kprobe: %s", err)
+			} else {
+				backend = pwru.BackendKprobeMulti
+				useKprobeMulti = true
+			}
+		}
+	}
+	log.Printf("Using the %s backend", backend)
 
 	var opts ebpf.CollectionOptions
 	opts.Programs.KernelTypes = btfSpec
 
 	var objs pwru.KProbeObjects
+	var bpfSpec *ebpf.CollectionSpec
 	switch {
 	case flags.OutputSkb && useKprobeMulti:
 		objs = &KProbeMultiPWRUObjects{}
-		err = LoadKProbeMultiPWRUObjects(objs, &opts)
+		bpfSpec, err = LoadKProbeMultiPWRU()
 	case flags.OutputSkb:
 		objs = &KProbePWRUObjects{}
-		err = LoadKProbePWRUObjects(objs, &opts)
+		bpfSpec, err = LoadKProbePWRU()
 	case useKprobeMulti:
 		objs = &KProbeMultiPWRUWithoutOutputSKBObjects{}
-		err = LoadKProbeMultiPWRUWithoutOutputSKBObjects(objs, &opts)
+		bpfSpec, err = LoadKProbeMultiPWRUWithoutOutputSKB()
 	default:
 		objs = &KProbePWRUWithoutOutputSKBObjects{}
-		err = LoadKProbePWRUWithoutOutputSKBObjects(objs, &opts)
+		bpfSpec, err = LoadKProbePWRUWithoutOutputSKB()
+	}
+	if err != nil {
+		log.Fatalf("Failed to load BPF spec: %v", err)
+	}
+
+	if flags.FilterExpr != "" {
+		if err := pwru.InjectFilterExpr(bpfSpec, flags.FilterExpr); err != nil {
+			log.Fatalf("Failed to inject filter expression: %v", err)
+		}
 	}
 
+	perCPUBuffer, ringbufSize, err := pwru.EventBufferSizes(&flags)
 	if err != nil {
+		log.Fatalf("Invalid event buffer size: %v", err)
+	}
+	useRingbuf := flags.Ringbuf && pwru.HaveRingbuf()
+	if err := pwru.ConfigRingbuf(bpfSpec, useRingbuf, ringbufSize); err != nil {
+		log.Fatalf("Failed to configure event delivery: %v", err)
+	}
+	if err := pwru.ConfigNestedSkb(bpfSpec, flags.TraceNestedSkb); err != nil {
+		log.Fatalf("Failed to configure the nested skb probes: %v", err)
+	}
+
+	if err := bpfSpec.LoadAndAssign(objs, &opts); err != nil {
 		log.Fatalf("Loading objects: %v", err)
 	}
 	defer objs.Close()
 
+	// The other probes, and the functions which can't be traced with a
+	// trampoline, use the kprobe objects.
+	var fentry *pwru.Fentry
+	if flags.Backend == pwru.BackendFentry {
+		var fentrySpec *ebpf.CollectionSpec
+		if flags.OutputSkb {
+			fentrySpec, err = LoadFentryPWRU()
+		} else {
+			fentrySpec, err = LoadFentryPWRUWithoutOutputSKB()
+		}
+		if err != nil {
+			log.Fatalf("Failed to load fentry BPF spec: %v", err)
+		}
+		if flags.FilterExpr != "" {
+			if err := pwru.InjectFilterExpr(fentrySpec, flags.FilterExpr); err != nil {
+				log.Fatalf("Failed to inject filter expression: %v", err)
+			}
+		}
+		if err := pwru.ConfigRingbuf(fentrySpec, useRingbuf, ringbufSize); err != nil {
+			log.Fatalf("Failed to configure event delivery: %v", err)
+		}
+		fentry, err = pwru.NewFentry(fentrySpec, objs, btfSpec)
+		if err != nil {
+			log.Fatalf("Loading fentry objects: %v", err)
+		}
+		defer fentry.Close()
+	}
+
 	kprobe1 := objs.GetKprobeSkb1()
 	kprobe2 := objs.GetKprobeSkb2()
 	kprobe3 := objs.GetKprobeSkb3()
 	kprobe4 := objs.GetKprobeSkb4()
 	kprobe5 := objs.GetKprobeSkb5()
+	kprobeNested1 := objs.GetKprobeSkbNested1()
+	kprobeNested2 := objs.GetKprobeSkbNested2()
+	kprobeNested3 := objs.GetKprobeSkbNested3()
+	kprobeNested4 := objs.GetKprobeSkbNested4()
+	kprobeNested5 := objs.GetKprobeSkbNested5()
+	if flags.TraceType == pwru.TraceTypeSk {
+		kprobe1 = objs.GetKprobeSk1()
+		kprobe2 = objs.GetKprobeSk2()
+		kprobe3 = objs.GetKprobeSk3()
+		kprobe4 = objs.GetKprobeSk4()
+		kprobe5 = objs.GetKprobeSk5()
+	}
 
 	cfgMap := objs.GetCfgMap()
 	events := objs.GetEvents()
+	eventsRingbuf := objs.GetEventsRb()
 	printStackMap := objs.GetPrintStackMap()
 	var printSkbMap *ebpf.Map
 	if flags.OutputSkb {
 		printSkbMap = objs.(pwru.KProbeMapsWithOutputSKB).GetPrintSkbMap()
 	}
 
-	log.Printf("Per cpu buffer size: %d bytes\n", flags.PerCPUBuffer)
+	if useRingbuf {
+		log.Printf("Ring buffer size: %d bytes\n", eventsRingbuf.MaxEntries())
+	} else {
+		log.Printf("Per cpu buffer size: %d bytes\n", perCPUBuffer)
+	}
 	pwru.ConfigBPFMap(&flags, cfgMap)
+	pwru.ConfigCgroupMap(&flags, objs.GetCgroupMap())
+	pwru.ConfigIPMaps(&flags, objs.GetSaddrLpm(), objs.GetDaddrLpm())
+
+	var metrics *pwru.Metrics
+	if flags.MetricsAddr != "" {
+		metrics = pwru.NewMetrics()
+		if err := metrics.Serve(flags.MetricsAddr); err != nil {
+			log.Fatalf("Failed to serve metrics: %s", err)
+		}
+	}
 
 	var kprobes []link.Link
 	defer func() {
+		var bar *pb.ProgressBar
+		var done func()
 		select {
 		case <-ctx.Done():
 			log.Println("Detaching kprobes...")
-			bar := pb.StartNew(len(kprobes))
-			for _, kp := range kprobes {
-				_ = kp.Close()
-				bar.Increment()
-			}
-			bar.Finish()
-
+			bar = pb.StartNew(len(kprobes))
+			done = func() { bar.Increment() }
 		default:
-			for _, kp := range kprobes {
-				_ = kp.Close()
-			}
 		}
+
+		detached, errs := pwru.DetachLinks(kprobes, done)
+		if bar != nil {
+			bar.Finish()
+		}
+		for _, err := range errs {
+			log.Printf("Failed to detach probe: %s", err)
+		}
+		log.Printf("Detached %d probes\n", detached)
 	}()
 
 	msg := "kprobe"
 	if useKprobeMulti {
 		msg = "kprobe-multi"
+	} else if fentry != nil {
+		msg = "fentry"
 	}
 	log.Printf("Attaching kprobes (via %s)...\n", msg)
 	ignored := 0
+	attached := 0
+	fallbacks := 0
 	bar := pb.StartNew(len(funcs))
 	funcsByPos := pwru.GetFuncsByPos(funcs)
 	for pos, fns := range funcsByPos {
-		var fn *ebpf.Program
+		var fn, nestedFn *ebpf.Program
 		switch pos {
 		case 1:
-			fn = kprobe1
+			fn, nestedFn = kprobe1, kprobeNested1
 		case 2:
-			fn = kprobe2
+			fn, nestedFn = kprobe2, kprobeNested2
 		case 3:
-			fn = kprobe3
+			fn, nestedFn = kprobe3, kprobeNested3
 		case 4:
-			fn = kprobe4
+			fn, nestedFn = kprobe4, kprobeNested4
 		case 5:
-			fn = kprobe5
+			fn, nestedFn = kprobe5, kprobeNested5
 		default:
 			ignored += 1
 			continue
@@ -197,7 +402,22 @@ func main() {
 				default:
 				}
 
-				kp, err := link.Kprobe(name, fn, nil)
+				var kp link.Link
+				var err error
+				if arg, ok := nested[name]; ok {
+					// The skb is read by the kprobe at the offset of
+					// the cookie
+					kp, err = link.Kprobe(name, nestedFn, &link.KprobeOptions{Cookie: arg.Offset})
+				} else {
+					if fentry != nil {
+						if kp, err = fentry.Attach(name, pos); err != nil {
+							fallbacks += 1
+						}
+					}
+					if kp == nil {
+						kp, err = link.Kprobe(name, fn, nil)
+					}
+				}
 				bar.Increment()
 				if err != nil {
 					if !errors.Is(err, os.ErrNotExist) {
@@ -207,6 +427,7 @@ func main() {
 					}
 				} else {
 					kprobes = append(kprobes, kp)
+					attached += 1
 				}
 			}
 		} else {
@@ -217,31 +438,133 @@ func main() {
 			default:
 			}
 
-			opts := link.KprobeMultiOptions{Symbols: funcsByPos[pos]}
-			kp, err := link.KprobeMulti(fn, opts)
+			var opts, nestedOpts link.KprobeMultiOptions
+			for _, name := range fns {
+				if arg, ok := nested[name]; ok {
+					nestedOpts.Symbols = append(nestedOpts.Symbols, name)
+					nestedOpts.Cookies = append(nestedOpts.Cookies, arg.Offset)
+				} else {
+					opts.Symbols = append(opts.Symbols, name)
+				}
+			}
+			if len(opts.Symbols) != 0 {
+				kp, err := link.KprobeMulti(fn, opts)
+				if err != nil {
+					log.Fatalf("Opening kprobe-multi for pos %d: %s\n", pos, err)
+				}
+				kprobes = append(kprobes, kp)
+			}
+			if len(nestedOpts.Symbols) != 0 {
+				kp, err := link.KprobeMulti(nestedFn, nestedOpts)
+				if err != nil {
+					log.Fatalf("Opening kprobe-multi for the nested skbs of pos %d: %s\n", pos, err)
+				}
+				kprobes = append(kprobes, kp)
+			}
 			bar.Add(len(fns))
+			attached += len(fns)
+		}
+	}
+	bar.Finish()
+	if fallbacks > 0 {
+		log.Printf("%d functions cannot be traced with fentry, kprobes are used instead\n", fallbacks)
+	}
+
+	if flags.OutputRetval || flags.OutputLatency || flags.LatencyHist {
+		log.Println("Attaching kretprobes...")
+		kretprobe := objs.GetKretprobeSkb()
+		bar := pb.StartNew(len(funcs))
+		if !useKprobeMulti {
+			for name := range funcs {
+				select {
+				case <-ctx.Done():
+					bar.Finish()
+					return
+				default:
+				}
+
+				var kp link.Link
+				var err error
+				if fentry != nil {
+					kp, _ = fentry.AttachReturn(name)
+				}
+				if kp == nil {
+					kp, err = link.Kretprobe(name, kretprobe, nil)
+				}
+				bar.Increment()
+				if err != nil {
+					if !errors.Is(err, os.ErrNotExist) {
+						log.Fatalf("Opening kretprobe %s: %s\n", name, err)
+					}
+				} else {
+					kprobes = append(kprobes, kp)
+				}
+			}
+		} else {
+			var names []string
+			for _, fns := range funcsByPos {
+				names = append(names, fns...)
+			}
+			kp, err := link.KretprobeMulti(kretprobe, link.KprobeMultiOptions{Symbols: names})
+			bar.Add(len(names))
 			if err != nil {
-				log.Fatalf("Opening kprobe-multi for pos %d: %s\n", pos, err)
+				log.Fatalf("Opening kretprobe-multi: %s\n", err)
 			}
 			kprobes = append(kprobes, kp)
 		}
+		bar.Finish()
 	}
-	bar.Finish()
+	if flags.OutputNetfilter {
+		log.Println("Attaching netfilter probes...")
+		links, err := pwru.AttachNetfilter(objs, useKprobeMulti)
+		if err != nil {
+			log.Fatalf("Attaching netfilter probes: %s", err)
+		}
+		kprobes = append(kprobes, links...)
+	}
+	if flags.TrackClones {
+		log.Println("Attaching clone tracking probes...")
+		links, err := pwru.AttachCloneTracking(objs, useKprobeMulti)
+		if err != nil {
+			log.Fatalf("Attaching clone tracking probes: %s", err)
+		}
+		kprobes = append(kprobes, links...)
+	}
+	if len(flags.Tracepoints) != 0 {
+		log.Println("Attaching tracepoints...")
+		links, err := pwru.AttachTracepoints(objs, flags.Tracepoints)
+		if err != nil {
+			log.Fatalf("Attaching tracepoints: %s", err)
+		}
+		kprobes = append(kprobes, links...)
+	}
+	if flags.FilterTraceXDP {
+		log.Println("Attaching XDP probes...")
+		links, err := pwru.AttachXDP(objs, useKprobeMulti)
+		if err != nil {
+			log.Fatalf("Attaching XDP probes: %s", err)
+		}
+		kprobes = append(kprobes, links...)
+	}
+	if flags.FilterTraceTC {
+		log.Println("Attaching tc probes...")
+		links, err := pwru.AttachTC(objs, useKprobeMulti)
+		if err != nil {
+			log.Fatalf("Attaching tc probes: %s", err)
+		}
+		kprobes = append(kprobes, links...)
+	}
+	metrics.SetAttachedProbes(attached)
 	log.Printf("Attached (ignored %d)\n", ignored)
 
-	rd, err := perf.NewReader(events, flags.PerCPUBuffer)
+	rd, err := pwru.NewEventReader(events, eventsRingbuf, useRingbuf, perCPUBuffer)
 	if err != nil {
-		log.Fatalf("Creating perf event reader: %s", err)
+		log.Fatalf("Creating event reader: %s", err)
 	}
 	defer rd.Close()
 
-	go func() {
-		<-ctx.Done()
-
-		if err := rd.Close(); err != nil {
-			log.Fatalf("Closing perf event reader: %s", err)
-		}
-	}()
+	lost := pwru.NewLostEvents(objs.GetLostEvents(), metrics)
+	go lost.Run(ctx)
 
 	log.Println("Listening for events..")
 
@@ -253,43 +576,104 @@ func main() {
 		file.Close()
 	}
 
-	output, err := pwru.NewOutput(&flags, printSkbMap, printStackMap, addr2name, useKprobeMulti)
+	output, err := pwru.NewOutput(&flags, printSkbMap, printStackMap, addr2name, useKprobeMulti, metrics, btfSpec)
 	if err != nil {
 		log.Fatalf("Failed to create outputer: %s", err)
 	}
-	output.PrintHeader()
+	defer output.Close()
+
+	// The TUI is started, so the fatal errors go through output.Fatalf from
+	// here on
+	go func() {
+		<-ctx.Done()
+
+		if err := rd.Close(); err != nil {
+			output.Fatalf("Closing event reader: %s", err)
+		}
+	}()
+
+	// The events are counted by the BPF programs instead of being printed
+	var aggregates *pwru.Aggregates
+	if flags.Aggregate > 0 {
+		aggregates = pwru.NewAggregates(objs.GetAggregates(), output.FuncName)
+		go aggregates.Run(ctx, flags.Aggregate, os.Stdout)
+	} else {
+		output.PrintHeader()
+	}
+
+	var hists *pwru.LatencyHists
+	if flags.LatencyHist {
+		hists = pwru.NewLatencyHists(objs.GetLatencyHists(), output.FuncName)
+		if flags.HistInterval > 0 {
+			go hists.Run(ctx, flags.HistInterval, os.Stdout)
+		}
+	}
+
+	var event pwru.Event
+	var printed uint64
 
 	defer func() {
-		select {
-		case <-ctx.Done():
+		if aggregates != nil {
+			aggregates.Print(os.Stdout)
+		}
+		if hists != nil {
+			hists.Print(os.Stdout)
+		}
+		output.PrintSummary(os.Stderr)
+		lost.Report()
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			log.Printf("Timeout of %s reached, printed %d events, exiting program..\n", flags.Timeout, printed)
+		case ctx.Err() != nil:
 			log.Println("Received signal, exiting program..")
 		default:
-			log.Printf("Printed %d events, exiting program..\n", flags.OutputLimitLines)
+			log.Printf("Printed %d events, exiting program..\n", printed)
 		}
 	}()
-
-	var event pwru.Event
-	runForever := flags.OutputLimitLines == 0
-	for i := flags.OutputLimitLines; i > 0 || runForever; i-- {
+	for {
+		if flags.Coalesce {
+			rd.SetDeadline(time.Now().Add(pwru.CoalesceIdle))
+		}
 		record, err := rd.Read()
 		if err != nil {
-			if errors.Is(err, perf.ErrClosed) {
+			if errors.Is(err, pwru.ErrReaderClosed) {
 				return
 			}
-			log.Printf("Reading from perf event reader: %s", err)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				output.FlushCoalesced()
+				continue
+			}
+			log.Printf("Reading from event reader: %s", err)
 		}
 
 		if record.LostSamples != 0 {
-			log.Printf("Perf event ring buffer full, dropped %d samples", record.LostSamples)
+			lost.AddPerf(record.LostSamples)
 			continue
 		}
 
-		if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
-			log.Printf("Parsing perf event: %s", err)
+		buf := bytes.NewBuffer(record.RawSample)
+		if err := binary.Read(buf, binary.LittleEndian, &event); err != nil {
+			log.Printf("Parsing event: %s", err)
 			continue
 		}
 
-		output.Print(&event)
+		var pkt *pwru.Packet
+		if buf.Len() > 0 {
+			var hdr pwru.CaptureHeader
+			if err := binary.Read(buf, binary.LittleEndian, &hdr); err != nil {
+				log.Printf("Parsing captured packet: %s", err)
+				continue
+			}
+			pkt = &pwru.Packet{Len: hdr.PktLen, Data: buf.Next(int(hdr.CapLen))}
+		}
+
+		output.Print(&event, pkt)
+
+		// Lost and malformed events don't count
+		printed++
+		if flags.LimitEvents != 0 && printed >= flags.LimitEvents {
+			return
+		}
 
 		select {
 		case <-ctx.Done():
@@ -298,3 +682,39 @@ func main() {
 		}
 	}
 }
+
+// replayRecord prints the events of the file given to "pwru replay".
+func replayRecord(flags *pwru.Flags) {
+	if flag.NArg() != 1 {
+		log.Fatalf("Usage: pwru replay [options] <file>")
+	}
+	if flags.Record != "" {
+		log.Fatalf("--record cannot be used with replay")
+	}
+	if flags.FilterExpr != "" {
+		log.Fatalf("The filter expression is not supported by replay")
+	}
+	if !pwru.HaveOutputFormat(flags.OutputFormat) {
+		log.Fatalf("Invalid output format %s (available: %s)", flags.OutputFormat,
+			strings.Join(pwru.OutputFormats(), ", "))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if _, err := pwru.Replay(ctx, flags, flag.Arg(0)); err != nil {
+		log.Fatalf("Failed to replay %s: %s", flag.Arg(0), err)
+	}
+}
+
+// diffRecords compares the files given to "pwru diff".
+func diffRecords(flags *pwru.Flags) {
+	if flag.NArg() != 2 {
+		log.Fatalf("Usage: pwru diff [options] <file> <file>")
+	}
+	if flags.FilterExpr != "" {
+		log.Fatalf("The filter expression is not supported by diff")
+	}
+	if err := pwru.DiffRecords(os.Stdout, flags, flag.Arg(0), flag.Arg(1)); err != nil {
+		log.Fatalf("Failed to diff: %s", err)
+	}
+}